@@ -0,0 +1,317 @@
+package req
+
+import (
+	"context"
+	"fmt"
+	urlpkg "net/url"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// BindError is returned by Bind if the service struct or the tags of its
+// func fields are malformed.
+type BindError struct {
+	// Field is the name of the malformed func field, empty if the service
+	// itself is malformed.
+	Field string
+	// Reason describes what is malformed.
+	Reason string
+}
+
+func (e *BindError) Error() string {
+	if e.Field == "" {
+		return "req: bind: " + e.Reason
+	}
+	return fmt.Sprintf("req: bind %s: %s", e.Field, e.Reason)
+}
+
+// BindStatusError is returned by the funcs implemented by Bind if the
+// response is in ErrorState and the error result (see SetCommonErrorResult)
+// is not an error.
+type BindStatusError struct {
+	Response *Response
+}
+
+func (e *BindStatusError) Error() string {
+	return fmt.Sprintf("req: %s %s: bad status %s", e.Response.Request.Method, e.Response.Request.RawURL, e.Response.Status)
+}
+
+var (
+	contextType  = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType    = reflect.TypeOf((*error)(nil)).Elem()
+	responseType = reflect.TypeOf((*Response)(nil))
+	stringType   = reflect.TypeOf("")
+	bytesType    = reflect.TypeOf([]byte(nil))
+	valuesType   = reflect.TypeOf(urlpkg.Values(nil))
+
+	bindPathParamRegexp = regexp.MustCompile(`{([^{}/]+)}`)
+)
+
+const (
+	bindArgBody  = "body"
+	bindArgQuery = "query"
+)
+
+// bindMethod is the parsed tags of a func field.
+type bindMethod struct {
+	method     string
+	path       string
+	headers    map[string]string
+	hasContext bool
+	// args is the role of each argument after the context, which is the
+	// name of a path param, or bindArgBody and bindArgQuery.
+	args   []string
+	result reflect.Type // nil if the func only returns error.
+}
+
+// Bind implements the func fields of the struct svc points to, with the
+// requests described by their tags, so that the API client is declared once
+// instead of writing the wrapper methods by hand. For example:
+//
+//	type UserService struct {
+//		Get    func(ctx context.Context, id int) (*User, error)    `method:"GET" path:"/users/{id}"`
+//		List   func(ctx context.Context, q ListQuery) ([]User, error) `method:"GET" path:"/users" args:"query"`
+//		Create func(ctx context.Context, u *User) (*User, error)   `method:"POST" path:"/users" args:"body"`
+//		Rename func(id int, u *User) error                         `method:"PUT" path:"/users/{id}" args:"id,body" header:"X-Api-Version: 2"`
+//	}
+//
+//	var svc UserService
+//	if err := req.Bind(client, &svc); err != nil {
+//		log.Fatal(err) // malformed tags are reported at startup.
+//	}
+//	user, err := svc.Get(ctx, 1)
+//
+// The tags of each func field:
+//   - method: the HTTP method, required.
+//   - path: the path which is resolved against the base URL of the client,
+//     with the path params like `{id}`, required.
+//   - args: the comma-separated roles of the arguments after the optional
+//     leading context.Context, which is the name of a path param, "body"
+//     for the request body (see Request.SetBody), or "query" for the query
+//     params (a struct with `url` tags, url.Values or map[string]string). If
+//     omitted, the arguments fill the path params in the order they appear
+//     in the path.
+//   - header: the headers of the requests, in the form of "Key: Value",
+//     separated by "|".
+//
+// The func must return error as the last result, and optionally a result
+// before it, which is unmarshalled from the response body in SuccessState,
+// or the raw body if it is string or []byte, or the raw *Response. If the response is in ErrorState, the func returns
+// the error result if it is an error (see Client.SetCommonErrorResult),
+// otherwise a *BindStatusError. The func fields without the method tag are
+// left untouched, and Bind returns a *BindError if any tag is malformed.
+func Bind(c *Client, svc any) error {
+	v := reflect.ValueOf(svc)
+	if v.Kind() != reflect.Pointer || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return &BindError{Reason: fmt.Sprintf("svc must be a non-nil pointer to struct, got %T", svc)}
+	}
+	v = v.Elem()
+	typ := v.Type()
+	fns := make(map[int]reflect.Value)
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if _, ok := field.Tag.Lookup("method"); !ok {
+			continue
+		}
+		if field.Type.Kind() != reflect.Func {
+			return &BindError{Field: field.Name, Reason: "must be a func"}
+		}
+		if !field.IsExported() {
+			return &BindError{Field: field.Name, Reason: "must be exported"}
+		}
+		m, err := parseBindMethod(field)
+		if err != nil {
+			return &BindError{Field: field.Name, Reason: err.Error()}
+		}
+		fns[i] = reflect.MakeFunc(field.Type, func(args []reflect.Value) []reflect.Value {
+			return m.call(c, args)
+		})
+	}
+	// only set the fields if all of them are valid.
+	for i, fn := range fns {
+		v.Field(i).Set(fn)
+	}
+	return nil
+}
+
+func parseBindMethod(field reflect.StructField) (*bindMethod, error) {
+	m := &bindMethod{
+		method: field.Tag.Get("method"),
+		path:   field.Tag.Get("path"),
+	}
+	if m.method == "" || strings.ToUpper(m.method) != m.method || strings.ContainsAny(m.method, " \t/") {
+		return nil, fmt.Errorf("invalid method %q, it must be an uppercase HTTP method", m.method)
+	}
+	if m.path == "" {
+		return nil, fmt.Errorf("missing path tag")
+	}
+	if s := field.Tag.Get("header"); s != "" {
+		m.headers = make(map[string]string)
+		for _, kv := range strings.Split(s, "|") {
+			key, value, ok := strings.Cut(kv, ":")
+			key = strings.TrimSpace(key)
+			if !ok || key == "" {
+				return nil, fmt.Errorf("invalid header %q, it must be in the form of \"Key: Value\"", strings.TrimSpace(kv))
+			}
+			m.headers[key] = strings.TrimSpace(value)
+		}
+	}
+
+	ft := field.Type
+	if ft.IsVariadic() {
+		return nil, fmt.Errorf("variadic func is not supported")
+	}
+	in := make([]reflect.Type, ft.NumIn())
+	for i := range in {
+		in[i] = ft.In(i)
+	}
+	if len(in) > 0 && in[0] == contextType {
+		m.hasContext = true
+		in = in[1:]
+	}
+	var pathParams []string
+	for _, match := range bindPathParamRegexp.FindAllStringSubmatch(m.path, -1) {
+		pathParams = append(pathParams, match[1])
+	}
+	if s, ok := field.Tag.Lookup("args"); ok {
+		if s != "" {
+			for _, arg := range strings.Split(s, ",") {
+				m.args = append(m.args, strings.TrimSpace(arg))
+			}
+		}
+	} else {
+		m.args = pathParams
+	}
+	if len(m.args) != len(in) {
+		return nil, fmt.Errorf("func has %d arguments (excluding context), but %d are described by the tags", len(in), len(m.args))
+	}
+	seen := make(map[string]bool)
+	for i, arg := range m.args {
+		if seen[arg] {
+			return nil, fmt.Errorf("duplicate argument %q", arg)
+		}
+		seen[arg] = true
+		switch arg {
+		case bindArgBody:
+		case bindArgQuery:
+			t := in[i]
+			if t.Kind() == reflect.Pointer {
+				t = t.Elem()
+			}
+			if t != valuesType && t.Kind() != reflect.Struct && t != reflect.TypeOf(map[string]string(nil)) {
+				return nil, fmt.Errorf("query argument must be a struct, url.Values or map[string]string, got %s", in[i])
+			}
+		case "":
+			return nil, fmt.Errorf("empty argument in args tag")
+		default:
+			if in[i] == contextType {
+				return nil, fmt.Errorf("context.Context must be the first argument")
+			}
+		}
+	}
+	for _, p := range pathParams {
+		if !seen[p] {
+			return nil, fmt.Errorf("path param %q is not provided by any argument", p)
+		}
+	}
+	for _, arg := range m.args {
+		if arg != bindArgBody && arg != bindArgQuery && !strings.Contains(m.path, "{"+arg+"}") {
+			return nil, fmt.Errorf("argument %q is not a path param of %q", arg, m.path)
+		}
+	}
+
+	switch ft.NumOut() {
+	case 1:
+	case 2:
+		m.result = ft.Out(0)
+	default:
+		return nil, fmt.Errorf("func must return (error) or (T, error)")
+	}
+	if ft.Out(ft.NumOut()-1) != errorType {
+		return nil, fmt.Errorf("the last result of func must be error")
+	}
+	return m, nil
+}
+
+func (m *bindMethod) call(c *Client, args []reflect.Value) []reflect.Value {
+	r := c.R()
+	if m.hasContext {
+		ctx, _ := args[0].Interface().(context.Context)
+		r.SetContext(ctx)
+		args = args[1:]
+	}
+	r.SetHeaders(m.headers)
+	for i, name := range m.args {
+		arg := args[i]
+		switch name {
+		case bindArgBody:
+			if arg.Kind() != reflect.Pointer || !arg.IsNil() {
+				r.SetBody(arg.Interface())
+			}
+		case bindArgQuery:
+			if arg.Kind() == reflect.Pointer {
+				if arg.IsNil() {
+					continue
+				}
+				arg = arg.Elem()
+			}
+			switch q := arg.Interface().(type) {
+			case urlpkg.Values:
+				r.SetQueryParamsFromValues(q)
+			case map[string]string:
+				r.SetQueryParams(q)
+			default:
+				r.SetQueryParamsFromStruct(q)
+			}
+		default:
+			r.SetPathParam(name, fmt.Sprint(arg.Interface()))
+		}
+	}
+
+	var result reflect.Value
+	if m.result != nil && !isRawBindResult(m.result) {
+		if m.result.Kind() == reflect.Pointer {
+			result = reflect.New(m.result.Elem())
+		} else {
+			result = reflect.New(m.result)
+		}
+		r.SetSuccessResult(result.Interface())
+	}
+
+	resp, err := r.Send(m.method, m.path)
+	if err == nil && resp.IsErrorState() {
+		if e, ok := resp.ErrorResult().(error); ok {
+			err = e
+		} else {
+			err = &BindStatusError{Response: resp}
+		}
+	}
+
+	errValue := reflect.Zero(errorType)
+	if err != nil {
+		errValue = reflect.ValueOf(&err).Elem()
+	}
+	if m.result == nil {
+		return []reflect.Value{errValue}
+	}
+	switch {
+	case m.result == responseType:
+		result = reflect.ValueOf(resp)
+	case err != nil:
+		result = reflect.Zero(m.result)
+	case m.result == stringType:
+		result = reflect.ValueOf(string(resp.Bytes()))
+	case m.result == bytesType:
+		result = reflect.ValueOf(resp.Bytes())
+	case m.result.Kind() != reflect.Pointer:
+		result = result.Elem()
+	}
+	return []reflect.Value{result, errValue}
+}
+
+// isRawBindResult reports whether the result is not unmarshalled from the
+// response body.
+func isRawBindResult(t reflect.Type) bool {
+	return t == responseType || t == stringType || t == bytesType
+}
@@ -0,0 +1,409 @@
+package req
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CacheStatus is how the response is served by the response cache, see
+// Response.CacheStatus.
+type CacheStatus string
+
+const (
+	// CacheMiss means the response is fetched from the network, because it
+	// is not in the cache, or the cached one cannot be reused.
+	CacheMiss CacheStatus = "MISS"
+	// CacheHit means the response is served from the cache without sending
+	// the request.
+	CacheHit CacheStatus = "HIT"
+	// CacheRevalidated means the cached response is served after being
+	// revalidated by the server with 304 Not Modified.
+	CacheRevalidated CacheStatus = "REVALIDATED"
+	// CacheStale means the stale cached response is served because the
+	// revalidation failed, which is allowed by the stale-if-error directive.
+	CacheStale CacheStatus = "STALE"
+)
+
+const defaultCacheStatusHeader = "X-Cache"
+
+// CacheStatus returns how the response is served by the response cache (see
+// Client.SetResponseCache), which is empty if the request does not go
+// through the cache, e.g. the response cache is disabled, the method is not
+// GET or the request has `Cache-Control: no-store`. It is the status of the
+// final response if redirects are followed.
+func (r *Response) CacheStatus() CacheStatus {
+	return r.cacheStatus
+}
+
+// FromCache reports whether the response body is served from the response
+// cache, i.e. the CacheStatus is CacheHit, CacheRevalidated or CacheStale.
+func (r *Response) FromCache() bool {
+	switch r.cacheStatus {
+	case CacheHit, CacheRevalidated, CacheStale:
+		return true
+	}
+	return false
+}
+
+// SetCacheStatusHeader set the name of the synthetic response header which
+// carries the CacheStatus of the responses that go through the response
+// cache, e.g. "X-Cache: HIT", so that it is captured by the dump and the
+// logging of the response headers. Default is "X-Cache", pass "" to disable.
+func (c *Client) SetCacheStatusHeader(name string) *Client {
+	c.cacheStatusHeader = name
+	return c
+}
+
+// maxCachedBodySize is the max size of the response body which is stored in
+// the response cache.
+const maxCachedBodySize = 10 << 20
+
+// CachedResponse is the response stored in the Cache, which must not be
+// modified after it is stored.
+type CachedResponse struct {
+	StatusCode int
+	Proto      string
+	Header     http.Header
+	Body       []byte
+	// VaryHeader is the values of the request headers listed in the Vary
+	// header of the response, which must match to reuse the response.
+	VaryHeader http.Header
+	// StoredAt is the time when the response is stored or revalidated.
+	StoredAt time.Time
+	// Expires is the time when the response becomes stale, which is derived
+	// from the Cache-Control: max-age or Expires header.
+	Expires time.Time
+}
+
+// Fresh reports whether the response is still fresh at t.
+func (r *CachedResponse) Fresh(t time.Time) bool {
+	return t.Before(r.Expires)
+}
+
+// Revalidatable reports whether the stale response can be revalidated with
+// the ETag or Last-Modified validator.
+func (r *CachedResponse) Revalidatable() bool {
+	return r.Header.Get("ETag") != "" || r.Header.Get("Last-Modified") != ""
+}
+
+// Size returns the approximate size of the response in bytes.
+func (r *CachedResponse) Size() int64 {
+	size := int64(len(r.Body))
+	for k, vs := range r.Header {
+		for _, v := range vs {
+			size += int64(len(k) + len(v))
+		}
+	}
+	return size
+}
+
+// staleIfError reports whether the stale response can be served at t when
+// the revalidation fails, which is allowed by the stale-if-error directive
+// of the response (RFC 5861).
+func (r *CachedResponse) staleIfError(t time.Time) bool {
+	v, ok := parseCacheControl(r.Header)["stale-if-error"]
+	if !ok {
+		return false
+	}
+	seconds, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || seconds < 0 {
+		return false
+	}
+	return t.Before(r.Expires.Add(time.Duration(seconds) * time.Second))
+}
+
+func (r *CachedResponse) response(req *http.Request) *http.Response {
+	h := r.Header.Clone()
+	h.Set("Age", strconv.FormatInt(int64(time.Since(r.StoredAt)/time.Second), 10))
+	proto := r.Proto
+	major, minor, ok := http.ParseHTTPVersion(proto)
+	if !ok {
+		proto, major, minor = "HTTP/1.1", 1, 1
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", r.StatusCode, http.StatusText(r.StatusCode)),
+		StatusCode:    r.StatusCode,
+		Proto:         proto,
+		ProtoMajor:    major,
+		ProtoMinor:    minor,
+		Header:        h,
+		Body:          io.NopCloser(bytes.NewReader(r.Body)),
+		ContentLength: int64(len(r.Body)),
+		Request:       req,
+	}
+}
+
+// Cache is the store of the response cache, see Client.SetResponseCache and
+// NewLRUCache, implement it to use a custom store, e.g. Redis. It must be
+// safe for concurrent use.
+type Cache interface {
+	// Get returns the response stored with the key.
+	Get(key string) (*CachedResponse, bool)
+	// Set stores the response with the key.
+	Set(key string, resp *CachedResponse)
+	// Delete deletes the response stored with the key.
+	Delete(key string)
+}
+
+// SetResponseCache set the store of the response cache, which enables the
+// HTTP caching of the GET requests according to RFC 9111 as a private cache:
+// the fresh response (see Cache-Control: max-age and Expires) is reused
+// without sending the request, and the stale response which has the ETag or
+// Last-Modified validator is revalidated with a conditional request. The
+// responses with `Cache-Control: no-store`, `Vary: *` or the body larger
+// than 10MB are not stored, and the request with `Cache-Control: no-store`
+// bypasses the cache. The stale response is served if the revalidation fails
+// within its stale-if-error window. See Response.CacheStatus for how the
+// response is served. Pass nil to disable the response cache (default).
+func (c *Client) SetResponseCache(cache Cache) *Client {
+	c.responseCache = cache
+	c.httpClient.Transport = c.newHttpTransport()
+	return c
+}
+
+// cacheControl is the parsed directives of the Cache-Control header.
+type cacheControl map[string]string
+
+func parseCacheControl(h http.Header) cacheControl {
+	cc := cacheControl{}
+	for _, v := range h.Values("Cache-Control") {
+		for _, d := range strings.Split(v, ",") {
+			name, value, _ := strings.Cut(strings.TrimSpace(d), "=")
+			if name != "" {
+				cc[strings.ToLower(name)] = strings.Trim(value, `"`)
+			}
+		}
+	}
+	return cc
+}
+
+func (cc cacheControl) has(name string) bool {
+	_, ok := cc[name]
+	return ok
+}
+
+// freshnessLifetime returns the freshness lifetime of the response, and
+// reports whether it is explicit.
+func freshnessLifetime(h http.Header, now time.Time) (time.Duration, bool) {
+	cc := parseCacheControl(h)
+	if cc.has("no-cache") {
+		return 0, true
+	}
+	if v, ok := cc["max-age"]; ok {
+		seconds, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || seconds < 0 {
+			return 0, true
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if v := h.Get("Expires"); v != "" {
+		expires, err := http.ParseTime(v)
+		if err != nil {
+			return 0, true // invalid Expires means already expired.
+		}
+		date, err := http.ParseTime(h.Get("Date"))
+		if err != nil {
+			date = now
+		}
+		return expires.Sub(date), true
+	}
+	return 0, false
+}
+
+// cacheableStatus is the status codes which can be stored by default.
+var cacheableStatus = map[int]bool{
+	http.StatusOK:                   true,
+	http.StatusNonAuthoritativeInfo: true,
+	http.StatusNoContent:            true,
+	http.StatusMultipleChoices:      true,
+	http.StatusMovedPermanently:     true,
+	http.StatusPermanentRedirect:    true,
+	http.StatusNotFound:             true,
+	http.StatusGone:                 true,
+}
+
+func cacheKey(req *http.Request) string {
+	return req.Method + " " + req.URL.String()
+}
+
+// cacheTransport serves the GET requests from the response cache.
+type cacheTransport struct {
+	rt http.RoundTripper
+	c  *Client
+}
+
+func (t *cacheTransport) bypass(req *http.Request) bool {
+	if req.Method != http.MethodGet || req.Header.Get("Range") != "" ||
+		req.Header.Get("If-None-Match") != "" || req.Header.Get("If-Modified-Since") != "" {
+		return true
+	}
+	if disabled, _ := req.Context().Value(disableAutoDecodeKey).(bool); disabled {
+		return true // the stored body has been decoded.
+	}
+	return parseCacheControl(req.Header).has("no-store")
+}
+
+// setStatus reports the cache status of the response to the Response of req,
+// and sets the cache status header if enabled.
+func (t *cacheTransport) setStatus(req *http.Request, resp *http.Response, err error, status CacheStatus) (*http.Response, error) {
+	if s, ok := req.Context().Value(cacheStatusKey).(*CacheStatus); ok {
+		*s = status
+	}
+	if err == nil && status != "" && t.c.cacheStatusHeader != "" {
+		resp.Header.Set(t.c.cacheStatusHeader, string(status))
+	}
+	return resp, err
+}
+
+func (t *cacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	cache := t.c.responseCache
+	if cache == nil || t.bypass(req) {
+		resp, err := t.rt.RoundTrip(req)
+		return t.setStatus(req, resp, err, "")
+	}
+	key := cacheKey(req)
+	now := time.Now()
+	cached, ok := cache.Get(key)
+	if ok && !varyMatches(cached, req) {
+		ok = false
+	}
+	if !ok {
+		resp, err := t.rt.RoundTrip(req)
+		resp, err = t.store(key, req, resp, err, now)
+		return t.setStatus(req, resp, err, CacheMiss)
+	}
+	reqCC := parseCacheControl(req.Header)
+	if cached.Fresh(now) && !reqCC.has("no-cache") && reqCC["max-age"] != "0" {
+		return t.setStatus(req, cached.response(req), nil, CacheHit)
+	}
+	if !cached.Revalidatable() {
+		cache.Delete(key)
+		resp, err := t.rt.RoundTrip(req)
+		resp, err = t.store(key, req, resp, err, now)
+		return t.setStatus(req, resp, err, CacheMiss)
+	}
+	creq := req.Clone(req.Context())
+	if etag := cached.Header.Get("ETag"); etag != "" {
+		creq.Header.Set("If-None-Match", etag)
+	}
+	if lm := cached.Header.Get("Last-Modified"); lm != "" {
+		creq.Header.Set("If-Modified-Since", lm)
+	}
+	resp, err := t.rt.RoundTrip(creq)
+	if (err != nil || resp.StatusCode >= 500) && cached.staleIfError(now) && req.Context().Err() == nil {
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		return t.setStatus(req, cached.response(req), nil, CacheStale)
+	}
+	if err != nil {
+		return t.setStatus(req, nil, err, CacheMiss)
+	}
+	if resp.StatusCode != http.StatusNotModified {
+		resp.Request = req
+		resp, err = t.store(key, req, resp, nil, now)
+		return t.setStatus(req, resp, err, CacheMiss)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	updated := *cached
+	updated.Header = cached.Header.Clone()
+	for k, vs := range resp.Header {
+		if k != "Content-Length" {
+			updated.Header[k] = vs
+		}
+	}
+	updated.StoredAt = now
+	lifetime, _ := freshnessLifetime(updated.Header, now)
+	updated.Expires = now.Add(lifetime)
+	cache.Set(key, &updated)
+	return t.setStatus(req, updated.response(req), nil, CacheRevalidated)
+}
+
+// store stores the response in the cache when the body is fully read, if
+// the response is storable.
+func (t *cacheTransport) store(key string, req *http.Request, resp *http.Response, err error, now time.Time) (*http.Response, error) {
+	if err != nil {
+		return nil, err
+	}
+	if !cacheableStatus[resp.StatusCode] || resp.ContentLength > maxCachedBodySize {
+		return resp, nil
+	}
+	cc := parseCacheControl(resp.Header)
+	if cc.has("no-store") || resp.Header.Get("Vary") == "*" {
+		return resp, nil
+	}
+	lifetime, explicit := freshnessLifetime(resp.Header, now)
+	entry := &CachedResponse{
+		StatusCode: resp.StatusCode,
+		Proto:      resp.Proto,
+		Header:     resp.Header.Clone(),
+		VaryHeader: varyHeader(resp.Header, req.Header),
+		StoredAt:   now,
+		Expires:    now.Add(lifetime),
+	}
+	if !explicit && !entry.Revalidatable() {
+		return resp, nil
+	}
+	resp.Body = &cacheBodyReader{ReadCloser: resp.Body, cache: t.c.responseCache, key: key, entry: entry}
+	return resp, nil
+}
+
+func varyHeader(respHeader, reqHeader http.Header) http.Header {
+	var h http.Header
+	for _, v := range respHeader.Values("Vary") {
+		for _, k := range strings.Split(v, ",") {
+			if k = strings.TrimSpace(k); k != "" {
+				if h == nil {
+					h = make(http.Header)
+				}
+				h[http.CanonicalHeaderKey(k)] = reqHeader.Values(k)
+			}
+		}
+	}
+	return h
+}
+
+func varyMatches(cached *CachedResponse, req *http.Request) bool {
+	for k, vs := range cached.VaryHeader {
+		if strings.Join(vs, ",") != strings.Join(req.Header.Values(k), ",") {
+			return false
+		}
+	}
+	return true
+}
+
+// cacheBodyReader buffers the body, and stores the response in the cache
+// when the body is fully read.
+type cacheBodyReader struct {
+	io.ReadCloser
+	cache Cache
+	key   string
+	entry *CachedResponse
+	buf   bytes.Buffer
+	skip  bool
+}
+
+func (r *cacheBodyReader) Read(p []byte) (n int, err error) {
+	n, err = r.ReadCloser.Read(p)
+	if !r.skip && n > 0 {
+		if r.buf.Len()+n > maxCachedBodySize {
+			r.skip = true
+			r.buf = bytes.Buffer{}
+		} else {
+			r.buf.Write(p[:n])
+		}
+	}
+	if err == io.EOF && !r.skip {
+		r.skip = true
+		r.entry.Body = r.buf.Bytes()
+		r.cache.Set(r.key, r.entry)
+	}
+	return
+}
@@ -0,0 +1,63 @@
+package req
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// CanceledError is returned when the request is cancelled or times out by
+// its context, no matter in which phase (e.g. waiting for the connection,
+// dialing, handshaking, awaiting the response headers, reading the body or
+// sleeping between the retries) and over which protocol, so that the
+// cancellation can be classified uniformly. errors.Is reports
+// context.Canceled or context.DeadlineExceeded according to the context,
+// and errors.Unwrap returns the cause of the context (see
+// context.WithCancelCause), which is the context error if no cause is set.
+type CanceledError struct {
+	// Err is the error of the interrupted phase, e.g. "net/http: request
+	// canceled" or the stream error of HTTP2 and HTTP3.
+	Err error
+	// Cause is the cause of the context, see context.Cause.
+	Cause error
+
+	ctxErr error
+}
+
+func (e *CanceledError) Error() string {
+	msg := e.Err.Error()
+	if cause := e.Cause.Error(); !strings.Contains(msg, cause) {
+		msg += ": " + cause
+	}
+	return "req: " + msg
+}
+
+// Unwrap returns the cause of the context.
+func (e *CanceledError) Unwrap() error {
+	return e.Cause
+}
+
+// Is reports whether target is the context error, or matches the error of
+// the interrupted phase.
+func (e *CanceledError) Is(target error) bool {
+	return target == e.ctxErr || errors.Is(e.Err, target)
+}
+
+// As finds the first error in the error of the interrupted phase which
+// matches target, e.g. *url.Error.
+func (e *CanceledError) As(target any) bool {
+	return errors.As(e.Err, target)
+}
+
+// canceledError returns the CanceledError of err if ctx is done, otherwise
+// err is returned as is.
+func canceledError(ctx context.Context, err error) error {
+	if err == nil || ctx == nil || ctx.Err() == nil {
+		return err
+	}
+	var ce *CanceledError
+	if errors.As(err, &ce) {
+		return err
+	}
+	return &CanceledError{Err: err, Cause: context.Cause(ctx), ctxErr: ctx.Err()}
+}
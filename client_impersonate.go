@@ -1,9 +1,7 @@
 package req
 
 import (
-	"crypto/rand"
 	"encoding/binary"
-	"math/big"
 	"strconv"
 	"strings"
 
@@ -14,34 +12,28 @@ import (
 // Identical for both Blink-based browsers (Chrome, Chromium, etc.) and WebKit-based browsers (Safari, etc.)
 // Blink implementation: https://source.chromium.org/chromium/chromium/src/+/main:third_party/blink/renderer/platform/network/form_data_encoder.cc;drc=1d694679493c7b2f7b9df00e967b4f8699321093;l=130
 // WebKit implementation: https://github.com/WebKit/WebKit/blob/47eea119fe9462721e5cc75527a4280c6d5f5214/Source/WebCore/platform/network/FormDataBuilder.cpp#L120
-func webkitMultipartBoundaryFunc() string {
+func webkitMultipartBoundaryFunc(c *Client) string {
 	const letters = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789AB"
 
 	sb := strings.Builder{}
 	sb.WriteString("----WebKitFormBoundary")
 
+	rnd := c.getRand()
 	for i := 0; i < 16; i++ {
-		index, err := rand.Int(rand.Reader, big.NewInt(int64(len(letters)-1)))
-		if err != nil {
-			panic(err)
-		}
-
-		sb.WriteByte(letters[index.Int64()])
+		sb.WriteByte(letters[rnd.Int63n(int64(len(letters)-1))])
 	}
 
 	return sb.String()
 }
 
 // Firefox implementation: https://searchfox.org/mozilla-central/source/dom/html/HTMLFormSubmission.cpp#355
-func firefoxMultipartBoundaryFunc() string {
+func firefoxMultipartBoundaryFunc(c *Client) string {
 	sb := strings.Builder{}
 	sb.WriteString("-------------------------")
 
 	for i := 0; i < 3; i++ {
 		var b [8]byte
-		if _, err := rand.Read(b[:]); err != nil {
-			panic(err)
-		}
+		c.getRand().Read(b[:])
 		u32 := binary.LittleEndian.Uint32(b[:])
 		s := strconv.FormatUint(uint64(u32), 10)
 
@@ -105,11 +97,7 @@ var (
 	chromeHeaders = map[string]string{
 		"pragma":                    "no-cache",
 		"cache-control":             "no-cache",
-		"sec-ch-ua":                 `"Not_A Brand";v="8", "Chromium";v="120", "Google Chrome";v="120"`,
-		"sec-ch-ua-mobile":          "?0",
-		"sec-ch-ua-platform":        `"macOS"`,
 		"upgrade-insecure-requests": "1",
-		"user-agent":                "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
 		"accept":                    "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.7",
 		"sec-fetch-site":            "none",
 		"sec-fetch-mode":            "navigate",
@@ -118,6 +106,24 @@ var (
 		"accept-language":           "zh-CN,zh;q=0.9",
 	}
 
+	chromeUserAgentProfile = &UserAgentProfile{
+		UserAgent: "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+		Brands: []UserAgentBrand{
+			{Brand: "Not_A Brand", Version: "8"},
+			{Brand: "Chromium", Version: "120"},
+			{Brand: "Google Chrome", Version: "120"},
+		},
+		Platform: "macOS",
+		FullVersionList: []UserAgentBrand{
+			{Brand: "Not_A Brand", Version: "8.0.0.0"},
+			{Brand: "Chromium", Version: "120.0.6099.129"},
+			{Brand: "Google Chrome", Version: "120.0.6099.129"},
+		},
+		PlatformVersion: "14.2.0",
+		Arch:            "arm",
+		Bitness:         "64",
+	}
+
 	chromeHeaderPriority = http2.PriorityParam{
 		StreamDep: 0,
 		Exclusive: true,
@@ -134,8 +140,11 @@ func (c *Client) ImpersonateChrome() *Client {
 		SetCommonPseudoHeaderOder(chromePseudoHeaderOrder...).
 		SetCommonHeaderOrder(chromeHeaderOrder...).
 		SetCommonHeaders(chromeHeaders).
-		SetHTTP2HeaderPriority(chromeHeaderPriority).
-		SetMultipartBoundaryFunc(webkitMultipartBoundaryFunc)
+		SetUserAgentProfile(chromeUserAgentProfile).
+		SetHTTP2HeaderPriority(chromeHeaderPriority)
+	c.multipartBoundaryFunc = webkitMultipartBoundaryFunc
+	c.impersonate = "chrome"
+	c.Transport.configChanged()
 	return c
 }
 
@@ -229,7 +238,6 @@ var (
 	}
 
 	firefoxHeaders = map[string]string{
-		"user-agent":                "Mozilla/5.0 (Macintosh; Intel Mac OS X 10.15; rv:120.0) Gecko/20100101 Firefox/120.0",
 		"accept":                    "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,*/*;q=0.8",
 		"accept-language":           "zh-CN,zh;q=0.8,zh-TW;q=0.7,zh-HK;q=0.5,en-US;q=0.3,en;q=0.2",
 		"upgrade-insecure-requests": "1",
@@ -240,6 +248,10 @@ var (
 		//"te":                        "trailers",
 	}
 
+	firefoxUserAgentProfile = &UserAgentProfile{
+		UserAgent: "Mozilla/5.0 (Macintosh; Intel Mac OS X 10.15; rv:120.0) Gecko/20100101 Firefox/120.0",
+	}
+
 	firefoxHeaderPriority = http2.PriorityParam{
 		StreamDep: 13,
 		Exclusive: false,
@@ -257,8 +269,11 @@ func (c *Client) ImpersonateFirefox() *Client {
 		SetCommonPseudoHeaderOder(firefoxPseudoHeaderOrder...).
 		SetCommonHeaderOrder(firefoxHeaderOrder...).
 		SetCommonHeaders(firefoxHeaders).
-		SetHTTP2HeaderPriority(firefoxHeaderPriority).
-		SetMultipartBoundaryFunc(firefoxMultipartBoundaryFunc)
+		SetUserAgentProfile(firefoxUserAgentProfile).
+		SetHTTP2HeaderPriority(firefoxHeaderPriority)
+	c.multipartBoundaryFunc = firefoxMultipartBoundaryFunc
+	c.impersonate = "firefox"
+	c.Transport.configChanged()
 	return c
 }
 
@@ -299,7 +314,10 @@ var (
 		"sec-fetch-dest":  "document",
 		"accept-language": "zh-CN,zh-Hans;q=0.9",
 		"sec-fetch-mode":  "navigate",
-		"user-agent":      "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.6 Safari/605.1.15",
+	}
+
+	safariUserAgentProfile = &UserAgentProfile{
+		UserAgent: "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.6 Safari/605.1.15",
 	}
 
 	safariHeaderPriority = http2.PriorityParam{
@@ -318,7 +336,10 @@ func (c *Client) ImpersonateSafari() *Client {
 		SetCommonPseudoHeaderOder(safariPseudoHeaderOrder...).
 		SetCommonHeaderOrder(safariHeaderOrder...).
 		SetCommonHeaders(safariHeaders).
-		SetHTTP2HeaderPriority(safariHeaderPriority).
-		SetMultipartBoundaryFunc(webkitMultipartBoundaryFunc)
+		SetUserAgentProfile(safariUserAgentProfile).
+		SetHTTP2HeaderPriority(safariHeaderPriority)
+	c.multipartBoundaryFunc = webkitMultipartBoundaryFunc
+	c.impersonate = "safari"
+	c.Transport.configChanged()
 	return c
 }
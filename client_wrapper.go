@@ -4,12 +4,16 @@ import (
 	"context"
 	"crypto/tls"
 	"io"
+	"math/rand"
 	"net"
 	"net/http"
+	"net/netip"
 	"net/url"
+	"syscall"
 	"time"
 
 	"github.com/imroc/req/v3/http2"
+	"github.com/quic-go/quic-go"
 	utls "github.com/refraction-networking/utls"
 )
 
@@ -39,6 +43,48 @@ func SetCommonErrorResult(err any) *Client {
 	return defaultClient.SetCommonErrorResult(err)
 }
 
+// EnableRequestID is a global wrapper methods which delegated
+// to the default client's Client.EnableRequestID.
+func EnableRequestID() *Client {
+	return defaultClient.EnableRequestID()
+}
+
+// DisableRequestID is a global wrapper methods which delegated
+// to the default client's Client.DisableRequestID.
+func DisableRequestID() *Client {
+	return defaultClient.DisableRequestID()
+}
+
+// SetRequestIDFunc is a global wrapper methods which delegated
+// to the default client's Client.SetRequestIDFunc.
+func SetRequestIDFunc(fn func() string) *Client {
+	return defaultClient.SetRequestIDFunc(fn)
+}
+
+// EnableRequestIDHeader is a global wrapper methods which delegated
+// to the default client's Client.EnableRequestIDHeader.
+func EnableRequestIDHeader(name string) *Client {
+	return defaultClient.EnableRequestIDHeader(name)
+}
+
+// DisableRequestIDHeader is a global wrapper methods which delegated
+// to the default client's Client.DisableRequestIDHeader.
+func DisableRequestIDHeader() *Client {
+	return defaultClient.DisableRequestIDHeader()
+}
+
+// SetTreatEmptyBodyAsNoError is a global wrapper methods which delegated
+// to the default client's Client.SetTreatEmptyBodyAsNoError.
+func SetTreatEmptyBodyAsNoError(b bool) *Client {
+	return defaultClient.SetTreatEmptyBodyAsNoError(b)
+}
+
+// SetCommonErrorBodyLimit is a global wrapper methods which delegated
+// to the default client's Client.SetCommonErrorBodyLimit.
+func SetCommonErrorBodyLimit(n int) *Client {
+	return defaultClient.SetCommonErrorBodyLimit(n)
+}
+
 // SetResultStateCheckFunc is a global wrapper methods which delegated
 // to the default client's Client.SetCommonResultStateCheckFunc.
 func SetResultStateCheckFunc(fn func(resp *Response) ResultState) *Client {
@@ -273,6 +319,18 @@ func EnableDumpAllAsync() *Client {
 	return defaultClient.EnableDumpAllAsync()
 }
 
+// EnableDumpAllAsyncWithPolicy is a global wrapper methods which delegated
+// to the default client's Client.EnableDumpAllAsyncWithPolicy.
+func EnableDumpAllAsyncWithPolicy(bufferSize int, policy OverflowPolicy) *Client {
+	return defaultClient.EnableDumpAllAsyncWithPolicy(bufferSize, policy)
+}
+
+// DroppedDumps is a global wrapper methods which delegated
+// to the default client's Client.DroppedDumps.
+func DroppedDumps() int64 {
+	return defaultClient.DroppedDumps()
+}
+
 // EnableDumpAllWithoutRequestBody is a global wrapper methods which delegated
 // to the default client's Client.EnableDumpAllWithoutRequestBody.
 func EnableDumpAllWithoutRequestBody() *Client {
@@ -411,6 +469,18 @@ func SetCommonBasicAuth(username, password string) *Client {
 	return defaultClient.SetCommonBasicAuth(username, password)
 }
 
+// EnableBasicAuthFromURL is a global wrapper methods which delegated
+// to the default client's Client.EnableBasicAuthFromURL.
+func EnableBasicAuthFromURL() *Client {
+	return defaultClient.EnableBasicAuthFromURL()
+}
+
+// DisableBasicAuthFromURL is a global wrapper methods which delegated
+// to the default client's Client.DisableBasicAuthFromURL.
+func DisableBasicAuthFromURL() *Client {
+	return defaultClient.DisableBasicAuthFromURL()
+}
+
 // SetCommonDigestAuth is a global wrapper methods which delegated
 // to the default client's Client.SetCommonDigestAuth.
 func SetCommonDigestAuth(username, password string) *Client {
@@ -465,6 +535,12 @@ func SetHTTP2PriorityFrames(frames ...http2.PriorityFrame) *Client {
 	return defaultClient.SetHTTP2PriorityFrames(frames...)
 }
 
+// SetMaxResponseHeaderBytes is a global wrapper methods which delegated
+// to the default client's Client.SetMaxResponseHeaderBytes.
+func SetMaxResponseHeaderBytes(n int64) *Client {
+	return defaultClient.SetMaxResponseHeaderBytes(n)
+}
+
 // SetHTTP2MaxHeaderListSize is a global wrapper methods which delegated
 // to the default client's Client.SetHTTP2MaxHeaderListSize.
 func SetHTTP2MaxHeaderListSize(max uint32) *Client {
@@ -537,6 +613,30 @@ func SetProxy(proxy func(*http.Request) (*url.URL, error)) *Client {
 	return defaultClient.SetProxy(proxy)
 }
 
+// DisablePanicRecovery is a global wrapper methods which delegated
+// to the default client's Client.DisablePanicRecovery.
+func DisablePanicRecovery() *Client {
+	return defaultClient.DisablePanicRecovery()
+}
+
+// EnablePanicRecovery is a global wrapper methods which delegated
+// to the default client's Client.EnablePanicRecovery.
+func EnablePanicRecovery() *Client {
+	return defaultClient.EnablePanicRecovery()
+}
+
+// EnableGraphQLErrorsAsError is a global wrapper methods which delegated
+// to the default client's Client.EnableGraphQLErrorsAsError.
+func EnableGraphQLErrorsAsError() *Client {
+	return defaultClient.EnableGraphQLErrorsAsError()
+}
+
+// DisableGraphQLErrorsAsError is a global wrapper methods which delegated
+// to the default client's Client.DisableGraphQLErrorsAsError.
+func DisableGraphQLErrorsAsError() *Client {
+	return defaultClient.DisableGraphQLErrorsAsError()
+}
+
 // OnBeforeRequest is a global wrapper methods which delegated
 // to the default client's Client.OnBeforeRequest.
 func OnBeforeRequest(m RequestMiddleware) *Client {
@@ -567,12 +667,36 @@ func EnableTraceAll() *Client {
 	return defaultClient.EnableTraceAll()
 }
 
+// EnableRawHeadersAll is a global wrapper methods which delegated
+// to the default client's Client.EnableRawHeadersAll.
+func EnableRawHeadersAll() *Client {
+	return defaultClient.EnableRawHeadersAll()
+}
+
+// DisableRawHeadersAll is a global wrapper methods which delegated
+// to the default client's Client.DisableRawHeadersAll.
+func DisableRawHeadersAll() *Client {
+	return defaultClient.DisableRawHeadersAll()
+}
+
 // SetCookieJar is a global wrapper methods which delegated
 // to the default client's Client.SetCookieJar.
 func SetCookieJar(jar http.CookieJar) *Client {
 	return defaultClient.SetCookieJar(jar)
 }
 
+// SetContextCookieJar is a global wrapper methods which delegated
+// to the default client's Client.SetContextCookieJar.
+func SetContextCookieJar(jar CookieJar) *Client {
+	return defaultClient.SetContextCookieJar(jar)
+}
+
+// SetCookieJarErrorPolicy is a global wrapper methods which delegated
+// to the default client's Client.SetCookieJarErrorPolicy.
+func SetCookieJarErrorPolicy(policy CookieJarErrorPolicy) *Client {
+	return defaultClient.SetCookieJarErrorPolicy(policy)
+}
+
 // GetCookies is a global wrapper methods which delegated
 // to the default client's Client.GetCookies.
 func GetCookies(url string) ([]*http.Cookie, error) {
@@ -615,6 +739,60 @@ func SetDialTLS(fn func(ctx context.Context, network, addr string) (net.Conn, er
 	return defaultClient.SetDialTLS(fn)
 }
 
+// SetDialer is a global wrapper methods which delegated
+// to the default client's Client.SetDialer.
+func SetDialer(d *net.Dialer) *Client {
+	return defaultClient.SetDialer(d)
+}
+
+// SetLocalAddr is a global wrapper methods which delegated
+// to the default client's Client.SetLocalAddr.
+func SetLocalAddr(addr net.Addr) *Client {
+	return defaultClient.SetLocalAddr(addr)
+}
+
+// SetHTTP3Dial is a global wrapper methods which delegated
+// to the default client's Client.SetHTTP3Dial.
+func SetHTTP3Dial(fn func(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (*quic.Conn, error)) *Client {
+	return defaultClient.SetHTTP3Dial(fn)
+}
+
+// SetHTTP3QUICConfig is a global wrapper methods which delegated
+// to the default client's Client.SetHTTP3QUICConfig.
+func SetHTTP3QUICConfig(cfg *quic.Config) *Client {
+	return defaultClient.SetHTTP3QUICConfig(cfg)
+}
+
+// EnableHTTP3Datagrams is a global wrapper methods which delegated
+// to the default client's Client.EnableHTTP3Datagrams.
+func EnableHTTP3Datagrams() *Client {
+	return defaultClient.EnableHTTP3Datagrams()
+}
+
+// DisableHTTP3Datagrams is a global wrapper methods which delegated
+// to the default client's Client.DisableHTTP3Datagrams.
+func DisableHTTP3Datagrams() *Client {
+	return defaultClient.DisableHTTP3Datagrams()
+}
+
+// SetHTTP3FallbackTimeout is a global wrapper methods which delegated
+// to the default client's Client.SetHTTP3FallbackTimeout.
+func SetHTTP3FallbackTimeout(d time.Duration) *Client {
+	return defaultClient.SetHTTP3FallbackTimeout(d)
+}
+
+// EnableHTTP3CloseLateConn is a global wrapper methods which delegated
+// to the default client's Client.EnableHTTP3CloseLateConn.
+func EnableHTTP3CloseLateConn() *Client {
+	return defaultClient.EnableHTTP3CloseLateConn()
+}
+
+// DisableHTTP3CloseLateConn is a global wrapper methods which delegated
+// to the default client's Client.DisableHTTP3CloseLateConn.
+func DisableHTTP3CloseLateConn() *Client {
+	return defaultClient.DisableHTTP3CloseLateConn()
+}
+
 // SetDial is a global wrapper methods which delegated
 // to the default client's Client.SetDial.
 func SetDial(fn func(ctx context.Context, network, addr string) (net.Conn, error)) *Client {
@@ -693,6 +871,12 @@ func SetCommonRetryInterval(getRetryIntervalFunc GetRetryIntervalFunc) *Client {
 	return defaultClient.SetCommonRetryInterval(getRetryIntervalFunc)
 }
 
+// SetCommonRetryIntervalFunc is a global wrapper methods which delegated
+// to the default client's Client.SetCommonRetryIntervalFunc.
+func SetCommonRetryIntervalFunc(fn RetryIntervalFunc) *Client {
+	return defaultClient.SetCommonRetryIntervalFunc(fn)
+}
+
 // SetCommonRetryFixedInterval is a global wrapper methods which delegated
 // to the default client's Client.SetCommonRetryFixedInterval.
 func SetCommonRetryFixedInterval(interval time.Duration) *Client {
@@ -729,6 +913,18 @@ func AddCommonRetryCondition(condition RetryConditionFunc) *Client {
 	return defaultClient.AddCommonRetryCondition(condition)
 }
 
+// SetRetryOnStatusCodes is a global wrapper methods which delegated
+// to the default client's Client.SetRetryOnStatusCodes.
+func SetRetryOnStatusCodes(codes ...int) *Client {
+	return defaultClient.SetRetryOnStatusCodes(codes...)
+}
+
+// SetRetryOnStatusRange is a global wrapper methods which delegated
+// to the default client's Client.SetRetryOnStatusRange.
+func SetRetryOnStatusRange(min, max int) *Client {
+	return defaultClient.SetRetryOnStatusRange(min, max)
+}
+
 // SetResponseBodyTransformer is a global wrapper methods which delegated
 // to the default client's Client.SetResponseBodyTransformer.
 func SetResponseBodyTransformer(fn func(rawBody []byte, req *Request, resp *Response) (transformedBody []byte, err error)) *Client {
@@ -807,6 +1003,18 @@ func GetClient() *http.Client {
 	return defaultClient.GetClient()
 }
 
+// SetRoundTripper is a global wrapper methods which delegated
+// to the default client's Client.SetRoundTripper.
+func SetRoundTripper(rt http.RoundTripper) *Client {
+	return defaultClient.SetRoundTripper(rt)
+}
+
+// StdClient is a global wrapper methods which delegated
+// to the default client's Client.StdClient.
+func StdClient() *http.Client {
+	return defaultClient.StdClient()
+}
+
 // NewRequest is a global wrapper methods which delegated
 // to the default client's Client.NewRequest.
 func NewRequest() *Request {
@@ -818,3 +1026,459 @@ func NewRequest() *Request {
 func R() *Request {
 	return defaultClient.R()
 }
+
+// EnableMetaRefreshFollow is a global wrapper methods which delegated
+// to the default client's Client.EnableMetaRefreshFollow.
+func EnableMetaRefreshFollow(maxHops int) *Client {
+	return defaultClient.EnableMetaRefreshFollow(maxHops)
+}
+
+// DisableMetaRefreshFollow is a global wrapper methods which delegated
+// to the default client's Client.DisableMetaRefreshFollow.
+func DisableMetaRefreshFollow() *Client {
+	return defaultClient.DisableMetaRefreshFollow()
+}
+
+// SetMetaRefreshMaxDelay is a global wrapper methods which delegated
+// to the default client's Client.SetMetaRefreshMaxDelay.
+func SetMetaRefreshMaxDelay(d time.Duration) *Client {
+	return defaultClient.SetMetaRefreshMaxDelay(d)
+}
+
+// SetCSRFTokenExtractor is a global wrapper methods which delegated
+// to the default client's Client.SetCSRFTokenExtractor.
+func SetCSRFTokenExtractor(source CSRFSource, name string) *Client {
+	return defaultClient.SetCSRFTokenExtractor(source, name)
+}
+
+// SetCSRFTokenTarget is a global wrapper methods which delegated
+// to the default client's Client.SetCSRFTokenTarget.
+func SetCSRFTokenTarget(target CSRFTarget, name string) *Client {
+	return defaultClient.SetCSRFTokenTarget(target, name)
+}
+
+// GetCSRFToken is a global wrapper methods which delegated
+// to the default client's Client.GetCSRFToken.
+func GetCSRFToken() string {
+	return defaultClient.GetCSRFToken()
+}
+
+// SetHostProfile is a global wrapper methods which delegated
+// to the default client's Client.SetHostProfile.
+func SetHostProfile(hostPattern string, profile HostProfile) *Client {
+	return defaultClient.SetHostProfile(hostPattern, profile)
+}
+
+// GetHostConfig is a global wrapper methods which delegated
+// to the default client's Client.GetHostConfig.
+func GetHostConfig(host string) *HostConfig {
+	return defaultClient.GetHostConfig(host)
+}
+
+// ProbeResource is a global wrapper methods which delegated
+// to the default client's Client.ProbeResource.
+func ProbeResource(ctx context.Context, url string) (*ResourceInfo, error) {
+	return defaultClient.ProbeResource(ctx, url)
+}
+
+// SetProbeCacheTTL is a global wrapper methods which delegated
+// to the default client's Client.SetProbeCacheTTL.
+func SetProbeCacheTTL(d time.Duration) *Client {
+	return defaultClient.SetProbeCacheTTL(d)
+}
+
+// EnableDumpOnError is a global wrapper methods which delegated
+// to the default client's Client.EnableDumpOnError.
+func EnableDumpOnError() *Client {
+	return defaultClient.EnableDumpOnError()
+}
+
+// EnableDumpIfSlowerThan is a global wrapper methods which delegated
+// to the default client's Client.EnableDumpIfSlowerThan.
+func EnableDumpIfSlowerThan(d time.Duration) *Client {
+	return defaultClient.EnableDumpIfSlowerThan(d)
+}
+
+// DisableConditionalDump is a global wrapper methods which delegated
+// to the default client's Client.DisableConditionalDump.
+func DisableConditionalDump() *Client {
+	return defaultClient.DisableConditionalDump()
+}
+
+// EnableStrictMode is a global wrapper methods which delegated
+// to the default client's Client.EnableStrictMode.
+func EnableStrictMode(policy StrictPolicy) *Client {
+	return defaultClient.EnableStrictMode(policy)
+}
+
+// DisableStrictMode is a global wrapper methods which delegated
+// to the default client's Client.DisableStrictMode.
+func DisableStrictMode() *Client {
+	return defaultClient.DisableStrictMode()
+}
+
+// SetSocketOptions is a global wrapper methods which delegated
+// to the default client's Client.SetSocketOptions.
+func SetSocketOptions(fn func(network, address string, c syscall.RawConn) error) *Client {
+	return defaultClient.SetSocketOptions(fn)
+}
+
+// SetTCPKeepAlive is a global wrapper methods which delegated
+// to the default client's Client.SetTCPKeepAlive.
+func SetTCPKeepAlive(d time.Duration) *Client {
+	return defaultClient.SetTCPKeepAlive(d)
+}
+
+// SetTCPNoDelay is a global wrapper methods which delegated
+// to the default client's Client.SetTCPNoDelay.
+func SetTCPNoDelay(noDelay bool) *Client {
+	return defaultClient.SetTCPNoDelay(noDelay)
+}
+
+// SetCommonForwardedFor is a global wrapper methods which delegated
+// to the default client's Client.SetCommonForwardedFor.
+func SetCommonForwardedFor(clientIP string) *Client {
+	return defaultClient.SetCommonForwardedFor(clientIP)
+}
+
+// EnableCommonForwardedHeader is a global wrapper methods which delegated
+// to the default client's Client.EnableCommonForwardedHeader.
+func EnableCommonForwardedHeader(proto, host string) *Client {
+	return defaultClient.EnableCommonForwardedHeader(proto, host)
+}
+
+// SetResponseCache is a global wrapper methods which delegated
+// to the default client's Client.SetResponseCache.
+func SetResponseCache(cache Cache) *Client {
+	return defaultClient.SetResponseCache(cache)
+}
+
+// OnRetry is a global wrapper methods which delegated
+// to the default client's Client.OnRetry.
+func OnRetry(fn func(info RetryInfo)) *Client {
+	return defaultClient.OnRetry(fn)
+}
+
+// WrapRoundTripper is a global wrapper methods which delegated
+// to the default client's Client.WrapRoundTripper.
+func WrapRoundTripper(wrappers ...HttpRoundTripWrapper) *Client {
+	return defaultClient.WrapRoundTripper(wrappers...)
+}
+
+// SetUserAgentProfile is a global wrapper methods which delegated
+// to the default client's Client.SetUserAgentProfile.
+func SetUserAgentProfile(profile *UserAgentProfile) *Client {
+	return defaultClient.SetUserAgentProfile(profile)
+}
+
+// AllowHighEntropyClientHints is a global wrapper methods which delegated
+// to the default client's Client.AllowHighEntropyClientHints.
+func AllowHighEntropyClientHints(hints ...string) *Client {
+	return defaultClient.AllowHighEntropyClientHints(hints...)
+}
+
+// ClearClientHints is a global wrapper methods which delegated
+// to the default client's Client.ClearClientHints.
+func ClearClientHints() *Client {
+	return defaultClient.ClearClientHints()
+}
+
+// SetFormArrayStyle is a global wrapper methods which delegated
+// to the default client's Client.SetFormArrayStyle.
+func SetFormArrayStyle(style FormArrayStyle) *Client {
+	return defaultClient.SetFormArrayStyle(style)
+}
+
+// SetCacheStatusHeader is a global wrapper methods which delegated
+// to the default client's Client.SetCacheStatusHeader.
+func SetCacheStatusHeader(name string) *Client {
+	return defaultClient.SetCacheStatusHeader(name)
+}
+
+// SetTLSKeyLogWriter is a global wrapper methods which delegated
+// to the default client's Client.SetTLSKeyLogWriter.
+func SetTLSKeyLogWriter(w io.Writer) *Client {
+	return defaultClient.SetTLSKeyLogWriter(w)
+}
+
+// EnableWireCapture is a global wrapper methods which delegated
+// to the default client's Client.EnableWireCapture.
+func EnableWireCapture(w io.Writer) *Client {
+	return defaultClient.EnableWireCapture(w)
+}
+
+// DisableWireCapture is a global wrapper methods which delegated
+// to the default client's Client.DisableWireCapture.
+func DisableWireCapture() *Client {
+	return defaultClient.DisableWireCapture()
+}
+
+// SetHTTP1OnlyHosts is a global wrapper methods which delegated
+// to the default client's Client.SetHTTP1OnlyHosts.
+func SetHTTP1OnlyHosts(hosts ...string) *Client {
+	return defaultClient.SetHTTP1OnlyHosts(hosts...)
+}
+
+// SetHTTP2OnlyHosts is a global wrapper methods which delegated
+// to the default client's Client.SetHTTP2OnlyHosts.
+func SetHTTP2OnlyHosts(hosts ...string) *Client {
+	return defaultClient.SetHTTP2OnlyHosts(hosts...)
+}
+
+// EnableEarlyHintsPreconnect is a global wrapper methods which delegated
+// to the default client's Client.EnableEarlyHintsPreconnect.
+func EnableEarlyHintsPreconnect(maxOrigins int) *Client {
+	return defaultClient.EnableEarlyHintsPreconnect(maxOrigins)
+}
+
+// DisableEarlyHintsPreconnect is a global wrapper methods which delegated
+// to the default client's Client.DisableEarlyHintsPreconnect.
+func DisableEarlyHintsPreconnect() *Client {
+	return defaultClient.DisableEarlyHintsPreconnect()
+}
+
+// OnEarlyHintsPreconnect is a global wrapper methods which delegated
+// to the default client's Client.OnEarlyHintsPreconnect.
+func OnEarlyHintsPreconnect(fn func(origin string, err error)) *Client {
+	return defaultClient.OnEarlyHintsPreconnect(fn)
+}
+
+// SetResponseDrainLimit is a global wrapper methods which delegated
+// to the default client's Client.SetResponseDrainLimit.
+func SetResponseDrainLimit(n int64) *Client {
+	return defaultClient.SetResponseDrainLimit(n)
+}
+
+// GetResponseDrainStats is a global wrapper methods which delegated
+// to the default client's Client.GetResponseDrainStats.
+func GetResponseDrainStats() ResponseDrainStats {
+	return defaultClient.GetResponseDrainStats()
+}
+
+// SetAllowBodyOnMethod is a global wrapper methods which delegated
+// to the default client's Client.SetAllowBodyOnMethod.
+func SetAllowBodyOnMethod(method string, allow bool) *Client {
+	return defaultClient.SetAllowBodyOnMethod(method, allow)
+}
+
+// SetURLNormalizer is a global wrapper methods which delegated
+// to the default client's Client.SetURLNormalizer.
+func SetURLNormalizer(fn URLNormalizer) *Client {
+	return defaultClient.SetURLNormalizer(fn)
+}
+
+// SetAllowedHosts is a global wrapper methods which delegated
+// to the default client's Client.SetAllowedHosts.
+func SetAllowedHosts(patterns ...string) *Client {
+	return defaultClient.SetAllowedHosts(patterns...)
+}
+
+// SetDeniedHosts is a global wrapper methods which delegated
+// to the default client's Client.SetDeniedHosts.
+func SetDeniedHosts(patterns ...string) *Client {
+	return defaultClient.SetDeniedHosts(patterns...)
+}
+
+// SetDialGuard is a global wrapper methods which delegated
+// to the default client's Client.SetDialGuard.
+func SetDialGuard(fn func(ctx context.Context, network, addr string, resolved []net.IP) error) *Client {
+	return defaultClient.SetDialGuard(fn)
+}
+
+// EnableSSRFProtection is a global wrapper methods which delegated
+// to the default client's Client.EnableSSRFProtection.
+func EnableSSRFProtection() *Client {
+	return defaultClient.EnableSSRFProtection()
+}
+
+// DisableSSRFProtection is a global wrapper methods which delegated
+// to the default client's Client.DisableSSRFProtection.
+func DisableSSRFProtection() *Client {
+	return defaultClient.DisableSSRFProtection()
+}
+
+// SendRaw is a global wrapper methods which delegated
+// to the default client's Client.SendRaw.
+func SendRaw(ctx context.Context, hostPort string, raw []byte, useTLS bool) (*Response, error) {
+	return defaultClient.SendRaw(ctx, hostPort, raw, useTLS)
+}
+
+// SetMaxDecompressionRatio is a global wrapper methods which delegated
+// to the default client's Client.SetMaxDecompressionRatio.
+func SetMaxDecompressionRatio(ratio float64) *Client {
+	return defaultClient.SetMaxDecompressionRatio(ratio)
+}
+
+// SetMaxDecompressedSize is a global wrapper methods which delegated
+// to the default client's Client.SetMaxDecompressedSize.
+func SetMaxDecompressedSize(n int64) *Client {
+	return defaultClient.SetMaxDecompressedSize(n)
+}
+
+// SetHeadersForHost is a global wrapper methods which delegated
+// to the default client's Client.SetHeadersForHost.
+func SetHeadersForHost(hostPattern string, headers map[string]string) *Client {
+	return defaultClient.SetHeadersForHost(hostPattern, headers)
+}
+
+// LoadRewriteRules is a global wrapper methods which delegated
+// to the default client's Client.LoadRewriteRules.
+func LoadRewriteRules(r io.Reader) error {
+	return defaultClient.LoadRewriteRules(r)
+}
+
+// ReloadRules is a global wrapper methods which delegated
+// to the default client's Client.ReloadRules.
+func ReloadRules(r io.Reader) error {
+	return defaultClient.ReloadRules(r)
+}
+
+// WarmupConnections is a global wrapper methods which delegated
+// to the default client's Client.WarmupConnections.
+func WarmupConnections(ctx context.Context, urls ...string) error {
+	return defaultClient.WarmupConnections(ctx, urls...)
+}
+
+// Prewarm is a global wrapper methods which delegated
+// to the default client's Client.Prewarm.
+func Prewarm(ctx context.Context, origin string, n int) error {
+	return defaultClient.Prewarm(ctx, origin, n)
+}
+
+// PrewarmKeepAlive is a global wrapper methods which delegated
+// to the default client's Client.PrewarmKeepAlive.
+func PrewarmKeepAlive(origin string, interval time.Duration) (stop func()) {
+	return defaultClient.PrewarmKeepAlive(origin, interval)
+}
+
+// EnableNegativeCaching is a global wrapper methods which delegated
+// to the default client's Client.EnableNegativeCaching.
+func EnableNegativeCaching(ttl time.Duration) *Client {
+	return defaultClient.EnableNegativeCaching(ttl)
+}
+
+// DisableNegativeCaching is a global wrapper methods which delegated
+// to the default client's Client.DisableNegativeCaching.
+func DisableNegativeCaching() *Client {
+	return defaultClient.DisableNegativeCaching()
+}
+
+// ClearNegativeCache is a global wrapper methods which delegated
+// to the default client's Client.ClearNegativeCache.
+func ClearNegativeCache(host string) *Client {
+	return defaultClient.ClearNegativeCache(host)
+}
+
+// SetRequestCompressionVerify is a global wrapper methods which delegated
+// to the default client's Client.SetRequestCompressionVerify.
+func SetRequestCompressionVerify(verify bool) *Client {
+	return defaultClient.SetRequestCompressionVerify(verify)
+}
+
+// SetBodySpillThreshold is a global wrapper methods which delegated
+// to the default client's Client.SetBodySpillThreshold.
+func SetBodySpillThreshold(n int64) *Client {
+	return defaultClient.SetBodySpillThreshold(n)
+}
+
+// SetBodySpillDir is a global wrapper methods which delegated
+// to the default client's Client.SetBodySpillDir.
+func SetBodySpillDir(dir string) *Client {
+	return defaultClient.SetBodySpillDir(dir)
+}
+
+// EnableRobotsTxt is a global wrapper methods which delegated
+// to the default client's Client.EnableRobotsTxt.
+func EnableRobotsTxt(userAgent string, cacheTTL time.Duration) *Client {
+	return defaultClient.EnableRobotsTxt(userAgent, cacheTTL)
+}
+
+// DisableRobotsTxt is a global wrapper methods which delegated
+// to the default client's Client.DisableRobotsTxt.
+func DisableRobotsTxt() *Client {
+	return defaultClient.DisableRobotsTxt()
+}
+
+// SetRobotsTxtAllowOnError is a global wrapper methods which delegated
+// to the default client's Client.SetRobotsTxtAllowOnError.
+func SetRobotsTxtAllowOnError(allow bool) *Client {
+	return defaultClient.SetRobotsTxtAllowOnError(allow)
+}
+
+// SetRobotsTxtDecisionFunc is a global wrapper methods which delegated
+// to the default client's Client.SetRobotsTxtDecisionFunc.
+func SetRobotsTxtDecisionFunc(fn func(req *http.Request) error) *Client {
+	return defaultClient.SetRobotsTxtDecisionFunc(fn)
+}
+
+// DisableRobotsTxtCrawlDelay is a global wrapper methods which delegated
+// to the default client's Client.DisableRobotsTxtCrawlDelay.
+func DisableRobotsTxtCrawlDelay() *Client {
+	return defaultClient.DisableRobotsTxtCrawlDelay()
+}
+
+// SetRandSource is a global wrapper methods which delegated
+// to the default client's Client.SetRandSource.
+func SetRandSource(src rand.Source) *Client {
+	return defaultClient.SetRandSource(src)
+}
+
+// EnableRedirectLoopDetection is a global wrapper methods which delegated
+// to the default client's Client.EnableRedirectLoopDetection.
+func EnableRedirectLoopDetection() *Client {
+	return defaultClient.EnableRedirectLoopDetection()
+}
+
+// DisableRedirectLoopDetection is a global wrapper methods which delegated
+// to the default client's Client.DisableRedirectLoopDetection.
+func DisableRedirectLoopDetection() *Client {
+	return defaultClient.DisableRedirectLoopDetection()
+}
+
+// DiagnoseH3 is a global wrapper methods which delegated
+// to the default client's Client.DiagnoseH3.
+func DiagnoseH3(ctx context.Context, origin string) (*H3Diagnosis, error) {
+	return defaultClient.DiagnoseH3(ctx, origin)
+}
+
+// DiagnoseAll is a global wrapper methods which delegated
+// to the default client's Client.DiagnoseAll.
+func DiagnoseAll(ctx context.Context, origin string) (*ConnectivityDiagnosis, error) {
+	return defaultClient.DiagnoseAll(ctx, origin)
+}
+
+// OnDNSResolved is a global wrapper methods which delegated
+// to the default client's Client.OnDNSResolved.
+func OnDNSResolved(fn func(host string, addrs []netip.Addr) []netip.Addr) *Client {
+	return defaultClient.OnDNSResolved(fn)
+}
+
+// SetClientHelloSpecFunc is a global wrapper methods which delegated
+// to the default client's Client.SetClientHelloSpecFunc.
+func SetClientHelloSpecFunc(fn func(host string) *utls.ClientHelloSpec) *Client {
+	return defaultClient.SetClientHelloSpecFunc(fn)
+}
+
+// SetClientHelloInfoHook is a global wrapper methods which delegated
+// to the default client's Client.SetClientHelloInfoHook.
+func SetClientHelloInfoHook(fn func(info ClientHelloSummary)) *Client {
+	return defaultClient.SetClientHelloInfoHook(fn)
+}
+
+// EnableStrictConfig is a global wrapper methods which delegated
+// to the default client's Client.EnableStrictConfig.
+func EnableStrictConfig() *Client {
+	return defaultClient.EnableStrictConfig()
+}
+
+// DisableStrictConfig is a global wrapper methods which delegated
+// to the default client's Client.DisableStrictConfig.
+func DisableStrictConfig() *Client {
+	return defaultClient.DisableStrictConfig()
+}
+
+// Validate is a global wrapper methods which delegated
+// to the default client's Client.Validate.
+func Validate() []ConfigIssue {
+	return defaultClient.Validate()
+}
@@ -0,0 +1,236 @@
+package req
+
+import (
+	"encoding/binary"
+	"net"
+
+	utls "github.com/refraction-networking/utls"
+)
+
+// maxClientHelloSize is the max size of the ClientHello which is recorded
+// for the ClientHello info hook.
+const maxClientHelloSize = 64 << 10
+
+// ClientHelloSummary is the summary of the TLS ClientHello which is
+// actually sent, see Client.SetClientHelloInfoHook.
+type ClientHelloSummary struct {
+	// ServerName is the SNI, empty if not sent.
+	ServerName string
+	// Version is the legacy version field of the ClientHello, the versions
+	// offered by TLS 1.3 are in the supported_versions extension.
+	Version uint16
+	// CipherSuites is the cipher suites in order, including the GREASE
+	// values.
+	CipherSuites []uint16
+	// Extensions is the types of the extensions in order.
+	Extensions []uint16
+	// ALPN is the protocols of the ALPN extension.
+	ALPN []string
+	// Raw is the raw ClientHello handshake message.
+	Raw []byte
+}
+
+// SetClientHelloSpecFunc set the function which returns the uTLS ClientHello
+// spec for the host, which fully customizes the ClientHello beyond the
+// presets of SetTLSFingerprint, the preset fingerprint (or the one of Go if
+// not set) is used if it returns nil. It enables the uTLS handshake, which
+// is valid for HTTP1 and HTTP2, not HTTP3. The spec is applied to a single
+// connection, so return a new spec each time rather than sharing one.
+//
+// The connections to the same host share the spec as they are pooled by
+// host, the function should return the equivalent spec for the same host.
+// Changing the function changes the key of the connection pool, so the
+// connections built with the previous specs are never reused. Passing nil
+// removes the function, the fingerprint set before is used.
+func (c *Client) SetClientHelloSpecFunc(fn func(host string) *utls.ClientHelloSpec) *Client {
+	if fn != nil {
+		c.clientHelloSpecFunc.Store(&fn)
+	} else {
+		c.clientHelloSpecFunc.Store(nil)
+	}
+	c.Transport.configChanged()
+	if fn != nil && !c.utlsEnabled {
+		c.SetTLSFingerprint(utls.HelloGolang)
+	} else {
+		c.Transport.resetTLSIdentity()
+		c.resetHostProfileTransports()
+	}
+	c.Transport.CloseIdleConnections()
+	return c
+}
+
+// getClientHelloSpecFunc returns the function set by SetClientHelloSpecFunc,
+// which is read at dial time while it may be changed concurrently.
+func (c *Client) getClientHelloSpecFunc() func(host string) *utls.ClientHelloSpec {
+	if fn := c.clientHelloSpecFunc.Load(); fn != nil {
+		return *fn
+	}
+	return nil
+}
+
+// SetClientHelloInfoHook set the function which is called with the summary
+// of the ClientHello which is actually sent in the uTLS handshake (see
+// SetTLSFingerprint, SetClientHelloSpecFunc and the ImpersonateXXX methods),
+// e.g. the cipher suites, extensions and ALPN, which helps to verify and
+// debug the fingerprint. It's called with the first ClientHello of each
+// connection during the handshake, so it must be fast and safe for
+// concurrent use.
+func (c *Client) SetClientHelloInfoHook(fn func(info ClientHelloSummary)) *Client {
+	c.clientHelloInfoHook = fn
+	return c
+}
+
+// newUTLSConn creates the uTLS client connection with the spec returned by
+// the ClientHello spec function if any, otherwise with clientHelloID.
+func (c *Client) newUTLSConn(conn net.Conn, config *utls.Config, clientHelloID utls.ClientHelloID) (*uTLSConn, error) {
+	if c.clientHelloInfoHook != nil {
+		conn = &clientHelloRecorder{Conn: conn, hook: c.clientHelloInfoHook}
+	}
+	if fn := c.getClientHelloSpecFunc(); fn != nil {
+		if spec := fn(config.ServerName); spec != nil {
+			uconn := utls.UClient(conn, config, utls.HelloCustom)
+			if err := uconn.ApplyPreset(spec); err != nil {
+				return nil, err
+			}
+			return &uTLSConn{uconn}, nil
+		}
+	}
+	return &uTLSConn{utls.UClient(conn, config, clientHelloID)}, nil
+}
+
+// clientHelloRecorder records the first ClientHello written to the
+// connection, and reports the summary to the hook.
+type clientHelloRecorder struct {
+	net.Conn
+	hook func(info ClientHelloSummary)
+	buf  []byte
+	done bool
+}
+
+func (r *clientHelloRecorder) Write(p []byte) (int, error) {
+	if !r.done {
+		r.buf = append(r.buf, p...)
+		if msg, ok := readHandshakeMessage(r.buf); ok {
+			r.done, r.buf = true, nil
+			if info, ok := parseClientHello(msg); ok {
+				r.hook(info)
+			}
+		} else if len(r.buf) > maxClientHelloSize {
+			r.done, r.buf = true, nil
+		}
+	}
+	return r.Conn.Write(p)
+}
+
+// readHandshakeMessage returns the first handshake message in the TLS
+// records of b, which may be fragmented across the records, ok is false if
+// the message is incomplete or b is not the handshake records.
+func readHandshakeMessage(b []byte) (msg []byte, ok bool) {
+	var payload []byte
+	for len(b) >= 5 {
+		if b[0] != 22 { // not handshake record.
+			return nil, false
+		}
+		n := int(binary.BigEndian.Uint16(b[3:5]))
+		if len(b) < 5+n {
+			break
+		}
+		payload = append(payload, b[5:5+n]...)
+		b = b[5+n:]
+		if len(payload) >= 4 {
+			size := 4 + (int(payload[1])<<16 | int(payload[2])<<8 | int(payload[3]))
+			if len(payload) >= size {
+				return payload[:size], true
+			}
+		}
+	}
+	return nil, false
+}
+
+// parseClientHello parses the ClientHello handshake message (RFC 8446
+// Section 4.1.2).
+func parseClientHello(msg []byte) (info ClientHelloSummary, ok bool) {
+	if len(msg) < 4 || msg[0] != 1 {
+		return
+	}
+	s := cryptoBytes(msg[4:])
+	var random, sessionID, suites, compression, exts cryptoBytes
+	version, ok1 := s.uint16()
+	if !ok1 || !s.bytes(32, &random) || !s.prefixed(1, &sessionID) || !s.prefixed(2, &suites) || !s.prefixed(1, &compression) {
+		return
+	}
+	info = ClientHelloSummary{Version: version, Raw: msg}
+	for len(suites) >= 2 {
+		suite, _ := suites.uint16()
+		info.CipherSuites = append(info.CipherSuites, suite)
+	}
+	if len(s) == 0 { // no extensions.
+		return info, true
+	}
+	if !s.prefixed(2, &exts) {
+		return ClientHelloSummary{}, false
+	}
+	for len(exts) > 0 {
+		typ, ok1 := exts.uint16()
+		var data cryptoBytes
+		if !ok1 || !exts.prefixed(2, &data) {
+			return ClientHelloSummary{}, false
+		}
+		info.Extensions = append(info.Extensions, typ)
+		switch typ {
+		case 0: // server_name
+			var list, name cryptoBytes
+			if data.prefixed(2, &list) && len(list) > 0 {
+				list = list[1:] // name type
+				if list.prefixed(2, &name) {
+					info.ServerName = string(name)
+				}
+			}
+		case 16: // application_layer_protocol_negotiation
+			var list cryptoBytes
+			if data.prefixed(2, &list) {
+				for len(list) > 0 {
+					var proto cryptoBytes
+					if !list.prefixed(1, &proto) {
+						break
+					}
+					info.ALPN = append(info.ALPN, string(proto))
+				}
+			}
+		}
+	}
+	return info, true
+}
+
+// cryptoBytes is the minimal reader of the TLS wire format.
+type cryptoBytes []byte
+
+func (b *cryptoBytes) uint16() (uint16, bool) {
+	if len(*b) < 2 {
+		return 0, false
+	}
+	v := binary.BigEndian.Uint16(*b)
+	*b = (*b)[2:]
+	return v, true
+}
+
+func (b *cryptoBytes) bytes(n int, out *cryptoBytes) bool {
+	if len(*b) < n {
+		return false
+	}
+	*out, *b = (*b)[:n], (*b)[n:]
+	return true
+}
+
+// prefixed reads the bytes prefixed with the length of lenSize bytes.
+func (b *cryptoBytes) prefixed(lenSize int, out *cryptoBytes) bool {
+	if len(*b) < lenSize {
+		return false
+	}
+	n := 0
+	for _, c := range (*b)[:lenSize] {
+		n = n<<8 | int(c)
+	}
+	*b = (*b)[lenSize:]
+	return b.bytes(n, out)
+}
@@ -0,0 +1,271 @@
+package req
+
+import (
+	"maps"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/imroc/req/v3/internal/netutil"
+)
+
+// UserAgentBrand is a brand and its version in the brand list of the
+// sec-ch-ua and sec-ch-ua-full-version-list client hints.
+type UserAgentBrand struct {
+	Brand   string
+	Version string
+}
+
+// UserAgentProfile is the User-Agent and the User-Agent client hints of a
+// browser, which are kept mutually consistent by the client, see
+// Client.SetUserAgentProfile.
+type UserAgentProfile struct {
+	// UserAgent is the value of the User-Agent header.
+	UserAgent string
+	// Brands is the brand list of the sec-ch-ua hint, leave it empty for
+	// browsers which do not support client hints, e.g. Firefox and Safari.
+	Brands []UserAgentBrand
+	// Mobile is the value of the sec-ch-ua-mobile hint.
+	Mobile bool
+	// Platform is the value of the sec-ch-ua-platform hint, e.g. "macOS".
+	Platform string
+
+	// The high-entropy hints below are only sent to the origins which ask
+	// for them with Accept-CH, and only if allowed by
+	// Client.AllowHighEntropyClientHints.
+
+	// FullVersionList is the brand list of the sec-ch-ua-full-version-list hint.
+	FullVersionList []UserAgentBrand
+	// PlatformVersion is the value of the sec-ch-ua-platform-version hint.
+	PlatformVersion string
+	// Arch is the value of the sec-ch-ua-arch hint, e.g. "arm".
+	Arch string
+	// Bitness is the value of the sec-ch-ua-bitness hint, e.g. "64".
+	Bitness string
+	// Model is the value of the sec-ch-ua-model hint, which is usually
+	// empty on desktop.
+	Model string
+}
+
+const (
+	hintUA                = "sec-ch-ua"
+	hintUAMobile          = "sec-ch-ua-mobile"
+	hintUAPlatform        = "sec-ch-ua-platform"
+	hintUAFullVersionList = "sec-ch-ua-full-version-list"
+	hintUAPlatformVersion = "sec-ch-ua-platform-version"
+	hintUAArch            = "sec-ch-ua-arch"
+	hintUABitness         = "sec-ch-ua-bitness"
+	hintUAModel           = "sec-ch-ua-model"
+)
+
+// lowEntropyClientHints are sent to every secure origin by default, like
+// Chromium-based browsers do.
+var lowEntropyClientHints = []string{hintUA, hintUAMobile, hintUAPlatform}
+
+func isLowEntropyClientHint(name string) bool {
+	for _, h := range lowEntropyClientHints {
+		if h == name {
+			return true
+		}
+	}
+	return false
+}
+
+func formatBrands(brands []UserAgentBrand) string {
+	var sb strings.Builder
+	for i, b := range brands {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(strconv.Quote(b.Brand))
+		sb.WriteString(";v=")
+		sb.WriteString(strconv.Quote(b.Version))
+	}
+	return sb.String()
+}
+
+// hint returns the value of the client hint with the lowercase name, and
+// false if the profile does not provide it.
+func (p *UserAgentProfile) hint(name string) (string, bool) {
+	if len(p.Brands) == 0 { // client hints are not supported by the browser.
+		return "", false
+	}
+	quote := func(s string) (string, bool) {
+		return strconv.Quote(s), s != ""
+	}
+	switch name {
+	case hintUA:
+		return formatBrands(p.Brands), true
+	case hintUAMobile:
+		if p.Mobile {
+			return "?1", true
+		}
+		return "?0", true
+	case hintUAPlatform:
+		return strconv.Quote(p.Platform), true
+	case hintUAFullVersionList:
+		return formatBrands(p.FullVersionList), len(p.FullVersionList) > 0
+	case hintUAPlatformVersion:
+		return quote(p.PlatformVersion)
+	case hintUAArch:
+		return quote(p.Arch)
+	case hintUABitness:
+		return quote(p.Bitness)
+	case hintUAModel:
+		return strconv.Quote(p.Model), true
+	}
+	return "", false
+}
+
+// clientHints keeps the hints requested by each origin with Accept-CH,
+// alongside the Alt-Svc cache of the Transport.
+type clientHints struct {
+	profile     *UserAgentProfile
+	highEntropy map[string]bool
+
+	mu      sync.Mutex
+	origins map[string][]string
+}
+
+func newClientHints(profile *UserAgentProfile, highEntropy map[string]bool) *clientHints {
+	return &clientHints{
+		profile:     profile,
+		highEntropy: highEntropy,
+		origins:     make(map[string][]string),
+	}
+}
+
+func (ch *clientHints) clone() *clientHints {
+	return newClientHints(ch.profile, maps.Clone(ch.highEntropy))
+}
+
+func (ch *clientHints) clear() {
+	ch.mu.Lock()
+	ch.origins = make(map[string][]string)
+	ch.mu.Unlock()
+}
+
+// recordAcceptCH replaces the hints requested by the origin of the
+// response, an empty Accept-CH clears them.
+func (ch *clientHints) recordAcceptCH(req *http.Request, resp *http.Response) {
+	if req.URL.Scheme != "https" {
+		return
+	}
+	values := resp.Header.Values("Accept-CH")
+	if len(values) == 0 {
+		return
+	}
+	var hints []string
+	for _, v := range values {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.ToLower(strings.TrimSpace(name)); name == "" || isLowEntropyClientHint(name) {
+				continue
+			}
+			if ch.highEntropy[name] {
+				hints = append(hints, name)
+			}
+		}
+	}
+	origin := netutil.AuthorityKey(req.URL)
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	if len(hints) == 0 {
+		delete(ch.origins, origin)
+	} else {
+		ch.origins[origin] = hints
+	}
+}
+
+// apply returns the request with the client hints for its origin, the
+// request is copied if any hint is added, and the hints which have been
+// set on the request are left untouched.
+func (ch *clientHints) apply(req *http.Request) *http.Request {
+	if req.URL.Scheme != "https" {
+		return req
+	}
+	ch.mu.Lock()
+	requested := ch.origins[netutil.AuthorityKey(req.URL)]
+	ch.mu.Unlock()
+	var hdr http.Header
+	for _, names := range [][]string{lowEntropyClientHints, requested} {
+		for _, name := range names {
+			v, ok := ch.profile.hint(name)
+			if !ok || hasHeaderSpelling(req.Header, name) {
+				continue
+			}
+			if hdr == nil {
+				hdr = req.Header.Clone()
+				if hdr == nil {
+					hdr = make(http.Header)
+				}
+			}
+			hdr.Set(name, v)
+		}
+	}
+	if hdr == nil {
+		return req
+	}
+	r := *req
+	r.Header = hdr
+	return &r
+}
+
+// SetUserAgentProfile sets the User-Agent and the User-Agent client hints of
+// the client, which are kept mutually consistent, the impersonation presets
+// (e.g. ImpersonateChrome) install their own profile. The low-entropy hints
+// (sec-ch-ua, sec-ch-ua-mobile and sec-ch-ua-platform) are sent to every
+// https origin, and the high-entropy hints are only sent to the origins which
+// ask for them with Accept-CH, if they are allowed by
+// AllowHighEntropyClientHints. The hints which are set on the request are
+// left untouched. Pass nil to stop sending client hints, the User-Agent is
+// left unchanged in this case.
+func (c *Client) SetUserAgentProfile(profile *UserAgentProfile) *Client {
+	// remove the hints of the previous profile or the common headers.
+	for k := range c.Headers {
+		if strings.HasPrefix(strings.ToLower(k), hintUA) {
+			delete(c.Headers, k)
+		}
+	}
+	if profile == nil {
+		c.Transport.clientHints = nil
+		return c
+	}
+	if profile.UserAgent != "" {
+		c.SetUserAgent(profile.UserAgent)
+	}
+	var highEntropy map[string]bool
+	if c.Transport.clientHints != nil {
+		highEntropy = c.Transport.clientHints.highEntropy
+	}
+	c.Transport.clientHints = newClientHints(profile, highEntropy)
+	return c
+}
+
+// AllowHighEntropyClientHints allows the high-entropy client hints (e.g.
+// sec-ch-ua-platform-version and sec-ch-ua-full-version-list) to be sent to
+// the origins which ask for them with Accept-CH, the names are
+// case-insensitive. It takes effect once a profile is set by
+// SetUserAgentProfile or an impersonation preset.
+func (c *Client) AllowHighEntropyClientHints(hints ...string) *Client {
+	if c.Transport.clientHints == nil {
+		c.Transport.clientHints = newClientHints(&UserAgentProfile{}, nil)
+	}
+	ch := c.Transport.clientHints
+	if ch.highEntropy == nil {
+		ch.highEntropy = make(map[string]bool)
+	}
+	for _, name := range hints {
+		ch.highEntropy[strings.ToLower(name)] = true
+	}
+	return c
+}
+
+// ClearClientHints clears the client hints requested by the origins with
+// Accept-CH, the low-entropy hints are still sent.
+func (c *Client) ClearClientHints() *Client {
+	if c.Transport.clientHints != nil {
+		c.Transport.clientHints.clear()
+	}
+	return c
+}
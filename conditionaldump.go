@@ -0,0 +1,91 @@
+package req
+
+import (
+	"time"
+)
+
+// conditionalDump controls emitting the dump buffered for each request, only
+// if the request failed or is slow.
+type conditionalDump struct {
+	onError    bool
+	slowerThan time.Duration
+}
+
+func (d *conditionalDump) Clone() *conditionalDump {
+	if d == nil {
+		return nil
+	}
+	dd := *d
+	return &dd
+}
+
+func (d *conditionalDump) shouldEmit(resp *Response) bool {
+	if d.onError && (resp.Err != nil || resp.Response == nil || resp.IsErrorState()) {
+		return true
+	}
+	return d.slowerThan > 0 && time.Since(resp.Request.StartTime) > d.slowerThan
+}
+
+func (c *Client) getConditionalDump() *conditionalDump {
+	if c.conditionalDump == nil {
+		c.conditionalDump = &conditionalDump{}
+	}
+	return c.conditionalDump
+}
+
+// EnableDumpOnError enables dump for each request like EnableDumpEachRequest,
+// the dump is buffered during the request, and is only written to the output
+// of the client dump options (see SetCommonDumpOptions, default is stdout) if
+// the request failed with an error or the response is in error state, which
+// is discarded otherwise. It can be combined with EnableDumpIfSlowerThan, the
+// dump is written if either condition is met. Each attempt of the retried
+// request is handled separately.
+func (c *Client) EnableDumpOnError() *Client {
+	c.getConditionalDump().onError = true
+	return c
+}
+
+// EnableDumpIfSlowerThan enables dump for each request like EnableDumpOnError,
+// but the dump is written if the total time of the request, including reading
+// the response body automatically, exceeds d.
+func (c *Client) EnableDumpIfSlowerThan(d time.Duration) *Client {
+	c.getConditionalDump().slowerThan = d
+	return c
+}
+
+// DisableConditionalDump disables the dump enabled by EnableDumpOnError and
+// EnableDumpIfSlowerThan.
+func (c *Client) DisableConditionalDump() *Client {
+	c.conditionalDump = nil
+	return c
+}
+
+func enableConditionalDump(c *Client, r *Request) error {
+	if c.conditionalDump == nil || r.RetryAttempt > 0 || r.dumpOptions != nil {
+		return nil
+	}
+	o := r.getDumpOptions()
+	if co := c.dumpOptions; co != nil {
+		o.RequestHeader = co.RequestHeader
+		o.RequestBody = co.RequestBody
+		o.ResponseHeader = co.ResponseHeader
+		o.ResponseBody = co.ResponseBody
+		o.Attempts = co.Attempts
+	}
+	r.conditionalDump = true
+	r.EnableDump()
+	return nil
+}
+
+func emitConditionalDump(c *Client, resp *Response) error {
+	r := resp.Request
+	if c.conditionalDump == nil || !r.conditionalDump || !c.conditionalDump.shouldEmit(resp) {
+		return nil
+	}
+	output := c.getDumpOptions().Output
+	if output == nil || r.dumpBuffer == nil {
+		return nil
+	}
+	output.Write([]byte(r.dumpBuffer.String()))
+	return nil
+}
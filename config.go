@@ -0,0 +1,382 @@
+package req
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// RedactedValue is the value which the secrets are replaced with in the
+// ClientConfig returned by Client.ConfigSnapshot.
+const RedactedValue = "[REDACTED]"
+
+// ClientConfig is the data-representable configuration of the Client, which
+// can be marshalled to JSON, see Client.ConfigSnapshot and
+// NewClientFromConfig. The durations are in nanoseconds.
+type ClientConfig struct {
+	BaseURL     string              `json:"base_url,omitempty"`
+	Impersonate string              `json:"impersonate,omitempty"`
+	Headers     map[string][]string `json:"headers,omitempty"`
+	QueryParams map[string][]string `json:"query_params,omitempty"`
+	PathParams  map[string]string   `json:"path_params,omitempty"`
+	FormData    map[string][]string `json:"form_data,omitempty"`
+	Timeout     time.Duration       `json:"timeout"`
+	ProxyURL    string              `json:"proxy_url,omitempty"`
+	// HTTPVersion is the forced HTTP version, "1.1", "2" or "3".
+	HTTPVersion             string          `json:"http_version,omitempty"`
+	HTTP3                   bool            `json:"http3,omitempty"`
+	DebugLog                bool            `json:"debug_log,omitempty"`
+	AllowGetMethodPayload   bool            `json:"allow_get_method_payload,omitempty"`
+	DisableAutoReadResponse bool            `json:"disable_auto_read_response,omitempty"`
+	DisableAutoDecode       bool            `json:"disable_auto_decode,omitempty"`
+	DisableCookieJar        bool            `json:"disable_cookie_jar,omitempty"`
+	Retry                   RetryConfig     `json:"retry"`
+	TLS                     TLSConfig       `json:"tls"`
+	Transport               TransportConfig `json:"transport"`
+	// Funcs is the names of the function-valued options which are set,
+	// e.g. "RetryCondition" and "DialContext", which are only listed for
+	// the reference and can not be reconstructed.
+	Funcs []string `json:"funcs,omitempty"`
+}
+
+// RetryConfig is the retry configuration of the ClientConfig.
+type RetryConfig struct {
+	Count       int      `json:"count,omitempty"`
+	StatusCodes []int    `json:"status_codes,omitempty"`
+	StatusRange [][2]int `json:"status_range,omitempty"`
+}
+
+// TLSConfig is the TLS configuration of the ClientConfig.
+type TLSConfig struct {
+	InsecureSkipVerify bool     `json:"insecure_skip_verify,omitempty"`
+	ServerName         string   `json:"server_name,omitempty"`
+	MinVersion         uint16   `json:"min_version,omitempty"`
+	MaxVersion         uint16   `json:"max_version,omitempty"`
+	NextProtos         []string `json:"next_protos,omitempty"`
+}
+
+// TransportConfig is the connection configuration of the ClientConfig.
+type TransportConfig struct {
+	MaxIdleConns           int           `json:"max_idle_conns,omitempty"`
+	MaxIdleConnsPerHost    int           `json:"max_idle_conns_per_host,omitempty"`
+	MaxConnsPerHost        int           `json:"max_conns_per_host,omitempty"`
+	IdleConnTimeout        time.Duration `json:"idle_conn_timeout,omitempty"`
+	TLSHandshakeTimeout    time.Duration `json:"tls_handshake_timeout,omitempty"`
+	ResponseHeaderTimeout  time.Duration `json:"response_header_timeout,omitempty"`
+	ExpectContinueTimeout  time.Duration `json:"expect_continue_timeout,omitempty"`
+	PriorityAging          time.Duration `json:"priority_aging,omitempty"`
+	DisableKeepAlives      bool          `json:"disable_keep_alives,omitempty"`
+	DisableCompression     bool          `json:"disable_compression,omitempty"`
+	MaxResponseHeaderBytes int64         `json:"max_response_header_bytes,omitempty"`
+	WriteBufferSize        int           `json:"write_buffer_size,omitempty"`
+	ReadBufferSize         int           `json:"read_buffer_size,omitempty"`
+}
+
+// sensitiveHeaders are the headers whose values are always redacted.
+var sensitiveHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+}
+
+// isSecretName reports whether the header, query param or form field named
+// name likely carries a secret.
+func isSecretName(name string) bool {
+	if sensitiveHeaders[http.CanonicalHeaderKey(name)] {
+		return true
+	}
+	name = strings.ToLower(name)
+	for _, s := range []string{"token", "secret", "password", "passwd", "apikey", "api-key", "api_key"} {
+		if strings.Contains(name, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func redactValues(values map[string][]string) map[string][]string {
+	if len(values) == 0 {
+		return nil
+	}
+	m := make(map[string][]string, len(values))
+	for k, vv := range values {
+		if isSecretName(k) {
+			vv = []string{RedactedValue}
+		}
+		m[k] = cloneSlice(vv)
+	}
+	return m
+}
+
+func redactURL(s string) string {
+	if u, err := url.Parse(s); err == nil && u.User != nil {
+		return u.Redacted()
+	}
+	return s
+}
+
+// ConfigSnapshot returns the effective configuration of the client which is
+// data-representable, e.g. for diffing the configurations in the bug
+// reports, or saving it as JSON to be loaded by NewClientFromConfig. The
+// secrets are redacted: the values of the Authorization and Cookie headers
+// and the headers, query params and form fields named like a token, secret,
+// password or api key are replaced with RedactedValue, and the password of
+// the URLs is masked. The function-valued options are listed in Funcs by
+// name only.
+func (c *Client) ConfigSnapshot() ClientConfig {
+	t := c.Transport
+	cfg := ClientConfig{
+		BaseURL:                 redactURL(c.BaseURL),
+		Impersonate:             c.impersonate,
+		Headers:                 redactValues(t.Headers),
+		QueryParams:             redactValues(c.QueryParams),
+		FormData:                redactValues(c.FormData),
+		Timeout:                 c.httpClient.Timeout,
+		ProxyURL:                redactURL(c.proxyURL),
+		HTTPVersion:             string(t.forceHttpVersion),
+		HTTP3:                   t.t3 != nil,
+		DebugLog:                c.DebugLog,
+		AllowGetMethodPayload:   c.AllowGetMethodPayload,
+		DisableAutoReadResponse: c.disableAutoReadResponse,
+		DisableAutoDecode:       t.disableAutoDecode,
+		DisableCookieJar:        c.cookieJar == nil && c.httpClient.Jar == nil,
+		Transport: TransportConfig{
+			MaxIdleConns:           t.MaxIdleConns,
+			MaxIdleConnsPerHost:    t.MaxIdleConnsPerHost,
+			MaxConnsPerHost:        t.MaxConnsPerHost,
+			IdleConnTimeout:        t.IdleConnTimeout,
+			TLSHandshakeTimeout:    t.TLSHandshakeTimeout,
+			ResponseHeaderTimeout:  t.ResponseHeaderTimeout,
+			ExpectContinueTimeout:  t.ExpectContinueTimeout,
+			PriorityAging:          t.PriorityAging,
+			DisableKeepAlives:      t.DisableKeepAlives,
+			DisableCompression:     t.DisableCompression,
+			MaxResponseHeaderBytes: t.MaxResponseHeaderBytes,
+			WriteBufferSize:        t.WriteBufferSize,
+			ReadBufferSize:         t.ReadBufferSize,
+		},
+	}
+	if len(c.PathParams) > 0 {
+		cfg.PathParams = make(map[string]string, len(c.PathParams))
+		for k, v := range c.PathParams {
+			if isSecretName(k) {
+				v = RedactedValue
+			}
+			cfg.PathParams[k] = v
+		}
+	}
+	if ro := c.retryOption; ro != nil {
+		cfg.Retry.Count = ro.MaxRetries
+		cfg.Retry.StatusCodes = cloneSlice(ro.RetryStatusCodes)
+		for _, r := range ro.RetryStatusRanges {
+			cfg.Retry.StatusRange = append(cfg.Retry.StatusRange, [2]int{r.Min, r.Max})
+		}
+	}
+	if tc := t.TLSClientConfig; tc != nil {
+		cfg.TLS = TLSConfig{
+			InsecureSkipVerify: tc.InsecureSkipVerify,
+			ServerName:         tc.ServerName,
+			MinVersion:         tc.MinVersion,
+			MaxVersion:         tc.MaxVersion,
+			NextProtos:         cloneSlice(tc.NextProtos),
+		}
+	}
+	cfg.Funcs = c.funcOptions()
+	return cfg
+}
+
+// funcOptions returns the sorted names of the function-valued options which
+// are set.
+func (c *Client) funcOptions() []string {
+	t := c.Transport
+	var names []string
+	add := func(name string, set bool) {
+		if set {
+			names = append(names, name)
+		}
+	}
+	add("Proxy", t.Proxy != nil && c.proxyURL == "" && !isSameFunc(t.Proxy, http.ProxyFromEnvironment))
+	add("DialContext", t.DialContext != nil)
+	add("DialTLSContext", t.DialTLSContext != nil && !t.Options.EnableH2C)
+	add("TLSHandshake", t.TLSHandshakeContext != nil && c.impersonate == "")
+	add("RoundTripper", c.roundTripper != nil)
+	add("ClientHelloSpecFunc", c.getClientHelloSpecFunc() != nil)
+	add("ClientHelloInfoHook", c.clientHelloInfoHook != nil)
+	add("WrapRoundTrip", len(c.roundTripWrappers) > 0 || len(c.httpRoundTripWrappers) > 0)
+	add("OnBeforeRequest", len(c.udBeforeRequest) > 0)
+	add("OnError", c.onError != nil)
+	add("ResultStateCheckFunc", c.resultStateCheckFunc != nil)
+	add("ResponseBodyTransformer", c.responseBodyTransformer != nil)
+	add("RequestIDFunc", c.requestIDFunc != nil)
+	add("MultipartBoundaryFunc", c.multipartBoundaryFunc != nil && c.impersonate == "")
+	add("JsonMarshal", !isSameFunc(c.jsonMarshal, json.Marshal))
+	add("JsonUnmarshal", !isSameFunc(c.jsonUnmarshal, json.Unmarshal))
+	add("XmlMarshal", !isSameFunc(c.xmlMarshal, xml.Marshal))
+	add("XmlUnmarshal", !isSameFunc(c.xmlUnmarshal, xml.Unmarshal))
+	if ro := c.retryOption; ro != nil {
+		add("RetryCondition", len(ro.RetryConditions) > 0)
+		add("RetryHook", len(ro.RetryHooks) > 0)
+		add("RetryInterval", ro.RetryInterval != nil || !isSameFunc(ro.GetRetryInterval, defaultGetRetryInterval))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewClientFromConfig creates the Client with the configuration, which is
+// usually returned by Client.ConfigSnapshot or loaded from JSON. The config
+// is overlaid on the defaults of C(), the zero fields (e.g. the fields
+// missing from the JSON) keep the defaults, and the headers, query params,
+// path params and form data are merged into the default ones. The redacted
+// values (see RedactedValue) are skipped, and Funcs is ignored as the
+// functions can not be reconstructed, set them on the returned client if
+// needed.
+func NewClientFromConfig(cfg ClientConfig) (*Client, error) {
+	c := C()
+	switch cfg.Impersonate {
+	case "":
+	case "chrome":
+		c.ImpersonateChrome()
+	case "firefox":
+		c.ImpersonateFirefox()
+	case "safari":
+		c.ImpersonateSafari()
+	default:
+		return nil, fmt.Errorf("req: unknown impersonate %q in client config", cfg.Impersonate)
+	}
+	t := c.Transport
+	setNonZero(&c.BaseURL, unredactURL(cfg.BaseURL))
+	for k, vv := range cfg.Headers {
+		if vv = unredacted(vv); len(vv) > 0 {
+			if t.Headers == nil {
+				t.Headers = make(http.Header)
+			}
+			t.Headers[k] = vv
+		}
+	}
+	for k, vv := range cfg.QueryParams {
+		if vv = unredacted(vv); len(vv) > 0 {
+			if c.QueryParams == nil {
+				c.QueryParams = make(url.Values)
+			}
+			c.QueryParams[k] = vv
+		}
+	}
+	for k, vv := range cfg.FormData {
+		if vv = unredacted(vv); len(vv) > 0 {
+			if c.FormData == nil {
+				c.FormData = make(url.Values)
+			}
+			c.FormData[k] = vv
+		}
+	}
+	for k, v := range cfg.PathParams {
+		if v != RedactedValue {
+			if c.PathParams == nil {
+				c.PathParams = make(map[string]string)
+			}
+			c.PathParams[k] = v
+		}
+	}
+	if cfg.Timeout != 0 {
+		c.SetTimeout(cfg.Timeout)
+	}
+	if cfg.ProxyURL != "" {
+		u, err := url.Parse(cfg.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("req: invalid proxy url in client config: %w", err)
+		}
+		c.SetProxyURL(unredactURL(u.String()))
+	}
+	if cfg.TLS.InsecureSkipVerify || cfg.TLS.ServerName != "" || cfg.TLS.MinVersion != 0 ||
+		cfg.TLS.MaxVersion != 0 || len(cfg.TLS.NextProtos) > 0 {
+		tlsConfig := c.GetTLSClientConfig()
+		setNonZero(&tlsConfig.InsecureSkipVerify, cfg.TLS.InsecureSkipVerify)
+		setNonZero(&tlsConfig.ServerName, cfg.TLS.ServerName)
+		setNonZero(&tlsConfig.MinVersion, cfg.TLS.MinVersion)
+		setNonZero(&tlsConfig.MaxVersion, cfg.TLS.MaxVersion)
+		if len(cfg.TLS.NextProtos) > 0 {
+			tlsConfig.NextProtos = cloneSlice(cfg.TLS.NextProtos)
+		}
+	}
+	if cfg.HTTP3 {
+		c.EnableHTTP3()
+	}
+	switch httpVersion(cfg.HTTPVersion) {
+	case "":
+	case h1:
+		c.EnableForceHTTP1()
+	case h2:
+		c.EnableForceHTTP2()
+	case h3:
+		c.EnableForceHTTP3()
+	default:
+		return nil, fmt.Errorf("req: unknown http version %q in client config", cfg.HTTPVersion)
+	}
+	setNonZero(&c.DebugLog, cfg.DebugLog)
+	setNonZero(&c.AllowGetMethodPayload, cfg.AllowGetMethodPayload)
+	setNonZero(&c.disableAutoReadResponse, cfg.DisableAutoReadResponse)
+	setNonZero(&t.disableAutoDecode, cfg.DisableAutoDecode)
+	if cfg.DisableCookieJar {
+		c.SetCookieJar(nil)
+	}
+	if cfg.Retry.Count != 0 {
+		c.SetCommonRetryCount(cfg.Retry.Count)
+	}
+	if len(cfg.Retry.StatusCodes) > 0 {
+		c.getRetryOption().RetryStatusCodes = cloneSlice(cfg.Retry.StatusCodes)
+	}
+	for _, r := range cfg.Retry.StatusRange {
+		c.getRetryOption().RetryStatusRanges = append(c.getRetryOption().RetryStatusRanges, statusRange{r[0], r[1]})
+	}
+	tc := cfg.Transport
+	setNonZero(&t.MaxIdleConns, tc.MaxIdleConns)
+	setNonZero(&t.MaxIdleConnsPerHost, tc.MaxIdleConnsPerHost)
+	setNonZero(&t.MaxConnsPerHost, tc.MaxConnsPerHost)
+	setNonZero(&t.IdleConnTimeout, tc.IdleConnTimeout)
+	setNonZero(&t.TLSHandshakeTimeout, tc.TLSHandshakeTimeout)
+	setNonZero(&t.ResponseHeaderTimeout, tc.ResponseHeaderTimeout)
+	setNonZero(&t.ExpectContinueTimeout, tc.ExpectContinueTimeout)
+	setNonZero(&t.PriorityAging, tc.PriorityAging)
+	setNonZero(&t.DisableKeepAlives, tc.DisableKeepAlives)
+	setNonZero(&t.DisableCompression, tc.DisableCompression)
+	setNonZero(&t.MaxResponseHeaderBytes, tc.MaxResponseHeaderBytes)
+	setNonZero(&t.WriteBufferSize, tc.WriteBufferSize)
+	setNonZero(&t.ReadBufferSize, tc.ReadBufferSize)
+	return c, nil
+}
+
+// setNonZero sets v to dst unless v is the zero value.
+func setNonZero[T comparable](dst *T, v T) {
+	var zero T
+	if v != zero {
+		*dst = v
+	}
+}
+
+// unredactURL removes the masked password of the URL.
+func unredactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || u.User == nil {
+		return s
+	}
+	if password, ok := u.User.Password(); ok && password == "xxxxx" {
+		u.User = url.User(u.User.Username())
+	}
+	return u.String()
+}
+
+func unredacted(values []string) []string {
+	var vv []string
+	for _, v := range values {
+		if v != RedactedValue {
+			vv = append(vv, v)
+		}
+	}
+	return vv
+}
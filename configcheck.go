@@ -0,0 +1,233 @@
+package req
+
+import (
+	"crypto/tls"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/imroc/req/v3/internal/header"
+)
+
+// ConfigSeverity is the severity of the ConfigIssue.
+type ConfigSeverity int
+
+const (
+	// ConfigSeverityWarning means the options work, but some of them are
+	// ignored or overridden.
+	ConfigSeverityWarning ConfigSeverity = iota + 1
+	// ConfigSeverityError means the requests can not succeed with the
+	// options.
+	ConfigSeverityError
+)
+
+func (s ConfigSeverity) String() string {
+	switch s {
+	case ConfigSeverityWarning:
+		return "warning"
+	case ConfigSeverityError:
+		return "error"
+	}
+	return fmt.Sprintf("severity(%d)", int(s))
+}
+
+// The codes of the ConfigIssue, which are stable across versions.
+const (
+	ConfigIssueForceHTTP1WithHTTP3          = "force-http1-with-http3"
+	ConfigIssueForceHTTP2WithHTTP3          = "force-http2-with-http3"
+	ConfigIssueForceHTTP1WithH2C            = "force-http1-with-h2c"
+	ConfigIssueProxyWithHTTP3               = "proxy-with-http3"
+	ConfigIssueTLSFingerprintWithHTTP3      = "tls-fingerprint-with-http3"
+	ConfigIssueTLSFingerprintWithDialTLS    = "tls-fingerprint-with-dial-tls"
+	ConfigIssueTLSVersionRange              = "tls-version-range"
+	ConfigIssueInsecureSkipVerifyWithRootCA = "insecure-skip-verify-with-root-ca"
+	ConfigIssueMaxIdleConnsPerHost          = "max-idle-conns-per-host"
+	ConfigIssueIdleConnsWithoutKeepAlive    = "idle-conns-without-keep-alive"
+	ConfigIssueResponseHeaderTimeout        = "response-header-timeout"
+	ConfigIssueImpersonateUserAgent         = "impersonate-user-agent"
+	ConfigIssueImpersonateWithForceHTTP1    = "impersonate-with-force-http1"
+	ConfigIssueImpersonateWithClientHello   = "impersonate-with-client-hello"
+	ConfigIssueDigestAuthWithAuthorization  = "digest-auth-with-authorization"
+	ConfigIssueHTTP3DatagramsWithQUICConfig = "http3-datagrams-with-quic-config"
+)
+
+// ConfigIssue is the conflict of the client options reported by
+// Client.Validate.
+type ConfigIssue struct {
+	// Code is the stable identifier of the issue, e.g.
+	// ConfigIssueForceHTTP1WithHTTP3.
+	Code     string
+	Severity ConfigSeverity
+	// Message names the conflicting options and the consequence.
+	Message string
+}
+
+func (i ConfigIssue) String() string {
+	return fmt.Sprintf("%s [%s]: %s", i.Severity, i.Code, i.Message)
+}
+
+// ConfigError is returned by the requests of the client with the strict
+// config (see Client.EnableStrictConfig) if any of the options conflict.
+type ConfigError struct {
+	Issues []ConfigIssue
+}
+
+func (e *ConfigError) Error() string {
+	issues := make([]string, len(e.Issues))
+	for i, issue := range e.Issues {
+		issues[i] = issue.String()
+	}
+	return "req: conflicting client options: " + strings.Join(issues, "; ")
+}
+
+// configWarnings caches the issues of the client options, which are
+// validated again only if the options change (see Transport.configChanged),
+// and records the codes of the issues which have been logged.
+type configWarnings struct {
+	mu        sync.Mutex
+	transport *Transport
+	gen       uint64
+	issues    []ConfigIssue
+	warned    map[string]bool
+}
+
+// EnableStrictConfig fails the requests with ConfigError before they are
+// sent if any of the client options conflict (see Validate), rather than
+// logging the warnings.
+func (c *Client) EnableStrictConfig() *Client {
+	c.strictConfig = true
+	return c
+}
+
+// DisableStrictConfig logs the warnings of the conflicting client options
+// rather than failing the requests (see EnableStrictConfig), which is the
+// default.
+func (c *Client) DisableStrictConfig() *Client {
+	c.strictConfig = false
+	return c
+}
+
+// Validate reports the conflicting client options, some of which would be
+// ignored or overridden silently, e.g. EnableForceHTTP1 with EnableHTTP3.
+// It's called before the requests once the options are changed by the
+// setters, the issues are logged as warnings once for each code, or fail the
+// requests with the strict config (see EnableStrictConfig). It reports nil if
+// no option conflicts.
+func (c *Client) Validate() []ConfigIssue {
+	var issues []ConfigIssue
+	add := func(code string, severity ConfigSeverity, format string, a ...any) {
+		issues = append(issues, ConfigIssue{Code: code, Severity: severity, Message: fmt.Sprintf(format, a...)})
+	}
+	t := c.Transport
+	http3 := t.t3 != nil
+	switch t.forceHttpVersion {
+	case h1:
+		if http3 {
+			add(ConfigIssueForceHTTP1WithHTTP3, ConfigSeverityWarning, "EnableForceHTTP1 prevents EnableHTTP3 from using HTTP3")
+		}
+		if t.Options.EnableH2C {
+			add(ConfigIssueForceHTTP1WithH2C, ConfigSeverityWarning, "EnableForceHTTP1 prevents EnableH2C from using HTTP2 over TCP")
+		}
+		if c.impersonate != "" {
+			add(ConfigIssueImpersonateWithForceHTTP1, ConfigSeverityWarning, "EnableForceHTTP1 prevents the HTTP2 fingerprint of Impersonate%s from being used, the browser negotiates HTTP2", impersonateName(c.impersonate))
+		}
+	case h2:
+		if http3 {
+			add(ConfigIssueForceHTTP2WithHTTP3, ConfigSeverityWarning, "EnableForceHTTP2 prevents EnableHTTP3 from using HTTP3")
+		}
+	}
+	if http3 && t.forceHttpVersion != h1 && t.forceHttpVersion != h2 {
+		if c.proxyURL != "" {
+			add(ConfigIssueProxyWithHTTP3, ConfigSeverityWarning, "EnableHTTP3 bypasses SetProxyURL, the HTTP3 requests are not sent through the proxy")
+		}
+		if c.utlsEnabled {
+			add(ConfigIssueTLSFingerprintWithHTTP3, ConfigSeverityWarning, "SetTLSFingerprint (or ImpersonateXXX) is not applied to the HTTP3 of EnableHTTP3, which uses the TLS fingerprint of Go")
+		}
+	}
+	if http3 && t.http3Datagrams && t.http3QUICConfig != nil && !t.http3QUICConfig.EnableDatagrams {
+		add(ConfigIssueHTTP3DatagramsWithQUICConfig, ConfigSeverityError, "EnableHTTP3Datagrams requires the EnableDatagrams of SetHTTP3QUICConfig, the HTTP3 requests fail")
+	}
+	if t.TLSHandshakeContext != nil && t.DialTLSContext != nil && !t.Options.EnableH2C {
+		add(ConfigIssueTLSFingerprintWithDialTLS, ConfigSeverityWarning, "SetDialTLS bypasses the TLS handshake of SetTLSFingerprint (or SetTLSHandshake)")
+	}
+	if cfg := t.TLSClientConfig; cfg != nil {
+		if cfg.MaxVersion != 0 && cfg.MinVersion > cfg.MaxVersion {
+			add(ConfigIssueTLSVersionRange, ConfigSeverityError, "the MinVersion %s of SetTLSClientConfig is greater than the MaxVersion %s, no TLS version can be negotiated",
+				tls.VersionName(cfg.MinVersion), tls.VersionName(cfg.MaxVersion))
+		}
+		if cfg.InsecureSkipVerify && cfg.RootCAs != nil {
+			add(ConfigIssueInsecureSkipVerifyWithRootCA, ConfigSeverityWarning, "EnableInsecureSkipVerify makes the root certificates of SetRootCertsFromFile (or SetRootCertFromString) unused")
+		}
+	}
+	if t.MaxIdleConns > 0 && t.MaxIdleConnsPerHost > t.MaxIdleConns {
+		add(ConfigIssueMaxIdleConnsPerHost, ConfigSeverityWarning, "the MaxIdleConnsPerHost (%d) of the transport is greater than SetMaxIdleConns (%d), which limits the idle connections of each host too",
+			t.MaxIdleConnsPerHost, t.MaxIdleConns)
+	}
+	if t.DisableKeepAlives && t.MaxIdleConnsPerHost > 0 {
+		add(ConfigIssueIdleConnsWithoutKeepAlive, ConfigSeverityWarning, "DisableKeepAlives makes the MaxIdleConnsPerHost of the transport unused, no connection is kept idle")
+	}
+	if timeout := c.httpClient.Timeout; timeout > 0 && t.ResponseHeaderTimeout > timeout {
+		add(ConfigIssueResponseHeaderTimeout, ConfigSeverityWarning, "SetResponseHeaderTimeout (%s) is longer than SetTimeout (%s), which is never reached",
+			t.ResponseHeaderTimeout, timeout)
+	}
+	if c.impersonate != "" {
+		name := impersonateName(c.impersonate)
+		if ua := c.Headers.Get(header.UserAgent); ua != "" && !strings.Contains(ua, name+"/") {
+			add(ConfigIssueImpersonateUserAgent, ConfigSeverityWarning, "SetUserAgent (or SetCommonHeader) sets the User-Agent %q which does not match Impersonate%s", ua, name)
+		}
+		if c.getClientHelloSpecFunc() != nil {
+			add(ConfigIssueImpersonateWithClientHello, ConfigSeverityWarning, "SetClientHelloSpecFunc overrides the TLS fingerprint of Impersonate%s", name)
+		}
+	}
+	if c.digestAuth != nil && c.Headers.Get(header.Authorization) != "" {
+		add(ConfigIssueDigestAuthWithAuthorization, ConfigSeverityWarning, "SetCommonDigestAuth overrides the Authorization header of SetCommonBasicAuth (or SetCommonBearerAuthToken, SetCommonHeader) once challenged")
+	}
+	return issues
+}
+
+// checkConfig validates the client options before sending the request, it
+// returns ConfigError with the strict config, otherwise logs the issues
+// which have not been logged. The issues are cached until the options are
+// changed by the setters.
+func (c *Client) checkConfig() error {
+	w := c.configWarnings
+	if w == nil {
+		return nil
+	}
+	gen := c.Transport.configGen.Load()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.transport != c.Transport || w.gen != gen {
+		w.transport, w.gen, w.issues = c.Transport, gen, c.Validate()
+	}
+	if len(w.issues) == 0 {
+		return nil
+	}
+	if c.strictConfig {
+		return &ConfigError{Issues: w.issues}
+	}
+	if w.warned == nil {
+		w.warned = make(map[string]bool)
+	}
+	for _, issue := range w.issues {
+		if w.warned[issue.Code] {
+			continue
+		}
+		w.warned[issue.Code] = true
+		if issue.Severity == ConfigSeverityError {
+			c.log.Errorf("conflicting client options: %s", issue)
+		} else {
+			c.log.Warnf("conflicting client options: %s", issue)
+		}
+	}
+	return nil
+}
+
+// impersonateName returns the browser name of the impersonation, e.g.
+// "Chrome" of "chrome".
+func impersonateName(impersonate string) string {
+	if impersonate == "" {
+		return ""
+	}
+	return strings.ToUpper(impersonate[:1]) + impersonate[1:]
+}
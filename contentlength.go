@@ -0,0 +1,128 @@
+package req
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ContentLengthMismatchError is returned when reading the response body if
+// the number of bytes received does not match the expected length, which
+// usually means the response is truncated, see
+// Request.SetExpectedContentLength and Request.SetExpectedDecompressedLength.
+type ContentLengthMismatchError struct {
+	// Expected is the expected length.
+	Expected int64
+	// Actual is the number of bytes received.
+	Actual int64
+	// Decompressed reports whether the lengths are of the decompressed body,
+	// otherwise they are of the body on the wire.
+	Decompressed bool
+}
+
+func (e *ContentLengthMismatchError) Error() string {
+	kind := "content length"
+	if e.Decompressed {
+		kind = "decompressed content length"
+	}
+	return fmt.Sprintf("req: %s mismatch: expected %d bytes, received %d bytes", kind, e.Expected, e.Actual)
+}
+
+// SetExpectedContentLength set the expected length of the response body on
+// the wire (before decompression). After the body is fully read, reading the
+// body fails with ContentLengthMismatchError if the number of bytes received
+// does not match n, or the Content-Length header of the response if present,
+// which catches the truncated responses that otherwise look successful. It
+// works for both the in-memory body and the download (see
+// Request.SetOutputFile).
+func (r *Request) SetExpectedContentLength(n int64) *Request {
+	r.getExpectedLength().wire = n
+	return r
+}
+
+// SetExpectedDecompressedLength is similar to SetExpectedContentLength, but
+// validates the length of the response body after decompression, which is
+// the same as the length on the wire if the body is not compressed.
+func (r *Request) SetExpectedDecompressedLength(n int64) *Request {
+	r.getExpectedLength().decompressed = n
+	return r
+}
+
+func (r *Request) getExpectedLength() *expectedLength {
+	if r.expectedLength == nil {
+		r.expectedLength = &expectedLength{wire: -1, decompressed: -1}
+	}
+	return r.expectedLength
+}
+
+// expectedLength is the expected lengths of the response body, -1 if not
+// expected.
+type expectedLength struct {
+	wire         int64
+	decompressed int64
+}
+
+func (e *expectedLength) wrapWire(resp *Response, rc io.ReadCloser) io.ReadCloser {
+	return &lengthCheckReader{
+		ReadCloser: rc,
+		check: func(n int64) error {
+			if n != e.wire {
+				return &ContentLengthMismatchError{Expected: e.wire, Actual: n}
+			}
+			// the Content-Length header is removed if the body is
+			// decompressed, check the received one.
+			if cl, ok := resp.receivedContentLength(); ok && n != cl {
+				return &ContentLengthMismatchError{Expected: cl, Actual: n}
+			}
+			return nil
+		},
+	}
+}
+
+func (e *expectedLength) wrapDecompressed(rc io.ReadCloser) io.ReadCloser {
+	return &lengthCheckReader{
+		ReadCloser: rc,
+		check: func(n int64) error {
+			if n != e.decompressed {
+				return &ContentLengthMismatchError{Expected: e.decompressed, Actual: n, Decompressed: true}
+			}
+			return nil
+		},
+	}
+}
+
+// receivedContentLength returns the Content-Length header as received.
+func (r *Response) receivedContentLength() (int64, bool) {
+	for _, f := range r.rawHeaders.Fields {
+		if strings.EqualFold(f.Key, "Content-Length") {
+			n, err := strconv.ParseInt(strings.TrimSpace(f.Value), 10, 64)
+			return n, err == nil
+		}
+	}
+	return 0, false
+}
+
+// lengthCheckReader counts the bytes read, and checks the count when the
+// body is fully read, the error of the check is returned instead of io.EOF.
+type lengthCheckReader struct {
+	io.ReadCloser
+	n     int64
+	check func(n int64) error
+	err   error
+}
+
+func (r *lengthCheckReader) Read(p []byte) (n int, err error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	n, err = r.ReadCloser.Read(p)
+	r.n += int64(n)
+	if err == io.EOF {
+		if e := r.check(r.n); e != nil {
+			r.err = e
+			return n, e
+		}
+	}
+	return
+}
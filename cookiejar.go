@@ -0,0 +1,123 @@
+package req
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// CookieJar is the context-aware and fallible version of http.CookieJar,
+// which makes it possible to implement a cookie jar backed by external
+// storage (e.g. Redis or database) correctly. The context of the request
+// is passed to the jar, including the requests of redirect hops.
+type CookieJar interface {
+	// SetCookies handles the receipt of the cookies in a reply for the
+	// given URL.
+	SetCookies(ctx context.Context, u *url.URL, cookies []*http.Cookie) error
+	// Cookies returns the cookies to send in a request for the given URL.
+	Cookies(ctx context.Context, u *url.URL) ([]*http.Cookie, error)
+}
+
+// CookieJarErrorPolicy controls how the errors returned by CookieJar are
+// handled.
+type CookieJarErrorPolicy int
+
+const (
+	// CookieJarErrorAsError aborts the request and returns the cookie jar error
+	// as the request error, which is the default policy.
+	CookieJarErrorAsError CookieJarErrorPolicy = iota
+	// CookieJarErrorAsWarning logs the cookie jar error as a warning and
+	// continues the request without the cookies.
+	CookieJarErrorAsWarning
+)
+
+// CookieJarError is the error returned by CookieJar.
+type CookieJarError struct {
+	// Op is the failed operation, "Cookies" or "SetCookies".
+	Op  string
+	URL *url.URL
+	Err error
+}
+
+func (e *CookieJarError) Error() string {
+	return fmt.Sprintf("cookie jar %s %s: %s", e.Op, e.URL.Redacted(), e.Err.Error())
+}
+
+func (e *CookieJarError) Unwrap() error {
+	return e.Err
+}
+
+// AdaptCookieJar adapts the plain http.CookieJar to CookieJar, which never
+// returns errors and ignores the context.
+func AdaptCookieJar(jar http.CookieJar) CookieJar {
+	if jar == nil {
+		return nil
+	}
+	return stdCookieJar{jar}
+}
+
+type stdCookieJar struct {
+	http.CookieJar
+}
+
+func (j stdCookieJar) SetCookies(ctx context.Context, u *url.URL, cookies []*http.Cookie) error {
+	j.CookieJar.SetCookies(u, cookies)
+	return nil
+}
+
+func (j stdCookieJar) Cookies(ctx context.Context, u *url.URL) ([]*http.Cookie, error) {
+	return j.CookieJar.Cookies(u), nil
+}
+
+// cookieJarTransport sends and stores cookies with the CookieJar for each hop
+// of the request (including redirect hops), so that the context of the request
+// is passed to the jar and the jar errors can be surfaced.
+type cookieJarTransport struct {
+	rt http.RoundTripper
+	c  *Client
+}
+
+func (t *cookieJarTransport) handleError(err *CookieJarError) error {
+	if t.c.cookieJarErrorPolicy == CookieJarErrorAsWarning {
+		t.c.log.Warnf("%s", err.Error())
+		return nil
+	}
+	return err
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *cookieJarTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	jar := t.c.cookieJar
+	ctx := req.Context()
+	cookies, err := jar.Cookies(ctx, req.URL)
+	if err != nil {
+		if err = t.handleError(&CookieJarError{Op: "Cookies", URL: req.URL, Err: err}); err != nil {
+			if req.Body != nil {
+				req.Body.Close()
+			}
+			return nil, err
+		}
+	}
+	if len(cookies) > 0 {
+		r := *req
+		r.Header = req.Header.Clone()
+		for _, cookie := range cookies {
+			r.AddCookie(cookie)
+		}
+		req = &r
+	}
+	resp, err := t.rt.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if rc := resp.Cookies(); len(rc) > 0 {
+		if err = jar.SetCookies(ctx, req.URL, rc); err != nil {
+			if err = t.handleError(&CookieJarError{Op: "SetCookies", URL: req.URL, Err: err}); err != nil {
+				resp.Body.Close()
+				return nil, err
+			}
+		}
+	}
+	return resp, nil
+}
@@ -0,0 +1,265 @@
+package req
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/imroc/req/v3/internal/netutil"
+	"golang.org/x/net/html"
+)
+
+// CSRFSource is where the CSRF token is extracted from the response.
+type CSRFSource int
+
+const (
+	// FromCookie extracts the CSRF token from the cookie with the name.
+	FromCookie CSRFSource = iota
+	// FromHeader extracts the CSRF token from the response header with the name.
+	FromHeader
+	// FromHTMLMeta extracts the CSRF token from the content of the HTML
+	// <meta> element with the name, e.g. <meta name="csrf-token" content="...">.
+	FromHTMLMeta
+	// FromHTMLInput extracts the CSRF token from the value of the HTML
+	// <input> element with the name, e.g. <input type="hidden" name="_csrf" value="...">.
+	FromHTMLInput
+)
+
+// CSRFTarget is where the CSRF token is attached to the request.
+type CSRFTarget int
+
+const (
+	// CSRFToHeader attaches the CSRF token as a request header.
+	CSRFToHeader CSRFTarget = iota
+	// CSRFToFormField attaches the CSRF token as a form field, only if the
+	// request has form data or multipart form data.
+	CSRFToFormField
+)
+
+// DefaultCSRFHeader is the default header name which the CSRF token is
+// attached as.
+const DefaultCSRFHeader = "X-CSRF-Token"
+
+type csrfExtractor struct {
+	source     CSRFSource
+	name       string
+	target     CSRFTarget
+	targetName string
+
+	mu sync.RWMutex
+	// tokens are the tokens of the origins which they are extracted from,
+	// which are only attached to the requests to the same origin.
+	tokens map[string]string
+	latest string
+}
+
+func (e *csrfExtractor) Clone() *csrfExtractor {
+	if e == nil {
+		return nil
+	}
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return &csrfExtractor{
+		source:     e.source,
+		name:       e.name,
+		target:     e.target,
+		targetName: e.targetName,
+		tokens:     cloneMap(e.tokens),
+		latest:     e.latest,
+	}
+}
+
+func (e *csrfExtractor) getToken(origin string) string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.tokens[origin]
+}
+
+func (e *csrfExtractor) setToken(origin, token string) {
+	e.mu.Lock()
+	if e.tokens == nil {
+		e.tokens = make(map[string]string)
+	}
+	e.tokens[origin] = token
+	e.latest = token
+	e.mu.Unlock()
+}
+
+// csrfOrigin returns the origin which the CSRF token is scoped to.
+func csrfOrigin(u *url.URL) string {
+	return netutil.AuthorityKey(&url.URL{Scheme: strings.ToLower(u.Scheme), Host: strings.ToLower(u.Host)})
+}
+
+func (e *csrfExtractor) extract(resp *Response) string {
+	switch e.source {
+	case FromCookie:
+		for _, cookie := range resp.Cookies() {
+			if cookie.Name == e.name {
+				return cookie.Value
+			}
+		}
+	case FromHeader:
+		return resp.Header.Get(e.name)
+	case FromHTMLMeta:
+		return e.extractFromHTML(resp, "meta", "content")
+	case FromHTMLInput:
+		return e.extractFromHTML(resp, "input", "value")
+	}
+	return ""
+}
+
+func (e *csrfExtractor) extractFromHTML(resp *Response, tag, valueAttr string) string {
+	// only extract from the auto-read body, never consume the streamed body.
+	if len(resp.body) == 0 || !strings.Contains(resp.GetContentType(), "html") {
+		return ""
+	}
+	z := html.NewTokenizer(bytes.NewReader(resp.body))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return ""
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			if string(name) != tag || !hasAttr {
+				continue
+			}
+			var attrName, value string
+			for hasAttr {
+				var k, v []byte
+				k, v, hasAttr = z.TagAttr()
+				switch string(k) {
+				case "name":
+					attrName = string(v)
+				case valueAttr:
+					value = string(v)
+				}
+			}
+			if attrName == e.name {
+				return value
+			}
+		}
+	}
+}
+
+// SetCSRFTokenExtractor enables extracting the CSRF token from each response,
+// and attaching the latest token to subsequent requests to the same origin
+// (scheme, host and port) which the token is extracted from, which automates
+// the token-relay pattern of form-based auth. The token attached as a header
+// is removed when redirected to another origin. The name is the cookie name, the
+// header name, or the value of `name` attribute of the HTML <meta> or <input>
+// element according to the source. The token is attached as the
+// "X-CSRF-Token" header by default, use SetCSRFTokenTarget to customize it.
+func (c *Client) SetCSRFTokenExtractor(source CSRFSource, name string) *Client {
+	e := &csrfExtractor{
+		source:     source,
+		name:       name,
+		target:     CSRFToHeader,
+		targetName: DefaultCSRFHeader,
+	}
+	if c.csrf != nil {
+		e.target = c.csrf.target
+		e.targetName = c.csrf.targetName
+	}
+	c.csrf = e
+	return c
+}
+
+// SetCSRFTokenTarget set where the CSRF token extracted by the extractor set
+// by SetCSRFTokenExtractor is attached to, as a header or as a form field
+// with the name.
+func (c *Client) SetCSRFTokenTarget(target CSRFTarget, name string) *Client {
+	if c.csrf == nil {
+		c.log.Warnf("ignore SetCSRFTokenTarget, call SetCSRFTokenExtractor first")
+		return c
+	}
+	c.csrf.target = target
+	c.csrf.targetName = name
+	return c
+}
+
+// GetCSRFToken returns the latest CSRF token extracted by the extractor set
+// by SetCSRFTokenExtractor, which may be extracted from any origin.
+func (c *Client) GetCSRFToken() string {
+	if c.csrf == nil {
+		return ""
+	}
+	c.csrf.mu.RLock()
+	defer c.csrf.mu.RUnlock()
+	return c.csrf.latest
+}
+
+// attachCSRFToken attaches the token of the origin of the request, the url is
+// resolved without modifying the request, which is parsed by parseRequestURL
+// later.
+func attachCSRFToken(c *Client, r *Request) error {
+	if c.csrf == nil {
+		return nil
+	}
+	u, err := buildRequestURL(c, r)
+	if err != nil {
+		return nil // reported by parseRequestURL.
+	}
+	token := c.csrf.getToken(csrfOrigin(u))
+	if token == "" {
+		return nil
+	}
+	name := c.csrf.targetName
+	switch c.csrf.target {
+	case CSRFToHeader:
+		if r.Headers.Get(name) == "" {
+			r.SetHeader(name, token)
+		}
+	case CSRFToFormField:
+		if c.isPayloadForbid(r) {
+			return nil
+		}
+		if len(r.OrderedFormData) > 0 {
+			for i := 0; i < len(r.OrderedFormData); i += 2 {
+				if r.OrderedFormData[i] == name {
+					return nil
+				}
+			}
+			r.OrderedFormData = append(r.OrderedFormData, name, token)
+		} else if len(r.FormData) > 0 || len(c.FormData) > 0 || r.isMultiPart {
+			if r.FormData == nil {
+				r.FormData = url.Values{}
+			}
+			if r.FormData.Get(name) == "" {
+				r.FormData.Set(name, token)
+			}
+		}
+	}
+	return nil
+}
+
+func extractCSRFToken(c *Client, r *Response) error {
+	if c.csrf == nil || r.Err != nil || r.Response == nil || r.Response.Request == nil {
+		return nil
+	}
+	if token := c.csrf.extract(r); token != "" {
+		// the origin which actually responded, which may be redirected to.
+		c.csrf.setToken(csrfOrigin(r.Response.Request.URL), token)
+	}
+	return nil
+}
+
+// stripCSRFToken replaces the CSRF token header of the redirect request to
+// another origin with the token of that origin, or removes it. The headers
+// of each redirect request are copied from the original request.
+func (c *Client) stripCSRFToken(req *http.Request, via []*http.Request) {
+	if c.csrf == nil || c.csrf.target != CSRFToHeader || len(via) == 0 {
+		return
+	}
+	name := c.csrf.targetName
+	prev, origin := csrfOrigin(via[0].URL), csrfOrigin(req.URL)
+	if prev == origin || req.Header.Get(name) != c.csrf.getToken(prev) {
+		return
+	}
+	if token := c.csrf.getToken(origin); token != "" {
+		req.Header.Set(name, token)
+	} else {
+		req.Header.Del(name)
+	}
+}
@@ -1,9 +1,11 @@
 package req
 
 import (
-	"github.com/imroc/req/v3/internal/charsets"
+	"context"
 	"io"
 	"strings"
+
+	"github.com/imroc/req/v3/internal/charsets"
 )
 
 var textContentTypes = []string{"text", "json", "xml", "html", "java"}
@@ -30,13 +32,14 @@ func (d *decodeReaderCloser) Read(p []byte) (n int, err error) {
 	return d.decodeReader.Read(p)
 }
 
-func newAutoDecodeReadCloser(input io.ReadCloser, t *Transport) *autoDecodeReadCloser {
-	return &autoDecodeReadCloser{ReadCloser: input, t: t}
+func newAutoDecodeReadCloser(ctx context.Context, input io.ReadCloser, t *Transport) *autoDecodeReadCloser {
+	return &autoDecodeReadCloser{ReadCloser: input, t: t, ctx: ctx}
 }
 
 type autoDecodeReadCloser struct {
 	io.ReadCloser
 	t            *Transport
+	ctx          context.Context
 	decodeReader io.Reader
 	detected     bool
 	peek         []byte
@@ -52,9 +55,7 @@ func (a *autoDecodeReadCloser) peekRead(p []byte) (n int, err error) {
 	if enc == nil {
 		return
 	}
-	if a.t.Debugf != nil {
-		a.t.Debugf("charset %s found in body's meta, auto-decode to utf-8", name)
-	}
+	a.t.DebugfContext(a.ctx, "charset %s found in body's meta, auto-decode to utf-8", name)
 	dc := enc.NewDecoder()
 	a.decodeReader = dc.Reader(a.ReadCloser)
 	var pp []byte
@@ -0,0 +1,131 @@
+package req
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// DecodeRequestBody reads the body of the request and decodes it according
+// to the Content-Encoding header, which is useful on the server side of the
+// tests to verify the compressed request body. The gzip (and x-gzip),
+// deflate (both zlib wrapped and raw), br and zstd are supported, the
+// multiple encodings (e.g. "gzip, br") are decoded in the reverse order.
+// The concatenated gzip members and zstd frames are decoded as a whole. The
+// body is consumed and closed.
+func DecodeRequestBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil {
+		return nil, nil
+	}
+	defer r.Body.Close()
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	if b, err = decodeContent(b, r.Header.Values("Content-Encoding")); err != nil {
+		return nil, fmt.Errorf("req: %w", err)
+	}
+	return b, nil
+}
+
+// contentEncodings returns the content codings of the Content-Encoding
+// header values in the order they are applied.
+func contentEncodings(values []string) []string {
+	var encodings []string
+	for _, v := range values {
+		for _, ce := range strings.Split(v, ",") {
+			if ce = strings.ToLower(strings.TrimSpace(ce)); ce != "" && ce != "identity" {
+				encodings = append(encodings, ce)
+			}
+		}
+	}
+	return encodings
+}
+
+// decodeContent decodes b encoded with the Content-Encoding header values.
+func decodeContent(b []byte, values []string) ([]byte, error) {
+	encodings := contentEncodings(values)
+	for i := len(encodings) - 1; i >= 0; i-- {
+		var err error
+		if b, err = decodeContentEncoding(b, encodings[i]); err != nil {
+			return nil, fmt.Errorf("failed to decode %s content: %w", encodings[i], err)
+		}
+	}
+	return b, nil
+}
+
+func decodeContentEncoding(b []byte, encoding string) ([]byte, error) {
+	var r io.Reader
+	switch encoding {
+	case "gzip", "x-gzip":
+		gr, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+		r = gr
+	case "deflate":
+		// "deflate" is the zlib format (RFC 9110), but the raw deflate
+		// is also sent by some implementations.
+		if isZlibHeader(b) {
+			zr, err := zlib.NewReader(bytes.NewReader(b))
+			if err != nil {
+				return nil, err
+			}
+			r = zr
+		} else {
+			r = flate.NewReader(bytes.NewReader(b))
+		}
+	case "br":
+		r = brotli.NewReader(bytes.NewReader(b))
+	case "zstd":
+		zr, err := zstd.NewReader(bytes.NewReader(b), zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		r = zr
+	default:
+		return nil, fmt.Errorf("unsupported content encoding %q", encoding)
+	}
+	return io.ReadAll(r)
+}
+
+// isZlibHeader reports whether b starts with the zlib header (RFC 1950),
+// whose compression method is deflate and check bits are valid.
+func isZlibHeader(b []byte) bool {
+	return len(b) >= 2 && b[0]&0x0f == 8 && b[0]>>4 <= 7 && (uint16(b[0])<<8|uint16(b[1]))%31 == 0
+}
+
+// SetRequestCompressionVerify set whether to verify the compressed request
+// body before sending, the in-memory request body with the Content-Encoding
+// header is decoded as the server would do with DecodeRequestBody, and the
+// request fails without being sent if it can not be decoded, which catches
+// the mismatched Content-Encoding header and the broken compression (e.g.
+// an unflushed writer) early in the tests. The streamed request body is not
+// verified.
+func (c *Client) SetRequestCompressionVerify(verify bool) *Client {
+	c.verifyReqCompression = verify
+	return c
+}
+
+func verifyRequestCompression(c *Client, r *Request) error {
+	if !c.verifyReqCompression || r.Body == nil {
+		return nil
+	}
+	values := r.Headers.Values("Content-Encoding")
+	if len(values) == 0 {
+		return nil
+	}
+	if _, err := decodeContent(r.Body, values); err != nil {
+		return fmt.Errorf("req: request body does not match Content-Encoding %q: %w", strings.Join(values, ", "), err)
+	}
+	return nil
+}
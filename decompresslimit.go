@@ -0,0 +1,140 @@
+package req
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/imroc/req/v3/internal/compress"
+)
+
+const (
+	// DefaultMaxDecompressionRatio is the default max ratio of the
+	// decompressed size to the compressed size of the response body.
+	DefaultMaxDecompressionRatio = 1000
+	// DefaultMaxDecompressedSize is the default max decompressed size of the
+	// response body.
+	DefaultMaxDecompressedSize = 4 << 30
+
+	// decompressionRatioFloor is the decompressed size below which the
+	// ratio is not checked, so that the small and highly compressible
+	// bodies are not rejected.
+	decompressionRatioFloor = 1 << 20
+)
+
+// ErrDecompressionBomb is wrapped by DecompressionBombError, which can be
+// checked with errors.Is.
+var ErrDecompressionBomb = errors.New("decompression bomb")
+
+// DecompressionBombError is returned when reading the automatically
+// decompressed response body beyond the limits, see
+// Client.SetMaxDecompressionRatio and Client.SetMaxDecompressedSize.
+type DecompressionBombError struct {
+	// Compressed is the number of the compressed bytes which have been read.
+	Compressed int64
+	// Decompressed is the number of the decompressed bytes which have been
+	// read.
+	Decompressed int64
+}
+
+func (e *DecompressionBombError) Error() string {
+	return fmt.Sprintf("req: %v: %d compressed bytes are decompressed to more than %d bytes", ErrDecompressionBomb, e.Compressed, e.Decompressed)
+}
+
+func (e *DecompressionBombError) Unwrap() error {
+	return ErrDecompressionBomb
+}
+
+// SetMaxDecompressionRatio set the max ratio of the decompressed size to the
+// compressed size of the response body which is automatically decompressed,
+// reading the body beyond the ratio fails with DecompressionBombError. The
+// ratio is only checked once more than 1MB is decompressed. Default is
+// DefaultMaxDecompressionRatio, zero or negative disables the check.
+func (t *Transport) SetMaxDecompressionRatio(ratio float64) *Transport {
+	t.maxDecompressionRatio = &ratio
+	return t
+}
+
+// SetMaxDecompressedSize set the max decompressed size of the response body
+// which is automatically decompressed, reading the body beyond the size
+// fails with DecompressionBombError. Default is DefaultMaxDecompressedSize,
+// zero or negative disables the check.
+func (t *Transport) SetMaxDecompressedSize(n int64) *Transport {
+	t.maxDecompressedSize = &n
+	return t
+}
+
+// limitDecompression wraps the response body which is decompressed by the
+// transport with the limits, which counts the compressed bytes read by the
+// decompressor and the decompressed bytes read by the consumer, so the
+// limits apply to the unmarshal, the outputs and the dump uniformly.
+func (t *Transport) limitDecompression(res *http.Response) {
+	if !res.Uncompressed {
+		return
+	}
+	ratio, size := float64(DefaultMaxDecompressionRatio), int64(DefaultMaxDecompressedSize)
+	if t.maxDecompressionRatio != nil {
+		ratio = *t.maxDecompressionRatio
+	}
+	if t.maxDecompressedSize != nil {
+		size = *t.maxDecompressedSize
+	}
+	if ratio <= 0 && size <= 0 {
+		return
+	}
+	compressed := &countReadCloser{}
+	switch body := res.Body.(type) {
+	case compress.CompressReader:
+		compressed.ReadCloser = body.GetUnderlyingBody()
+		body.SetUnderlyingBody(compressed)
+	case *gzipReader:
+		compressed.ReadCloser = body.body.body
+		body.body.body = compressed
+	default: // decompressed by the custom round tripper.
+		return
+	}
+	res.Body = &decompressionLimitReader{
+		ReadCloser: res.Body,
+		compressed: compressed,
+		ratio:      ratio,
+		size:       size,
+	}
+}
+
+type countReadCloser struct {
+	io.ReadCloser
+	n int64
+}
+
+func (r *countReadCloser) Read(p []byte) (n int, err error) {
+	n, err = r.ReadCloser.Read(p)
+	r.n += int64(n)
+	return
+}
+
+type decompressionLimitReader struct {
+	io.ReadCloser
+	compressed *countReadCloser
+	ratio      float64
+	size       int64
+	n          int64
+	err        error
+}
+
+func (r *decompressionLimitReader) Read(p []byte) (n int, err error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	n, err = r.ReadCloser.Read(p)
+	r.n += int64(n)
+	exceeded := r.size > 0 && r.n > r.size
+	if !exceeded && r.ratio > 0 && r.n > decompressionRatioFloor {
+		exceeded = float64(r.n) > r.ratio*float64(r.compressed.n)
+	}
+	if exceeded {
+		r.err = &DecompressionBombError{Compressed: r.compressed.n, Decompressed: r.n}
+		return 0, r.err
+	}
+	return
+}
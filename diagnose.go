@@ -0,0 +1,523 @@
+package req
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/imroc/req/v3/internal/http3"
+	"github.com/imroc/req/v3/internal/netutil"
+)
+
+const (
+	// defaultDiagnoseStepTimeout is the timeout of each network step of the
+	// diagnosis, which is shortened by the deadline of the context.
+	defaultDiagnoseStepTimeout = 5 * time.Second
+	// defaultHTTP3BrokenTTL is how long the requests are steered away from
+	// HTTP3 after the HTTP3 diagnosis of the origin failed.
+	defaultHTTP3BrokenTTL = 5 * time.Minute
+	// quicProbeVersion is the reserved QUIC version (RFC 9000 Section 15)
+	// which makes the server reply with the version negotiation packet.
+	quicProbeVersion = 0x1a2a3a4a
+	// quicMinInitialSize is the min size of the UDP datagram of the client
+	// Initial packet, the smaller one is dropped by the server.
+	quicMinInitialSize = 1200
+)
+
+// DiagnosisStep is the result of one step of the connectivity diagnosis.
+type DiagnosisStep struct {
+	// Name is the name of the step, e.g. "dns", "connect", "tls", "udp",
+	// "handshake", "settings" and "request".
+	Name string
+	// Duration is how long the step took.
+	Duration time.Duration
+	// Detail is the human-readable detail of the step, e.g. the resolved
+	// addresses or the response status.
+	Detail string
+	// Err is the failure reason, nil if the step succeeded.
+	Err error
+}
+
+// Diagnosis is the result of the connectivity diagnosis of the origin with
+// one HTTP protocol, the steps are run in order, and stop at the first
+// failed step.
+type Diagnosis struct {
+	// Protocol is the diagnosed protocol, "h1", "h2" or "h3".
+	Protocol string
+	// Origin is the diagnosed origin, e.g. "https://example.com".
+	Origin string
+	// Steps is the results of the steps which have been run.
+	Steps []DiagnosisStep
+}
+
+// OK reports whether all the steps succeeded.
+func (d *Diagnosis) OK() bool {
+	return d.Err() == nil
+}
+
+// Err returns the error of the failed step, nil if all the steps succeeded.
+func (d *Diagnosis) Err() error {
+	for _, s := range d.Steps {
+		if s.Err != nil {
+			return fmt.Errorf("%s %s: %w", d.Protocol, s.Name, s.Err)
+		}
+	}
+	return nil
+}
+
+// String returns the human-readable summary of the diagnosis, one line per
+// step.
+func (d *Diagnosis) String() string {
+	var b strings.Builder
+	result := "ok"
+	if !d.OK() {
+		result = "failed"
+	}
+	fmt.Fprintf(&b, "%s %s: %s\n", d.Protocol, d.Origin, result)
+	for _, s := range d.Steps {
+		status, detail := "ok", s.Detail
+		if s.Err != nil {
+			status = "failed"
+			if detail != "" {
+				detail = s.Err.Error() + " (" + detail + ")"
+			} else {
+				detail = s.Err.Error()
+			}
+		}
+		fmt.Fprintf(&b, "  %-9s %-6s %10s  %s\n", s.Name, status, s.Duration.Round(time.Microsecond), detail)
+	}
+	return b.String()
+}
+
+func (d *Diagnosis) add(name string, start time.Time, detail string, err error) bool {
+	d.Steps = append(d.Steps, DiagnosisStep{Name: name, Duration: time.Since(start), Detail: detail, Err: err})
+	return err == nil
+}
+
+// H3Diagnosis is the result of Client.DiagnoseH3.
+type H3Diagnosis struct {
+	Diagnosis
+	// QUICVersions is the QUIC versions supported by the server, which are
+	// reported by the version negotiation, nil if the server did not reply.
+	QUICVersions []uint32
+	// ICMPUnreachable reports whether the ICMP port unreachable is received
+	// for the UDP port of the origin, that is, the UDP packet reached the
+	// host but nothing listens on the port.
+	ICMPUnreachable bool
+}
+
+// ConnectivityDiagnosis is the result of Client.DiagnoseAll.
+type ConnectivityDiagnosis struct {
+	// HTTP1 and HTTP2 are the diagnosis of HTTP1 and HTTP2, HTTP2 is nil if
+	// the origin is not https and H2C is not enabled.
+	HTTP1, HTTP2 *Diagnosis
+	// HTTP3 is the diagnosis of HTTP3, nil if the origin is not https.
+	HTTP3 *H3Diagnosis
+}
+
+// String returns the human-readable summary of all the diagnosis.
+func (d *ConnectivityDiagnosis) String() string {
+	var b strings.Builder
+	for _, diag := range []*Diagnosis{d.HTTP1, d.HTTP2} {
+		if diag != nil {
+			b.WriteString(diag.String())
+		}
+	}
+	if d.HTTP3 != nil {
+		b.WriteString(d.HTTP3.String())
+	}
+	return b.String()
+}
+
+// parseDiagnoseOrigin parses the origin, the scheme defaults to https.
+func parseDiagnoseOrigin(origin string) (*url.URL, error) {
+	if !strings.Contains(origin, "://") {
+		origin = "https://" + origin
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("req: unsupported scheme %q of origin", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return nil, errors.New("req: missing host of origin")
+	}
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	return u, nil
+}
+
+func diagnoseStepContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, defaultDiagnoseStepTimeout)
+}
+
+// DiagnoseH3 diagnoses the HTTP3 connectivity to the origin (e.g.
+// "https://example.com"), which helps to tell why HTTP3 is slow or
+// unavailable in the network, e.g. the network drops UDP/443. It runs the
+// steps in order with the configuration of the client, each of which has
+// its duration and failure reason reported in H3Diagnosis:
+//   - dns: resolves the host of the origin.
+//   - udp: sends the QUIC packet with the reserved version which makes the
+//     server reply with the version negotiation, which tells whether the
+//     UDP packets reach the server (the server may ignore it, which is not
+//     a failure), or the ICMP port unreachable is received.
+//   - handshake: completes the QUIC and TLS handshake of a new connection.
+//   - settings: receives the HTTP3 SETTINGS of the server.
+//   - request: sends a HEAD request of the path of the origin.
+//
+// Each network step times out after 5 seconds or the deadline of ctx. The
+// returned error is only for the invalid origin, the failure of the steps
+// is reported by H3Diagnosis.Err, and H3Diagnosis.String returns the
+// human-readable summary.
+//
+// The result feeds the HTTP3 fallback of the client: if it failed, the
+// subsequent requests to the origin are steered away from HTTP3 (to HTTP2
+// or HTTP1) for 5 minutes, that is, the alt-svc of the origin is ignored.
+// If it succeeded, the previous mark is cleared.
+func (c *Client) DiagnoseH3(ctx context.Context, origin string) (*H3Diagnosis, error) {
+	u, err := parseDiagnoseOrigin(origin)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "https" {
+		return nil, errors.New("req: http3 requires https origin")
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	d := &H3Diagnosis{Diagnosis: Diagnosis{Protocol: "h3", Origin: u.Scheme + "://" + u.Host}}
+	c.diagnoseH3(ctx, u, d)
+	addr := netutil.AuthorityKey(u)
+	if d.OK() {
+		c.Transport.clearHTTP3Broken(addr)
+	} else {
+		c.Transport.markHTTP3Broken(addr, defaultHTTP3BrokenTTL)
+	}
+	return d, nil
+}
+
+func (c *Client) diagnoseH3(ctx context.Context, u *url.URL, d *H3Diagnosis) {
+	host, port := netutil.AuthorityHostPort(u.Scheme, u.Host)
+	host = strings.Trim(host, "[]")
+
+	start := time.Now()
+	ips, err := diagnoseLookup(ctx, host)
+	if !d.add("dns", start, joinIPs(ips), err) {
+		return
+	}
+
+	start = time.Now()
+	raddr := net.JoinHostPort(ips[0].String(), port)
+	versions, err := c.probeQUICVersions(ctx, raddr)
+	detail := "version negotiation from " + raddr + ": " + formatQUICVersions(versions)
+	switch {
+	case errors.Is(err, syscall.ECONNREFUSED):
+		d.ICMPUnreachable = true
+		err = fmt.Errorf("ICMP port unreachable from %s, nothing listens on the UDP port", raddr)
+		detail = ""
+	case err != nil && isTimeout(err):
+		// the server may ignore the version negotiation, go on.
+		detail = "no reply to version negotiation from " + raddr + ", UDP may be blocked"
+		err = nil
+	}
+	d.QUICVersions = versions
+	if !d.add("udp", start, detail, err) {
+		return
+	}
+
+	t3 := &http3.Transport{Options: &c.Transport.Options, Dial: c.Transport.http3Dial}
+	defer t3.Close()
+	start = time.Now()
+	stepCtx, cancel := diagnoseStepContext(ctx)
+	cc, err := t3.DialConn(stepCtx, u.Host)
+	cancel()
+	detail = ""
+	if err == nil {
+		detail = tls.VersionName(cc.Conn().ConnectionState().TLS.Version)
+	} else if d.QUICVersions == nil && isTimeout(err) {
+		detail = "no reply over UDP, UDP/" + port + " is likely blocked"
+	}
+	if !d.add("handshake", start, detail, err) {
+		return
+	}
+	defer cc.CloseWithError(http3.ErrCodeNoError, "")
+
+	start = time.Now()
+	stepCtx, cancel = diagnoseStepContext(ctx)
+	select {
+	case <-cc.ReceivedSettings():
+		err = nil
+	case <-cc.Context().Done():
+		err = context.Cause(cc.Context())
+	case <-stepCtx.Done():
+		err = stepCtx.Err()
+	}
+	cancel()
+	if !d.add("settings", start, "", err) {
+		return
+	}
+
+	start = time.Now()
+	stepCtx, cancel = diagnoseStepContext(ctx)
+	defer cancel()
+	req, err := http.NewRequestWithContext(stepCtx, http.MethodHead, u.String(), nil)
+	if err == nil {
+		var resp *http.Response
+		if resp, err = cc.RoundTrip(req); err == nil {
+			resp.Body.Close()
+			detail = "HEAD " + u.Path + ": " + resp.Status
+		}
+	}
+	d.add("request", start, detail, err)
+}
+
+// DiagnoseAll diagnoses the connectivity to the origin with HTTP1, HTTP2 and
+// HTTP3 concurrently, which is the connectivity doctor callable from the
+// command line tools. HTTP1 and HTTP2 are diagnosed with the steps "dns",
+// "connect", "tls" (only https) and "request" (a HEAD request of the path
+// of the origin) over a new connection, HTTP3 is diagnosed by DiagnoseH3.
+// HTTP2 is skipped if the origin is not https and H2C is not enabled, and
+// HTTP3 is skipped if the origin is not https.
+func (c *Client) DiagnoseAll(ctx context.Context, origin string) (*ConnectivityDiagnosis, error) {
+	u, err := parseDiagnoseOrigin(origin)
+	if err != nil {
+		return nil, err
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	d := &ConnectivityDiagnosis{}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		d.HTTP1 = c.diagnoseTCP(ctx, u, "h1")
+	}()
+	if u.Scheme == "https" || c.Transport.Options.EnableH2C {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.HTTP2 = c.diagnoseTCP(ctx, u, "h2")
+		}()
+	}
+	if u.Scheme == "https" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.HTTP3, _ = c.DiagnoseH3(ctx, u.String())
+		}()
+	}
+	wg.Wait()
+	return d, nil
+}
+
+func (c *Client) diagnoseTCP(ctx context.Context, u *url.URL, protocol string) *Diagnosis {
+	d := &Diagnosis{Protocol: protocol, Origin: u.Scheme + "://" + u.Host}
+	t := c.Transport.Clone()
+	t.DisableHTTP3()
+	defer t.CloseIdleConnections()
+	if protocol == "h1" {
+		t.EnableForceHTTP1()
+	} else if u.Scheme == "https" {
+		// negotiate h2 with ALPN rather than forcing it, which goes through
+		// the traced TLS handshake, the protocol is checked below.
+		t.DisableForceHttpVersion()
+	} else {
+		t.EnableForceHTTP2()
+	}
+	t.DisableKeepAlives = true
+
+	var (
+		mu    sync.Mutex
+		step  string
+		start = time.Now()
+	)
+	// begin finishes the current step and begins the next step.
+	begin := func(next, detail string, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if step != "" {
+			d.add(step, start, detail, err)
+		}
+		step, start = next, time.Now()
+	}
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { begin("dns", "", nil) },
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			ips := make([]net.IP, 0, len(info.Addrs))
+			for _, addr := range info.Addrs {
+				ips = append(ips, addr.IP)
+			}
+			begin("", joinIPs(ips), info.Err)
+		},
+		ConnectStart: func(network, addr string) { begin("connect", "", nil) },
+		ConnectDone: func(network, addr string, err error) {
+			begin("", network+" "+addr, err)
+		},
+		TLSHandshakeStart: func() { begin("tls", "", nil) },
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			detail := ""
+			if err == nil {
+				detail = tls.VersionName(state.Version) + ", ALPN " + state.NegotiatedProtocol
+			}
+			begin("", detail, err)
+		},
+		GotConn: func(httptrace.GotConnInfo) { begin("request", "", nil) },
+	}
+	stepCtx, cancel := diagnoseStepContext(ctx)
+	defer cancel()
+	req, err := http.NewRequestWithContext(httptrace.WithClientTrace(stepCtx, trace), http.MethodHead, u.String(), nil)
+	if err != nil {
+		d.add("request", start, "", err)
+		return d
+	}
+	resp, err := t.RoundTrip(req)
+	detail := ""
+	if err == nil {
+		resp.Body.Close()
+		detail = "HEAD " + u.Path + ": " + resp.Status
+		if protocol == "h2" && resp.ProtoMajor != 2 {
+			err = fmt.Errorf("server responded with %s", resp.Proto)
+		}
+	}
+	mu.Lock()
+	if step == "" {
+		if err == nil || len(d.Steps) > 0 && d.Steps[len(d.Steps)-1].Err != nil {
+			mu.Unlock()
+			return d
+		}
+		step = "request" // failed before the request is sent.
+	}
+	mu.Unlock()
+	begin("", detail, err)
+	return d
+}
+
+func diagnoseLookup(ctx context.Context, host string) ([]net.IP, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IP{ip}, nil
+	}
+	ctx, cancel := diagnoseStepContext(ctx)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	ips := make([]net.IP, 0, len(addrs))
+	for _, addr := range addrs {
+		ips = append(ips, addr.IP)
+	}
+	return ips, nil
+}
+
+func joinIPs(ips []net.IP) string {
+	ss := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		ss = append(ss, ip.String())
+	}
+	return strings.Join(ss, ", ")
+}
+
+func isTimeout(err error) bool {
+	var ne net.Error
+	return errors.Is(err, context.DeadlineExceeded) || errors.As(err, &ne) && ne.Timeout()
+}
+
+// probeQUICVersions sends the QUIC Initial packet with the reserved version
+// to raddr, and returns the versions in the version negotiation packet
+// replied by the server. The error is syscall.ECONNREFUSED if the ICMP port
+// unreachable is received, or the timeout error if the server did not reply.
+func (c *Client) probeQUICVersions(ctx context.Context, raddr string) ([]uint32, error) {
+	ctx, cancel := diagnoseStepContext(ctx)
+	defer cancel()
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "udp", raddr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	// long header: form and fixed bits, version, DCID and SCID, padded to
+	// the min size of the Initial packet.
+	packet := make([]byte, quicMinInitialSize)
+	packet[0] = 0xc0
+	binary.BigEndian.PutUint32(packet[1:5], quicProbeVersion)
+	packet[5] = 8
+	c.getRand().Read(packet[6:14])
+	packet[14] = 8
+	c.getRand().Read(packet[15:23])
+	scid := packet[15:23]
+	if _, err = conn.Write(packet); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 1500)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, err
+		}
+		if versions, ok := parseVersionNegotiation(buf[:n], scid); ok {
+			return versions, nil
+		}
+	}
+}
+
+// parseVersionNegotiation parses the version negotiation packet whose DCID
+// is the SCID sent by the client (RFC 9000 Section 17.2.1).
+func parseVersionNegotiation(b, scid []byte) ([]uint32, bool) {
+	if len(b) < 7 || b[0]&0x80 == 0 || binary.BigEndian.Uint32(b[1:5]) != 0 {
+		return nil, false
+	}
+	b = b[5:]
+	dcidLen := int(b[0])
+	if len(b) < 1+dcidLen+1 || !bytes.Equal(b[1:1+dcidLen], scid) {
+		return nil, false
+	}
+	b = b[1+dcidLen:]
+	scidLen := int(b[0])
+	if len(b) < 1+scidLen {
+		return nil, false
+	}
+	b = b[1+scidLen:]
+	versions := make([]uint32, 0, len(b)/4)
+	for ; len(b) >= 4; b = b[4:] {
+		versions = append(versions, binary.BigEndian.Uint32(b))
+	}
+	return versions, true
+}
+
+func formatQUICVersions(versions []uint32) string {
+	ss := make([]string, 0, len(versions))
+	for _, v := range versions {
+		switch v {
+		case 0x1:
+			ss = append(ss, "v1")
+		case 0x6b3343cf:
+			ss = append(ss, "v2")
+		default:
+			ss = append(ss, fmt.Sprintf("0x%x", v))
+		}
+	}
+	return strings.Join(ss, ", ")
+}
@@ -0,0 +1,154 @@
+package req
+
+import (
+	"context"
+	"io"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// defaultResponseDrainLimit is the default max size of the unread body
+	// which is drained to reuse the connection.
+	defaultResponseDrainLimit = 4 << 10
+	// responseDrainTimeout bounds the draining of the abandoned body, which
+	// runs in the background.
+	responseDrainTimeout = 5 * time.Second
+)
+
+// ResponseDrainStats is the statistics of the unread response bodies which
+// are discarded by Response.Discard or abandoned, see
+// Client.SetResponseDrainLimit.
+type ResponseDrainStats struct {
+	// Drained is the number of the bodies which are read to the end within
+	// the limit, so that the connection is reused.
+	Drained uint64
+	// Closed is the number of the bodies which exceed the limit or fail to
+	// be read, so that they are closed directly, which closes the HTTP1
+	// connection, and cancels the HTTP2 and HTTP3 stream.
+	Closed uint64
+}
+
+type responseDrainStats struct {
+	drained atomic.Uint64
+	closed  atomic.Uint64
+}
+
+// SetResponseDrainLimit set the max size of the unread response body which
+// is read and discarded to the end by Response.Discard, so that the
+// connection returns to the pool instead of being closed, the larger body
+// is closed directly. The same applies to the response body which is not
+// read automatically (e.g. with DisableAutoReadResponse) and is abandoned
+// without being closed, which is drained in the background once the body is
+// garbage collected or the context of the request is done. Default is 4KB,
+// a negative value disables draining. Use GetResponseDrainStats to see the
+// effect.
+func (c *Client) SetResponseDrainLimit(n int64) *Client {
+	c.responseDrainLimit = n
+	return c
+}
+
+// GetResponseDrainStats returns the statistics of the unread response
+// bodies which are drained or closed.
+func (c *Client) GetResponseDrainStats() ResponseDrainStats {
+	return ResponseDrainStats{
+		Drained: c.responseDrainStats.drained.Load(),
+		Closed:  c.responseDrainStats.closed.Load(),
+	}
+}
+
+// drain reads and discards the body up to the drain limit, then closes it.
+func (c *Client) drain(body io.ReadCloser) error {
+	var err error
+	drained := false
+	if limit := c.responseDrainLimit; limit >= 0 {
+		var n int64
+		n, err = io.CopyN(io.Discard, body, limit+1)
+		if err == io.EOF {
+			drained, err = true, nil
+		} else if n > limit {
+			err = nil // exceeds the limit.
+		}
+	}
+	if drained {
+		c.responseDrainStats.drained.Add(1)
+	} else {
+		c.responseDrainStats.closed.Add(1)
+	}
+	if e := body.Close(); err == nil && !drained {
+		err = e
+	}
+	return err
+}
+
+// Discard discards the unread response body, which is the cheap way to
+// release the response without caring about the body. The body up to the
+// drain limit (see Client.SetResponseDrainLimit) is read to the end so that
+// the connection can be reused, the larger body is closed directly. It does
+// nothing if the body has been read, e.g. automatically.
+func (r *Response) Discard() error {
+	if r.Response == nil || r.Body == nil || r.body != nil || r.spilled != nil {
+		return nil
+	}
+	if r.Request == nil || r.Request.client == nil {
+		return r.Body.Close()
+	}
+	return r.Request.client.drain(r.Body)
+}
+
+// drainState is the state of drainBody, which is kept separately so that it
+// is available to the cleanup of drainBody.
+type drainState struct {
+	body   io.ReadCloser
+	client *Client
+	done   atomic.Bool
+	stop   func() bool
+	// mu serializes Read with the background draining.
+	mu sync.Mutex
+}
+
+// drainInBackground drains the body in the background if it has not been
+// closed.
+func (s *drainState) drainInBackground() {
+	if !s.done.CompareAndSwap(false, true) {
+		return
+	}
+	s.stop()
+	go func() {
+		timer := time.AfterFunc(responseDrainTimeout, func() {
+			s.body.Close()
+		})
+		defer timer.Stop()
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.client.drain(s.body)
+	}()
+}
+
+// drainBody drains the body in the background if it is garbage collected
+// without being closed, or the context of the request is done.
+type drainBody struct {
+	*drainState
+}
+
+func newDrainBody(ctx context.Context, c *Client, body io.ReadCloser) io.ReadCloser {
+	b := &drainBody{&drainState{body: body, client: c}}
+	b.stop = context.AfterFunc(ctx, b.drainState.drainInBackground)
+	runtime.AddCleanup(b, (*drainState).drainInBackground, b.drainState)
+	return b
+}
+
+func (b *drainBody) Read(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.body.Read(p)
+}
+
+func (b *drainBody) Close() error {
+	if b.done.CompareAndSwap(false, true) {
+		b.stop()
+	}
+	return b.body.Close()
+}
@@ -1,9 +1,16 @@
 package req
 
 import (
-	"github.com/imroc/req/v3/internal/dump"
+	"bytes"
+	"fmt"
 	"io"
+	"net/http"
 	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/imroc/req/v3/internal/dump"
 )
 
 // DumpOptions controls the dump behavior.
@@ -20,8 +27,65 @@ type DumpOptions struct {
 	ResponseHeader       bool
 	ResponseBody         bool
 	Async                bool
+	// AsyncBufferSize is the max number of dumps buffered in async mode,
+	// default is 20.
+	AsyncBufferSize int
+	// AsyncOverflowPolicy controls the behavior when the buffer of async
+	// dump is full, default is OverflowBlock.
+	AsyncOverflowPolicy OverflowPolicy
+	// Attempts controls which attempts of the retried request are kept in
+	// the dump stored in memory (see Response.Dump and Response.Dumps),
+	// which bounds the memory of the request with many retries, default is
+	// DumpAllAttempts.
+	Attempts DumpAttempts
+}
+
+// DumpAttempts controls which attempts of the retried request are kept in
+// the dump stored in memory.
+type DumpAttempts int
+
+const (
+	// DumpAllAttempts keeps the dump of all attempts.
+	DumpAllAttempts DumpAttempts = iota
+	// DumpFinalAttempt keeps only the dump of the final attempt.
+	DumpFinalAttempt
+	// DumpFailedAttempts keeps only the dump of the failed attempts, which
+	// are the retried attempts, and the final attempt if it gets an error or
+	// the response is in ErrorState.
+	DumpFailedAttempts
+)
+
+// AttemptDump is the dump of a single attempt or redirect hop of the
+// request, see Response.Dumps.
+type AttemptDump struct {
+	// Attempt is the attempt number, which is the same as
+	// Request.RetryAttempt, 0 is the first attempt.
+	Attempt int
+	// Hop is the redirect hop number of the attempt, 0 is the request sent
+	// by the attempt, n is the nth redirect (or meta refresh).
+	Hop int
+	// URL is the url of the hop.
+	URL string
+	// Time is when the hop is sent.
+	Time time.Time
+	// Content is the dump content of the hop, which starts with the header
+	// line of the section, e.g. "* attempt: 0, hop: 1, url: https://example.com/, time: ...".
+	Content string
 }
 
+// OverflowPolicy controls the behavior when the buffer of async dump is full.
+type OverflowPolicy = dump.OverflowPolicy
+
+const (
+	// OverflowBlock blocks the request until the buffer has room, no dump
+	// will be lost.
+	OverflowBlock = dump.OverflowBlock
+	// OverflowDropOldest drops the oldest dump in the buffer.
+	OverflowDropOldest = dump.OverflowDropOldest
+	// OverflowDropNewest drops the dump of the current request.
+	OverflowDropNewest = dump.OverflowDropNewest
+)
+
 // Clone return a copy of DumpOptions
 func (do *DumpOptions) Clone() *DumpOptions {
 	if do == nil {
@@ -102,6 +166,14 @@ func (o dumpOptions) Async() bool {
 	return o.DumpOptions.Async
 }
 
+func (o dumpOptions) AsyncBufferSize() int {
+	return o.DumpOptions.AsyncBufferSize
+}
+
+func (o dumpOptions) AsyncOverflowPolicy() OverflowPolicy {
+	return o.DumpOptions.AsyncOverflowPolicy
+}
+
 func (o dumpOptions) Clone() dump.Options {
 	return dumpOptions{o.DumpOptions.Clone()}
 }
@@ -125,3 +197,110 @@ func newDumper(opt *DumpOptions) *dump.Dumper {
 	}
 	return dump.NewDumper(dumpOptions{opt})
 }
+
+// dumpBuffer is the request-scoped buffer of the dump, which is safe for
+// the concurrent writes of the request and response dumps. The dump is
+// segmented into the sections of the attempts and redirect hops.
+type dumpBuffer struct {
+	mu       sync.Mutex
+	sections []*dumpSection
+}
+
+type dumpSection struct {
+	AttemptDump
+	buf bytes.Buffer
+}
+
+func (b *dumpBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.sections) == 0 { // dump outside any hop.
+		b.sections = append(b.sections, &dumpSection{})
+	}
+	return b.sections[len(b.sections)-1].buf.Write(p)
+}
+
+func (b *dumpBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var buf strings.Builder
+	for _, s := range b.sections {
+		buf.Write(s.buf.Bytes())
+	}
+	return buf.String()
+}
+
+func (b *dumpBuffer) Reset() {
+	b.mu.Lock()
+	b.sections = nil
+	b.mu.Unlock()
+}
+
+// startSection starts the section of the hop, the subsequent writes belong
+// to it.
+func (b *dumpBuffer) startSection(d AttemptDump) {
+	b.mu.Lock()
+	b.sections = append(b.sections, &dumpSection{AttemptDump: d})
+	b.mu.Unlock()
+}
+
+// dropAttempt drops the sections of the attempt.
+func (b *dumpBuffer) dropAttempt(attempt int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	sections := b.sections[:0]
+	for _, s := range b.sections {
+		if s.Attempt != attempt {
+			sections = append(sections, s)
+		}
+	}
+	clear(b.sections[len(sections):])
+	b.sections = sections
+}
+
+func (b *dumpBuffer) attemptDumps() []AttemptDump {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	dumps := make([]AttemptDump, len(b.sections))
+	for i, s := range b.sections {
+		dumps[i] = s.AttemptDump
+		dumps[i].Content = s.buf.String()
+	}
+	return dumps
+}
+
+// dumpHops starts the dump section of each hop of an attempt.
+type dumpHops struct {
+	c       *Client
+	attempt int
+	hop     int
+	buf     *dumpBuffer
+}
+
+func (h *dumpHops) start(req *http.Request) {
+	ctx := req.Context()
+	d := AttemptDump{Attempt: h.attempt, Hop: h.hop, URL: req.URL.String(), Time: time.Now()}
+	h.hop++
+	if h.buf != nil {
+		h.buf.startSection(d)
+	}
+	line := fmt.Sprintf("* attempt: %d, hop: %d, url: %s, time: %s\r\n", d.Attempt, d.Hop, d.URL, d.Time.Format(time.RFC3339Nano))
+	for _, dd := range dump.GetDumpers(ctx, h.c.Dump) {
+		if dd.RequestHeader() || dd.RequestBody() || dd.ResponseHeader() || dd.ResponseBody() {
+			dd.DumpDefault([]byte(line))
+		}
+	}
+	h.c.dumpRequestID(ctx)
+}
+
+// dumpHopTransport starts the dump section before sending each hop.
+type dumpHopTransport struct {
+	rt http.RoundTripper
+}
+
+func (t *dumpHopTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if h, ok := req.Context().Value(dumpHopsKey).(*dumpHops); ok {
+		h.start(req)
+	}
+	return t.rt.RoundTrip(req)
+}
@@ -0,0 +1,155 @@
+package req
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptrace"
+	"net/textproto"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	// earlyHintsPreconnectTTL is how long the origin is considered warmed, and
+	// how long the warmed HTTP1 connection is kept if unused.
+	earlyHintsPreconnectTTL = 10 * time.Second
+	// earlyHintsPreconnectConcurrency is the max number of concurrent dials.
+	earlyHintsPreconnectConcurrency = 4
+)
+
+// earlyHintsPreconnect pre-warms the connections to the origins hinted by
+// the `Link: rel=preconnect` headers of 103 Early Hints.
+type earlyHintsPreconnect struct {
+	maxOrigins int
+	hook       func(origin string, err error)
+	sem        chan struct{}
+
+	mu sync.Mutex
+	// origins records when the origin is warmed, which deduplicates the
+	// hints within earlyHintsPreconnectTTL.
+	origins map[string]time.Time
+}
+
+func newEarlyHintsPreconnect(maxOrigins int, hook func(origin string, err error)) *earlyHintsPreconnect {
+	return &earlyHintsPreconnect{
+		maxOrigins: maxOrigins,
+		hook:       hook,
+		sem:        make(chan struct{}, earlyHintsPreconnectConcurrency),
+		origins:    make(map[string]time.Time),
+	}
+}
+
+func (p *earlyHintsPreconnect) Clone() *earlyHintsPreconnect {
+	if p == nil {
+		return nil
+	}
+	return newEarlyHintsPreconnect(p.maxOrigins, p.hook)
+}
+
+// EnableEarlyHintsPreconnect enables pre-warming the connections (DNS, TCP
+// or QUIC and TLS) to the origins hinted by the `Link: <origin>; rel=preconnect`
+// headers of 103 Early Hints, so that the subsequent requests to these
+// origins are faster. At most maxOrigins origins are pre-warmed for each
+// response, the origins warmed in the last 10 seconds are skipped, and the
+// warmed HTTP1 connections are closed if they are still unused after 10
+// seconds. The connections are dialed in the background with bounded
+// concurrency, which never delays the response, through the same path of
+// the requests (proxy and tls fingerprint included), and are put into the
+// pool as idle (see Transport.ConnPoolStats). Use OnEarlyHintsPreconnect to
+// observe the dials.
+func (c *Client) EnableEarlyHintsPreconnect(maxOrigins int) *Client {
+	if maxOrigins <= 0 {
+		return c.DisableEarlyHintsPreconnect()
+	}
+	var hook func(origin string, err error)
+	if c.earlyHints != nil {
+		hook = c.earlyHints.hook
+	}
+	c.earlyHints = newEarlyHintsPreconnect(maxOrigins, hook)
+	return c
+}
+
+// DisableEarlyHintsPreconnect disables the pre-warming enabled by
+// EnableEarlyHintsPreconnect (default).
+func (c *Client) DisableEarlyHintsPreconnect() *Client {
+	c.earlyHints = nil
+	return c
+}
+
+// OnEarlyHintsPreconnect set the hook which is called after each dial
+// driven by 103 Early Hints with the origin (e.g. "https://cdn.example.com")
+// and the error of the dial, which is useful for the metrics to evaluate
+// whether the pre-warming helps. It takes effect once
+// EnableEarlyHintsPreconnect is called.
+func (c *Client) OnEarlyHintsPreconnect(fn func(origin string, err error)) *Client {
+	if c.earlyHints == nil {
+		c.earlyHints = newEarlyHintsPreconnect(0, fn)
+		return c
+	}
+	c.earlyHints.hook = fn
+	return c
+}
+
+// clientTrace returns the trace which pre-warms the connections on 103
+// Early Hints.
+func (p *earlyHintsPreconnect) clientTrace(t *Transport) *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		Got1xxResponse: func(code int, header textproto.MIMEHeader) error {
+			if code == http.StatusEarlyHints {
+				p.preconnect(t, linksByRel(http.Header(header), "preconnect"))
+			}
+			return nil
+		},
+	}
+}
+
+func (p *earlyHintsPreconnect) preconnect(t *Transport, links []string) {
+	if p.maxOrigins <= 0 {
+		return
+	}
+	now := time.Now()
+	var origins []*url.URL
+	p.mu.Lock()
+	for origin, at := range p.origins {
+		if now.Sub(at) >= earlyHintsPreconnectTTL {
+			delete(p.origins, origin)
+		}
+	}
+	for _, link := range links {
+		if len(origins) >= p.maxOrigins {
+			break
+		}
+		u, err := url.Parse(link)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			continue
+		}
+		u = &url.URL{Scheme: u.Scheme, Host: u.Host}
+		origin := u.String()
+		if _, ok := p.origins[origin]; ok {
+			continue
+		}
+		p.origins[origin] = now
+		origins = append(origins, u)
+	}
+	p.mu.Unlock()
+
+	for _, u := range origins {
+		go func() {
+			p.sem <- struct{}{}
+			defer func() { <-p.sem }()
+			ctx, cancel := context.WithTimeout(context.Background(), earlyHintsPreconnectTTL)
+			defer cancel()
+			err := t.preconnect(ctx, u, earlyHintsPreconnectTTL)
+			if err != nil {
+				// allow retrying on the next hint.
+				p.mu.Lock()
+				delete(p.origins, u.String())
+				p.mu.Unlock()
+			}
+			if p.hook != nil {
+				p.hook(u.String(), err)
+			}
+		}()
+	}
+}
@@ -0,0 +1,367 @@
+package req
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"mime"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// TestingT is the subset of testing.TB which is used by Response.ExpectT to
+// report the failed expectations, *testing.T satisfies it.
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...any)
+}
+
+// Expectation is the fluent assertions of the response, which is created by
+// Response.Expect or Response.ExpectT. All the failures are accumulated
+// rather than stopping at the first one, use Done to get them.
+type Expectation struct {
+	resp *Response
+	t    TestingT
+	errs []error
+
+	json    any
+	jsonErr error
+	decoded bool
+}
+
+// Expect returns the Expectation of the response, which is useful for the
+// integration tests and contract checks, e.g.
+//
+//	err := resp.Expect().
+//		Status(200).
+//		ContentType("application/json").
+//		HeaderMatches("X-Request-Id", `^[0-9a-f-]{36}$`).
+//		JSONPath("data.id", 42).
+//		Done()
+//
+// The body is read and kept if it has not been read, so that it can still
+// be read later.
+func (r *Response) Expect() *Expectation {
+	return r.newExpectation(nil)
+}
+
+// ExpectT is similar to Expect, but each failed expectation is also
+// reported with t.Errorf immediately.
+func (r *Response) ExpectT(t TestingT) *Expectation {
+	t.Helper()
+	return r.newExpectation(t)
+}
+
+func (r *Response) newExpectation(t TestingT) *Expectation {
+	if t != nil {
+		t.Helper()
+	}
+	e := &Expectation{resp: r, t: t}
+	if r.Err != nil {
+		e.fail(fmt.Errorf("req: expect response, got error: %w", r.Err))
+	} else if r.Response == nil {
+		e.fail(errors.New("req: expect response, got nil"))
+	}
+	return e
+}
+
+func (e *Expectation) fail(err error) {
+	if e.t != nil {
+		e.t.Helper()
+		e.t.Errorf("%v", err)
+	}
+	e.errs = append(e.errs, err)
+}
+
+// ok reports whether the response is available for the expectations, the
+// expectations are skipped if the request failed.
+func (e *Expectation) ok() bool {
+	return e.resp.Err == nil && e.resp.Response != nil
+}
+
+// Status expects the status code is one of the codes.
+func (e *Expectation) Status(codes ...int) *Expectation {
+	if e.t != nil {
+		e.t.Helper()
+	}
+	if !e.ok() {
+		return e
+	}
+	for _, code := range codes {
+		if e.resp.StatusCode == code {
+			return e
+		}
+	}
+	want := fmt.Sprint(codes)
+	if len(codes) == 1 {
+		want = strconv.Itoa(codes[0])
+	}
+	e.fail(fmt.Errorf("req: expect status %s, got %d", want, e.resp.StatusCode))
+	return e
+}
+
+// StatusSuccess expects the status code is 2xx.
+func (e *Expectation) StatusSuccess() *Expectation {
+	if e.t != nil {
+		e.t.Helper()
+	}
+	if e.ok() && (e.resp.StatusCode < 200 || e.resp.StatusCode > 299) {
+		e.fail(fmt.Errorf("req: expect status 2xx, got %d", e.resp.StatusCode))
+	}
+	return e
+}
+
+// ContentType expects the media type of the Content-Type header is
+// contentType, the parameters (e.g. charset) are ignored unless contentType
+// contains parameters.
+func (e *Expectation) ContentType(contentType string) *Expectation {
+	if e.t != nil {
+		e.t.Helper()
+	}
+	if !e.ok() {
+		return e
+	}
+	got := e.resp.GetContentType()
+	if !strings.Contains(contentType, ";") {
+		if mediaType, _, err := mime.ParseMediaType(got); err == nil && strings.EqualFold(mediaType, contentType) {
+			return e
+		}
+	} else if strings.EqualFold(strings.ReplaceAll(got, " ", ""), strings.ReplaceAll(contentType, " ", "")) {
+		return e
+	}
+	e.fail(fmt.Errorf("req: expect content type %q, got %q", contentType, got))
+	return e
+}
+
+// Header expects the value of the header is value.
+func (e *Expectation) Header(key, value string) *Expectation {
+	if e.t != nil {
+		e.t.Helper()
+	}
+	if !e.ok() {
+		return e
+	}
+	if values := e.resp.Header.Values(key); len(values) == 0 {
+		e.fail(fmt.Errorf("req: expect header %s to be %q, got none", key, value))
+	} else if values[0] != value {
+		e.fail(fmt.Errorf("req: expect header %s to be %q, got %q", key, value, values[0]))
+	}
+	return e
+}
+
+// HeaderMatches expects the value of the header matches the regular
+// expression pattern.
+func (e *Expectation) HeaderMatches(key, pattern string) *Expectation {
+	if e.t != nil {
+		e.t.Helper()
+	}
+	if !e.ok() {
+		return e
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		e.fail(fmt.Errorf("req: invalid pattern of header %s: %w", key, err))
+		return e
+	}
+	if values := e.resp.Header.Values(key); len(values) == 0 {
+		e.fail(fmt.Errorf("req: expect header %s to match %q, got none", key, pattern))
+	} else if !re.MatchString(values[0]) {
+		e.fail(fmt.Errorf("req: expect header %s to match %q, got %q", key, pattern, values[0]))
+	}
+	return e
+}
+
+// JSONPath expects the value at the path of the JSON body equals want. The
+// path is the dot-separated keys and indexes, e.g. "data.items.0.id" or
+// "data.items[0].id", the empty path is the whole body. The want is
+// compared by the JSON value, e.g. the numbers are equal if they are equal
+// in value regardless of the type (42, 42.0, int64(42) and
+// json.Number("42") are equal), and the structs are compared by the JSON
+// they are marshalled into.
+func (e *Expectation) JSONPath(path string, want any) *Expectation {
+	if e.t != nil {
+		e.t.Helper()
+	}
+	if !e.ok() {
+		return e
+	}
+	body, err := e.decodeJSON()
+	if err != nil {
+		e.fail(fmt.Errorf("req: expect JSON path %q, got invalid JSON body: %w", path, err))
+		return e
+	}
+	got, err := lookupJSONPath(body, path)
+	if err != nil {
+		e.fail(fmt.Errorf("req: expect JSON path %q: %w", path, err))
+		return e
+	}
+	wantJSON, err := normalizeJSON(want)
+	if err != nil {
+		e.fail(fmt.Errorf("req: invalid expected value of JSON path %q: %w", path, err))
+		return e
+	}
+	if diff := diffJSON(path, got, wantJSON); diff != "" {
+		e.fail(fmt.Errorf("req: expect JSON path %q to be %s, got %s: %s", path, formatJSON(wantJSON), formatJSON(got), diff))
+	}
+	return e
+}
+
+// Done returns the failed expectations joined as a single error, nil if
+// all the expectations are met.
+func (e *Expectation) Done() error {
+	return errors.Join(e.errs...)
+}
+
+func (e *Expectation) decodeJSON() (any, error) {
+	if e.decoded {
+		return e.json, e.jsonErr
+	}
+	e.decoded = true
+	r := e.resp
+	readBefore := r.body != nil || r.spilled != nil
+	var body []byte
+	body, e.jsonErr = r.ToBytes()
+	if e.jsonErr != nil {
+		return nil, e.jsonErr
+	}
+	if !readBefore && r.Response != nil { // keep the body readable.
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	e.json, e.jsonErr = decodeJSONUseNumber(body)
+	return e.json, e.jsonErr
+}
+
+func decodeJSONUseNumber(b []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("invalid data after the top-level value")
+	}
+	return v, nil
+}
+
+func normalizeJSON(v any) (any, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return decodeJSONUseNumber(b)
+}
+
+func formatJSON(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+func lookupJSONPath(v any, path string) (any, error) {
+	if path == "" {
+		return v, nil
+	}
+	path = strings.NewReplacer("[", ".", "]", "").Replace(path)
+	var cur []string
+	for _, key := range strings.Split(path, ".") {
+		cur = append(cur, key)
+		switch x := v.(type) {
+		case map[string]any:
+			val, ok := x[key]
+			if !ok {
+				return nil, fmt.Errorf("%q not found", strings.Join(cur, "."))
+			}
+			v = val
+		case []any:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(x) {
+				return nil, fmt.Errorf("%q not found, the array length is %d", strings.Join(cur, "."), len(x))
+			}
+			v = x[i]
+		default:
+			return nil, fmt.Errorf("%q not found, %q is %s", strings.Join(cur, "."), strings.Join(cur[:len(cur)-1], "."), formatJSON(v))
+		}
+	}
+	return v, nil
+}
+
+// diffJSON returns the description of the first difference between the
+// decoded JSON values, empty if they are equal.
+func diffJSON(path string, got, want any) string {
+	at := func(p string) string {
+		if p == "" {
+			return "the body"
+		}
+		return p
+	}
+	switch w := want.(type) {
+	case map[string]any:
+		g, ok := got.(map[string]any)
+		if !ok {
+			return fmt.Sprintf("%s is %s, not an object", at(path), formatJSON(got))
+		}
+		for _, k := range sortedKeys(w) {
+			gv, ok := g[k]
+			if !ok {
+				return fmt.Sprintf("%s is missing", joinJSONPath(path, k))
+			}
+			if d := diffJSON(joinJSONPath(path, k), gv, w[k]); d != "" {
+				return d
+			}
+		}
+		for _, k := range sortedKeys(g) {
+			if _, ok := w[k]; !ok {
+				return fmt.Sprintf("%s is unexpected", joinJSONPath(path, k))
+			}
+		}
+		return ""
+	case []any:
+		g, ok := got.([]any)
+		if !ok {
+			return fmt.Sprintf("%s is %s, not an array", at(path), formatJSON(got))
+		}
+		if len(g) != len(w) {
+			return fmt.Sprintf("the length of %s is %d, not %d", at(path), len(g), len(w))
+		}
+		for i := range w {
+			if d := diffJSON(joinJSONPath(path, strconv.Itoa(i)), g[i], w[i]); d != "" {
+				return d
+			}
+		}
+		return ""
+	case json.Number:
+		if g, ok := got.(json.Number); ok && equalJSONNumber(g, w) {
+			return ""
+		}
+	default:
+		if got == want {
+			return ""
+		}
+	}
+	return fmt.Sprintf("%s is %s, not %s", at(path), formatJSON(got), formatJSON(want))
+}
+
+func joinJSONPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// equalJSONNumber reports whether the numbers are equal in value, which
+// is exact for the big integers and decimals.
+func equalJSONNumber(a, b json.Number) bool {
+	if a == b {
+		return true
+	}
+	x, ok1 := new(big.Rat).SetString(string(a))
+	y, ok2 := new(big.Rat).SetString(string(b))
+	return ok1 && ok2 && x.Cmp(y) == 0
+}
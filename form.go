@@ -0,0 +1,240 @@
+package req
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/imroc/req/v3/internal/header"
+)
+
+// setFormContentType sets the Content-Type of the form body, unless it has
+// been set to the form content type with parameters, e.g.
+// "application/x-www-form-urlencoded; charset=utf-8".
+func setFormContentType(r *Request) {
+	ct := r.getHeader(header.ContentType)
+	if mediaType, _, _ := strings.Cut(ct, ";"); strings.EqualFold(strings.TrimSpace(mediaType), header.FormContentType) {
+		return
+	}
+	r.SetContentType(header.FormContentType)
+}
+
+// FormArrayStyle is the style of the keys of the array elements in the
+// nested form data, see Request.SetFormDataNested.
+type FormArrayStyle int
+
+const (
+	// FormArrayIndexed encodes the array elements with their index, e.g.
+	// items[0]=a&items[1]=b, which is the default.
+	FormArrayIndexed FormArrayStyle = iota
+	// FormArrayBrackets encodes the array elements with empty brackets, e.g.
+	// items[]=a&items[]=b.
+	FormArrayBrackets
+)
+
+// SetFormArrayStyle set the style of the keys of the array elements in the
+// nested form data set by Request.SetFormDataNested, default is
+// FormArrayIndexed.
+func (c *Client) SetFormArrayStyle(style FormArrayStyle) *Client {
+	c.formArrayStyle = style
+	return c
+}
+
+// SetFormDataNested set the form data from a map which values could be
+// nested maps and slices, which are encoded into the PHP and Rails style
+// bracketed keys, e.g. items[0][name]=x, the array style is set by
+// Client.SetFormArrayStyle. The keys of the maps are encoded in sorted order,
+// and the elements of the slices are kept in order, the other values are
+// converted to string like SetFormDataAnyType, and the nil values, empty maps
+// and empty slices are omitted.
+//
+// The form data is appended to the ordered form data (see SetOrderedFormData),
+// so it is not used together with SetFormData or the common form data of
+// the client.
+func (r *Request) SetFormDataNested(data map[string]any) *Request {
+	style := FormArrayIndexed
+	if r.client != nil {
+		style = r.client.formArrayStyle
+	}
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		r.OrderedFormData = appendNestedFormData(r.OrderedFormData, k, reflect.ValueOf(data[k]), style)
+	}
+	return r
+}
+
+func appendNestedFormData(kvs []string, key string, v reflect.Value, style FormArrayStyle) []string {
+	for v.IsValid() && (v.Kind() == reflect.Interface || v.Kind() == reflect.Pointer) {
+		if v.IsNil() {
+			return kvs
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return kvs
+	}
+	switch v.Kind() {
+	case reflect.Map:
+		keys := make([]string, 0, v.Len())
+		values := make(map[string]reflect.Value, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			k := fmt.Sprint(iter.Key().Interface())
+			keys = append(keys, k)
+			values[k] = iter.Value()
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			kvs = appendNestedFormData(kvs, key+"["+k+"]", values[k], style)
+		}
+		return kvs
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 { // []byte
+			return append(kvs, key, string(v.Bytes()))
+		}
+		for i := 0; i < v.Len(); i++ {
+			k := key + "[]"
+			if style == FormArrayIndexed {
+				k = key + "[" + strconv.Itoa(i) + "]"
+			}
+			kvs = appendNestedFormData(kvs, k, v.Index(i), style)
+		}
+		return kvs
+	}
+	return append(kvs, key, fmt.Sprint(v.Interface()))
+}
+
+// UnmarshalForm unmarshalls the application/x-www-form-urlencoded response
+// body into v, which is a pointer to a struct, a map[string]string, a
+// map[string][]string or url.Values. The struct fields are matched by the
+// `form` tag, or the field name if the tag is absent, and "-" skips the
+// field. The supported field types are string, bool, the integer and float
+// types, the pointers to them, and the slices of them which receive all
+// values of the key.
+func (r *Response) UnmarshalForm(v any) error {
+	if r.Err != nil {
+		return r.Err
+	}
+	b, err := r.ToBytes()
+	if err != nil {
+		return err
+	}
+	values, err := url.ParseQuery(string(b))
+	if err != nil {
+		return err
+	}
+	return unmarshalForm(values, v)
+}
+
+func unmarshalForm(values url.Values, v any) error {
+	switch m := v.(type) {
+	case *url.Values:
+		*m = values
+		return nil
+	case *map[string][]string:
+		*m = values
+		return nil
+	case *map[string]string:
+		if *m == nil {
+			*m = make(map[string]string, len(values))
+		}
+		for k := range values {
+			(*m)[k] = values.Get(k)
+		}
+		return nil
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("req: UnmarshalForm requires a non-nil pointer to struct or map, got %T", v)
+	}
+	rv = rv.Elem()
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		name := sf.Name
+		if tag, ok := sf.Tag.Lookup("form"); ok {
+			tag, _, _ = strings.Cut(tag, ",")
+			if tag == "-" {
+				continue
+			}
+			if tag != "" {
+				name = tag
+			}
+		}
+		vs, ok := values[name]
+		if !ok || len(vs) == 0 {
+			continue
+		}
+		if err := setFormField(rv.Field(i), vs); err != nil {
+			return fmt.Errorf("req: unmarshal form field %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func setFormField(fv reflect.Value, vs []string) error {
+	switch fv.Kind() {
+	case reflect.Slice:
+		s := reflect.MakeSlice(fv.Type(), len(vs), len(vs))
+		for i, v := range vs {
+			if err := setFormValue(s.Index(i), v); err != nil {
+				return err
+			}
+		}
+		fv.Set(s)
+		return nil
+	case reflect.Pointer:
+		p := reflect.New(fv.Type().Elem())
+		if err := setFormValue(p.Elem(), vs[0]); err != nil {
+			return err
+		}
+		fv.Set(p)
+		return nil
+	}
+	return setFormValue(fv, vs[0])
+}
+
+func setFormValue(fv reflect.Value, v string) error {
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(v)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(v, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(v, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(v, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetFloat(f)
+	default:
+		return errors.New("unsupported type " + fv.Type().String())
+	}
+	return nil
+}
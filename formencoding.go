@@ -0,0 +1,55 @@
+package req
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+)
+
+// FieldEncoding is the encoding of the form field value, see
+// Request.SetFormDataEncoded.
+type FieldEncoding int
+
+const (
+	// FieldEncodingRaw sets the value as is.
+	FieldEncodingRaw FieldEncoding = iota
+	// FieldEncodingBase64 encodes the value with the standard base64
+	// encoding (RFC 4648) with padding.
+	FieldEncodingBase64
+	// FieldEncodingBase64URL encodes the value with the URL-safe base64
+	// encoding (RFC 4648) with padding.
+	FieldEncodingBase64URL
+	// FieldEncodingGzipBase64 compresses the value into a gzip stream (RFC
+	// 1952), then encodes it with the standard base64 encoding.
+	FieldEncodingGzipBase64
+	// FieldEncodingGzipBase64URL compresses the value into a gzip stream (RFC
+	// 1952), then encodes it with the URL-safe base64 encoding.
+	FieldEncodingGzipBase64URL
+)
+
+// encode returns the encoded value.
+func (e FieldEncoding) encode(value []byte) string {
+	switch e {
+	case FieldEncodingGzipBase64, FieldEncodingGzipBase64URL:
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		w.Write(value) // never fails with bytes.Buffer.
+		w.Close()      // flush the trailer (checksum and size).
+		value = buf.Bytes()
+	}
+	switch e {
+	case FieldEncodingBase64, FieldEncodingGzipBase64:
+		return base64.StdEncoding.EncodeToString(value)
+	case FieldEncodingBase64URL, FieldEncodingGzipBase64URL:
+		return base64.URLEncoding.EncodeToString(value)
+	}
+	return string(value)
+}
+
+// SetFormDataEncoded set the form field with the value encoded by enc,
+// which is useful for the APIs that expect the field to be base64 or
+// gzip+base64 encoded (e.g. the log-ingest endpoints), will not been used
+// if request method does not allow payload.
+func (r *Request) SetFormDataEncoded(field string, value []byte, enc FieldEncoding) *Request {
+	return r.SetFormData(map[string]string{field: enc.encode(value)})
+}
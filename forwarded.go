@@ -0,0 +1,204 @@
+package req
+
+import (
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// forwardedInfo is the forwarding information which is appended to the
+// Forwarded and X-Forwarded-* headers.
+type forwardedInfo struct {
+	forNode string
+	proto   string
+	host    string
+}
+
+func (f *forwardedInfo) merge(o *forwardedInfo) *forwardedInfo {
+	if o == nil {
+		return f
+	}
+	if f == nil {
+		return o
+	}
+	merged := *f
+	if merged.forNode == "" {
+		merged.forNode = o.forNode
+	}
+	if merged.proto == "" {
+		merged.proto = o.proto
+	}
+	if merged.host == "" {
+		merged.host = o.host
+	}
+	return &merged
+}
+
+// SetForwardedFor set the client address which is appended to the RFC 7239
+// Forwarded header as the "for" parameter and the X-Forwarded-For header,
+// the existing values of the headers are kept, so that the forwarding chain
+// is extended. The clientIP can be an IP address with an optional port, an
+// obfuscated identifier (e.g. "_hidden") or "unknown", which is quoted and
+// bracketed as required by RFC 7239, e.g. `for="[2001:db8::1]"`.
+func (r *Request) SetForwardedFor(clientIP string) *Request {
+	if r.forwarded == nil {
+		r.forwarded = &forwardedInfo{}
+	}
+	r.forwarded.forNode = clientIP
+	return r
+}
+
+// EnableForwardedHeader set the original protocol and host of the request,
+// which are appended to the RFC 7239 Forwarded header as the "proto" and
+// "host" parameters, and set as the X-Forwarded-Proto and X-Forwarded-Host
+// headers, empty value is omitted. It can be used together with
+// SetForwardedFor, the parameters are appended as a single element.
+func (r *Request) EnableForwardedHeader(proto, host string) *Request {
+	if r.forwarded == nil {
+		r.forwarded = &forwardedInfo{}
+	}
+	r.forwarded.proto = proto
+	r.forwarded.host = host
+	return r
+}
+
+// SetCommonForwardedFor set the default client address of the Forwarded and
+// X-Forwarded-For headers for all requests, which can be overridden by
+// Request.SetForwardedFor.
+func (c *Client) SetCommonForwardedFor(clientIP string) *Client {
+	if c.forwarded == nil {
+		c.forwarded = &forwardedInfo{}
+	}
+	c.forwarded.forNode = clientIP
+	return c
+}
+
+// EnableCommonForwardedHeader set the default original protocol and host of
+// the Forwarded and X-Forwarded-* headers for all requests, which can be
+// overridden by Request.EnableForwardedHeader.
+func (c *Client) EnableCommonForwardedHeader(proto, host string) *Client {
+	if c.forwarded == nil {
+		c.forwarded = &forwardedInfo{}
+	}
+	c.forwarded.proto = proto
+	c.forwarded.host = host
+	return c
+}
+
+// applyForwardedHeaders appends the forwarding information to the Forwarded
+// and X-Forwarded-* headers, which runs after the common headers are merged.
+func applyForwardedHeaders(c *Client, r *Request) error {
+	f := r.forwarded.merge(c.forwarded)
+	if f == nil || r.RetryAttempt > 0 { // the headers are kept when retry.
+		return nil
+	}
+	var params []string
+	if f.forNode != "" {
+		params = append(params, "for="+formatForwardedNode(f.forNode))
+	}
+	if f.host != "" {
+		params = append(params, "host="+formatForwardedValue(f.host))
+	}
+	if f.proto != "" {
+		params = append(params, "proto="+formatForwardedValue(strings.ToLower(f.proto)))
+	}
+	if len(params) == 0 {
+		return nil
+	}
+	if r.Headers == nil {
+		r.Headers = make(http.Header)
+	}
+	// replace the values instead of appending to them, which may be shared
+	// with the common headers of the client.
+	appendHeaderChain(r.Headers, "Forwarded", strings.Join(params, ";"))
+	if f.forNode != "" {
+		appendHeaderChain(r.Headers, "X-Forwarded-For", forwardedForValue(f.forNode))
+	}
+	if f.proto != "" {
+		r.Headers.Set("X-Forwarded-Proto", strings.ToLower(f.proto))
+	}
+	if f.host != "" {
+		r.Headers.Set("X-Forwarded-Host", f.host)
+	}
+	return nil
+}
+
+func appendHeaderChain(h http.Header, key, value string) {
+	if existing := h.Values(key); len(existing) > 0 {
+		value = strings.Join(existing, ", ") + ", " + value
+	}
+	h.Set(key, value)
+}
+
+// formatForwardedNode formats the node of the "for" parameter according
+// to RFC 7239 section 6.
+func formatForwardedNode(node string) string {
+	if strings.EqualFold(node, "unknown") || isObfuscatedNode(node) {
+		return node
+	}
+	if addr, err := netip.ParseAddr(strings.Trim(node, "[]")); err == nil {
+		if addr.Is6() && !addr.Is4In6() {
+			return `"[` + addr.String() + `]"`
+		}
+		return addr.Unmap().String()
+	}
+	if ap, err := netip.ParseAddrPort(node); err == nil {
+		return `"` + ap.String() + `"`
+	}
+	return formatForwardedValue(node)
+}
+
+// forwardedForValue returns the X-Forwarded-For form of the node, the IPv6
+// address is not bracketed.
+func forwardedForValue(node string) string {
+	if addr, err := netip.ParseAddr(strings.Trim(node, "[]")); err == nil {
+		return addr.Unmap().String()
+	}
+	return node
+}
+
+// isObfuscatedNode reports whether the node is an obfuscated identifier:
+// "_" 1*( ALPHA / DIGIT / "." / "_" / "-").
+func isObfuscatedNode(node string) bool {
+	if len(node) < 2 || node[0] != '_' {
+		return false
+	}
+	for i := 1; i < len(node); i++ {
+		b := node[i]
+		if !isAlphaNum(b) && b != '.' && b != '_' && b != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// formatForwardedValue returns the value as a token, or a quoted-string if
+// it contains the characters which are not allowed in a token.
+func formatForwardedValue(v string) string {
+	if v != "" && isToken(v) {
+		return v
+	}
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(v); i++ {
+		if v[i] == '"' || v[i] == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(v[i])
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+func isToken(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !isAlphaNum(s[i]) && !strings.ContainsRune("!#$%&'*+-.^_`|~", rune(s[i])) {
+			return false
+		}
+	}
+	return true
+}
+
+func isAlphaNum(b byte) bool {
+	return ('a' <= b && b <= 'z') || ('A' <= b && b <= 'Z') || ('0' <= b && b <= '9')
+}
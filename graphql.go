@@ -0,0 +1,124 @@
+package req
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/imroc/req/v3/internal/header"
+)
+
+// graphQLRequest is the standard GraphQL request body.
+type graphQLRequest struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName,omitempty"`
+	Variables     map[string]any `json:"variables,omitempty"`
+}
+
+// GraphQLErrorLocation is the location in the GraphQL document of an error.
+type GraphQLErrorLocation struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// GraphQLError is the error in the "errors" array of GraphQL response.
+type GraphQLError struct {
+	Message    string                 `json:"message"`
+	Locations  []GraphQLErrorLocation `json:"locations,omitempty"`
+	Path       []any                  `json:"path,omitempty"`
+	Extensions map[string]any         `json:"extensions,omitempty"`
+}
+
+func (e GraphQLError) Error() string {
+	if len(e.Path) == 0 {
+		return e.Message
+	}
+	path := make([]string, len(e.Path))
+	for i, p := range e.Path {
+		path[i] = fmt.Sprint(p)
+	}
+	return fmt.Sprintf("%s (path: %s)", e.Message, strings.Join(path, "."))
+}
+
+// GraphQLErrors is the "errors" array of GraphQL response, which is returned
+// as error when Client.EnableGraphQLErrorsAsError is called.
+type GraphQLErrors []GraphQLError
+
+func (es GraphQLErrors) Error() string {
+	msgs := make([]string, len(es))
+	for i, e := range es {
+		msgs[i] = e.Error()
+	}
+	return "graphql: " + strings.Join(msgs, "; ")
+}
+
+func (r *Request) setGraphQL(query string, variables map[string]any) *Request {
+	if r.graphQL == nil {
+		r.graphQL = &graphQLRequest{}
+	}
+	r.graphQL.Query = query
+	r.graphQL.Variables = variables
+	r.marshalBody = r.graphQL
+	r.SetContentType(header.JsonContentType)
+	r.Method = http.MethodPost
+	return r
+}
+
+// SetGraphQLQuery set the request Body as the standard GraphQL request
+// `{"query":..., "variables":...}`, set Content-Type header as
+// "application/json; charset=utf-8" and the method as POST, so it can be
+// sent with Do after SetURL, or with the Post method to the GraphQL endpoint.
+func (r *Request) SetGraphQLQuery(query string, variables map[string]any) *Request {
+	return r.setGraphQL(query, variables)
+}
+
+// SetGraphQLMutation is similar to SetGraphQLQuery, but for GraphQL mutation.
+func (r *Request) SetGraphQLMutation(mutation string, variables map[string]any) *Request {
+	return r.setGraphQL(mutation, variables)
+}
+
+// SetGraphQLOperationName set the operation name of the GraphQL request,
+// which is required if the document contains multiple operations.
+func (r *Request) SetGraphQLOperationName(name string) *Request {
+	if r.graphQL == nil {
+		r.graphQL = &graphQLRequest{}
+		r.marshalBody = r.graphQL
+		r.SetContentType(header.JsonContentType)
+	}
+	r.graphQL.OperationName = name
+	return r
+}
+
+// GraphQLErrors parses and returns the "errors" array of GraphQL response,
+// which can be used to detect a response that has status code 200 but with
+// errors. It returns nil if there is no error or the body is not a GraphQL
+// response.
+func (r *Response) GraphQLErrors() GraphQLErrors {
+	if r.Response == nil {
+		return nil
+	}
+	body := r.body
+	if body == nil {
+		body, _ = r.ToBytes()
+	}
+	if len(body) == 0 {
+		return nil
+	}
+	var resp struct {
+		Errors GraphQLErrors `json:"errors"`
+	}
+	if err := r.Request.client.jsonUnmarshal(body, &resp); err != nil {
+		return nil
+	}
+	return resp.Errors
+}
+
+func handleGraphQLErrors(c *Client, r *Response) error {
+	if !c.graphQLErrorsAsError || r.Request.graphQL == nil || r.Err != nil {
+		return nil
+	}
+	if errs := r.GraphQLErrors(); len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package req
+
+import (
+	"net/http"
+	urlpkg "net/url"
+	"strings"
+)
+
+// RequestGroup is the prototype of the requests, which holds the base path,
+// the default headers, query parameters, path parameters and middlewares of
+// a group of APIs, e.g. the users API, create it with Client.Group, and
+// create the requests with RequestGroup.R, which share the client and its
+// connection pool.
+//
+// The settings are resolved in the order of client < group < request, i.e.
+// the settings of the group override the common settings of the client, and
+// the settings of the request override the settings of the group, and the
+// settings of the nested group override the settings of its parent. The
+// group should be set up before creating the requests, it is not safe to
+// modify the group concurrently with creating the requests.
+type RequestGroup struct {
+	client        *Client
+	parent        *RequestGroup
+	pathPrefix    string
+	headers       http.Header
+	queryParams   urlpkg.Values
+	pathParams    map[string]string
+	beforeRequest []RequestMiddleware
+	afterResponse []ResponseMiddleware
+}
+
+// Group creates a RequestGroup of the client with the base path, which is
+// joined with the relative url of the requests created by the group, e.g.
+// the request of "/list" in the group of "/users" is sent to
+// "{BaseURL}/users/list". The absolute url of the request is not joined.
+func (c *Client) Group(pathPrefix string) *RequestGroup {
+	return &RequestGroup{client: c, pathPrefix: pathPrefix}
+}
+
+// Group creates a nested RequestGroup, which base path is joined with the
+// base path of g, and inherits the settings of g.
+func (g *RequestGroup) Group(pathPrefix string) *RequestGroup {
+	return &RequestGroup{client: g.client, parent: g, pathPrefix: pathPrefix}
+}
+
+// SetCommonHeader set a header for the requests created by the group.
+func (g *RequestGroup) SetCommonHeader(key, value string) *RequestGroup {
+	if g.headers == nil {
+		g.headers = make(http.Header)
+	}
+	g.headers.Set(key, value)
+	return g
+}
+
+// SetCommonHeaders set headers for the requests created by the group.
+func (g *RequestGroup) SetCommonHeaders(hdrs map[string]string) *RequestGroup {
+	for k, v := range hdrs {
+		g.SetCommonHeader(k, v)
+	}
+	return g
+}
+
+// SetCommonQueryParam set a URL query parameter for the requests created by
+// the group, which is overridden by the query parameter of the request with
+// the same key.
+func (g *RequestGroup) SetCommonQueryParam(key, value string) *RequestGroup {
+	if g.queryParams == nil {
+		g.queryParams = make(urlpkg.Values)
+	}
+	g.queryParams.Set(key, value)
+	return g
+}
+
+// SetCommonQueryParams set URL query parameters for the requests created
+// by the group.
+func (g *RequestGroup) SetCommonQueryParams(params map[string]string) *RequestGroup {
+	for k, v := range params {
+		g.SetCommonQueryParam(k, v)
+	}
+	return g
+}
+
+// AddCommonQueryParam add a value of the URL query parameter for the
+// requests created by the group.
+func (g *RequestGroup) AddCommonQueryParam(key, value string) *RequestGroup {
+	if g.queryParams == nil {
+		g.queryParams = make(urlpkg.Values)
+	}
+	g.queryParams.Add(key, value)
+	return g
+}
+
+// SetCommonPathParam set a path parameter for the requests created by the
+// group, which can also be used in the base path of the group.
+func (g *RequestGroup) SetCommonPathParam(key, value string) *RequestGroup {
+	if g.pathParams == nil {
+		g.pathParams = make(map[string]string)
+	}
+	g.pathParams[key] = value
+	return g
+}
+
+// SetCommonPathParams set path parameters for the requests created by the
+// group.
+func (g *RequestGroup) SetCommonPathParams(pathParams map[string]string) *RequestGroup {
+	for k, v := range pathParams {
+		g.SetCommonPathParam(k, v)
+	}
+	return g
+}
+
+// OnBeforeRequest add a request middleware for the requests created by the
+// group, which runs after the request middlewares of the client added by
+// Client.OnBeforeRequest, and the middlewares of the parent group run first.
+func (g *RequestGroup) OnBeforeRequest(m RequestMiddleware) *RequestGroup {
+	g.beforeRequest = append(g.beforeRequest, m)
+	return g
+}
+
+// OnAfterResponse add a response middleware for the requests created by the
+// group, which runs before the response middlewares added by
+// Request.OnAfterResponse, and the middlewares of the parent group run first.
+func (g *RequestGroup) OnAfterResponse(m ResponseMiddleware) *RequestGroup {
+	g.afterResponse = append(g.afterResponse, m)
+	return g
+}
+
+// PathPrefix returns the full base path of the group, which is joined with
+// the base paths of the parent groups.
+func (g *RequestGroup) PathPrefix() string {
+	var base string
+	if g.parent != nil {
+		base = g.parent.PathPrefix()
+	}
+	return strings.TrimRight(joinURLPath(base, g.pathPrefix), "/")
+}
+
+// chain returns the groups from the root to g.
+func (g *RequestGroup) chain() []*RequestGroup {
+	var groups []*RequestGroup
+	for ; g != nil; g = g.parent {
+		groups = append([]*RequestGroup{g}, groups...)
+	}
+	return groups
+}
+
+// R create a new request with the settings of the group.
+func (g *RequestGroup) R() *Request {
+	r := g.client.R()
+	r.pathPrefix = g.PathPrefix()
+	for _, gg := range g.chain() {
+		for k, vs := range gg.headers {
+			if r.Headers == nil {
+				r.Headers = make(http.Header)
+			}
+			r.Headers[k] = append([]string(nil), vs...)
+		}
+		for k, vs := range gg.queryParams {
+			if r.QueryParams == nil {
+				r.QueryParams = make(urlpkg.Values)
+			}
+			r.QueryParams[k] = append([]string(nil), vs...)
+		}
+		for k, v := range gg.pathParams {
+			if r.PathParams == nil {
+				r.PathParams = make(map[string]string)
+			}
+			r.PathParams[k] = v
+		}
+		r.beforeRequest = append(r.beforeRequest, gg.beforeRequest...)
+		r.afterResponse = append(r.afterResponse, gg.afterResponse...)
+	}
+	return r
+}
+
+// joinURLPath joins the base path and the path with a single slash.
+func joinURLPath(base, path string) string {
+	base = strings.TrimRight(base, "/")
+	if path == "" {
+		return base
+	}
+	if path[0] == '?' {
+		return base + path
+	}
+	return base + "/" + strings.TrimLeft(path, "/")
+}
@@ -0,0 +1,194 @@
+package req
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"net/http"
+
+	"github.com/imroc/req/v3/internal/compress"
+)
+
+// GzipIntegrityError is returned when reading the gzip response body whose
+// trailer does not match the decompressed data, see
+// Request.EnableGzipIntegrityCheck. It wraps gzip.ErrChecksum, or
+// io.ErrUnexpectedEOF if the body is truncated.
+type GzipIntegrityError struct {
+	// Member is the index of the gzip member which fails the check, the
+	// body may consist of the concatenated members.
+	Member int
+	// Truncated reports whether the body ends before the trailer of the
+	// member, the expected values are zero if it's true.
+	Truncated bool
+	// ExpectedCRC and ExpectedSize are the CRC32 and ISIZE in the trailer.
+	ExpectedCRC  uint32
+	ExpectedSize uint32
+	// ActualCRC and ActualSize are the CRC32 and size (modulo 2^32) of the
+	// decompressed data of the member.
+	ActualCRC  uint32
+	ActualSize uint32
+}
+
+func (e *GzipIntegrityError) Error() string {
+	if e.Truncated {
+		return fmt.Sprintf("req: gzip body is truncated in member %d after %d decompressed bytes", e.Member, e.ActualSize)
+	}
+	return fmt.Sprintf("req: gzip integrity check failed in member %d: expected crc32 %08x and size %d, got crc32 %08x and size %d",
+		e.Member, e.ExpectedCRC, e.ExpectedSize, e.ActualCRC, e.ActualSize)
+}
+
+func (e *GzipIntegrityError) Unwrap() error {
+	if e.Truncated {
+		return io.ErrUnexpectedEOF
+	}
+	return gzip.ErrChecksum
+}
+
+// EnableGzipIntegrityCheck verifies the CRC32 and ISIZE in the trailer of
+// the gzip response body which is decompressed automatically, reading the
+// body fails with GzipIntegrityError if the trailer does not match or the
+// body is truncated, rather than returning the corrupted data.
+//
+// The trailer is verified when the body is read to the end, which is the
+// case of the auto-read body and the unmarshal. Closing the body which is
+// not read to the end (e.g. the streamed body of DisableAutoReadResponse and
+// EnableUnbufferedBody) reads the rest of it to verify the trailer, and
+// returns the error from Close.
+func (r *Request) EnableGzipIntegrityCheck() *Request {
+	r.gzipIntegrityCheck = true
+	return r
+}
+
+// DisableGzipIntegrityCheck disables the gzip integrity check (see
+// EnableGzipIntegrityCheck), which is disabled by default.
+func (r *Request) DisableGzipIntegrityCheck() *Request {
+	r.gzipIntegrityCheck = false
+	return r
+}
+
+// checkGzipIntegrity replaces the gzip decompressor of the response body
+// with the one which verifies the trailer of each member.
+func checkGzipIntegrity(res *http.Response) {
+	switch body := res.Body.(type) {
+	case *gzipReader:
+		res.Body = &gzipIntegrityReader{body: body.body}
+	case *compress.GzipReader:
+		res.Body = &gzipIntegrityReader{body: body.GetUnderlyingBody()}
+	}
+}
+
+// gzipIntegrityReader decompresses the gzip body member by member, and
+// reports GzipIntegrityError if the trailer of the member does not match.
+type gzipIntegrityReader struct {
+	body io.ReadCloser // the compressed body
+	br   *gzipTrailerReader
+	zr   *gzip.Reader
+	crc  uint32 // of the current member
+	size uint32 // of the current member
+	n    int    // index of the current member
+	err  error  // sticky error
+}
+
+func (g *gzipIntegrityReader) Read(p []byte) (n int, err error) {
+	if g.err != nil {
+		return 0, g.err
+	}
+	if g.zr == nil {
+		g.br = &gzipTrailerReader{r: bufio.NewReader(g.body)}
+		if g.zr, err = gzip.NewReader(g.br); err != nil {
+			g.err = err
+			return 0, err
+		}
+		g.zr.Multistream(false)
+	}
+	n, err = g.zr.Read(p)
+	g.crc = crc32.Update(g.crc, crc32.IEEETable, p[:n])
+	g.size += uint32(n)
+	switch err {
+	case nil:
+	case io.EOF: // the member is verified.
+		g.n++
+		g.crc, g.size = 0, 0
+		if rerr := g.zr.Reset(g.br); rerr != nil {
+			if rerr != io.EOF {
+				err = rerr
+			}
+			g.err = err
+			return
+		}
+		g.zr.Multistream(false)
+		err = nil
+	case gzip.ErrChecksum:
+		g.err = &GzipIntegrityError{
+			Member:       g.n,
+			ExpectedCRC:  binary.LittleEndian.Uint32(g.br.tail[:4]),
+			ExpectedSize: binary.LittleEndian.Uint32(g.br.tail[4:]),
+			ActualCRC:    g.crc,
+			ActualSize:   g.size,
+		}
+		err = g.err
+	case io.ErrUnexpectedEOF:
+		g.err = &GzipIntegrityError{Member: g.n, Truncated: true, ActualCRC: g.crc, ActualSize: g.size}
+		err = g.err
+	default:
+		g.err = err
+	}
+	return
+}
+
+// Close reads the rest of the body to verify the trailer if it's not read
+// to the end.
+func (g *gzipIntegrityReader) Close() error {
+	var err error
+	if g.err == nil {
+		_, err = io.Copy(io.Discard, g)
+	}
+	g.err = fs.ErrClosed
+	if cerr := g.body.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (g *gzipIntegrityReader) GetUnderlyingBody() io.ReadCloser {
+	return g.body
+}
+
+func (g *gzipIntegrityReader) SetUnderlyingBody(body io.ReadCloser) {
+	g.body = body
+}
+
+// gzipTrailerReader records the last 8 bytes consumed by the gzip reader,
+// which are the trailer once the member ends. It implements io.ByteReader
+// so that the gzip reader does not read ahead of the member.
+type gzipTrailerReader struct {
+	r    *bufio.Reader
+	tail [8]byte
+}
+
+func (t *gzipTrailerReader) Read(p []byte) (n int, err error) {
+	n, err = t.r.Read(p)
+	t.record(p[:n])
+	return
+}
+
+func (t *gzipTrailerReader) ReadByte() (byte, error) {
+	b, err := t.r.ReadByte()
+	if err == nil {
+		t.record([]byte{b})
+	}
+	return b, err
+}
+
+func (t *gzipTrailerReader) record(b []byte) {
+	if len(b) >= len(t.tail) {
+		copy(t.tail[:], b[len(b)-len(t.tail):])
+		return
+	}
+	copy(t.tail[:], t.tail[len(b):])
+	copy(t.tail[len(t.tail)-len(b):], b)
+}
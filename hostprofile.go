@@ -0,0 +1,401 @@
+package req
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Protocol is the HTTP protocol version forced by the HostProfile.
+type Protocol string
+
+const (
+	// ProtocolAuto uses the protocol selection of the client (default).
+	ProtocolAuto Protocol = ""
+	// ProtocolHTTP1 forces using HTTP1.
+	ProtocolHTTP1 Protocol = Protocol(h1)
+	// ProtocolHTTP2 forces using HTTP2 for https requests.
+	ProtocolHTTP2 Protocol = Protocol(h2)
+	// ProtocolHTTP3 forces using HTTP3 for https requests.
+	ProtocolHTTP3 Protocol = Protocol(h3)
+)
+
+// HostProfile is the configuration which overrides the client settings for
+// the requests to the matched hosts, see Client.SetHostProfile. The zero
+// value of each field means inheriting the client settings.
+type HostProfile struct {
+	// Timeout overrides the timeout of the client (see Client.SetTimeout).
+	Timeout time.Duration
+	// Protocol overrides the protocol selection of the client.
+	Protocol Protocol
+	// Headers are the common headers of the matched host, which override
+	// the common headers of the client with the same key.
+	Headers http.Header
+	// RetryCount overrides the retry count of the client, a negative value
+	// means retrying infinitely, see DisableRetry to disable the retry.
+	RetryCount int
+	// DisableRetry disables the retry for the matched host.
+	DisableRetry bool
+	// RetryInterval overrides the retry interval of the client.
+	RetryInterval GetRetryIntervalFunc
+	// TLSClientConfig overrides the tls config of the client.
+	TLSClientConfig *tls.Config
+}
+
+// needTransport reports whether the profile requires a dedicated transport,
+// so that the connections are not shared with the hosts using a different
+// protocol or tls config.
+func (p *HostProfile) needTransport() bool {
+	return p.Protocol != ProtocolAuto || p.TLSClientConfig != nil
+}
+
+func (p *HostProfile) hasRetry() bool {
+	return p.RetryCount != 0 || p.DisableRetry || p.RetryInterval != nil
+}
+
+type hostProfileEntry struct {
+	pattern string
+	profile HostProfile
+
+	mu sync.Mutex
+	t  *Transport
+}
+
+// transport returns the dedicated transport of the profile, which is cloned
+// from the client transport when it is first used after being reset.
+func (e *hostProfileEntry) transport(c *Client) *Transport {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.t == nil {
+		t := c.Transport.Clone()
+		switch e.profile.Protocol {
+		case ProtocolHTTP1:
+			t.EnableForceHTTP1()
+		case ProtocolHTTP2:
+			t.EnableForceHTTP2()
+		case ProtocolHTTP3:
+			t.EnableForceHTTP3()
+		}
+		if e.profile.TLSClientConfig != nil {
+			t.SetTLSClientConfig(e.profile.TLSClientConfig.Clone())
+		}
+		e.t = t
+	}
+	return e.t
+}
+
+// resetTransport drops the dedicated transport, so that it is cloned again
+// with the latest client transport settings, the idle connections of the
+// dropped one are closed.
+func (e *hostProfileEntry) resetTransport() {
+	e.mu.Lock()
+	t := e.t
+	e.t = nil
+	e.mu.Unlock()
+	if t != nil {
+		t.CloseIdleConnections()
+	}
+}
+
+// resetHostProfileTransports resets the dedicated transports of the host
+// profiles after the client transport settings they are cloned from change.
+func (c *Client) resetHostProfileTransports() {
+	for _, e := range c.hostProfiles {
+		e.resetTransport()
+	}
+}
+
+// match reports whether the host matches the pattern, and returns the
+// priority of the match, the exact match takes precedence over the wildcard
+// match, and the longer wildcard takes precedence over the shorter one.
+func (e *hostProfileEntry) match(host string) (priority int, ok bool) {
+	if suffix, found := strings.CutPrefix(e.pattern, "*"); found {
+		if strings.HasSuffix(host, suffix) && len(host) > len(suffix) {
+			return len(suffix), true
+		}
+		return 0, false
+	}
+	if host == e.pattern {
+		return len(host) + 1, true
+	}
+	return 0, false
+}
+
+// SetHostProfile set the HostProfile which overrides the client settings
+// for the requests to the hosts matching the hostPattern, which is an exact
+// host (e.g. "api.example.com") or a wildcard (e.g. "*.internal.corp", which
+// matches all subdomains of "internal.corp" but not itself), the port is
+// ignored when matching. The settings of the request take precedence over
+// the host profile, which takes precedence over the client settings.
+//
+// The profile is matched before each request is built, and the connections
+// of the profile which overrides the protocol or tls config are not shared
+// with other hosts. Set the profile with the same hostPattern again to
+// replace it, use GetHostConfig to inspect the effective configuration.
+func (c *Client) SetHostProfile(hostPattern string, profile HostProfile) *Client {
+	pattern := normalizeHostPattern(hostPattern)
+	e := &hostProfileEntry{
+		pattern: pattern,
+		profile: profile,
+	}
+	e.profile.Headers = nil
+	for k, vs := range profile.Headers {
+		if e.profile.Headers == nil {
+			e.profile.Headers = make(http.Header)
+		}
+		e.profile.Headers[http.CanonicalHeaderKey(k)] = append([]string(nil), vs...)
+	}
+	profiles := make([]*hostProfileEntry, 0, len(c.hostProfiles)+1)
+	for _, p := range c.hostProfiles {
+		if p.pattern != pattern {
+			profiles = append(profiles, p)
+		}
+	}
+	c.hostProfiles = append(profiles, e)
+	c.httpClient.Transport = c.newHttpTransport()
+	return c
+}
+
+// SetHTTP1OnlyHosts forces using HTTP1 for the requests to the hosts, which
+// is the targeted workaround for the servers with buggy HTTP2, while other
+// hosts are left on the protocol selection of the client. The hosts are
+// exact hosts or wildcards like "*.example.com", see SetHostProfile, the
+// other settings of the existing host profile with the same pattern are kept.
+func (c *Client) SetHTTP1OnlyHosts(hosts ...string) *Client {
+	return c.setHostsProtocol(ProtocolHTTP1, hosts)
+}
+
+// SetHTTP2OnlyHosts is similar to SetHTTP1OnlyHosts, but forces using HTTP2
+// for the https requests to the hosts.
+func (c *Client) SetHTTP2OnlyHosts(hosts ...string) *Client {
+	return c.setHostsProtocol(ProtocolHTTP2, hosts)
+}
+
+// SetHeadersForHost set the common headers for the requests to the hosts
+// matching the hostPattern, which is an exact host or a wildcard like
+// "*.example.com", see SetHostProfile. The headers are merged into the
+// headers of the existing host profile with the same pattern, and override
+// the common headers of the client with the same key, while the headers set
+// by the request take precedence.
+func (c *Client) SetHeadersForHost(hostPattern string, headers map[string]string) *Client {
+	var profile HostProfile
+	pattern := normalizeHostPattern(hostPattern)
+	for _, e := range c.hostProfiles {
+		if e.pattern == pattern {
+			profile = e.profile
+			break
+		}
+	}
+	hdr := profile.Headers.Clone()
+	if hdr == nil {
+		hdr = make(http.Header)
+	}
+	for k, v := range headers {
+		hdr.Set(k, v)
+	}
+	profile.Headers = hdr
+	return c.SetHostProfile(pattern, profile)
+}
+
+func (c *Client) setHostsProtocol(protocol Protocol, hosts []string) *Client {
+	for _, host := range hosts {
+		var profile HostProfile
+		pattern := normalizeHostPattern(host)
+		for _, e := range c.hostProfiles {
+			if e.pattern == pattern {
+				profile = e.profile
+				break
+			}
+		}
+		profile.Protocol = protocol
+		c.SetHostProfile(pattern, profile)
+	}
+	return c
+}
+
+func normalizeHostPattern(hostPattern string) string {
+	pattern := strings.ToLower(hostPattern)
+	if !strings.HasPrefix(pattern, "*") {
+		pattern = hostWithoutPort(pattern)
+	}
+	return pattern
+}
+
+// hostProfile returns the best matching host profile of the host, returns
+// nil if no profile matches.
+func (c *Client) hostProfile(host string) *hostProfileEntry {
+	if len(c.hostProfiles) == 0 {
+		return nil
+	}
+	host = strings.ToLower(hostWithoutPort(host))
+	var (
+		best     *hostProfileEntry
+		priority int
+	)
+	for _, e := range c.hostProfiles {
+		if p, ok := e.match(host); ok && p > priority {
+			best, priority = e, p
+		}
+	}
+	return best
+}
+
+func cloneHostProfiles(profiles []*hostProfileEntry) []*hostProfileEntry {
+	if profiles == nil {
+		return nil
+	}
+	cloned := make([]*hostProfileEntry, len(profiles))
+	for i, e := range profiles {
+		cloned[i] = &hostProfileEntry{pattern: e.pattern, profile: e.profile}
+	}
+	return cloned
+}
+
+func hostWithoutPort(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+}
+
+// HostConfig is the effective configuration of the requests to the host,
+// which merges the matched HostProfile with the client settings.
+type HostConfig struct {
+	// Host is the inspected host.
+	Host string
+	// Pattern is the hostPattern of the matched HostProfile, empty if no
+	// profile matches.
+	Pattern string
+	// Timeout is the effective timeout.
+	Timeout time.Duration
+	// Protocol is the forced protocol, ProtocolAuto if not forced.
+	Protocol Protocol
+	// Headers are the effective common headers.
+	Headers http.Header
+	// RetryCount is the effective retry count.
+	RetryCount int
+	// TLSClientConfig is the effective tls config, which may be nil if the
+	// default tls config is used.
+	TLSClientConfig *tls.Config
+}
+
+// GetHostConfig returns the effective configuration of the requests to the
+// host, which is useful for debugging the host profiles set by SetHostProfile.
+// The settings of the single request is not included.
+func (c *Client) GetHostConfig(host string) *HostConfig {
+	hc := &HostConfig{
+		Host:            host,
+		Timeout:         c.httpClient.Timeout,
+		Protocol:        Protocol(c.Transport.forceHttpVersion),
+		Headers:         c.Headers.Clone(),
+		TLSClientConfig: c.TLSClientConfig,
+	}
+	if c.retryOption != nil {
+		hc.RetryCount = c.retryOption.MaxRetries
+	}
+	e := c.hostProfile(host)
+	if e == nil {
+		return hc
+	}
+	p := &e.profile
+	hc.Pattern = e.pattern
+	if p.Timeout > 0 {
+		hc.Timeout = p.Timeout
+	}
+	if p.Protocol != ProtocolAuto {
+		hc.Protocol = p.Protocol
+	}
+	if len(p.Headers) > 0 {
+		if hc.Headers == nil {
+			hc.Headers = make(http.Header)
+		}
+		for k, vs := range p.Headers {
+			hc.Headers[k] = vs
+		}
+	}
+	if p.DisableRetry {
+		hc.RetryCount = 0
+	} else if p.RetryCount != 0 {
+		hc.RetryCount = p.RetryCount
+	}
+	if p.TLSClientConfig != nil {
+		hc.TLSClientConfig = p.TLSClientConfig
+	}
+	return hc
+}
+
+// applyHostProfile applies the headers and retry settings of the matched host
+// profile to the request, which do not override the request settings. It
+// runs before the common headers are merged, the url is resolved without
+// modifying the request, which is parsed by parseRequestURL later.
+func applyHostProfile(c *Client, r *Request) error {
+	if len(c.hostProfiles) == 0 {
+		return nil
+	}
+	u, err := buildRequestURL(c, r)
+	if err != nil {
+		return nil // reported by parseRequestURL.
+	}
+	e := c.hostProfile(u.Host)
+	if e == nil {
+		return nil
+	}
+	p := &e.profile
+	if len(p.Headers) > 0 {
+		if r.Headers == nil {
+			r.Headers = make(http.Header)
+		}
+		for k, vs := range p.Headers {
+			if len(r.Headers[k]) == 0 {
+				r.Headers[k] = vs
+			}
+		}
+	}
+	if r.RetryAttempt == 0 && !r.retryOptionModified && p.hasRetry() {
+		ro := c.retryOption.Clone()
+		if ro == nil {
+			ro = newDefaultRetryOption()
+		}
+		if p.DisableRetry {
+			ro.MaxRetries = 0
+		} else if p.RetryCount != 0 {
+			ro.MaxRetries = p.RetryCount
+		}
+		if p.RetryInterval != nil {
+			ro.GetRetryInterval = p.RetryInterval
+			ro.RetryInterval = nil
+		}
+		r.retryOption = ro
+	}
+	return nil
+}
+
+// httpClientFor returns the http.Client which applies the timeout of the
+// host profile matched by the request.
+func (c *Client) httpClientFor(r *Request) *http.Client {
+	if len(c.hostProfiles) == 0 || r.URL == nil {
+		return c.httpClient
+	}
+	if e := c.hostProfile(r.URL.Host); e != nil && e.profile.Timeout > 0 {
+		hc := *c.httpClient
+		hc.Timeout = e.profile.Timeout
+		return &hc
+	}
+	return c.httpClient
+}
+
+// hostProfileTransport selects the dedicated transport of the host profile
+// for each request, including the redirected ones.
+type hostProfileTransport struct {
+	c *Client
+}
+
+func (t *hostProfileTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if e := t.c.hostProfile(req.URL.Host); e != nil && e.profile.needTransport() {
+		return e.transport(t.c).RoundTrip(req)
+	}
+	return t.c.Transport.RoundTrip(req)
+}
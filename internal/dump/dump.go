@@ -4,8 +4,24 @@ import (
 	"context"
 	"io"
 	"net/http"
+	"sync"
+	"sync/atomic"
 )
 
+// OverflowPolicy controls the behavior when the buffer of async dump is full.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock blocks until the buffer has room.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropOldest drops the oldest dump in the buffer.
+	OverflowDropOldest
+	// OverflowDropNewest drops the dump which is being added.
+	OverflowDropNewest
+)
+
+const defaultAsyncBufferSize = 20
+
 // Options controls the dump behavior.
 type Options interface {
 	Output() io.Writer
@@ -18,6 +34,8 @@ type Options interface {
 	ResponseHeader() bool
 	ResponseBody() bool
 	Async() bool
+	AsyncBufferSize() int
+	AsyncOverflowPolicy() OverflowPolicy
 	Clone() Options
 }
 
@@ -119,19 +137,32 @@ func (ds Dumpers) DumpResponseHeader(p []byte) {
 // Dumper is the dump tool.
 type Dumper struct {
 	Options
-	ch chan *dumpTask
+	ch      chan *dumpTask
+	done    chan struct{}
+	dropped atomic.Int64
+	// session is not nil if the Dumper collects the dump of a single request.
+	session *Session
 }
 
-type dumpTask struct {
+type dumpPart struct {
 	Data   []byte
 	Output io.Writer
 }
 
+type dumpTask struct {
+	Parts []dumpPart
+}
+
 // NewDumper create a new Dumper.
 func NewDumper(opt Options) *Dumper {
+	size := opt.AsyncBufferSize()
+	if size <= 0 {
+		size = defaultAsyncBufferSize
+	}
 	d := &Dumper{
 		Options: opt,
-		ch:      make(chan *dumpTask, 20),
+		ch:      make(chan *dumpTask, size),
+		done:    make(chan struct{}),
 	}
 	return d
 }
@@ -144,9 +175,59 @@ func (d *Dumper) Clone() *Dumper {
 	if d == nil {
 		return nil
 	}
-	return &Dumper{
-		Options: d.Options.Clone(),
-		ch:      make(chan *dumpTask, 20),
+	return NewDumper(d.Options.Clone())
+}
+
+// Dropped returns the number of async dumps dropped by the overflow policy.
+func (d *Dumper) Dropped() int64 {
+	return d.dropped.Load()
+}
+
+// submit queues the async dump, which is dropped if the Dumper has been
+// stopped, e.g. the Session of an in-flight request is committed after
+// DisableDump, since no one consumes the queue.
+func (d *Dumper) submit(t *dumpTask) {
+	select {
+	case <-d.done:
+		d.dropped.Add(1)
+		return
+	default:
+	}
+	switch d.AsyncOverflowPolicy() {
+	case OverflowDropNewest:
+		select {
+		case d.ch <- t:
+		default:
+			d.dropped.Add(1)
+		}
+	case OverflowDropOldest:
+		for {
+			select {
+			case d.ch <- t:
+				return
+			default:
+			}
+			select {
+			case old := <-d.ch:
+				if old == nil { // never drop the stop signal, but drop t since the Dumper is stopping.
+					d.dropped.Add(1)
+					select {
+					case d.ch <- old:
+					default: // the queue is refilled by the concurrent producers.
+						go func() { d.ch <- old }()
+					}
+					return
+				}
+				d.dropped.Add(1)
+			default:
+			}
+		}
+	default:
+		select {
+		case d.ch <- t:
+		case <-d.done:
+			d.dropped.Add(1)
+		}
 	}
 }
 
@@ -154,10 +235,14 @@ func (d *Dumper) DumpTo(p []byte, output io.Writer) {
 	if len(p) == 0 || output == nil {
 		return
 	}
+	if d.session != nil {
+		d.session.add(p, output)
+		return
+	}
 	if d.Async() {
 		b := make([]byte, len(p))
 		copy(b, p)
-		d.ch <- &dumpTask{Data: b, Output: output}
+		d.submit(&dumpTask{Parts: []dumpPart{{Data: b, Output: output}}})
 		return
 	}
 	output.Write(p)
@@ -183,34 +268,146 @@ func (d *Dumper) DumpResponseBody(p []byte) {
 	d.DumpTo(p, d.ResponseBodyOutput())
 }
 
+// Stop stops the Dumper, and waits until the buffered dumps are written.
 func (d *Dumper) Stop() {
 	d.ch <- nil
+	<-d.done
 }
 
 func (d *Dumper) Start() {
+	defer close(d.done)
 	for t := range d.ch {
 		if t == nil {
 			return
 		}
-		t.Output.Write(t.Data)
+		for _, p := range t.Parts {
+			p.Output.Write(p.Data)
+		}
+	}
+}
+
+// Session collects the async dump of a single request, and submits it to
+// the Dumper as a whole when committed, so that the dump of concurrent
+// requests will not be interleaved in the output.
+type Session struct {
+	parent    *Dumper
+	dumper    *Dumper
+	mu        sync.Mutex
+	parts     []dumpPart
+	committed bool
+}
+
+// NewSession creates a Session for a single request, returns nil if the
+// Dumper is not async.
+func (d *Dumper) NewSession() *Session {
+	if d == nil || !d.Async() {
+		return nil
+	}
+	s := &Session{parent: d}
+	s.dumper = &Dumper{Options: d.Options, session: s}
+	return s
+}
+
+func (s *Session) add(p []byte, output io.Writer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.committed { // dump after committed, e.g. the body is read after closed.
+		s.parent.DumpTo(p, output)
+		return
+	}
+	if n := len(s.parts); n > 0 && s.parts[n-1].Output == output {
+		s.parts[n-1].Data = append(s.parts[n-1].Data, p...)
+		return
+	}
+	b := make([]byte, len(p))
+	copy(b, p)
+	s.parts = append(s.parts, dumpPart{Data: b, Output: output})
+}
+
+// Commit submits the collected dump to the Dumper, it's safe to call
+// multiple times, and never blocks after the Dumper is stopped.
+func (s *Session) Commit() {
+	s.mu.Lock()
+	if s.committed {
+		s.mu.Unlock()
+		return
+	}
+	s.committed = true
+	parts := s.parts
+	s.parts = nil
+	s.mu.Unlock()
+	if len(parts) > 0 {
+		s.parent.submit(&dumpTask{Parts: parts})
+	}
+}
+
+// WrapReadCloser wraps the response body which commits the Session
+// when the body is read to EOF or closed.
+func (s *Session) WrapReadCloser(rc io.ReadCloser) io.ReadCloser {
+	return &sessionReadCloser{ReadCloser: rc, s: s}
+}
+
+type sessionReadCloser struct {
+	io.ReadCloser
+	s *Session
+}
+
+func (r *sessionReadCloser) Read(p []byte) (n int, err error) {
+	n, err = r.ReadCloser.Read(p)
+	if err != nil {
+		r.s.Commit()
 	}
+	return
+}
+
+func (r *sessionReadCloser) Close() error {
+	err := r.ReadCloser.Close()
+	r.s.Commit()
+	return err
+}
+
+type sessionKeyType int
+
+const sessionKey sessionKeyType = iota
+
+// WithSession returns a copy of ctx with the Session, which replaces
+// the Dumper of the Session in GetDumpers.
+func WithSession(ctx context.Context, s *Session) context.Context {
+	return context.WithValue(ctx, sessionKey, s)
 }
 
 type dumperKeyType int
 
 const DumperKey dumperKeyType = iota
 
+type wireHashKeyType int
+
+// WireHashKey is the context key of the Dumper which receives the dump of a
+// single request in order to hash it, which is returned by GetDumpers in
+// addition to the Dumper of DumperKey.
+const WireHashKey wireHashKeyType = iota
+
 func GetDumpers(ctx context.Context, dump *Dumper) []*Dumper {
 	dumps := []*Dumper{}
-	if dump != nil {
-		dumps = append(dumps, dump)
-	}
 	if ctx == nil {
+		if dump != nil {
+			dumps = append(dumps, dump)
+		}
 		return dumps
 	}
+	if dump != nil {
+		if s, ok := ctx.Value(sessionKey).(*Session); ok && s.parent == dump {
+			dumps = append(dumps, s.dumper)
+		} else {
+			dumps = append(dumps, dump)
+		}
+	}
 	if d, ok := ctx.Value(DumperKey).(*Dumper); ok {
 		dumps = append(dumps, d)
 	}
+	if d, ok := ctx.Value(WireHashKey).(*Dumper); ok {
+		dumps = append(dumps, d)
+	}
 	return dumps
 }
 
@@ -9,6 +9,8 @@ import (
 	"errors"
 	"net"
 	"net/http"
+	"strconv"
+	"strings"
 	"sync"
 )
 
@@ -33,7 +35,7 @@ type clientConnPool struct {
 	mu sync.Mutex // TODO: maybe switch to RWMutex
 	// TODO: add support for sharing conns based on cert names
 	// (e.g. share conn for googleapis.com and appspot.com)
-	conns        map[string][]*ClientConn // key is host:port
+	conns        map[string][]*ClientConn // key is host:port, see poolKey
 	dialing      map[string]*dialCall     // currently in-flight dials
 	keys         map[*ClientConn][]string
 	addConnCalls map[string]*addConnCall // in-flight addConnIfNeeded calls
@@ -51,9 +53,10 @@ func (p *clientConnPool) GetClientConn(req *http.Request, addr string, dialOnMis
 		}
 		return cc, nil
 	}
+	key := poolKey(addr, p.t.GetTLSIdentity())
 	for {
 		p.mu.Lock()
-		for _, cc := range p.conns[addr] {
+		for _, cc := range p.conns[key] {
 			if cc.ReserveNewRequest() {
 				// When a connection is presented to us by the net/http package,
 				// the GetConn hook has already been called.
@@ -71,7 +74,7 @@ func (p *clientConnPool) GetClientConn(req *http.Request, addr string, dialOnMis
 			return nil, ErrNoCachedConn
 		}
 		traceGetConn(req, addr)
-		call := p.getStartDialLocked(req.Context(), addr)
+		call := p.getStartDialLocked(req.Context(), key, addr)
 		p.mu.Unlock()
 		<-call.done
 		if shouldRetryDial(call, req) {
@@ -100,8 +103,8 @@ type dialCall struct {
 }
 
 // requires p.mu is held.
-func (p *clientConnPool) getStartDialLocked(ctx context.Context, addr string) *dialCall {
-	if call, ok := p.dialing[addr]; ok {
+func (p *clientConnPool) getStartDialLocked(ctx context.Context, key, addr string) *dialCall {
+	if call, ok := p.dialing[key]; ok {
 		// A dial is already in-flight. Don't start another.
 		return call
 	}
@@ -109,20 +112,20 @@ func (p *clientConnPool) getStartDialLocked(ctx context.Context, addr string) *d
 	if p.dialing == nil {
 		p.dialing = make(map[string]*dialCall)
 	}
-	p.dialing[addr] = call
-	go call.dial(call.ctx, addr)
+	p.dialing[key] = call
+	go call.dial(call.ctx, key, addr)
 	return call
 }
 
 // run in its own goroutine.
-func (c *dialCall) dial(ctx context.Context, addr string) {
+func (c *dialCall) dial(ctx context.Context, key, addr string) {
 	const singleUse = false // shared conn
 	c.res, c.err = c.p.t.dialClientConn(ctx, addr, singleUse)
 
 	c.p.mu.Lock()
-	delete(c.p.dialing, addr)
+	delete(c.p.dialing, key)
 	if c.err == nil {
-		c.p.addConnLocked(addr, c.res)
+		c.p.addConnLocked(key, c.res)
 	}
 	c.p.mu.Unlock()
 
@@ -240,6 +243,41 @@ func (p *clientConnPool) CloseIdleConnections() {
 	}
 }
 
+// ClientConns returns the cached connections of the default pool, keyed by
+// "host:port", returns nil if a custom ConnPool is used.
+func (t *Transport) ClientConns() map[string][]*ClientConn {
+	p, ok := t.connPool().(*clientConnPool)
+	if !ok {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	conns := make(map[string][]*ClientConn, len(p.conns))
+	for key, vv := range p.conns {
+		addr := poolKeyAddr(key)
+		conns[addr] = append(conns[addr], vv...)
+	}
+	return conns
+}
+
+// poolKey returns the key of the pooled connections to addr, which includes
+// the TLSIdentity so the connections built with the different tls handshakes
+// are never pooled together.
+func poolKey(addr string, tlsIdentity uint64) string {
+	if tlsIdentity == 0 {
+		return addr
+	}
+	return addr + "#" + strconv.FormatUint(tlsIdentity, 10)
+}
+
+// poolKeyAddr returns the "host:port" of the pool key.
+func poolKeyAddr(key string) string {
+	if i := strings.LastIndexByte(key, '#'); i >= 0 {
+		return key[:i]
+	}
+	return key
+}
+
 func filterOutClientConn(in []*ClientConn, exclude *ClientConn) []*ClientConn {
 	out := in[:0]
 	for _, v := range in {
@@ -85,6 +85,10 @@ func streamError(id uint32, code ErrCode) StreamError {
 	return StreamError{StreamID: id, Code: code}
 }
 
+func (e StreamError) Unwrap() error {
+	return e.Cause
+}
+
 func (e StreamError) Error() string {
 	if e.Cause != nil {
 		return fmt.Sprintf("stream error: stream ID %d; %v; %v", e.StreamID, e.Code, e.Cause)
@@ -18,6 +18,7 @@ import (
 
 	"github.com/imroc/req/v3/http2"
 	"github.com/imroc/req/v3/internal/dump"
+	"github.com/imroc/req/v3/internal/transport"
 	"golang.org/x/net/http/httpguts"
 	"golang.org/x/net/http2/hpack"
 )
@@ -1546,6 +1547,12 @@ func (mh *MetaHeadersFrame) checkPseudos() error {
 	return nil
 }
 
+// headerListTooLargeError returns the error of the response headers which
+// exceed the max header list size.
+func (h2f *Framer) headerListTooLargeError() error {
+	return &transport.ResponseHeaderTooLargeError{Proto: "HTTP/2.0", Limit: int64(h2f.maxHeaderListSize())}
+}
+
 func (fr *Framer) maxHeaderStringLen() int {
 	v := int(fr.maxHeaderListSize())
 	if v < 0 {
@@ -1638,6 +1645,7 @@ func (h2f *Framer) readMetaFrame(hf *HeadersFrame, dumps []*dump.Dumper) (Frame,
 			if VerboseLogs {
 				log.Printf("http2: header list too large")
 			}
+			h2f.errDetail = h2f.headerListTooLargeError()
 			// It would be nice to send a RST_STREAM before sending the GOAWAY,
 			// but the structure of the server's frame writer makes this difficult.
 			return mh, ConnectionError(ErrCodeProtocol)
@@ -1656,6 +1664,9 @@ func (h2f *Framer) readMetaFrame(hf *HeadersFrame, dumps []*dump.Dumper) (Frame,
 		}
 
 		if _, err := hdec.Write(frag); err != nil {
+			if errors.Is(err, hpack.ErrStringLength) {
+				h2f.errDetail = h2f.headerListTooLargeError()
+			}
 			return mh, ConnectionError(ErrCodeCompression)
 		}
 
@@ -9,6 +9,8 @@ import (
 	"net/http/httptrace"
 	"net/textproto"
 	"time"
+
+	"github.com/imroc/req/v3/internal/transport"
 )
 
 func traceHasWroteHeaderField(trace *httptrace.ClientTrace) bool {
@@ -37,6 +39,7 @@ func traceGetConn(req *http.Request, hostPort string) {
 }
 
 func traceGotConn(req *http.Request, cc *ClientConn, reused bool) {
+	transport.RecordConn(req.Context(), cc.tconn, reused)
 	trace := httptrace.ContextClientTrace(req.Context())
 	if trace == nil || trace.GotConn == nil {
 		return
@@ -448,11 +448,28 @@ func authorityAddr(scheme string, authority string) (addr string) {
 	return net.JoinHostPort(host, port)
 }
 
-func (t *Transport) AddConn(conn net.Conn, addr string) (used bool, err error) {
-	used, err = t.connPool().AddConnIfNeeded(addr, t, conn)
+// AddConn adds the connection to addr built with the tls handshake of
+// tlsIdentity (see transport.Options.TLSIdentity) into the pool if needed.
+func (t *Transport) AddConn(conn net.Conn, addr string, tlsIdentity uint64) (used bool, err error) {
+	used, err = t.connPool().AddConnIfNeeded(poolKey(addr, tlsIdentity), t, conn)
 	return
 }
 
+// Preconnect dials a connection to addr if there is no cached one, which is
+// put into the pool for the subsequent requests.
+func (t *Transport) Preconnect(ctx context.Context, addr string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://"+addr+"/", nil)
+	if err != nil {
+		return err
+	}
+	cc, err := t.connPool().GetClientConn(req, addr, true)
+	if err != nil {
+		return err
+	}
+	cc.decrStreamReservations()
+	return nil
+}
+
 // RoundTripOpt is like RoundTrip, but takes options.
 func (t *Transport) RoundTripOpt(req *http.Request, opt RoundTripOpt) (*http.Response, error) {
 	if !(req.URL.Scheme == "https" || (req.URL.Scheme == "http" && t.AllowHTTP)) {
@@ -581,7 +598,7 @@ func (t *Transport) dialClientConn(ctx context.Context, addr string, singleUse b
 	if err != nil {
 		return nil, err
 	}
-	return t.newClientConn(tconn, singleUse)
+	return t.newClientConn(t.WrapWireCapture(tconn), singleUse)
 }
 
 func (t *Transport) newTLSConfig(host string) *tls.Config {
@@ -600,6 +617,15 @@ func (t *Transport) newTLSConfig(host string) *tls.Config {
 
 var zeroDialer net.Dialer
 
+// netDialer returns the dialer of the connection to addr, which applies
+// the SocketOptions and the DialGuard.
+func (t *Transport) netDialer(addr string) *net.Dialer {
+	if d := t.GuardDialer(t.SocketDialer(t.Dialer), addr); d != nil {
+		return d
+	}
+	return &zeroDialer
+}
+
 type tlsHandshakeTimeoutError struct{}
 
 func (tlsHandshakeTimeoutError) Timeout() bool   { return true }
@@ -610,7 +636,8 @@ func (tlsHandshakeTimeoutError) Error() string   { return "net/http: TLS handsha
 // connection.
 func (t *Transport) dialTLSWithContext(ctx context.Context, network, addr string, cfg *tls.Config) (reqtls.Conn, error) {
 	if t.TLSHandshakeContext != nil {
-		conn, err := zeroDialer.DialContext(ctx, network, addr)
+		d := t.netDialer(addr)
+		conn, err := t.DialResolved(ctx, d, network, addr, d.DialContext)
 		if err != nil {
 			return nil, err
 		}
@@ -654,10 +681,12 @@ func (t *Transport) dialTLSWithContext(ctx context.Context, network, addr string
 			return tlsCn, nil
 		}
 	} else {
+		d := t.netDialer(addr)
 		dialer := &tls.Dialer{
-			Config: cfg,
+			NetDialer: d,
+			Config:    cfg,
 		}
-		conn, err := dialer.DialContext(ctx, network, addr)
+		conn, err := t.DialResolved(ctx, d, network, addr, dialer.DialContext)
 		if err != nil {
 			return nil, err
 		}
@@ -667,12 +696,21 @@ func (t *Transport) dialTLSWithContext(ctx context.Context, network, addr string
 }
 
 func (t *Transport) dialTLS(ctx context.Context) func(string, string, *tls.Config) (net.Conn, error) {
-	if t.DialTLS != nil {
-		return t.DialTLS
-	}
-	if t.DialTLSContext != nil {
-		return func(network string, addr string, cfg *tls.Config) (net.Conn, error) {
-			return t.DialTLSContext(ctx, network, addr)
+	if t.DialTLS != nil || t.DialTLSContext != nil {
+		return func(network string, addr string, cfg *tls.Config) (conn net.Conn, err error) {
+			if t.DialTLS != nil {
+				conn, err = t.DialTLS(network, addr, cfg)
+			} else {
+				conn, err = t.DialTLSContext(ctx, network, addr)
+			}
+			if err != nil {
+				return nil, err
+			}
+			if err = t.GuardConn(ctx, network, addr, conn); err != nil {
+				conn.Close()
+				return nil, err
+			}
+			return conn, nil
 		}
 	}
 	return func(network, addr string, cfg *tls.Config) (net.Conn, error) {
@@ -1177,8 +1215,8 @@ func (cc *ClientConn) RoundTrip(req *http.Request) (*http.Response, error) {
 }
 
 func (cc *ClientConn) roundTrip(req *http.Request, streamf func(*clientStream)) (*http.Response, error) {
-	if cc.t != nil && cc.t.Debugf != nil {
-		cc.t.Debugf("HTTP/2 %s %s", req.Method, req.URL.String())
+	if cc.t != nil {
+		cc.t.DebugfContext(req.Context(), "HTTP/2 %s %s", req.Method, req.URL.String())
 	}
 	ctx := req.Context()
 	cs := &clientStream{
@@ -1198,6 +1236,7 @@ func (cc *ClientConn) roundTrip(req *http.Request, streamf func(*clientStream))
 
 	// TODO(bradfitz): this is a copy of the logic in net/http. Unify somewhere?
 	if !cc.t.DisableCompression &&
+		!transport.IsAutoDecompressDisabled(ctx) &&
 		req.Header.Get("Accept-Encoding") == "" &&
 		req.Header.Get("Range") == "" &&
 		!cs.isHead {
@@ -1230,7 +1269,7 @@ func (cc *ClientConn) roundTrip(req *http.Request, streamf func(*clientStream))
 
 	handleResponseHeaders := func() (*http.Response, error) {
 		res := cs.res
-		if res.StatusCode > 299 {
+		if res.StatusCode > 299 || transport.IsEarlyResponseEnabled(ctx) {
 			// On error or status code 3xx, 4xx, 5xx, etc abort any
 			// ongoing write, assuming that the server doesn't care
 			// about our request body. If the server replied with 1xx or
@@ -1239,7 +1278,8 @@ func (cc *ClientConn) roundTrip(req *http.Request, streamf func(*clientStream))
 			// golang.org/issue/13444). If it turns out the server
 			// doesn't, they'll RST_STREAM us soon enough. This is a
 			// heuristic to avoid adding knobs to Transport. Hopefully
-			// we can keep it.
+			// we can keep it. The early response (see
+			// transport.WithEarlyResponse) aborts it on any status.
 			cs.abortRequestBodyWrite()
 		}
 		res.Request = req
@@ -1501,7 +1541,7 @@ func (cs *clientStream) encodeAndWriteHeaders(req *http.Request, dumps []*dump.D
 	// Write the request.
 	endStream := !hasBody && !hasTrailers
 	cs.sentHeaders = true
-	err = cc.writeHeaders(cs.ID, endStream, int(cc.maxFrameSize), hdrs)
+	err = cc.writeHeaders(cs.ID, endStream, int(cc.maxFrameSize), hdrs, cc.headerPriority(ctx))
 	traceWroteHeaders(cs.trace)
 	return err
 }
@@ -1603,8 +1643,19 @@ func (cc *ClientConn) awaitOpenSlotForStreamLocked(cs *clientStream) error {
 	}
 }
 
+// headerPriority returns the priority param of the HEADERS frame, the
+// weight of HeaderPriority is replaced by the one mapped from the priority
+// of the request if both are set.
+func (cc *ClientConn) headerPriority(ctx context.Context) http2.PriorityParam {
+	priority := cc.t.HeaderPriority
+	if p := transport.GetPriority(ctx); p != 0 && priority != (http2.PriorityParam{}) {
+		priority.Weight = uint8(255 - 36*transport.Urgency(p))
+	}
+	return priority
+}
+
 // requires cc.wmu be held
-func (cc *ClientConn) writeHeaders(streamID uint32, endStream bool, maxFrameSize int, hdrs []byte) error {
+func (cc *ClientConn) writeHeaders(streamID uint32, endStream bool, maxFrameSize int, hdrs []byte, priority http2.PriorityParam) error {
 	first := true // first frame written (HEADERS is first, then CONTINUATION)
 	for len(hdrs) > 0 && cc.werr == nil {
 		chunk := hdrs
@@ -1619,7 +1670,7 @@ func (cc *ClientConn) writeHeaders(streamID uint32, endStream bool, maxFrameSize
 				BlockFragment: chunk,
 				EndStream:     endStream,
 				EndHeaders:    endHeaders,
-				Priority:      cc.t.HeaderPriority,
+				Priority:      priority,
 			})
 			first = false
 		} else {
@@ -1819,7 +1870,7 @@ func (cs *clientStream) writeRequestBody(req *http.Request, dumps []*dump.Dumper
 	// Two ways to send END_STREAM: either with trailers, or
 	// with an empty DATA frame.
 	if len(trls) > 0 {
-		err = cc.writeHeaders(cs.ID, true, maxFrameSize, trls)
+		err = cc.writeHeaders(cs.ID, true, maxFrameSize, trls, cc.t.HeaderPriority)
 	} else {
 		err = cc.fr.WriteData(cs.ID, true, nil)
 	}
@@ -2369,6 +2420,15 @@ func (rl *clientConnReadLoop) run() error {
 			}
 			continue
 		} else if err != nil {
+			// the headers exceeding the limit close the connection, fail the
+			// stream with the detail.
+			if he, ok := cc.fr.errDetail.(*transport.ResponseHeaderTooLargeError); ok {
+				if mh, ok := f.(*MetaHeadersFrame); ok {
+					if cs := rl.streamByID(mh.StreamID); cs != nil {
+						rl.endStreamError(cs, he)
+					}
+				}
+			}
 			cc.countReadFrameError(err)
 			return err
 		}
@@ -2496,7 +2556,7 @@ func foreachHeaderElement(v string, fn func(string)) {
 // frame (currently only used for 1xx responses).
 func (rl *clientConnReadLoop) handleResponse(cs *clientStream, f *MetaHeadersFrame) (*http.Response, error) {
 	if f.Truncated {
-		return nil, errResponseHeaderListSize
+		return nil, &transport.ResponseHeaderTooLargeError{Proto: "HTTP/2.0", Limit: int64(rl.cc.fr.maxHeaderListSize())}
 	}
 
 	status := f.PseudoValue("status")
@@ -2509,6 +2569,13 @@ func (rl *clientConnReadLoop) handleResponse(cs *clientStream, f *MetaHeadersFra
 	}
 
 	regularFields := f.RegularFields()
+	if statusCode > 199 && transport.WantRawHeaders(cs.ctx) {
+		rawHeaders := make([]transport.HeaderField, len(regularFields))
+		for i, hf := range regularFields {
+			rawHeaders[i] = transport.HeaderField{Key: hf.Name, Value: hf.Value}
+		}
+		transport.RecordRawHeaders(cs.ctx, rawHeaders)
+	}
 	strs := make([]string, len(regularFields))
 	header := make(http.Header, len(regularFields))
 	res := &http.Response{
@@ -2609,7 +2676,7 @@ func (rl *clientConnReadLoop) handleResponse(cs *clientStream, f *MetaHeadersFra
 		res.ContentLength = -1
 		res.Body = compress.NewGzipReader(res.Body)
 		res.Uncompressed = true
-	} else if cs.cc.t.AutoDecompression {
+	} else if cs.cc.t.AutoDecompression && !transport.IsAutoDecompressDisabled(cs.ctx) {
 		contentEncoding := res.Header.Get("Content-Encoding")
 		if contentEncoding != "" {
 			res.Header.Del("Content-Encoding")
@@ -3141,10 +3208,7 @@ func (cc *ClientConn) writeStreamReset(streamID uint32, code ErrCode, err error)
 	cc.wmu.Unlock()
 }
 
-var (
-	errResponseHeaderListSize = errors.New("http2: response header list larger than advertised limit")
-	errRequestHeaderListSize  = errors.New("http2: request header list larger than peer's advertised limit")
-)
+var errRequestHeaderListSize = errors.New("http2: request header list larger than peer's advertised limit")
 
 func (cc *ClientConn) logf(format string, args ...any) {
 	cc.t.logf(format, args...)
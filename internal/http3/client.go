@@ -203,6 +203,8 @@ func (c *ClientConn) RoundTrip(req *http.Request) (*http.Response, error) {
 	if err != nil && req.Context().Err() != nil {
 		// if the context was canceled, return the context cancellation error
 		err = req.Context().Err()
+	} else {
+		err = wrapConnectionError(c.conn, err, err)
 	}
 	return rsp, err
 }
@@ -274,7 +276,7 @@ func (c *ClientConn) roundTrip(req *http.Request) (*http.Response, error) {
 	if err != nil { // if any error occurred
 		close(reqDone)
 		<-done
-		return nil, maybeReplaceError(err)
+		return nil, wrapConnectionError(c.conn, err, maybeReplaceError(err))
 	}
 	return rsp, maybeReplaceError(err)
 }
@@ -297,6 +299,23 @@ func (c *ClientConn) CloseWithError(code ErrCode, msg string) error {
 	return c.conn.CloseWithError(quic.ApplicationErrorCode(code), msg)
 }
 
+// CloseCause returns the QUIC application error code and reason if the
+// connection was closed with an application error (e.g. CloseWithError of
+// the peer), and the error which caused the connection to close. It returns
+// zero values if the connection is not closed.
+func (c *ClientConn) CloseCause() (code uint64, reason string, err error) {
+	ctx := c.conn.Context()
+	if ctx.Err() == nil {
+		return 0, "", nil
+	}
+	err = context.Cause(ctx)
+	var appErr *quic.ApplicationError
+	if errors.As(err, &appErr) {
+		return uint64(appErr.ErrorCode), appErr.ErrorMessage, err
+	}
+	return 0, "", err
+}
+
 // Context returns a context that is cancelled when the connection is closed.
 func (c *ClientConn) Context() context.Context {
 	return c.conn.Context()
@@ -322,11 +341,14 @@ func (c *ClientConn) sendRequestBody(str *RequestStream, body io.ReadCloser, con
 	buf := make([]byte, bodyCopyBufferSize)
 	sr := &cancelingReader{str: str, r: body}
 	var w io.Writer = str
-	if len(dumps) > 0 {
-		for _, d := range dumps {
+	var bodyDumps []*dump.Dumper
+	for _, d := range dumps {
+		if d.RequestBody() {
+			bodyDumps = append(bodyDumps, d)
 			w = io.MultiWriter(w, d.RequestBodyOutput())
 		}
 	}
+	dumps = bodyDumps
 	writeTail := func() {
 		for _, d := range dumps {
 			d.Output().Write([]byte("\r\n\r\n"))
@@ -341,7 +363,7 @@ func (c *ClientConn) sendRequestBody(str *RequestStream, body io.ReadCloser, con
 	}
 
 	// make sure we don't send more bytes than the content length
-	n, err := io.CopyBuffer(str, io.LimitReader(sr, contentLength), buf)
+	n, err := io.CopyBuffer(w, io.LimitReader(sr, contentLength), buf)
 	if err != nil {
 		return err
 	} else {
@@ -362,6 +384,7 @@ func (c *ClientConn) sendRequestBody(str *RequestStream, body io.ReadCloser, con
 func (c *ClientConn) doRequest(req *http.Request, str *RequestStream) (*http.Response, error) {
 	trace := httptrace.ContextClientTrace(req.Context())
 	var sendingReqFailed bool
+	var reqBodyDone chan struct{} // closed when the request body is sent.
 	if err := str.sendRequestHeader(req); err != nil {
 		traceWroteRequest(trace, err)
 		if c.logger != nil {
@@ -375,7 +398,9 @@ func (c *ClientConn) doRequest(req *http.Request, str *RequestStream) (*http.Res
 			str.Close()
 		} else {
 			// send the request body asynchronously
+			reqBodyDone = make(chan struct{})
 			go func() {
+				defer close(reqBodyDone)
 				contentLength := int64(-1)
 				// According to the documentation for http.Request.ContentLength,
 				// a value of 0 with a non-nil Body is also treated as unknown content length.
@@ -423,6 +448,15 @@ func (c *ClientConn) doRequest(req *http.Request, str *RequestStream) (*http.Res
 		}
 		break
 	}
+	if reqBodyDone != nil && transport.IsEarlyResponseEnabled(req.Context()) {
+		select {
+		case <-reqBodyDone:
+		default:
+			// the server responds before reading the whole request body,
+			// stop sending the rest.
+			str.CancelWrite(quic.StreamErrorCode(ErrCodeNoError))
+		}
+	}
 	connState := c.conn.ConnectionState().TLS
 	res.TLS = &connState
 	res.Request = req
@@ -1,6 +1,7 @@
 package http3
 
 import (
+	"context"
 	"errors"
 	"fmt"
 
@@ -38,6 +39,61 @@ func (e *Error) Is(target error) bool {
 	return ok && e.ErrorCode == t.ErrorCode && e.Remote == t.Remote
 }
 
+// ConnectionError is returned from the round tripper if the request failed
+// because the HTTP/3 connection was closed with an application error, which
+// carries the error code and reason passed to CloseWithError.
+type ConnectionError struct {
+	// Remote is whether the connection was closed by the peer.
+	Remote bool
+	// ErrorCode is the QUIC application error code.
+	ErrorCode uint64
+	// Reason is the reason phrase of the close.
+	Reason string
+	// Err is the underlying error of the request.
+	Err error
+}
+
+func (e *ConnectionError) Error() string {
+	s := "http3: connection closed"
+	if e.Remote {
+		s += " by peer"
+	}
+	if name := ErrCode(e.ErrorCode).string(); name != "" {
+		s += " with " + name
+	} else {
+		s += fmt.Sprintf(" with error code %#x", e.ErrorCode)
+	}
+	if e.Reason != "" {
+		s += ": " + e.Reason
+	}
+	return s
+}
+
+func (e *ConnectionError) Unwrap() error { return e.Err }
+
+// wrapConnectionError wraps err in a *ConnectionError if the connection has
+// been closed with an application error, which is looked up from the raw
+// error of the request or the close cause of the connection.
+func wrapConnectionError(conn *Conn, raw, err error) error {
+	if err == nil {
+		return nil
+	}
+	var connErr *ConnectionError
+	if errors.As(err, &connErr) {
+		return err
+	}
+	var appErr *quic.ApplicationError
+	if !errors.As(raw, &appErr) && !errors.As(context.Cause(conn.Context()), &appErr) {
+		return err
+	}
+	return &ConnectionError{
+		Remote:    appErr.Remote,
+		ErrorCode: uint64(appErr.ErrorCode),
+		Reason:    appErr.ErrorMessage,
+		Err:       err,
+	}
+}
+
 func maybeReplaceError(err error) error {
 	if err == nil {
 		return nil
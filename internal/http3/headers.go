@@ -147,7 +147,7 @@ func parseHeaders(decodeFn qpack.DecodeFunc, isRequest bool, sizeLimit int, head
 			}
 		}
 	}
-	if ds.ShouldDump() && len(hdr.Headers) > 0 {
+	if ds.ShouldDump() {
 		ds.DumpResponseHeader([]byte("\r\n"))
 	}
 	hdr.ContentLength = -1
@@ -14,6 +14,7 @@ import (
 
 	"github.com/imroc/req/v3/internal/dump"
 	reqheader "github.com/imroc/req/v3/internal/header"
+	"github.com/imroc/req/v3/internal/transport"
 	"github.com/quic-go/qpack"
 	"github.com/quic-go/quic-go"
 	"github.com/quic-go/quic-go/http3/qlog"
@@ -198,6 +199,11 @@ func (w *requestWriter) encodeHeaders(req *http.Request, addGzipHeader bool, tra
 		if trailers != "" {
 			writeHeader("trailer", trailers)
 		}
+		// Signal the priority of the request (RFC 9218) unless the
+		// priority header is set explicitly.
+		if p := transport.GetPriority(req.Context()); p != 0 && req.Header.Get("priority") == "" {
+			writeHeader("priority", "u="+strconv.Itoa(transport.Urgency(p)))
+		}
 
 		var didUA bool
 		for k, vv := range req.Header {
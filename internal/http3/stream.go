@@ -304,7 +304,7 @@ func (s *RequestStream) sendRequestHeader(req *http.Request) error {
 	if s.sentRequest {
 		return errors.New("http3: invalid duplicate use of RequestStream.SendRequestHeader")
 	}
-	if !s.disableCompression && req.Method != http.MethodHead &&
+	if !s.disableCompression && !transport.IsAutoDecompressDisabled(req.Context()) && req.Method != http.MethodHead &&
 		req.Header.Get("Accept-Encoding") == "" && req.Header.Get("Range") == "" {
 		s.requestedGzip = true
 	}
@@ -346,7 +346,7 @@ func (s *RequestStream) ReadResponse() (*http.Response, error) {
 		maybeQlogInvalidHeadersFrame(s.str.qlogger, s.str.StreamID(), hf.Length)
 		s.str.CancelRead(quic.StreamErrorCode(ErrCodeFrameError))
 		s.str.CancelWrite(quic.StreamErrorCode(ErrCodeFrameError))
-		return nil, fmt.Errorf("http3: HEADERS frame too large: %d bytes (max: %d)", hf.Length, s.maxHeaderBytes)
+		return nil, &transport.ResponseHeaderTooLargeError{Proto: "HTTP/3.0", Limit: int64(s.maxHeaderBytes)}
 	}
 	headerBlock := make([]byte, hf.Length)
 	if _, err := io.ReadFull(s.str.datagramStream, headerBlock); err != nil {
@@ -374,8 +374,20 @@ func (s *RequestStream) ReadResponse() (*http.Response, error) {
 		}
 		s.str.CancelRead(quic.StreamErrorCode(errCode))
 		s.str.CancelWrite(quic.StreamErrorCode(errCode))
+		if errors.Is(err, errHeaderTooLarge) {
+			return nil, &transport.ResponseHeaderTooLargeError{Proto: "HTTP/3.0", Limit: int64(s.maxHeaderBytes)}
+		}
 		return nil, fmt.Errorf("http3: invalid response: %w", err)
 	}
+	if res.StatusCode > 199 && transport.WantRawHeaders(s.ctx) {
+		rawHeaders := make([]transport.HeaderField, 0, len(hfs))
+		for _, h := range hfs {
+			if !h.IsPseudo() {
+				rawHeaders = append(rawHeaders, transport.HeaderField{Key: h.Name, Value: h.Value})
+			}
+		}
+		transport.RecordRawHeaders(s.ctx, rawHeaders)
+	}
 
 	// Check that the server doesn't send more data in DATA frames than indicated by the Content-Length header (if set).
 	// See section 4.1.2 of RFC 9114.
@@ -394,14 +406,15 @@ func (s *RequestStream) ReadResponse() (*http.Response, error) {
 		res.ContentLength = -1
 		s.responseBody = compress.NewGzipReader(respBody)
 		res.Uncompressed = true
-	} else if s.AutoDecompression {
-		contentEncoding := res.Header.Get("Content-Encoding")
-		if contentEncoding != "" {
+	} else if contentEncoding := res.Header.Get("Content-Encoding"); contentEncoding != "" && s.AutoDecompression && !transport.IsAutoDecompressDisabled(s.ctx) {
+		if cr := compress.NewCompressReader(respBody, contentEncoding); cr != nil {
 			res.Header.Del("Content-Encoding")
 			res.Header.Del("Content-Length")
 			res.ContentLength = -1
 			res.Uncompressed = true
-			res.Body = compress.NewCompressReader(respBody, contentEncoding)
+			s.responseBody = cr
+		} else {
+			s.responseBody = respBody
 		}
 	} else {
 		s.responseBody = respBody
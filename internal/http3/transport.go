@@ -10,10 +10,12 @@ import (
 	"net"
 	"net/http"
 	"net/http/httptrace"
+	"net/netip"
 	"net/url"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"golang.org/x/net/http/httpguts"
 
@@ -66,7 +68,9 @@ func (r *roundTripperWithCount) Close() error {
 type Transport struct {
 	*transport.Options
 	// TLSClientConfig specifies the TLS configuration to use with
-	// tls.Client. If nil, the default configuration is used.
+	// tls.Client. If nil, the TLSClientConfig of Options shared with HTTP1
+	// and HTTP2 is used, which is shadowed by this field, or the default
+	// configuration if neither is set.
 	TLSClientConfig *tls.Config
 
 	// QUICConfig is the quic.Config used for dialing new connections.
@@ -89,7 +93,8 @@ type Transport struct {
 
 	// MaxResponseHeaderBytes specifies a limit on how many response bytes are
 	// allowed in the server's response header.
-	// Zero means to use a default limit.
+	// Zero means to use the MaxResponseHeaderBytes of the Options, or a
+	// default limit if it's zero too.
 	MaxResponseHeaderBytes int
 
 	// DisableCompression, if true, prevents the Transport from requesting compression with an
@@ -126,8 +131,20 @@ var (
 	ErrNoCachedConn = errors.New("http3: no cached connection was available")
 	// ErrTransportClosed is returned when attempting to use a closed Transport
 	ErrTransportClosed = errors.New("http3: transport is closed")
+	// ErrDialTimeout is returned by Transport.DialConnTimeout when the
+	// handshake is not completed within the timeout
+	ErrDialTimeout = errors.New("http3: handshake is not completed within the timeout")
 )
 
+// maxResponseHeaderBytes returns MaxResponseHeaderBytes, or the one of the
+// Options if it's zero.
+func (t *Transport) maxResponseHeaderBytes() int {
+	if t.MaxResponseHeaderBytes == 0 && t.Options != nil {
+		return int(t.Options.MaxResponseHeaderBytes)
+	}
+	return t.MaxResponseHeaderBytes
+}
+
 func (t *Transport) init() error {
 	if t.newClientConn == nil {
 		t.newClientConn = func(conn *quic.Conn) clientConn {
@@ -138,7 +155,7 @@ func (t *Transport) init() error {
 				t.AdditionalSettings,
 				t.StreamHijacker,
 				t.UniStreamHijacker,
-				t.MaxResponseHeaderBytes,
+				t.maxResponseHeaderBytes(),
 				t.DisableCompression,
 				t.Logger,
 			)
@@ -162,15 +179,72 @@ func (t *Transport) init() error {
 		t.QUICConfig.MaxIncomingStreams = -1 // don't allow any bidirectional streams
 	}
 	if t.Dial == nil {
-		udpConn, err := net.ListenUDP("udp", nil)
-		if err != nil {
+		if _, err := t.quicTransport(); err != nil {
 			return err
 		}
-		t.transport = &quic.Transport{Conn: udpConn}
 	}
 	return nil
 }
 
+// localUDPAddr returns the local address to bind the UDP socket, which is
+// derived from the LocalAddr of the Dialer if set.
+func (t *Transport) localUDPAddr() *net.UDPAddr {
+	if t.Options == nil || t.Dialer == nil || t.Dialer.LocalAddr == nil {
+		return nil
+	}
+	switch addr := t.Dialer.LocalAddr.(type) {
+	case *net.UDPAddr:
+		return addr
+	case *net.TCPAddr: // bind the same IP, but let the system choose the port.
+		return &net.UDPAddr{IP: addr.IP, Zone: addr.Zone}
+	case *net.IPAddr:
+		return &net.UDPAddr{IP: addr.IP, Zone: addr.Zone}
+	}
+	return nil
+}
+
+// listenUDP creates the UDP socket of the default dialer, which applies the
+// socket options if set.
+func (t *Transport) listenUDP() (net.PacketConn, error) {
+	laddr := t.localUDPAddr()
+	if t.Options == nil || t.SocketOptions == nil {
+		return net.ListenUDP("udp", laddr)
+	}
+	var address string
+	if laddr != nil {
+		address = laddr.String()
+	}
+	lc := net.ListenConfig{Control: t.ControlSocket}
+	return lc.ListenPacket(context.Background(), "udp", address)
+}
+
+// SetDialer sets the function for creating QUIC connections, which allows
+// controlling the connection establishment, e.g. proxying over UDP, custom
+// congestion control, or reusing connections from an existing pool. Pass nil
+// to use the default dialer. The validation of the transport (e.g. datagram
+// support mismatch) still runs at the first request.
+func (t *Transport) SetDialer(dial func(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (*quic.Conn, error)) *Transport {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.Dial = dial
+	return t
+}
+
+// quicTransport returns the QUIC transport used by the default dialer, which
+// is created lazily if the transport was initialized with a custom dialer.
+func (t *Transport) quicTransport() (*quic.Transport, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.transport == nil {
+		udpConn, err := t.listenUDP()
+		if err != nil {
+			return nil, err
+		}
+		t.transport = &quic.Transport{Conn: udpConn}
+	}
+	return t.transport, nil
+}
+
 // RoundTripOpt is like RoundTrip, but takes options.
 func (t *Transport) RoundTripOpt(req *http.Request, opt RoundTripOpt) (*http.Response, error) {
 	rsp, err := t.roundTripOpt(req, opt)
@@ -223,9 +297,7 @@ func (t *Transport) doRoundTripOpt(req *http.Request, opt RoundTripOpt, isRetrie
 	traceGetConn(trace, hostname)
 	cl, isReused, err := t.getClient(req.Context(), hostname, opt.OnlyCachedConn)
 	if err != ErrNoCachedConn {
-		if debugf := t.Debugf; debugf != nil {
-			debugf("HTTP/3 %s %s", req.Method, req.URL.String())
-		}
+		t.DebugfContext(req.Context(), "HTTP/3 %s %s", req.Method, req.URL.String())
 	}
 	if err != nil {
 		return nil, err
@@ -242,6 +314,7 @@ func (t *Transport) doRoundTripOpt(req *http.Request, opt RoundTripOpt, isRetrie
 		return nil, cl.dialErr
 	}
 	defer cl.useCount.Add(-1)
+	transport.RecordAddr(req.Context(), cl.conn.LocalAddr(), cl.conn.RemoteAddr(), isReused)
 	traceGotConn(trace, cl.conn, isReused)
 	rsp, err := cl.clientConn.RoundTrip(req)
 	if err != nil {
@@ -306,16 +379,157 @@ func (t *Transport) RoundTripOnlyCachedConn(req *http.Request) (*http.Response,
 	return t.RoundTripOpt(req, RoundTripOpt{OnlyCachedConn: true})
 }
 
-// AddConn add a http3 connection, dial new conn if not exists.
+// AddConn add a http3 connection, dial new conn if not exists, and waits
+// until the handshake is complete and the settings of the server are
+// received.
 func (t *Transport) AddConn(ctx context.Context, addr string) error {
+	t.initOnce.Do(func() { t.initErr = t.init() })
+	if t.initErr != nil {
+		return t.initErr
+	}
 	addr = authorityAddr(addr)
 	cl, _, err := t.getClient(ctx, addr, false)
-	if err == nil {
-		cl.useCount.Add(-1)
+	if err != nil {
+		return err
+	}
+	defer cl.useCount.Add(-1)
+	select {
+	case <-cl.dialing:
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	}
+	if cl.dialErr != nil {
+		t.removeClientIfEqual(addr, cl)
+		return cl.dialErr
+	}
+	select {
+	case <-cl.conn.HandshakeComplete():
+	case <-cl.conn.Context().Done():
+		return context.Cause(cl.conn.Context())
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	}
+	if cc, ok := cl.clientConn.(interface{ ReceivedSettings() <-chan struct{} }); ok {
+		select {
+		case <-cc.ReceivedSettings():
+		case <-cl.conn.Context().Done():
+			return context.Cause(cl.conn.Context())
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		}
+	}
+	return nil
+}
+
+// DialConn dials a new http3 connection to addr which is not added to the
+// connection pool, and waits until the handshake is complete. It's owned by
+// the caller, which should close it with CloseWithError.
+func (t *Transport) DialConn(ctx context.Context, addr string) (*ClientConn, error) {
+	t.initOnce.Do(func() { t.initErr = t.init() })
+	if t.initErr != nil {
+		return nil, t.initErr
+	}
+	conn, rt, err := t.dial(ctx, authorityAddr(addr))
+	if err != nil {
+		return nil, err
+	}
+	cc, ok := rt.(*ClientConn)
+	if !ok {
+		conn.CloseWithError(0, "")
+		return nil, errors.New("http3: unexpected client conn")
+	}
+	select {
+	case <-conn.HandshakeComplete():
+	case <-conn.Context().Done():
+		return nil, context.Cause(conn.Context())
+	case <-ctx.Done():
+		conn.CloseWithError(0, "")
+		return nil, context.Cause(ctx)
+	}
+	return cc, nil
+}
+
+// DialConnTimeout dials a http3 connection to addr if not exists, and waits
+// at most timeout for the handshake to complete, or until ctx is done. If the
+// handshake is still in progress after timeout, ErrDialTimeout (or the error
+// of ctx) is returned and the dial continues in the background, the late
+// connection is cached for subsequent requests if adoptLate is true,
+// otherwise it is closed once established if it is not used. lateDone, if
+// not nil, is called with the result of the late handshake.
+func (t *Transport) DialConnTimeout(ctx context.Context, addr string, timeout time.Duration, adoptLate bool, lateDone func(err error)) error {
+	t.initOnce.Do(func() { t.initErr = t.init() })
+	if t.initErr != nil {
+		return t.initErr
+	}
+	hostname := authorityAddr(addr)
+	cl, _, err := t.getClient(context.Background(), hostname, false)
+	if err != nil {
+		return err
 	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	err = ErrDialTimeout
+	select {
+	case <-cl.dialing:
+		cl.useCount.Add(-1)
+		if cl.dialErr != nil {
+			t.removeClientIfEqual(hostname, cl)
+			return cl.dialErr
+		}
+		select {
+		case <-cl.conn.HandshakeComplete():
+			return nil
+		case <-timer.C:
+		case <-ctx.Done():
+			err = context.Cause(ctx)
+		}
+	case <-timer.C:
+		cl.useCount.Add(-1)
+	case <-ctx.Done():
+		cl.useCount.Add(-1)
+		err = context.Cause(ctx)
+	}
+	go func() {
+		<-cl.dialing
+		lateErr := cl.dialErr
+		if lateErr == nil {
+			select {
+			case <-cl.conn.HandshakeComplete():
+			case <-cl.conn.Context().Done():
+				lateErr = context.Cause(cl.conn.Context())
+			}
+		}
+		if lateDone != nil {
+			lateDone(lateErr)
+		}
+		if cl.dialErr != nil {
+			t.removeClientIfEqual(hostname, cl)
+			return
+		}
+		if adoptLate {
+			return
+		}
+		t.mutex.Lock()
+		unused := t.clients[hostname] == cl && cl.useCount.Load() == 0
+		if unused {
+			delete(t.clients, hostname)
+		}
+		t.mutex.Unlock()
+		if unused {
+			cl.Close()
+		}
+	}()
 	return err
 }
 
+func (t *Transport) removeClientIfEqual(hostname string, cl *roundTripperWithCount) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.clients[hostname] == cl {
+		delete(t.clients, hostname)
+	}
+}
+
 func (t *Transport) getClient(ctx context.Context, hostname string, onlyCached bool) (rtc *roundTripperWithCount, isReused bool, err error) {
 	t.mutex.Lock()
 	defer t.mutex.Unlock()
@@ -369,10 +583,13 @@ func (t *Transport) getClient(ctx context.Context, hostname string, onlyCached b
 
 func (t *Transport) dial(ctx context.Context, hostname string) (*quic.Conn, clientConn, error) {
 	var tlsConf *tls.Config
-	if t.TLSClientConfig == nil {
-		tlsConf = &tls.Config{}
-	} else {
+	switch {
+	case t.TLSClientConfig != nil:
 		tlsConf = t.TLSClientConfig.Clone()
+	case t.Options != nil && t.Options.TLSClientConfig != nil: // shared with HTTP1 and HTTP2
+		tlsConf = t.Options.TLSClientConfig.Clone()
+	default:
+		tlsConf = &tls.Config{}
 	}
 	if tlsConf.ServerName == "" {
 		sni, _, err := net.SplitHostPort(hostname)
@@ -385,18 +602,30 @@ func (t *Transport) dial(ctx context.Context, hostname string) (*quic.Conn, clie
 	// Replace existing ALPNs by H3
 	tlsConf.NextProtos = []string{NextProtoH3}
 
+	t.mutex.Lock()
 	dial := t.Dial
+	t.mutex.Unlock()
+	custom := dial != nil
 	if dial == nil {
 		dial = func(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (*quic.Conn, error) {
+			qt, err := t.quicTransport()
+			if err != nil {
+				return nil, err
+			}
 			network := "udp"
 			udpAddr, err := t.resolveUDPAddr(ctx, network, addr)
 			if err != nil {
 				return nil, err
 			}
+			if t.Options != nil && t.DialGuard != nil {
+				if err = t.DialGuard(ctx, network, addr, udpAddr.IP); err != nil {
+					return nil, err
+				}
+			}
 			trace := httptrace.ContextClientTrace(ctx)
 			traceConnectStart(trace, network, udpAddr.String())
 			traceTLSHandshakeStart(trace)
-			conn, err := t.transport.DialEarly(ctx, udpAddr, tlsCfg, cfg)
+			conn, err := qt.DialEarly(ctx, udpAddr, tlsCfg, cfg)
 			var state tls.ConnectionState
 			if conn != nil {
 				state = conn.ConnectionState().TLS
@@ -410,6 +639,12 @@ func (t *Transport) dial(ctx context.Context, hostname string) (*quic.Conn, clie
 	if err != nil {
 		return nil, nil, err
 	}
+	if custom && t.Options != nil {
+		if err = t.GuardRemoteAddr(ctx, "udp", hostname, conn.RemoteAddr()); err != nil {
+			conn.CloseWithError(0, "")
+			return nil, nil, err
+		}
+	}
 	return conn, t.newClientConn(conn), nil
 }
 
@@ -422,6 +657,16 @@ func (t *Transport) resolveUDPAddr(ctx context.Context, network, addr string) (*
 	if err != nil {
 		return nil, err
 	}
+	if t.Options != nil && t.OnDNSResolved != nil {
+		if _, err = netip.ParseAddr(host); err != nil { // not IP literal.
+			addrs, err := t.LookupHost(ctx, t.Dialer, network, host)
+			if err != nil {
+				return nil, err
+			}
+			// QUIC dials a single address, which is the first one.
+			return net.UDPAddrFromAddrPort(netip.AddrPortFrom(addrs[0], uint16(port))), nil
+		}
+	}
 	resolver := net.DefaultResolver
 	ipAddrs, err := resolver.LookupIPAddr(ctx, host)
 	if err != nil {
@@ -432,6 +677,23 @@ func (t *Transport) resolveUDPAddr(ctx context.Context, network, addr string) (*
 	return &net.UDPAddr{IP: ip.IP, Port: port, Zone: ip.Zone}, nil
 }
 
+// ConnCount returns the number of established connections per "host:port".
+func (t *Transport) ConnCount() map[string]int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	count := make(map[string]int)
+	for hostname, cl := range t.clients {
+		select {
+		case <-cl.dialing:
+			if cl.dialErr == nil && cl.conn.Context().Err() == nil {
+				count[hostname]++
+			}
+		default:
+		}
+	}
+	return count
+}
+
 func (t *Transport) removeClient(hostname string) {
 	t.mutex.Lock()
 	defer t.mutex.Unlock()
@@ -455,7 +717,7 @@ func (t *Transport) NewClientConn(conn *quic.Conn) *ClientConn {
 		t.AdditionalSettings,
 		t.StreamHijacker,
 		t.UniStreamHijacker,
-		t.MaxResponseHeaderBytes,
+		t.maxResponseHeaderBytes(),
 		t.DisableCompression,
 		t.Logger,
 	)
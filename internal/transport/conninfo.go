@@ -0,0 +1,68 @@
+package transport
+
+import (
+	"context"
+	"net"
+)
+
+// ConnInfo records the connection used by the request, which is set by
+// the HTTP1, HTTP2 and HTTP3 transports when the connection is obtained.
+type ConnInfo struct {
+	Reused     bool
+	LocalAddr  net.Addr
+	RemoteAddr net.Addr
+}
+
+// ConnInfo returns ci itself, so that ConnInfo is a ConnInfoHolder.
+func (ci *ConnInfo) ConnInfo() *ConnInfo {
+	return ci
+}
+
+// ConnInfoHolder holds the ConnInfo of the request, which can be the state
+// of the request that records more than the connection, so that no separate
+// allocation is needed for the ConnInfo.
+type ConnInfoHolder interface {
+	ConnInfo() *ConnInfo
+}
+
+type connInfoKeyType int
+
+const connInfoKey connInfoKeyType = iota
+
+// WithConnInfo returns a copy of ctx which records the connection used by
+// the request into the ConnInfo of h.
+func WithConnInfo(ctx context.Context, h ConnInfoHolder) context.Context {
+	return context.WithValue(ctx, connInfoKey, h)
+}
+
+// ConnInfoHolderFrom returns the ConnInfoHolder of ctx set by WithConnInfo,
+// or nil if not set.
+func ConnInfoHolderFrom(ctx context.Context) ConnInfoHolder {
+	h, _ := ctx.Value(connInfoKey).(ConnInfoHolder)
+	return h
+}
+
+// RecordConn records the connection into the ConnInfo of ctx if any, the
+// later call overrides the earlier one, e.g. the final hop of redirects.
+func RecordConn(ctx context.Context, conn net.Conn, reused bool) {
+	if conn == nil {
+		return
+	}
+	if h := ConnInfoHolderFrom(ctx); h != nil {
+		ci := h.ConnInfo()
+		ci.Reused = reused
+		ci.LocalAddr = conn.LocalAddr()
+		ci.RemoteAddr = conn.RemoteAddr()
+	}
+}
+
+// RecordAddr is similar to RecordConn, but records the addresses directly,
+// which is used by the transport whose connection is not a net.Conn.
+func RecordAddr(ctx context.Context, local, remote net.Addr, reused bool) {
+	if h := ConnInfoHolderFrom(ctx); h != nil {
+		ci := h.ConnInfo()
+		ci.Reused = reused
+		ci.LocalAddr = local
+		ci.RemoteAddr = remote
+	}
+}
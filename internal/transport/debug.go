@@ -0,0 +1,23 @@
+package transport
+
+import "context"
+
+type debugLogKeyType int
+
+const debugLogKey debugLogKeyType = iota
+
+// WithDebugLog returns a copy of ctx which overrides whether the debug log
+// is enabled for the request, independent of the transport settings.
+func WithDebugLog(ctx context.Context, enabled bool) context.Context {
+	return context.WithValue(ctx, debugLogKey, enabled)
+}
+
+// DebugLogOverride returns whether the debug log is enabled for the request
+// by WithDebugLog, ok is false if it is not overridden.
+func DebugLogOverride(ctx context.Context) (enabled, ok bool) {
+	if ctx == nil {
+		return false, false
+	}
+	enabled, ok = ctx.Value(debugLogKey).(bool)
+	return
+}
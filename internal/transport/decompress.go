@@ -0,0 +1,25 @@
+package transport
+
+import "context"
+
+type disableAutoDecompressKeyType int
+
+const disableAutoDecompressKey disableAutoDecompressKeyType = iota
+
+// WithDisableAutoDecompress returns a copy of ctx which prevents the HTTP1,
+// HTTP2 and HTTP3 transports from requesting compression and decompressing
+// the response body, the body and the Content-Encoding and Content-Length
+// headers are left untouched.
+func WithDisableAutoDecompress(ctx context.Context) context.Context {
+	return context.WithValue(ctx, disableAutoDecompressKey, true)
+}
+
+// IsAutoDecompressDisabled reports whether ctx is returned by
+// WithDisableAutoDecompress.
+func IsAutoDecompressDisabled(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	disabled, _ := ctx.Value(disableAutoDecompressKey).(bool)
+	return disabled
+}
@@ -0,0 +1,97 @@
+package transport
+
+import (
+	"context"
+	"net"
+	"net/netip"
+)
+
+// DNSResolutionError is returned if OnDNSResolved returns no address to
+// dial for the host.
+type DNSResolutionError struct {
+	Host string
+	// Resolved is the addresses resolved before OnDNSResolved.
+	Resolved []netip.Addr
+}
+
+func (e *DNSResolutionError) Error() string {
+	return "req: no address of " + e.Host + " to dial is left by the DNS hook"
+}
+
+// ResolveAddrs resolves the host of addr with the resolver of d (the default
+// resolver if nil), calls OnDNSResolved with the resolved addresses, and
+// returns the addresses (ip:port) to be dialed in order. It returns addr
+// itself if OnDNSResolved is nil or the host is an IP literal.
+func (o *Options) ResolveAddrs(ctx context.Context, d *net.Dialer, network, addr string) ([]string, error) {
+	if o.OnDNSResolved == nil {
+		return []string{addr}, nil
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = netip.ParseAddr(host); err == nil {
+		return []string{addr}, nil
+	}
+	resolved, err := o.LookupHost(ctx, d, network, host)
+	if err != nil {
+		return nil, err
+	}
+	addrs := make([]string, 0, len(resolved))
+	for _, ip := range resolved {
+		addrs = append(addrs, net.JoinHostPort(ip.String(), port))
+	}
+	return addrs, nil
+}
+
+// LookupHost resolves host with the resolver of d (the default resolver if
+// nil), and returns the addresses filtered by OnDNSResolved, which fails
+// with DNSResolutionError if no address is left.
+func (o *Options) LookupHost(ctx context.Context, d *net.Dialer, network, host string) ([]netip.Addr, error) {
+	resolver := net.DefaultResolver
+	if d != nil && d.Resolver != nil {
+		resolver = d.Resolver
+	}
+	ipNetwork := "ip"
+	switch network {
+	case "tcp4", "udp4":
+		ipNetwork = "ip4"
+	case "tcp6", "udp6":
+		ipNetwork = "ip6"
+	}
+	resolved, err := resolver.LookupNetIP(ctx, ipNetwork, host)
+	if err != nil {
+		return nil, err
+	}
+	for i, ip := range resolved {
+		resolved[i] = ip.Unmap()
+	}
+	if o.OnDNSResolved == nil {
+		return resolved, nil
+	}
+	addrs := o.OnDNSResolved(host, append([]netip.Addr(nil), resolved...))
+	if len(addrs) == 0 {
+		return nil, &DNSResolutionError{Host: host, Resolved: resolved}
+	}
+	return addrs, nil
+}
+
+// DialResolved dials the addresses of addr returned by ResolveAddrs in order
+// with dial, and returns the first connection established, or the error of
+// the last address.
+func (o *Options) DialResolved(ctx context.Context, d *net.Dialer, network, addr string, dial func(ctx context.Context, network, addr string) (net.Conn, error)) (net.Conn, error) {
+	addrs, err := o.ResolveAddrs(ctx, d, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	var conn net.Conn
+	for _, a := range addrs {
+		if conn, err = dial(ctx, network, a); err == nil {
+			return conn, nil
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, err
+}
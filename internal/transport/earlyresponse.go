@@ -0,0 +1,24 @@
+package transport
+
+import "context"
+
+type earlyResponseKeyType int
+
+const earlyResponseKey earlyResponseKeyType = iota
+
+// WithEarlyResponse returns a copy of ctx which makes the HTTP1, HTTP2 and
+// HTTP3 transports abort writing the request body once the final response
+// is received, and return the response instead of the error of the write.
+func WithEarlyResponse(ctx context.Context) context.Context {
+	return context.WithValue(ctx, earlyResponseKey, true)
+}
+
+// IsEarlyResponseEnabled reports whether ctx is returned by
+// WithEarlyResponse.
+func IsEarlyResponseEnabled(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	enabled, _ := ctx.Value(earlyResponseKey).(bool)
+	return enabled
+}
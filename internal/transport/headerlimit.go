@@ -0,0 +1,17 @@
+package transport
+
+import "fmt"
+
+// ResponseHeaderTooLargeError is returned if the response headers exceed
+// the limit, which is MaxResponseHeaderBytes for HTTP1 and HTTP3, and the
+// MAX_HEADER_LIST_SIZE for HTTP2.
+type ResponseHeaderTooLargeError struct {
+	// Proto is the protocol of the response, e.g. "HTTP/2.0".
+	Proto string
+	// Limit is the max size of the response headers in bytes.
+	Limit int64
+}
+
+func (e *ResponseHeaderTooLargeError) Error() string {
+	return fmt.Sprintf("req: %s response headers exceed the limit of %d bytes", e.Proto, e.Limit)
+}
@@ -0,0 +1,41 @@
+package transport
+
+import "context"
+
+// HeaderField is a response header field in the received order.
+type HeaderField struct {
+	Key   string
+	Value string
+}
+
+// RawHeaders records the header fields of the response in the received
+// order, which is set by the HTTP1, HTTP2 and HTTP3 transports.
+type RawHeaders struct {
+	Fields []HeaderField
+}
+
+type rawHeadersKeyType int
+
+const rawHeadersKey rawHeadersKeyType = iota
+
+// WithRawHeaders returns a copy of ctx which records the header fields of
+// the response into rh.
+func WithRawHeaders(ctx context.Context, rh *RawHeaders) context.Context {
+	return context.WithValue(ctx, rawHeadersKey, rh)
+}
+
+// WantRawHeaders reports whether the header fields of the response should be
+// recorded.
+func WantRawHeaders(ctx context.Context) bool {
+	_, ok := ctx.Value(rawHeadersKey).(*RawHeaders)
+	return ok
+}
+
+// RecordRawHeaders records the header fields into the RawHeaders of ctx if
+// any, the later call overrides the earlier one, e.g. the final hop of
+// redirects.
+func RecordRawHeaders(ctx context.Context, fields []HeaderField) {
+	if rh, ok := ctx.Value(rawHeadersKey).(*RawHeaders); ok {
+		rh.Fields = fields
+	}
+}
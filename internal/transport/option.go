@@ -5,10 +5,14 @@ import (
 	"crypto/tls"
 	"net"
 	"net/http"
+	"net/netip"
 	"net/url"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/imroc/req/v3/internal/dump"
+	"github.com/imroc/req/v3/pkg/wirecapture"
 )
 
 // Options is transport's options.
@@ -43,6 +47,37 @@ type Options struct {
 	// becomes idle before the later DialContext completes.
 	DialContext func(ctx context.Context, network, addr string) (net.Conn, error)
 
+	// Dialer specifies the net.Dialer used for creating TCP connections
+	// when DialContext is nil, which can be used to bind a local address,
+	// or tune the timeout, keep-alive and Happy Eyeballs fallback delay.
+	// The LocalAddr of Dialer is also used to bind the UDP socket for HTTP/3.
+	// If Dialer is nil, a zero net.Dialer is used.
+	Dialer *net.Dialer
+
+	// SocketOptions is called with the raw socket of each TCP connection
+	// before connecting, and the UDP socket of HTTP/3 before binding, which
+	// can be used to tune the socket options, e.g. SO_MARK for policy routing.
+	// The error fails the dial. It is ignored if DialContext is set.
+	SocketOptions func(network, address string, c syscall.RawConn) error
+
+	// TCPNoDelay overrides the TCP_NODELAY option of the TCP connections if
+	// not nil, which is enabled by default.
+	TCPNoDelay *bool
+
+	// DialGuard is called with the address and the resolved IP of each
+	// connection to the origin server right before connecting, including
+	// the UDP dial of HTTP/3, the error fails the dial. The connections
+	// returned by the custom dial functions are checked with their remote
+	// address after connecting instead. It is not called for the
+	// connections to the proxy.
+	DialGuard func(ctx context.Context, network, addr string, ip net.IP) error
+
+	// OnDNSResolved is called with the host and the resolved addresses of
+	// each connection to be dialed, including the UDP dial of HTTP/3, the
+	// returned addresses are dialed in order. It is not called for the IP
+	// literal hosts, and is ignored if DialContext is set.
+	OnDNSResolved func(host string, addrs []netip.Addr) []netip.Addr
+
 	// DialTLSContext specifies an optional dial function for creating
 	// TLS connections for non-proxied HTTPS requests.
 	//
@@ -58,6 +93,13 @@ type Options struct {
 	// it works even if a proxy is set, can be used to customize the tls fingerprint.
 	TLSHandshakeContext func(ctx context.Context, addr string, plainConn net.Conn) (conn net.Conn, tlsState *tls.ConnectionState, err error)
 
+	// TLSIdentity identifies the tls handshake (e.g. the TLSHandshakeContext
+	// and the uTLS ClientHello spec), which is a part of the key of the
+	// connection pool, so the connections built with the different handshakes
+	// are never pooled together. It's changed atomically since the handshake
+	// can be changed while the requests are in flight, see GetTLSIdentity.
+	TLSIdentity *atomic.Uint64
+
 	// TLSClientConfig specifies the TLS configuration to use with
 	// tls.Client.
 	// If nil, the default configuration is used.
@@ -110,6 +152,11 @@ type Options struct {
 	// Zero means no limit.
 	MaxConnsPerHost int
 
+	// PriorityAging, if non-zero, raises the priority of the request
+	// waiting for a connection by one for each PriorityAging it has
+	// waited, so that the low priority requests are not starved.
+	PriorityAging time.Duration
+
 	// IdleConnTimeout is the maximum amount of time an idle
 	// (keep-alive) connection will remain idle before closing
 	// itself.
@@ -165,14 +212,55 @@ type Options struct {
 	// Debugf is the optional debug function.
 	Debugf func(format string, v ...any)
 
+	// ContextDebugf is the optional debug function used for the logs of
+	// a request, which respects the debug log switch of the request in the
+	// context (see WithDebugLog). Falls back to Debugf if nil.
+	ContextDebugf func(ctx context.Context, format string, v ...any)
+
 	Dump *dump.Dumper
+
+	// WireCapture is the optional writer which the plaintext data of the
+	// HTTP1 and HTTP2 connections are captured to.
+	WireCapture *wirecapture.Writer
+}
+
+// DebugfContext logs the debug message of the request of ctx, with
+// ContextDebugf if set, otherwise with Debugf unless the debug log is
+// disabled for the request.
+func (o *Options) DebugfContext(ctx context.Context, format string, v ...any) {
+	if o.ContextDebugf != nil {
+		o.ContextDebugf(ctx, format, v...)
+	} else if o.Debugf != nil {
+		if enabled, ok := DebugLogOverride(ctx); ok && !enabled {
+			return
+		}
+		o.Debugf(format, v...)
+	}
+}
+
+// GetTLSIdentity returns the current TLSIdentity, which is 0 if not set.
+func (o *Options) GetTLSIdentity() uint64 {
+	if o.TLSIdentity == nil {
+		return 0
+	}
+	return o.TLSIdentity.Load()
 }
 
 func (o Options) Clone() Options {
 	oo := o
+	oo.TLSIdentity = new(atomic.Uint64)
+	oo.TLSIdentity.Store(o.GetTLSIdentity())
 	if o.TLSClientConfig != nil {
 		oo.TLSClientConfig = o.TLSClientConfig.Clone()
 	}
+	if o.Dialer != nil {
+		d := *o.Dialer
+		oo.Dialer = &d
+	}
+	if o.TCPNoDelay != nil {
+		noDelay := *o.TCPNoDelay
+		oo.TCPNoDelay = &noDelay
+	}
 	if o.Dump != nil {
 		oo.Dump = o.Dump.Clone()
 		go oo.Dump.Start()
@@ -0,0 +1,37 @@
+package transport
+
+import "context"
+
+type priorityKeyType int
+
+const priorityKey priorityKeyType = iota
+
+// WithPriority returns a copy of ctx which carries the priority of the
+// request, the higher priority request acquires the connection first when
+// waiting, and is signaled to the server by HTTP2 and HTTP3.
+func WithPriority(ctx context.Context, priority int) context.Context {
+	return context.WithValue(ctx, priorityKey, priority)
+}
+
+// GetPriority returns the priority carried by ctx, zero if not set.
+func GetPriority(ctx context.Context) int {
+	if ctx == nil {
+		return 0
+	}
+	priority, _ := ctx.Value(priorityKey).(int)
+	return priority
+}
+
+// Urgency maps the priority to the urgency of the HTTP extensible
+// priorities (RFC 9218), the default priority 0 is the default urgency 3,
+// and the higher priority is the lower urgency, clamped to [0, 7].
+func Urgency(priority int) int {
+	u := 3 - priority
+	if u < 0 {
+		return 0
+	}
+	if u > 7 {
+		return 7
+	}
+	return u
+}
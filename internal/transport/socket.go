@@ -0,0 +1,141 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"syscall"
+	"time"
+)
+
+// ControlSocket calls SocketOptions with the raw socket, and wraps the error.
+func (o *Options) ControlSocket(network, address string, c syscall.RawConn) error {
+	if o.SocketOptions == nil {
+		return nil
+	}
+	if err := o.SocketOptions(network, address, c); err != nil {
+		return fmt.Errorf("set socket options: %w", err)
+	}
+	return nil
+}
+
+// SocketDialer returns a copy of d (a zero net.Dialer if nil) which calls
+// SocketOptions after the Control hooks of d, returns d itself if
+// SocketOptions is nil.
+func (o *Options) SocketDialer(d *net.Dialer) *net.Dialer {
+	if o.SocketOptions == nil {
+		return d
+	}
+	var dd net.Dialer
+	if d != nil {
+		dd = *d
+	}
+	control, controlContext := dd.Control, dd.ControlContext
+	dd.Control = nil
+	dd.ControlContext = func(ctx context.Context, network, address string, c syscall.RawConn) error {
+		if controlContext != nil {
+			if err := controlContext(ctx, network, address, c); err != nil {
+				return err
+			}
+		} else if control != nil {
+			if err := control(network, address, c); err != nil {
+				return err
+			}
+		}
+		return o.ControlSocket(network, address, c)
+	}
+	return &dd
+}
+
+// ApplyTCPNoDelay applies TCPNoDelay to the TCP connection, the connection
+// which does not support it is left untouched.
+func (o *Options) ApplyTCPNoDelay(conn net.Conn) error {
+	if o.TCPNoDelay == nil {
+		return nil
+	}
+	if tc, ok := conn.(interface{ SetNoDelay(bool) error }); ok {
+		return tc.SetNoDelay(*o.TCPNoDelay)
+	}
+	return nil
+}
+
+// ApplyTCPKeepAlive applies the KeepAlive of Dialer to the TCP connection
+// which is not dialed by Dialer (e.g. by DialContext), zero leaves the
+// connection untouched.
+func (o *Options) ApplyTCPKeepAlive(conn net.Conn) error {
+	if o.Dialer == nil || o.Dialer.KeepAlive == 0 {
+		return nil
+	}
+	tc, ok := conn.(interface {
+		SetKeepAlive(bool) error
+		SetKeepAlivePeriod(time.Duration) error
+	})
+	if !ok {
+		return nil
+	}
+	if o.Dialer.KeepAlive < 0 {
+		return tc.SetKeepAlive(false)
+	}
+	if err := tc.SetKeepAlive(true); err != nil {
+		return err
+	}
+	return tc.SetKeepAlivePeriod(o.Dialer.KeepAlive)
+}
+
+// GuardDialer returns a copy of d (a zero net.Dialer if nil) which calls
+// DialGuard with addr and the IP of each address which is about to be
+// connected, so that the IP which is actually dialed is checked rather than
+// the one resolved earlier, returns d itself if DialGuard is nil.
+func (o *Options) GuardDialer(d *net.Dialer, addr string) *net.Dialer {
+	if o.DialGuard == nil {
+		return d
+	}
+	var dd net.Dialer
+	if d != nil {
+		dd = *d
+	}
+	control, controlContext := dd.Control, dd.ControlContext
+	dd.Control = nil
+	dd.ControlContext = func(ctx context.Context, network, address string, c syscall.RawConn) error {
+		if err := o.guardAddress(ctx, network, addr, address); err != nil {
+			return err
+		}
+		if controlContext != nil {
+			return controlContext(ctx, network, address, c)
+		} else if control != nil {
+			return control(network, address, c)
+		}
+		return nil
+	}
+	return &dd
+}
+
+// GuardConn calls DialGuard with addr and the remote address of conn which
+// is returned by a custom dial function, the unix sockets are not checked.
+func (o *Options) GuardConn(ctx context.Context, network, addr string, conn net.Conn) error {
+	return o.GuardRemoteAddr(ctx, network, addr, conn.RemoteAddr())
+}
+
+// GuardRemoteAddr calls DialGuard with addr and the remote address of the
+// connection, the unix sockets are not checked.
+func (o *Options) GuardRemoteAddr(ctx context.Context, network, addr string, remote net.Addr) error {
+	if o.DialGuard == nil {
+		return nil
+	}
+	if _, ok := remote.(*net.UnixAddr); ok {
+		return nil
+	}
+	return o.guardAddress(ctx, network, addr, remote.String())
+}
+
+func (o *Options) guardAddress(ctx context.Context, network, addr, address string) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return fmt.Errorf("dial guard: %q is not an IP address", address)
+	}
+	return o.DialGuard(ctx, network, addr, ip)
+}
@@ -0,0 +1,39 @@
+package transport
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+
+	reqtls "github.com/imroc/req/v3/pkg/tls"
+)
+
+// WrapWireCapture wraps the connection to be captured by WireCapture if set,
+// which keeps the TLS details of the connection.
+func (o *Options) WrapWireCapture(conn net.Conn) net.Conn {
+	if o.WireCapture == nil {
+		return conn
+	}
+	cc := o.WireCapture.WrapConn(conn)
+	if tc, ok := conn.(reqtls.Conn); ok {
+		return &wireCaptureTLSConn{Conn: cc, tc: tc}
+	}
+	return cc
+}
+
+type wireCaptureTLSConn struct {
+	net.Conn
+	tc reqtls.Conn
+}
+
+func (c *wireCaptureTLSConn) ConnectionState() tls.ConnectionState {
+	return c.tc.ConnectionState()
+}
+
+func (c *wireCaptureTLSConn) Handshake() error {
+	return c.tc.Handshake()
+}
+
+func (c *wireCaptureTLSConn) HandshakeContext(ctx context.Context) error {
+	return c.tc.HandshakeContext(ctx)
+}
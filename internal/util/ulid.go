@@ -0,0 +1,27 @@
+package util
+
+import (
+	"encoding/binary"
+	"io"
+	"time"
+)
+
+const crockfordBase32 = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// NewULID returns a new ULID (https://github.com/ulid/spec), which is a
+// lexicographically sortable identifier of 26 characters consisting of a
+// 48-bit millisecond timestamp and 80 bits of randomness read from rnd.
+func NewULID(rnd io.Reader) string {
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[:8], uint64(time.Now().UnixMilli())<<16)
+	io.ReadFull(rnd, b[6:])
+	hi := binary.BigEndian.Uint64(b[:8])
+	lo := binary.BigEndian.Uint64(b[8:])
+	var dst [26]byte
+	for i := len(dst) - 1; i >= 0; i-- {
+		dst[i] = crockfordBase32[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(dst[:])
+}
@@ -0,0 +1,199 @@
+package req
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// JSONStreamError is returned by IterateJSONArray if the JSON body is
+// malformed, the error is detected after reading Offset bytes of the
+// (decoded) body.
+type JSONStreamError struct {
+	Offset int64
+	Err    error
+}
+
+func (e *JSONStreamError) Error() string {
+	return fmt.Sprintf("req: malformed json at offset %d: %v", e.Offset, e.Err)
+}
+
+func (e *JSONStreamError) Unwrap() error {
+	return e.Err
+}
+
+// IterateJSONArray decodes the elements of the JSON array in the response
+// body one at a time into T and calls fn as they arrive, rather than
+// buffering the whole array, e.g. the endpoint which returns a huge array:
+//
+//	resp, err := client.R().DisableAutoReadResponse().Get(url)
+//	if err != nil {
+//		return err
+//	}
+//	err = req.IterateJSONArray(resp, "data.items", func(item Item) error {
+//		// handle the item
+//		return nil
+//	})
+//
+// The path is the dot-separated keys of the nested array in the objects,
+// empty path means the body itself is the array. The elements are decoded
+// with the JSON decoder of the client (see Client.SetJsonUnmarshal).
+//
+// The memory usage stays in the size of one element only if the body is
+// streamed, that is, the body is not read automatically (see
+// Request.DisableAutoReadResponse and Request.EnableUnbufferedBody),
+// otherwise the read body is iterated. The body is decoded with the
+// auto-decode, and the response size limit (see StrictPolicy.MaxResponseSize
+// and Client.SetMaxDecompressedSize) applies as the body is read. It does
+// not work with Request.SetOutput, as the body has been written to the
+// output.
+//
+// The iteration stops at the first error returned by fn, which is returned
+// as it is, and the streamed body is closed (the connection is closed if
+// the body is not fully read). A malformed body reports JSONStreamError
+// with the byte offset.
+func IterateJSONArray[T any](resp *Response, path string, fn func(T) error) error {
+	if resp == nil {
+		return errors.New("req: no response")
+	}
+	if resp.Err != nil {
+		return resp.Err
+	}
+	if resp.Response == nil {
+		return errors.New("req: no response")
+	}
+	if resp.Request != nil && resp.Request.isSaveResponse {
+		return errors.New("req: IterateJSONArray does not work with SetOutput, the body has been written to the output")
+	}
+	unmarshal := json.Unmarshal
+	if resp.Request != nil && resp.Request.client != nil && resp.Request.client.jsonUnmarshal != nil {
+		unmarshal = resp.Request.client.jsonUnmarshal
+	}
+	var body io.Reader
+	switch {
+	case resp.spilled != nil:
+		body = resp.spilled.reader()
+	case resp.body != nil || resp.Body == nil:
+		body = bytes.NewReader(resp.body)
+	default:
+		body = resp.Body
+		defer resp.Body.Close()
+	}
+
+	dec := json.NewDecoder(body)
+	if err := seekJSONArray(dec, path); err != nil {
+		return err
+	}
+	for dec.More() {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return jsonStreamError(dec, err)
+		}
+		var v T
+		if err := unmarshal(raw, &v); err != nil {
+			return err
+		}
+		if err := fn(v); err != nil {
+			return err
+		}
+	}
+	// the closing bracket of the array.
+	if _, err := dec.Token(); err != nil {
+		return jsonStreamError(dec, err)
+	}
+	if body == resp.Body {
+		// read the rest of the stream, which surfaces the error detected
+		// at the end, e.g. the gzip integrity check.
+		if _, err := io.Copy(io.Discard, body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// seekJSONArray reads the tokens of dec until the opening bracket of the
+// array at path.
+func seekJSONArray(dec *json.Decoder, path string) error {
+	var keys []string
+	if path != "" {
+		keys = strings.Split(path, ".")
+	}
+	for i, key := range keys {
+		if err := expectJSONDelim(dec, '{', strings.Join(keys[:i], ".")); err != nil {
+			return err
+		}
+		for {
+			if !dec.More() {
+				return fmt.Errorf("req: json path %q not found", strings.Join(keys[:i+1], "."))
+			}
+			t, err := dec.Token()
+			if err != nil {
+				return jsonStreamError(dec, err)
+			}
+			if t == key {
+				break
+			}
+			if err = skipJSONValue(dec); err != nil {
+				return err
+			}
+		}
+	}
+	return expectJSONDelim(dec, '[', path)
+}
+
+func expectJSONDelim(dec *json.Decoder, delim json.Delim, path string) error {
+	t, err := dec.Token()
+	if err != nil {
+		return jsonStreamError(dec, err)
+	}
+	if t != delim {
+		kind := "object"
+		if delim == '[' {
+			kind = "array"
+		}
+		if path == "" {
+			return fmt.Errorf("req: json body is not an %s", kind)
+		}
+		return fmt.Errorf("req: json path %q is not an %s", path, kind)
+	}
+	return nil
+}
+
+// skipJSONValue skips the next value of dec token by token, which does not
+// buffer the whole value.
+func skipJSONValue(dec *json.Decoder) error {
+	depth := 0
+	for {
+		t, err := dec.Token()
+		if err != nil {
+			return jsonStreamError(dec, err)
+		}
+		switch t {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+		if depth == 0 {
+			return nil
+		}
+	}
+}
+
+func jsonStreamError(dec *json.Decoder, err error) error {
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		return &JSONStreamError{Offset: syntaxErr.Offset, Err: err}
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return &JSONStreamError{Offset: dec.InputOffset(), Err: err}
+	}
+	// the error of reading the body, e.g. exceeds the size limit.
+	return err
+}
@@ -0,0 +1,176 @@
+package req
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/imroc/req/v3/internal/header"
+)
+
+const jsonRPCVersion = "2.0"
+
+// jsonRPCRequest is the JSON-RPC 2.0 request object.
+type jsonRPCRequest struct {
+	JSONRPC string `json:"jsonrpc"`
+	Method  string `json:"method"`
+	Params  any    `json:"params,omitempty"`
+	ID      any    `json:"id,omitempty"`
+}
+
+// JSONRPCCall is a call of the JSON-RPC 2.0 batch request, see
+// Request.SetJSONRPCBatch.
+type JSONRPCCall struct {
+	Method string
+	// Params is the structured params of the call, which is marshalled to
+	// a JSON array or object, omitted if nil.
+	Params any
+	// ID is the id of the call, which is a string or a number, the call is
+	// a notification which has no response if ID is nil.
+	ID any
+}
+
+// JSONRPCError is the error object of JSON-RPC 2.0 response, which is
+// returned by Response.JSONRPCResult if the response contains an error.
+type JSONRPCError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *JSONRPCError) Error() string {
+	return fmt.Sprintf("jsonrpc: %s (code %d)", e.Message, e.Code)
+}
+
+// JSONRPCResult is the response object of JSON-RPC 2.0 batch response, see
+// Response.JSONRPCBatchResults.
+type JSONRPCResult struct {
+	ID     json.RawMessage `json:"id"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  *JSONRPCError   `json:"error,omitempty"`
+}
+
+// Unmarshal unmarshals the result into v, or returns the JSONRPCError if
+// the call failed.
+func (r *JSONRPCResult) Unmarshal(v any) error {
+	if r.Error != nil {
+		return r.Error
+	}
+	if v == nil || len(r.Result) == 0 {
+		return nil
+	}
+	return json.Unmarshal(r.Result, v)
+}
+
+// SetJSONRPC set the request Body as the JSON-RPC 2.0 request
+// `{"jsonrpc":"2.0","method":...,"params":...,"id":...}` and set
+// Content-Type header as "application/json; charset=utf-8", then send it
+// with the Post method to the JSON-RPC endpoint. The params is omitted if
+// nil, and the request is a notification if id is nil.
+func (r *Request) SetJSONRPC(method string, params, id any) *Request {
+	r.jsonRPCBatch = nil
+	r.marshalBody = &jsonRPCRequest{JSONRPC: jsonRPCVersion, Method: method, Params: params, ID: id}
+	r.SetContentType(header.JsonContentType)
+	return r
+}
+
+// SetJSONRPCBatch set the request Body as the JSON-RPC 2.0 batch request of
+// the calls, see SetJSONRPC, use Response.JSONRPCBatchResults to get the
+// results.
+func (r *Request) SetJSONRPCBatch(calls []JSONRPCCall) *Request {
+	batch := make([]*jsonRPCRequest, len(calls))
+	for i, call := range calls {
+		batch[i] = &jsonRPCRequest{JSONRPC: jsonRPCVersion, Method: call.Method, Params: call.Params, ID: call.ID}
+	}
+	r.jsonRPCBatch = calls
+	r.marshalBody = batch
+	r.SetContentType(header.JsonContentType)
+	return r
+}
+
+// JSONRPCResult unwraps the "result" of the JSON-RPC 2.0 response into v,
+// or returns the *JSONRPCError if the response contains an "error". The
+// error is returned if the request failed or the body is not a JSON-RPC
+// response.
+func (r *Response) JSONRPCResult(v any) error {
+	body, err := r.jsonRPCBody()
+	if err != nil {
+		return err
+	}
+	var result JSONRPCResult
+	if err = r.Request.client.jsonUnmarshal(body, &result); err != nil {
+		return fmt.Errorf("jsonrpc: invalid response (status %s): %w", r.Status, err)
+	}
+	if result.Error != nil {
+		return result.Error
+	}
+	if len(result.Result) == 0 {
+		return fmt.Errorf("jsonrpc: invalid response (status %s): neither result nor error", r.Status)
+	}
+	if v == nil {
+		return nil
+	}
+	return r.Request.client.jsonUnmarshal(result.Result, v)
+}
+
+// JSONRPCBatchResults returns the results of the JSON-RPC 2.0 batch
+// response, which are ordered as the calls set by Request.SetJSONRPCBatch
+// with the matching id, the notifications have no result, the results
+// which do not match any call (e.g. the error of the invalid request which
+// has null id) are appended at the end. A single error object is returned
+// as *JSONRPCError if the whole batch is rejected.
+func (r *Response) JSONRPCBatchResults() ([]JSONRPCResult, error) {
+	body, err := r.jsonRPCBody()
+	if err != nil {
+		return nil, err
+	}
+	if body = bytes.TrimSpace(body); len(body) > 0 && body[0] == '{' {
+		var result JSONRPCResult
+		if err = r.Request.client.jsonUnmarshal(body, &result); err == nil && result.Error != nil {
+			return nil, result.Error
+		}
+	}
+	var results []JSONRPCResult
+	if err = r.Request.client.jsonUnmarshal(body, &results); err != nil {
+		return nil, fmt.Errorf("jsonrpc: invalid batch response (status %s): %w", r.Status, err)
+	}
+	calls := r.Request.jsonRPCBatch
+	if len(calls) == 0 {
+		return results, nil
+	}
+	ordered := make([]JSONRPCResult, 0, len(results))
+	matched := make([]bool, len(results))
+	for _, call := range calls {
+		if call.ID == nil {
+			continue
+		}
+		id, err := json.Marshal(call.ID)
+		if err != nil {
+			continue
+		}
+		for i := range results {
+			if !matched[i] && bytes.Equal(bytes.TrimSpace(results[i].ID), id) {
+				matched[i] = true
+				ordered = append(ordered, results[i])
+				break
+			}
+		}
+	}
+	for i := range results {
+		if !matched[i] {
+			ordered = append(ordered, results[i])
+		}
+	}
+	return ordered, nil
+}
+
+func (r *Response) jsonRPCBody() ([]byte, error) {
+	if r.Err != nil {
+		return nil, r.Err
+	}
+	if r.Response == nil {
+		return nil, errors.New("jsonrpc: no response")
+	}
+	return r.ToBytes()
+}
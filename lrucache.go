@@ -0,0 +1,153 @@
+package req
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// lruSweepInterval is the interval of removing the expired entries of the
+// LRUCache.
+const lruSweepInterval = time.Minute
+
+// CacheStats is the statistics of the LRUCache.
+type CacheStats struct {
+	Hits        uint64
+	Misses      uint64
+	Evictions   uint64
+	Expirations uint64
+	Entries     int
+	Bytes       int64
+}
+
+// LRUCache is the in-memory Cache which evicts the least recently used
+// responses when the number of entries or the total size exceeds the limit,
+// see NewLRUCache. It is safe for concurrent use.
+type LRUCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	maxBytes   int64
+	ll         *list.List
+	items      map[string]*list.Element
+	bytes      int64
+	stats      CacheStats
+	lastSweep  time.Time
+}
+
+type lruEntry struct {
+	key  string
+	resp *CachedResponse
+	size int64
+}
+
+// NewLRUCache creates an in-memory Cache for Client.SetResponseCache, which
+// holds at most maxEntries responses of maxBytes in total, zero means no
+// limit. The entry expires when the response becomes stale according to
+// Cache-Control: max-age, but the stale response which can be revalidated
+// (has the ETag or Last-Modified validator) is kept until it is evicted. The
+// expired entries are removed lazily on access, and all of them are swept
+// every minute while the cache is in use.
+func NewLRUCache(maxEntries int, maxBytes int64) *LRUCache {
+	return &LRUCache{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		ll:         list.New(),
+		items:      make(map[string]*list.Element),
+		lastSweep:  time.Now(),
+	}
+}
+
+func (e *lruEntry) expired(now time.Time) bool {
+	return !e.resp.Fresh(now) && !e.resp.Revalidatable()
+}
+
+// Get implements Cache.
+func (c *LRUCache) Get(key string) (*CachedResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	c.sweepIfDue(now)
+	el, ok := c.items[key]
+	if ok && el.Value.(*lruEntry).expired(now) {
+		c.remove(el)
+		c.stats.Expirations++
+		ok = false
+	}
+	if !ok {
+		c.stats.Misses++
+		return nil, false
+	}
+	c.stats.Hits++
+	c.ll.MoveToFront(el)
+	return el.Value.(*lruEntry).resp, true
+}
+
+// Set implements Cache.
+func (c *LRUCache) Set(key string, resp *CachedResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	c.sweepIfDue(now)
+	if el, ok := c.items[key]; ok {
+		c.remove(el)
+	}
+	e := &lruEntry{key: key, resp: resp, size: resp.Size()}
+	if c.maxBytes > 0 && e.size > c.maxBytes {
+		return
+	}
+	c.items[key] = c.ll.PushFront(e)
+	c.bytes += e.size
+	for (c.maxEntries > 0 && c.ll.Len() > c.maxEntries) || (c.maxBytes > 0 && c.bytes > c.maxBytes) {
+		c.remove(c.ll.Back())
+		c.stats.Evictions++
+	}
+}
+
+// Delete implements Cache.
+func (c *LRUCache) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		c.remove(el)
+	}
+}
+
+// Clear removes all entries of the cache.
+func (c *LRUCache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ll.Init()
+	clear(c.items)
+	c.bytes = 0
+}
+
+// Stats returns the statistics of the cache.
+func (c *LRUCache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Entries = c.ll.Len()
+	stats.Bytes = c.bytes
+	return stats
+}
+
+func (c *LRUCache) remove(el *list.Element) {
+	e := c.ll.Remove(el).(*lruEntry)
+	delete(c.items, e.key)
+	c.bytes -= e.size
+}
+
+func (c *LRUCache) sweepIfDue(now time.Time) {
+	if now.Sub(c.lastSweep) < lruSweepInterval {
+		return
+	}
+	c.lastSweep = now
+	for el := c.ll.Back(); el != nil; {
+		prev := el.Prev()
+		if el.Value.(*lruEntry).expired(now) {
+			c.remove(el)
+			c.stats.Expirations++
+		}
+		el = prev
+	}
+}
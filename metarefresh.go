@@ -0,0 +1,243 @@
+package req
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+
+	"github.com/imroc/req/v3/internal/transport"
+)
+
+// defaultMetaRefreshMaxDelay is the default max delay honored when following
+// the meta refresh.
+const defaultMetaRefreshMaxDelay = 5 * time.Second
+
+// metaRefreshMaxBodySize is the max size of the html body which is parsed
+// for the meta refresh, the directive beyond it is not a refresh page in
+// practice.
+const metaRefreshMaxBodySize = 1 << 20
+
+// EnableMetaRefreshFollow enables following the `Refresh` header of responses
+// and the `<meta http-equiv="refresh">` directive of `text/html` responses
+// (within the first 1MB) as if it were a redirect, at most maxHops times, the
+// header takes precedence over the directive. The redirect policy is
+// respected, and the sensitive headers (e.g. Authorization and Cookie) are
+// stripped if the host changes. The delay of the directive is honored up to
+// 5 seconds by default, see SetMetaRefreshMaxDelay. It only works if the
+// response body is read automatically, the followed URLs are available in
+// Response.RedirectChain.
+func (c *Client) EnableMetaRefreshFollow(maxHops int) *Client {
+	c.metaRefreshMaxHops = maxHops
+	return c
+}
+
+// DisableMetaRefreshFollow disables following the meta refresh (default).
+func (c *Client) DisableMetaRefreshFollow() *Client {
+	c.metaRefreshMaxHops = 0
+	return c
+}
+
+// SetMetaRefreshMaxDelay set the max delay honored when following the meta
+// refresh, the longer delay of the directive is capped to d, set to zero to
+// follow without delay.
+func (c *Client) SetMetaRefreshMaxDelay(d time.Duration) *Client {
+	c.metaRefreshMaxDelay = &d
+	return c
+}
+
+func (c *Client) getMetaRefreshMaxDelay() time.Duration {
+	if c.metaRefreshMaxDelay == nil {
+		return defaultMetaRefreshMaxDelay
+	}
+	return *c.metaRefreshMaxDelay
+}
+
+// RedirectChain returns the URLs of the redirects followed in order, including
+// the followed meta refresh, the last one is the URL of the final response.
+// Returns nil if no redirect is followed.
+func (r *Response) RedirectChain() []*url.URL {
+	if r.record == nil {
+		return nil
+	}
+	var urls []*url.URL
+	for _, req := range r.record.redirects {
+		urls = append(urls, req.URL)
+	}
+	return urls
+}
+
+// roundTripRecord records the connection of the final hop and the redirect
+// requests which pass the redirect policy, which is allocated once for each
+// request and shared with the transports in the context.
+type roundTripRecord struct {
+	connInfo  transport.ConnInfo
+	redirects []*http.Request
+}
+
+// ConnInfo implements transport.ConnInfoHolder.
+func (rec *roundTripRecord) ConnInfo() *transport.ConnInfo {
+	return &rec.connInfo
+}
+
+func recordRedirect(req *http.Request) {
+	if rec, ok := transport.ConnInfoHolderFrom(req.Context()).(*roundTripRecord); ok {
+		rec.redirects = append(rec.redirects, req)
+	}
+}
+
+// followMetaRefresh follows the meta refresh of the response which body has
+// been read automatically.
+func (c *Client) followMetaRefresh(ctx context.Context, r *Request, resp *Response) {
+	for hops := 0; hops < c.metaRefreshMaxHops; hops++ {
+		if resp.Err != nil || resp.Response == nil {
+			return
+		}
+		target, delay, ok := parseRefresh(resp)
+		if !ok {
+			return
+		}
+		u, err := resp.Response.Request.URL.Parse(target)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+		if err != nil {
+			return
+		}
+		ireq := r.RawRequest
+		for k, vv := range ireq.Header {
+			if shouldCopyHeaderOnMetaRefresh(k, ireq.URL, u) {
+				req.Header[k] = vv
+			}
+		}
+		via := append([]*http.Request{ireq}, resp.record.redirects...)
+		if c.httpClient.CheckRedirect != nil {
+			if err = c.httpClient.CheckRedirect(req, via); err != nil {
+				if err != http.ErrUseLastResponse {
+					resp.Err = &url.Error{Op: "Get", URL: u.String(), Err: err}
+				}
+				return
+			}
+		} else {
+			recordRedirect(req)
+		}
+		if delay = min(delay, c.getMetaRefreshMaxDelay()); delay > 0 {
+			timer := time.NewTimer(delay)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				resp.Err = ctx.Err()
+				return
+			case <-timer.C:
+			}
+		}
+		httpResponse, err := c.httpClient.Do(req)
+		if err != nil {
+			resp.Err = err
+			return
+		}
+		resp.Response = httpResponse
+		resp.resetBody()
+		if resp.StatusCode <= 199 {
+			return
+		}
+		resp.readBody()
+		resp.Body = resp.rereadableBody()
+	}
+}
+
+// shouldCopyHeaderOnMetaRefresh strips the sensitive headers if the host
+// changes, which is the same as the behavior of redirects of net/http.
+func shouldCopyHeaderOnMetaRefresh(key string, initial, dest *url.URL) bool {
+	switch http.CanonicalHeaderKey(key) {
+	case "Host":
+		return false
+	case "Authorization", "Www-Authenticate", "Cookie", "Cookie2":
+		return strings.EqualFold(initial.Hostname(), dest.Hostname())
+	}
+	return true
+}
+
+// parseRefresh returns the target URL and delay of the Refresh header of the
+// response, or the meta refresh directive of the html body.
+func parseRefresh(resp *Response) (target string, delay time.Duration, ok bool) {
+	if v := resp.Header.Get("Refresh"); v != "" {
+		if target, delay, ok = parseMetaRefreshContent(v); ok {
+			return
+		}
+	}
+	if !strings.Contains(resp.GetContentType(), "text/html") {
+		return "", 0, false
+	}
+	var body io.Reader
+	switch {
+	case resp.spilled != nil:
+		body = resp.spilled.reader()
+	case resp.body != nil:
+		body = bytes.NewReader(resp.body)
+	default:
+		return "", 0, false
+	}
+	return parseMetaRefresh(io.LimitReader(body, metaRefreshMaxBodySize))
+}
+
+// parseMetaRefresh returns the target URL and delay of the first meta refresh
+// directive in the html, e.g. <meta http-equiv="refresh" content="5; url=/next">.
+func parseMetaRefresh(body io.Reader) (target string, delay time.Duration, ok bool) {
+	z := html.NewTokenizer(body)
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			if string(name) == "body" {
+				return
+			}
+			if string(name) != "meta" || !hasAttr {
+				continue
+			}
+			var httpEquiv, content string
+			for hasAttr {
+				var k, v []byte
+				k, v, hasAttr = z.TagAttr()
+				switch string(k) {
+				case "http-equiv":
+					httpEquiv = string(v)
+				case "content":
+					content = string(v)
+				}
+			}
+			if strings.EqualFold(httpEquiv, "refresh") {
+				return parseMetaRefreshContent(content)
+			}
+		}
+	}
+}
+
+func parseMetaRefreshContent(content string) (target string, delay time.Duration, ok bool) {
+	seconds, rest, _ := strings.Cut(content, ";")
+	if !strings.Contains(seconds, "=") {
+		if sec, err := strconv.ParseFloat(strings.TrimSpace(seconds), 64); err == nil && sec > 0 {
+			delay = time.Duration(sec * float64(time.Second))
+		}
+	} else { // no delay, e.g. "url=/next"
+		rest = content
+	}
+	rest = strings.TrimLeft(rest, " \t,;")
+	if key, value, found := strings.Cut(rest, "="); found && strings.EqualFold(strings.TrimSpace(key), "url") {
+		rest = value
+	}
+	target = strings.Trim(strings.TrimSpace(rest), `'"`)
+	if target == "" {
+		return "", 0, false
+	}
+	return target, delay, true
+}
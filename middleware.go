@@ -2,7 +2,9 @@ package req
 
 import (
 	"bytes"
+	"context"
 	"errors"
+	"fmt"
 	"io"
 	"mime/multipart"
 	"net/http"
@@ -11,6 +13,9 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"runtime"
+	"runtime/debug"
+	"sort"
 	"strings"
 	"time"
 
@@ -26,6 +31,106 @@ type (
 	ResponseMiddleware func(client *Client, resp *Response) error
 )
 
+// MiddlewarePanicError is the error returned when a panic occurs in the
+// middleware or hook (request middleware, response middleware, retry hook,
+// retry condition or redirect policy), it can be disabled by
+// Client.DisablePanicRecovery.
+type MiddlewarePanicError struct {
+	// Name is the name of the middleware function which panicked.
+	Name string
+	// Value is the value passed to panic.
+	Value any
+	// Stack is the stack trace captured when recovering the panic.
+	Stack []byte
+}
+
+func (e *MiddlewarePanicError) Error() string {
+	return fmt.Sprintf("panic in middleware %s: %v", e.Name, e.Value)
+}
+
+// Unwrap returns the panic value if it is an error.
+func (e *MiddlewarePanicError) Unwrap() error {
+	if err, ok := e.Value.(error); ok {
+		return err
+	}
+	return nil
+}
+
+func funcName(fn any) string {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func || v.IsNil() {
+		return ""
+	}
+	if f := runtime.FuncForPC(v.Pointer()); f != nil {
+		return f.Name()
+	}
+	return ""
+}
+
+func newMiddlewarePanicError(fn, v any) *MiddlewarePanicError {
+	return &MiddlewarePanicError{
+		Name:  funcName(fn),
+		Value: v,
+		Stack: debug.Stack(),
+	}
+}
+
+// recoverMiddlewarePanic must be called with defer, it converts the
+// panic into *MiddlewarePanicError and stores it in err.
+func (c *Client) recoverMiddlewarePanic(fn any, err *error) {
+	if c.disablePanicRecovery {
+		return
+	}
+	if v := recover(); v != nil {
+		*err = newMiddlewarePanicError(fn, v)
+	}
+}
+
+func (c *Client) runRequestMiddleware(m RequestMiddleware, r *Request) (err error) {
+	defer c.recoverMiddlewarePanic(m, &err)
+	return m(c, r)
+}
+
+func (c *Client) runResponseMiddleware(m ResponseMiddleware, resp *Response) (err error) {
+	defer func() {
+		if _, ok := err.(*MiddlewarePanicError); ok && resp.Response != nil && resp.Body != nil {
+			resp.Body.Close() // release the connection in case the body is not fully read.
+		}
+	}()
+	defer c.recoverMiddlewarePanic(m, &err)
+	return m(c, resp)
+}
+
+func (c *Client) runRetryCondition(condition RetryConditionFunc, resp *Response, e error) (needRetry bool, err error) {
+	defer c.recoverMiddlewarePanic(condition, &err)
+	return condition(resp, e), nil
+}
+
+func (c *Client) runRetryHook(hook RetryHookFunc, resp *Response, e error) (err error) {
+	defer c.recoverMiddlewarePanic(hook, &err)
+	hook(resp, e)
+	return
+}
+
+func (c *Client) runOnRetry(fn func(info RetryInfo), info RetryInfo) (err error) {
+	defer c.recoverMiddlewarePanic(fn, &err)
+	fn(info)
+	return
+}
+
+func (c *Client) runPrecondition(precondition func(ctx context.Context) error, ctx context.Context) (err error) {
+	defer c.recoverMiddlewarePanic(precondition, &err)
+	if e := precondition(ctx); e != nil {
+		err = &PreconditionError{Err: e}
+	}
+	return
+}
+
+func (c *Client) runRedirectPolicy(policy RedirectPolicy, req *http.Request, via []*http.Request) (err error) {
+	defer c.recoverMiddlewarePanic(policy, &err)
+	return policy(req, via)
+}
+
 func createMultipartHeader(file *FileUpload, contentType string) textproto.MIMEHeader {
 	hdr := make(textproto.MIMEHeader)
 
@@ -96,17 +201,22 @@ func writeMultipartFormFile(w *multipart.Writer, file *FileUpload, r *Request) e
 	}
 
 	if r.forceChunkedEncoding && r.uploadCallback != nil {
+		pg := newProgress(lastTime, r.progressWindow)
 		pw = &callbackWriter{
 			Writer:    pw,
 			lastTime:  lastTime,
 			interval:  r.uploadCallbackInterval,
 			totalSize: file.FileSize,
 			callback: func(written int64) {
+				speed, avg, eta := pg.update(time.Now(), written, file.FileSize)
 				r.uploadCallback(UploadInfo{
 					ParamName:    file.ParamName,
 					FileName:     file.FileName,
 					FileSize:     file.FileSize,
 					UploadedSize: written,
+					Speed:        speed,
+					AverageSpeed: avg,
+					ETA:          eta,
 				})
 			},
 		}
@@ -125,33 +235,27 @@ func writeMultipartFormFile(w *multipart.Writer, file *FileUpload, r *Request) e
 
 func writeMultiPart(r *Request, w *multipart.Writer) {
 	defer w.Close() // close multipart to write tailer boundary
-	if len(r.FormData) > 0 {
-		for k, vs := range r.FormData {
-			for _, v := range vs {
-				w.WriteField(k, v)
-			}
-		}
-	} else if len(r.OrderedFormData) > 0 {
-		if len(r.OrderedFormData)%2 != 0 {
-			r.error = errBadOrderedFormData
-			return
+	if len(r.FormData) == 0 && len(r.OrderedFormData)%2 != 0 {
+		r.error = errBadOrderedFormData
+		return
+	}
+	for _, p := range r.multipartLayout() {
+		if p.file != nil {
+			writeMultipartFormFile(w, p.file, r)
+			continue
 		}
-		maxIndex := len(r.OrderedFormData) - 2
-		for i := 0; i <= maxIndex; i += 2 {
-			key := r.OrderedFormData[i]
-			value := r.OrderedFormData[i+1]
-			w.WriteField(key, value)
+		for _, v := range p.values {
+			w.WriteField(p.field, v)
 		}
 	}
-	for _, file := range r.uploadFiles {
-		writeMultipartFormFile(w, file, r)
-	}
 }
 
 func handleMultiPart(c *Client, r *Request) (err error) {
 	var b string
-	if c.multipartBoundaryFunc != nil {
-		b = c.multipartBoundaryFunc()
+	if r.multipartBoundary != "" {
+		b = r.multipartBoundary
+	} else {
+		b = c.newMultipartBoundary()
 	}
 
 	if r.forceChunkedEncoding {
@@ -185,14 +289,14 @@ func handleMultiPart(c *Client, r *Request) (err error) {
 }
 
 func handleFormData(r *Request) {
-	r.SetContentType(header.FormContentType)
+	setFormContentType(r)
 	r.SetBodyBytes([]byte(r.FormData.Encode()))
 }
 
 var errBadOrderedFormData = errors.New("bad ordered form data, the number of key-value pairs should be an even number")
 
 func handleOrderedFormData(r *Request) {
-	r.SetContentType(header.FormContentType)
+	setFormContentType(r)
 	if len(r.OrderedFormData)%2 != 0 {
 		r.error = errBadOrderedFormData
 		return
@@ -245,7 +349,14 @@ func handleMarshalBody(c *Client, r *Request) error {
 }
 
 func parseRequestBody(c *Client, r *Request) (err error) {
-	if c.isPayloadForbid(r.Method) {
+	if c.isPayloadForbid(r) {
+		if r.marshalBody != nil || len(r.Body) > 0 || r.GetBody != nil || r.isMultiPart || r.multipartMixed != nil || len(r.FormData) > 0 || len(r.OrderedFormData) > 0 {
+			if c.bodyStrippedWarned.CompareAndSwap(false, true) {
+				c.log.Warnf("the body of %s request is stripped, use Client.SetAllowBodyOnMethod or Request.AllowBodyOnMethod to send it (logged once)", r.Method)
+			} else {
+				c.debugf(r.rawContext(), "the body of %s request is stripped, use Request.AllowBodyOnMethod to send it", r.Method)
+			}
+		}
 		r.marshalBody = nil
 		r.Body = nil
 		r.GetBody = nil
@@ -255,6 +366,9 @@ func parseRequestBody(c *Client, r *Request) (err error) {
 	if r.isMultiPart {
 		return handleMultiPart(c, r)
 	}
+	if r.multipartMixed != nil {
+		return handleMultipartMixed(c, r)
+	}
 
 	// handle form data
 	if len(c.FormData) > 0 {
@@ -293,20 +407,15 @@ func parseRequestBody(c *Client, r *Request) (err error) {
 }
 
 func unmarshalBody(c *Client, r *Response, v any) (err error) {
-	body, err := r.ToBytes() // in case req.SetResult or req.SetError with client.DisableAutoReadResponse(true)
-	if err != nil {
-		return
-	}
+	// in case req.SetResult or req.SetError with client.DisableAutoReadResponse(true)
 	ct := r.GetContentType()
 	if util.IsJSONType(ct) {
-		return c.jsonUnmarshal(body, v)
+		return r.unmarshalJson(v)
 	} else if util.IsXMLType(ct) {
-		return c.xmlUnmarshal(body, v)
+		return r.unmarshalXml(v)
 	} else {
-		if c.DebugLog {
-			c.log.Debugf("cannot determine the unmarshal function with %q Content-Type, default to json", ct)
-		}
-		return c.jsonUnmarshal(body, v)
+		c.debugf(r.Request.rawContext(), "cannot determine the unmarshal function with %q Content-Type, default to json", ct)
+		return r.unmarshalJson(v)
 	}
 }
 
@@ -321,38 +430,97 @@ func defaultResultStateChecker(resp *Response) ResultState {
 }
 
 func parseResponseBody(c *Client, r *Response) (err error) {
-	if r.Response == nil {
+	req := r.Request
+	if r.Response == nil || req.stdRequest != nil || req.unbufferedBody { // keep the raw body for StdClient and EnableUnbufferedBody
 		return
 	}
-	req := r.Request
 	switch r.ResultState() {
 	case SuccessState:
-		if req.Result != nil && r.StatusCode != http.StatusNoContent {
+		if req.Result != nil && !c.isEmptyBody(r) {
 			err = unmarshalBody(c, r, r.Request.Result)
 			if err == nil {
 				r.result = r.Request.Result
 			}
 		}
 	case ErrorState:
-		if r.StatusCode == http.StatusNoContent {
+		if c.isEmptyBody(r) {
 			return
 		}
+		var e any
 		if req.Error != nil {
-			err = unmarshalBody(c, r, req.Error)
-			if err == nil {
-				r.error = req.Error
-			}
+			e = req.Error
 		} else if c.commonErrorType != nil {
-			e := reflect.New(c.commonErrorType).Interface()
-			err = unmarshalBody(c, r, e)
-			if err == nil {
-				r.error = e
-			}
+			e = reflect.New(c.commonErrorType).Interface()
+		}
+		if e == nil {
+			captureErrorBodySnippet(c, r)
+			return
+		}
+		ct := r.GetContentType()
+		if !util.IsJSONType(ct) && !util.IsXMLType(ct) {
+			// no decoder registered for the content type, e.g. an HTML error
+			// page returned by a proxy, keep the raw body instead.
+			captureErrorBodySnippet(c, r)
+			return
 		}
+		if uerr := unmarshalBody(c, r, e); uerr != nil {
+			// never let an error body which cannot be unmarshalled hide the
+			// error status of the response.
+			c.debugf(r.Request.rawContext(), "failed to unmarshal error body with %q Content-Type: %v", ct, uerr)
+			captureErrorBodySnippet(c, r)
+			return
+		}
+		r.error = e
 	}
 	return
 }
 
+// isEmptyBody reports whether the response has no content to unmarshal, see
+// Client.SetTreatEmptyBodyAsNoError.
+func (c *Client) isEmptyBody(r *Response) bool {
+	if r.StatusCode == http.StatusNoContent {
+		return true
+	}
+	if c.emptyBodyAsError {
+		return false
+	}
+	switch r.StatusCode {
+	case http.StatusResetContent, http.StatusNotModified:
+		return true
+	}
+	if r.spilled != nil { // spilled, which is larger than the threshold.
+		return false
+	}
+	if r.body != nil { // already read
+		return len(r.body) == 0
+	}
+	if r.ContentLength >= 0 {
+		return r.ContentLength == 0
+	}
+	err := r.readBody()
+	return err == nil && r.spilled == nil && len(r.body) == 0
+}
+
+const defaultErrorBodyLimit = 4096
+
+func captureErrorBodySnippet(c *Client, r *Response) {
+	limit := c.errorBodyLimit
+	if r.Request.errorBodyLimit != nil {
+		limit = *r.Request.errorBodyLimit
+	}
+	if limit <= 0 || r.body == nil && r.spilled == nil { // capture disabled or body not read.
+		return
+	}
+	body := r.body
+	if r.spilled != nil {
+		body, _ = io.ReadAll(io.LimitReader(r.spilled.reader(), int64(limit)))
+	}
+	if len(body) > limit {
+		body = body[:limit]
+	}
+	r.errorBodySnippet = string(body)
+}
+
 type callbackWriter struct {
 	io.Writer
 	written   int64
@@ -413,8 +581,8 @@ func handleDownload(c *Client, r *Response) (err error) {
 	}
 	var body io.ReadCloser
 
-	if r.body != nil { // already read
-		body = io.NopCloser(bytes.NewReader(r.body))
+	if r.body != nil || r.spilled != nil { // already read
+		body = r.rereadableBody()
 	} else {
 		body = r.Body
 	}
@@ -436,14 +604,25 @@ func handleDownload(c *Client, r *Response) (err error) {
 			return
 		}
 	} else {
-		output = r.Request.output // must not nil
+		output = r.Request.output // nil if only AddOutput is called
+	}
+	outputs := r.Request.outputs
+	if output != nil {
+		outputs = append([]io.Writer{output}, outputs...)
 	}
 
 	defer func() {
 		body.Close()
-		closeq(output)
+		for _, o := range outputs {
+			closeq(o)
+		}
 	}()
 
+	if len(outputs) > 1 {
+		output = multiOutput(outputs)
+	} else {
+		output = outputs[0]
+	}
 	_, err = io.Copy(output, body)
 	r.setReceivedAt()
 	return
@@ -451,7 +630,39 @@ func handleDownload(c *Client, r *Response) (err error) {
 
 // generate URL
 func parseRequestURL(c *Client, r *Request) error {
-	tempURL := r.RawURL
+	reqURL, err := buildRequestURL(c, r)
+	if err != nil {
+		return err
+	}
+	if c.basicAuthFromURL && reqURL.User != nil {
+		if r.getHeader(header.Authorization) == "" {
+			password, _ := reqURL.User.Password()
+			r.SetBasicAuth(reqURL.User.Username(), password)
+		}
+		reqURL.User = nil
+	}
+	r.URL = reqURL
+	return nil
+}
+
+// buildRequestURL resolves the url of the request with the path prefix, path
+// params, scheme, base URL and query params, without modifying the request.
+func buildRequestURL(c *Client, r *Request) (*url.URL, error) {
+	reqURL, err := resolveRequestURL(c, r, r.RawURL)
+	if err != nil {
+		return nil, err
+	}
+	setRequestQuery(c, r, reqURL)
+	return reqURL, nil
+}
+
+// resolveRequestURL resolves rawURL with the path prefix, path params, scheme
+// and base URL of the request, the query params are not applied.
+func resolveRequestURL(c *Client, r *Request, rawURL string) (*url.URL, error) {
+	tempURL := rawURL
+	if r.pathPrefix != "" && !isAbsURL(tempURL) {
+		tempURL = joinURLPath(r.pathPrefix, tempURL)
+	}
 	if len(r.PathParams) > 0 {
 		for p, v := range r.PathParams {
 			tempURL = strings.Replace(tempURL, "{"+p+"}", url.PathEscape(v), -1)
@@ -466,13 +677,13 @@ func parseRequestURL(c *Client, r *Request) error {
 	// Parsing request URL
 	reqURL, err := url.Parse(tempURL)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if reqURL.Scheme == "" && len(c.scheme) > 0 { // set scheme if missing
 		reqURL, err = url.Parse(c.scheme + "://" + tempURL)
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
 
@@ -486,11 +697,28 @@ func parseRequestURL(c *Client, r *Request) error {
 
 		reqURL, err = url.Parse(c.BaseURL + tempURL)
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
 
-	// Adding Query Param
+	reqURL.Host = removeEmptyPort(reqURL.Host)
+	return reqURL, nil
+}
+
+// setRequestQuery sets the query of reqURL with the raw query or the query
+// params of the client and request.
+func setRequestQuery(c *Client, r *Request, reqURL *url.URL) {
+	if r.rawQuery != nil {
+		reqURL.RawQuery = *r.rawQuery
+		reqURL.ForceQuery = false
+	} else {
+		addQueryParams(c, r, reqURL)
+	}
+}
+
+// addQueryParams adds the query params of the client and request to the
+// query of reqURL.
+func addQueryParams(c *Client, r *Request, reqURL *url.URL) {
 	query := make(url.Values)
 	for k, v := range c.QueryParams {
 		for _, iv := range v {
@@ -519,10 +747,6 @@ func parseRequestURL(c *Client, r *Request) error {
 			reqURL.RawQuery = reqURL.RawQuery + "&" + query.Encode()
 		}
 	}
-
-	reqURL.Host = removeEmptyPort(reqURL.Host)
-	r.URL = reqURL
-	return nil
 }
 
 func parseRequestHeader(c *Client, r *Request) error {
@@ -532,14 +756,63 @@ func parseRequestHeader(c *Client, r *Request) error {
 	if r.Headers == nil {
 		r.Headers = make(http.Header)
 	}
+	// the userinfo of the url takes precedence over the common Authorization,
+	// which is applied by parseRequestURL later.
+	skipAuth := false
+	if c.basicAuthFromURL && len(c.Headers[header.Authorization]) > 0 {
+		if u, err := buildRequestURL(c, r); err == nil && u.User != nil {
+			skipAuth = true
+		}
+	}
 	for k, vs := range c.Headers {
-		if len(r.Headers[k]) == 0 {
+		if skipAuth && k == header.Authorization {
+			continue
+		}
+		if len(r.Headers[k]) == 0 && !hasHeaderSpelling(r.Headers, k) {
 			r.Headers[k] = vs
 		}
 	}
 	return nil
 }
 
+func isAbsURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	return err == nil && u.IsAbs()
+}
+
+// hasHeaderSpelling reports whether the header has the key in any casing,
+// which may be set by Request.SetHeaderNonCanonical.
+func hasHeaderSpelling(h http.Header, key string) bool {
+	for k, vs := range h {
+		if len(vs) > 0 && strings.EqualFold(k, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// deleteHeaderSpellings deletes the key in other casings from the header.
+func deleteHeaderSpellings(h http.Header, key string) {
+	for k := range h {
+		if k != key && strings.EqualFold(k, key) {
+			delete(h, k)
+		}
+	}
+}
+
+// nonCanonicalHeaderKeys returns the non-canonical keys of the header, which
+// are sent in lowercase in HTTP/2 and HTTP/3.
+func nonCanonicalHeaderKeys(h http.Header) []string {
+	var keys []string
+	for k := range h {
+		if k != http.CanonicalHeaderKey(k) && !header.IsExcluded(k) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 func parseRequestCookie(c *Client, r *Request) error {
 	if len(c.Cookies) > 0 || r.RetryAttempt <= 0 {
 		r.Cookies = append(r.Cookies, c.Cookies...)
@@ -0,0 +1,324 @@
+package req
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"slices"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/imroc/req/v3/internal/header"
+)
+
+// multipartPart is a part of the multipart body in the order it's added to
+// the request, which is either a form field or a file upload, the values of
+// the field are filled when the layout is resolved.
+type multipartPart struct {
+	field  string
+	values []string
+	file   *FileUpload
+}
+
+func (p multipartPart) name() string {
+	if p.file != nil {
+		return p.file.ParamName
+	}
+	return p.field
+}
+
+// trackFormField records the form field which is added to the request for
+// the first time, so that the multipart parts are written in the call order.
+func (r *Request) trackFormField(k string) {
+	if _, ok := r.FormData[k]; !ok {
+		r.multipartParts = append(r.multipartParts, multipartPart{field: k})
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// SetMultipartBoundary set the boundary of the multipart body of the request,
+// which overrides Client.SetMultipartBoundaryFunc. The boundary must be 1 to
+// 70 characters of the RFC 2046 charset (letters, digits, space and
+// '()+_,-./:=? characters) and must not end with space, otherwise the
+// request fails.
+func (r *Request) SetMultipartBoundary(boundary string) *Request {
+	if err := multipart.NewWriter(io.Discard).SetBoundary(boundary); err != nil {
+		r.appendError(fmt.Errorf("invalid multipart boundary %q: %w", boundary, err))
+		return r
+	}
+	r.multipartBoundary = boundary
+	return r
+}
+
+// SetMultipartOrder set the order of the multipart parts by the field names
+// (the ParamName of the file uploads), which is useful when the form data is
+// set from maps. The named parts are written first in the given order, the
+// rest are written in the default order: the form fields which are not set
+// by the request methods (e.g. the CSRF token) sorted by name, then the
+// fields and files in the order they are added, the fields in a single map
+// are sorted by name.
+func (r *Request) SetMultipartOrder(fieldNames ...string) *Request {
+	r.multipartOrder = fieldNames
+	return r
+}
+
+// multipartLayout returns the parts of the multipart body in the on-wire
+// order.
+func (r *Request) multipartLayout() []multipartPart {
+	var parts []multipartPart
+	if len(r.FormData) > 0 {
+		tracked := make(map[string]bool, len(r.multipartParts))
+		for _, p := range r.multipartParts {
+			if p.file == nil {
+				tracked[p.field] = true
+			}
+		}
+		for _, k := range sortedKeys(r.FormData) {
+			if !tracked[k] {
+				parts = append(parts, multipartPart{field: k, values: r.FormData[k]})
+			}
+		}
+		written := make(map[string]bool, len(tracked))
+		for _, p := range r.multipartParts {
+			if p.file == nil {
+				if _, ok := r.FormData[p.field]; !ok || written[p.field] {
+					continue
+				}
+				written[p.field] = true
+				p.values = r.FormData[p.field]
+			}
+			parts = append(parts, p)
+		}
+	} else {
+		for i := 0; i+1 < len(r.OrderedFormData); i += 2 {
+			parts = append(parts, multipartPart{field: r.OrderedFormData[i], values: r.OrderedFormData[i+1 : i+2]})
+		}
+		for _, p := range r.multipartParts {
+			if p.file != nil {
+				parts = append(parts, p)
+			}
+		}
+	}
+	if len(r.multipartOrder) > 0 {
+		rank := func(p multipartPart) int {
+			if i := slices.Index(r.multipartOrder, p.name()); i >= 0 {
+				return i
+			}
+			return len(r.multipartOrder)
+		}
+		sort.SliceStable(parts, func(i, j int) bool {
+			return rank(parts[i]) < rank(parts[j])
+		})
+	}
+	return parts
+}
+
+// MixedPart is a part of the multipart/mixed body, see
+// Request.SetMultipartMixed.
+type MixedPart struct {
+	// Header is the header of the part, e.g. Content-Type, the default
+	// content type of the part is "text/plain" if not set (RFC 2046).
+	Header http.Header
+	// Body is the content of the part, which is streamed rather than
+	// buffered. It's rewound if it's an io.Seeker when the body is sent
+	// again (e.g. retry), otherwise sending the body again fails.
+	Body io.Reader
+}
+
+// SetMultipartMixed set the request Body as the multipart/mixed body of the
+// parts, which are arbitrary typed sections rather than the named form
+// fields of multipart/form-data, e.g. the batch requests and the emails. The
+// Content-Type header is set as "multipart/mixed; boundary=...", the
+// boundary can be set by SetMultipartBoundary. The body is streamed, so it
+// is sent with the chunked encoding in HTTP1 as its length is unknown.
+func (r *Request) SetMultipartMixed(parts ...MixedPart) *Request {
+	m := &multipartMixed{parts: parts, starts: make([]int64, len(parts))}
+	for i, part := range parts {
+		if s, ok := part.Body.(io.Seeker); ok {
+			if offset, err := s.Seek(0, io.SeekCurrent); err == nil {
+				m.starts[i] = offset
+			}
+		}
+	}
+	r.multipartMixed = m
+	return r
+}
+
+// multipartMixed is the multipart/mixed body of the request.
+type multipartMixed struct {
+	parts []MixedPart
+	// starts are the offsets of the seekable bodies of the parts.
+	starts []int64
+	// sent is true if the body has been sent, the bodies of the parts are
+	// rewound when sent again.
+	sent atomic.Bool
+}
+
+func handleMultipartMixed(c *Client, r *Request) error {
+	b := r.multipartBoundary
+	if b == "" {
+		b = c.newMultipartBoundary()
+	}
+	m := r.multipartMixed
+	r.Body = nil
+	r.GetBody = func() (io.ReadCloser, error) {
+		pr, pw := io.Pipe()
+		w := multipart.NewWriter(pw)
+		if err := w.SetBoundary(b); err != nil {
+			return nil, err
+		}
+		replay := m.sent.Swap(true)
+		go func() {
+			pw.CloseWithError(m.write(w, replay))
+		}()
+		return pr, nil
+	}
+	r.SetContentType("multipart/mixed; boundary=" + quoteBoundary(b))
+	return nil
+}
+
+func (m *multipartMixed) write(w *multipart.Writer, replay bool) error {
+	for i, part := range m.parts {
+		pw, err := w.CreatePart(textproto.MIMEHeader(part.Header))
+		if err != nil {
+			return err
+		}
+		if part.Body == nil {
+			continue
+		}
+		if replay {
+			s, ok := part.Body.(io.Seeker)
+			if !ok {
+				return fmt.Errorf("req: the body of multipart/mixed part %d can not be sent again as it is not an io.Seeker", i)
+			}
+			if _, err = s.Seek(m.starts[i], io.SeekStart); err != nil {
+				return err
+			}
+		}
+		if _, err = io.Copy(pw, part.Body); err != nil {
+			return err
+		}
+	}
+	return w.Close()
+}
+
+// quoteBoundary quotes the boundary if it contains the characters which are
+// not allowed in the token, as multipart.Writer.FormDataContentType does.
+func quoteBoundary(b string) string {
+	for _, c := range b {
+		if c == ' ' || c == '(' || c == ')' || c == ',' || c == '/' || c == ':' || c == '=' || c == '?' {
+			return `"` + b + `"`
+		}
+	}
+	return b
+}
+
+// MultipartResponse is the multipart body of the response, see
+// Response.Multipart.
+type MultipartResponse struct {
+	// MediaType is the media type of the body, e.g. "multipart/mixed" and
+	// "multipart/related".
+	MediaType string
+	// Params are the parameters of the media type, e.g. the "boundary",
+	// and the "type" and "start" of multipart/related.
+	Params map[string]string
+
+	r      *multipart.Reader
+	closer io.Closer
+}
+
+// Part is a part of the multipart body, see MultipartResponse.Next.
+type Part struct {
+	// Header is the header of the part.
+	Header http.Header
+	// Body is the content of the part, the quoted-printable content is
+	// decoded. It is only valid until the next part is read.
+	Body io.Reader
+}
+
+// ContentType returns the Content-Type header of the part, the default
+// content type of the part is "text/plain" if it's empty (RFC 2046).
+func (p *Part) ContentType() string {
+	return p.Header.Get(header.ContentType)
+}
+
+// Multipart parses the body of the nested multipart part (e.g. the
+// multipart/alternative part of an email), returns error if the part is
+// not multipart.
+func (p *Part) Multipart() (*MultipartResponse, error) {
+	return newMultipartResponse(p.ContentType(), p.Body, nil)
+}
+
+// Multipart parses the response body whose content type is "multipart/*"
+// (e.g. multipart/mixed returned by the batch APIs, or multipart/related
+// of MTOM), the parts are read lazily from the body with the Next method.
+// The body is streamed if it has not been read, e.g. with
+// Request.DisableAutoReadResponse or Request.EnableUnbufferedBody, which
+// should be closed with MultipartResponse.Close, otherwise the read body is
+// parsed.
+func (r *Response) Multipart() (*MultipartResponse, error) {
+	if r.Err != nil {
+		return nil, r.Err
+	}
+	if r.Response == nil {
+		return nil, errors.New("req: no response")
+	}
+	if r.spilled != nil {
+		return newMultipartResponse(r.GetContentType(), r.spilled.reader(), nil)
+	}
+	if r.body != nil || r.Body == nil {
+		return newMultipartResponse(r.GetContentType(), bytes.NewReader(r.body), nil)
+	}
+	return newMultipartResponse(r.GetContentType(), r.Body, r.Body)
+}
+
+func newMultipartResponse(contentType string, body io.Reader, closer io.Closer) (*MultipartResponse, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, fmt.Errorf("req: invalid multipart content type %q: %w", contentType, err)
+	}
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		return nil, fmt.Errorf("req: content type %q is not multipart", contentType)
+	}
+	if params["boundary"] == "" {
+		return nil, fmt.Errorf("req: missing boundary in multipart content type %q", contentType)
+	}
+	return &MultipartResponse{
+		MediaType: mediaType,
+		Params:    params,
+		r:         multipart.NewReader(body, params["boundary"]),
+		closer:    closer,
+	}, nil
+}
+
+// Next returns the next part of the multipart body, or io.EOF if there are
+// no more parts.
+func (m *MultipartResponse) Next() (*Part, error) {
+	p, err := m.r.NextPart()
+	if err != nil {
+		return nil, err
+	}
+	return &Part{Header: http.Header(p.Header), Body: p}, nil
+}
+
+// Close closes the streamed response body.
+func (m *MultipartResponse) Close() error {
+	if m.closer == nil {
+		return nil
+	}
+	return m.closer.Close()
+}
@@ -0,0 +1,181 @@
+package req
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/imroc/req/v3/internal/netutil"
+)
+
+// NegativeCacheError is the error of the request which fails immediately
+// because the host failed to resolve or refused the connection recently,
+// see Client.EnableNegativeCaching. It unwraps to the cached error.
+type NegativeCacheError struct {
+	// Host is the "host:port" which failed.
+	Host string
+	// Expires is when the cached failure expires.
+	Expires time.Time
+	// Err is the cached error.
+	Err error
+}
+
+func (e *NegativeCacheError) Error() string {
+	return fmt.Sprintf("req: %s failed recently (negative cache): %v", e.Host, e.Err)
+}
+
+func (e *NegativeCacheError) Unwrap() error {
+	return e.Err
+}
+
+type negativeCacheEntry struct {
+	err     error
+	expires time.Time
+}
+
+// negativeCache remembers the hosts which failed to resolve or refused the
+// connection.
+type negativeCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]negativeCacheEntry
+}
+
+func newNegativeCache(ttl time.Duration) *negativeCache {
+	return &negativeCache{ttl: ttl, entries: make(map[string]negativeCacheEntry)}
+}
+
+func (nc *negativeCache) Clone() *negativeCache {
+	if nc == nil {
+		return nil
+	}
+	return newNegativeCache(nc.ttl)
+}
+
+func (nc *negativeCache) get(host string) *NegativeCacheError {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	e, ok := nc.entries[host]
+	if !ok {
+		return nil
+	}
+	if !time.Now().Before(e.expires) {
+		delete(nc.entries, host)
+		return nil
+	}
+	return &NegativeCacheError{Host: host, Expires: e.expires, Err: e.err}
+}
+
+func (nc *negativeCache) set(host string, err error) {
+	nc.mu.Lock()
+	nc.entries[host] = negativeCacheEntry{err: err, expires: time.Now().Add(nc.ttl)}
+	nc.mu.Unlock()
+}
+
+func (nc *negativeCache) delete(host string) {
+	nc.mu.Lock()
+	delete(nc.entries, host)
+	nc.mu.Unlock()
+}
+
+// EnableNegativeCaching enables caching the hard failures of the hosts for
+// ttl, which are the failures to resolve the host (e.g. NXDOMAIN) and the
+// refused connections, so that the subsequent requests to the host (keyed
+// by "host:port") within ttl fail immediately with NegativeCacheError
+// rather than waiting for the DNS and dial timeout again, which is useful
+// to fail fast during the outages. The timeout and cancellation errors are
+// never cached as they may be caused by the caller. The entry is cleared
+// once a request to the host succeeds or ttl expires, use
+// ClearNegativeCache to clear it manually.
+func (c *Client) EnableNegativeCaching(ttl time.Duration) *Client {
+	if ttl <= 0 {
+		return c.DisableNegativeCaching()
+	}
+	c.negativeCache = newNegativeCache(ttl)
+	c.httpClient.Transport = c.newHttpTransport()
+	return c
+}
+
+// DisableNegativeCaching disables the negative caching enabled by
+// EnableNegativeCaching (default).
+func (c *Client) DisableNegativeCaching() *Client {
+	if c.negativeCache == nil {
+		return c
+	}
+	c.negativeCache = nil
+	c.httpClient.Transport = c.newHttpTransport()
+	return c
+}
+
+// ClearNegativeCache clears the cached failures of the host, which is a
+// "host:port" or a host which clears all its ports, empty host clears all
+// the cached failures.
+func (c *Client) ClearNegativeCache(host string) *Client {
+	nc := c.negativeCache
+	if nc == nil {
+		return c
+	}
+	host = strings.ToLower(host)
+	_, _, err := net.SplitHostPort(host)
+	hasPort := err == nil
+	nc.mu.Lock()
+	for key := range nc.entries {
+		if host == "" || key == host || !hasPort && hostWithoutPort(key) == hostWithoutPort(host) {
+			delete(nc.entries, key)
+		}
+	}
+	nc.mu.Unlock()
+	return c
+}
+
+// isNegativeCacheable reports whether the error is a hard failure of the
+// host, which is not caused by the caller.
+func isNegativeCacheable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return false
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return dnsErr.IsNotFound
+	}
+	return errors.Is(err, syscall.ECONNREFUSED)
+}
+
+// negativeCacheTransport fails the requests to the hosts which failed
+// recently, see Client.EnableNegativeCaching.
+type negativeCacheTransport struct {
+	rt http.RoundTripper
+	c  *Client
+}
+
+func (t *negativeCacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	nc := t.c.negativeCache
+	if nc == nil {
+		return t.rt.RoundTrip(req)
+	}
+	host := strings.ToLower(netutil.AuthorityAddr(req.URL.Scheme, req.URL.Host))
+	if err := nc.get(host); err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	resp, err := t.rt.RoundTrip(req)
+	if err == nil {
+		nc.delete(host)
+	} else if isNegativeCacheable(err) {
+		nc.set(host, err)
+	}
+	return resp, err
+}
@@ -0,0 +1,44 @@
+package req
+
+import (
+	"fmt"
+	"io"
+)
+
+// OutputError is returned if writing the response body to one of the
+// outputs fails, which aborts the download, see Request.AddOutput.
+type OutputError struct {
+	// Index is the index of the failed output in the order they are added,
+	// the output set by Request.SetOutput or Request.SetOutputFile is the
+	// first one if any.
+	Index int
+	// Output is the failed output.
+	Output io.Writer
+	// Err is the error returned by the output.
+	Err error
+}
+
+func (e *OutputError) Error() string {
+	return fmt.Sprintf("req: failed to write response body to output #%d: %v", e.Index, e.Err)
+}
+
+func (e *OutputError) Unwrap() error {
+	return e.Err
+}
+
+// multiOutput writes to all the outputs in turn like io.MultiWriter, but
+// reports which output failed.
+type multiOutput []io.Writer
+
+func (m multiOutput) Write(p []byte) (n int, err error) {
+	for i, w := range m {
+		n, err = w.Write(p)
+		if err == nil && n != len(p) {
+			err = io.ErrShortWrite
+		}
+		if err != nil {
+			return n, &OutputError{Index: i, Output: w, Err: err}
+		}
+	}
+	return len(p), nil
+}
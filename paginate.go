@@ -0,0 +1,181 @@
+package req
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"net/http"
+	"strings"
+)
+
+// defaultMaxPages is the default max number of pages fetched by Request.Pages.
+const defaultMaxPages = 1000
+
+// ErrMaxPagesExceeded is returned by Request.Pages when there are still more
+// pages after the max number of pages have been fetched, see Request.SetMaxPages.
+var ErrMaxPagesExceeded = errors.New("max pages exceeded")
+
+// PaginateFunc returns the URL of the next page according to the response of
+// the current page, returns an empty string if there is no next page. The URL
+// can be relative to the URL of the current page.
+type PaginateFunc func(resp *Response) (next string, err error)
+
+// SetPaginateFunc set the PaginateFunc which is used by Pages to find the
+// URL of the next page.
+func (r *Request) SetPaginateFunc(fn PaginateFunc) *Request {
+	r.paginateFunc = fn
+	return r
+}
+
+// SetPaginateByLinkHeader make Pages find the URL of the next page from the
+// `Link` header of the response (RFC 8288), e.g.
+//
+//	Link: <https://api.example.com/items?page=2>; rel="next"
+func (r *Request) SetPaginateByLinkHeader() *Request {
+	return r.SetPaginateFunc(func(resp *Response) (string, error) {
+		if resp.Response == nil {
+			return "", nil
+		}
+		return nextLink(resp.Header), nil
+	})
+}
+
+// SetMaxPages set the max number of pages fetched by Pages, default is 1000,
+// a negative value means no limit. It guards against infinite pagination loops,
+// Pages yields an error wraps ErrMaxPagesExceeded if there are still more
+// pages after the max number of pages have been fetched.
+func (r *Request) SetMaxPages(n int) *Request {
+	r.maxPages = n
+	return r
+}
+
+// Pages returns an iterator over the pages of a paginated resource, the first
+// page is requested with the method and URL of the request (GET by default),
+// and the next pages are requested lazily with the URL returned by the
+// PaginateFunc (see SetPaginateFunc and SetPaginateByLinkHeader):
+//
+//	for resp, err := range client.R().SetURL("/items").SetPaginateByLinkHeader().Pages(ctx) {
+//		if err != nil {
+//			return err
+//		}
+//		// handle the page
+//	}
+//
+// Each Response is yielded once, the error of getting the next page (e.g.
+// ErrMaxPagesExceeded) is yielded with a nil Response after it. The iteration
+// stops after an error is yielded, when there is no next page, or when ctx is
+// canceled. The Response is only valid during the iteration,
+// its body is closed before requesting the next page.
+func (r *Request) Pages(ctx context.Context) iter.Seq2[*Response, error] {
+	return func(yield func(*Response, error) bool) {
+		if r.paginateFunc == nil {
+			yield(nil, errors.New("req: paginate func is not set, call SetPaginateFunc or SetPaginateByLinkHeader"))
+			return
+		}
+		if ctx != nil {
+			r.ctx = ctx
+		}
+		method := r.Method
+		if method == "" {
+			method = http.MethodGet
+		}
+		maxPages := r.maxPages
+		if maxPages == 0 {
+			maxPages = defaultMaxPages
+		}
+		rawURL := r.RawURL
+		for page := 1; ; page++ {
+			if err := r.Context().Err(); err != nil {
+				yield(nil, err)
+				return
+			}
+			resp, err := r.Send(method, rawURL)
+			if !yield(resp, err) {
+				closeResponseBody(resp)
+				return
+			}
+			if err != nil {
+				closeResponseBody(resp)
+				return
+			}
+			next, err := r.paginateFunc(resp)
+			closeResponseBody(resp)
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			if next == "" {
+				return
+			}
+			if maxPages > 0 && page >= maxPages {
+				yield(nil, fmt.Errorf("%w: %d", ErrMaxPagesExceeded, maxPages))
+				return
+			}
+			u, err := r.URL.Parse(next)
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			rawURL = u.String()
+			r.resetForNextPage()
+		}
+	}
+}
+
+// resetForNextPage cleans up the state of the request before requesting the
+// next page, the query and path params have been included in the next URL.
+func (r *Request) resetForNextPage() {
+	r.QueryParams = nil
+	r.PathParams = nil
+	r.rawQuery = nil
+	r.RetryAttempt = 0
+	if r.dumpBuffer != nil {
+		r.dumpBuffer.Reset()
+	}
+	if r.trace != nil {
+		r.trace = &clientTrace{}
+	}
+}
+
+func closeResponseBody(resp *Response) {
+	if resp != nil && resp.Response != nil && resp.Body != nil {
+		resp.Body.Close()
+	}
+}
+
+// nextLink returns the target URL of the `Link` header with rel="next".
+func nextLink(h http.Header) string {
+	if links := linksByRel(h, "next"); len(links) > 0 {
+		return links[0]
+	}
+	return ""
+}
+
+// linksByRel returns the target URLs of the `Link` header with the rel.
+func linksByRel(h http.Header, rel string) []string {
+	var links []string
+	for _, v := range h.Values("Link") {
+		for _, link := range strings.Split(v, ",") {
+			segs := strings.Split(link, ";")
+			target := strings.TrimSpace(segs[0])
+			if len(target) < 2 || target[0] != '<' || target[len(target)-1] != '>' {
+				continue
+			}
+		params:
+			for _, param := range segs[1:] {
+				key, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+				if !ok || !strings.EqualFold(strings.TrimSpace(key), "rel") {
+					continue
+				}
+				for _, r := range strings.Fields(strings.Trim(strings.TrimSpace(value), `"`)) {
+					if strings.EqualFold(r, rel) {
+						links = append(links, target[1:len(target)-1])
+						break params
+					}
+				}
+			}
+		}
+	}
+	return links
+}
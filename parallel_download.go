@@ -224,21 +224,25 @@ func (pd *ParallelDownload) Do(ctx ...context.Context) error {
 	for i := 0; i < pd.concurrency; i++ {
 		go pd.startWorker(ctx...)
 	}
-	resp := pd.client.Head(pd.url).Do(ctx...)
-	if resp.Err != nil {
-		return resp.Err
+	var probeCtx context.Context
+	if len(ctx) > 0 {
+		probeCtx = ctx[0]
 	}
-	if resp.ContentLength <= 0 {
-		return fmt.Errorf("bad content length: %d", resp.ContentLength)
+	info, err := pd.client.ProbeResource(probeCtx, pd.url)
+	if err != nil {
+		return err
+	}
+	if info.ContentLength <= 0 {
+		return fmt.Errorf("bad content length: %d", info.ContentLength)
 	}
-	pd.lastIndex = int(math.Ceil(float64(resp.ContentLength)/float64(pd.segmentSize))) - 1
+	pd.lastIndex = int(math.Ceil(float64(info.ContentLength)/float64(pd.segmentSize))) - 1
 	pd.wg.Add(1)
 	go pd.mergeFile()
 	go func() {
 		pd.wg.Wait()
 		close(pd.wgDoneCh)
 	}()
-	totalBytes := resp.ContentLength
+	totalBytes := info.ContentLength
 	start := int64(0)
 	for i := 0; ; i++ {
 		end := start + (pd.segmentSize - 1)
@@ -0,0 +1,185 @@
+// Package reqtest provides utilities for testing the requests built by req.
+package reqtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/imroc/req/v3"
+)
+
+// EchoFile is the file received in the multipart request.
+type EchoFile struct {
+	Filename string      `json:"filename"`
+	Header   http.Header `json:"header"`
+	Content  string      `json:"content"`
+}
+
+// Echo is the request received by the echo server, which is echoed back
+// as JSON.
+type Echo struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Host   string      `json:"host"`
+	Header http.Header `json:"header"`
+	// ContentEncodings is the Content-Encoding of the request body, which
+	// has been decoded.
+	ContentEncodings []string `json:"content_encodings,omitempty"`
+	// Body is the decoded request body.
+	Body string `json:"body"`
+	// Form is the url-encoded form values or the multipart values.
+	Form  url.Values             `json:"form,omitempty"`
+	Files map[string][]*EchoFile `json:"files,omitempty"`
+}
+
+// FormValue returns the first form value of the specified key.
+func (e *Echo) FormValue(key string) string {
+	return e.Form.Get(key)
+}
+
+// File returns the first multipart file of the specified field name.
+func (e *Echo) File(field string) *EchoFile {
+	if files := e.Files[field]; len(files) > 0 {
+		return files[0]
+	}
+	return nil
+}
+
+// NewEchoServer create and start an httptest server which echoes the request
+// (method, headers and decoded body) back as JSON, the gzip, deflate, zstd and
+// br encoded request body is decoded transparently according to the
+// Content-Encoding header. Use DecodeEcho to decode the response body.
+func NewEchoServer() *httptest.Server {
+	return httptest.NewServer(EchoHandler())
+}
+
+// EchoHandler returns the http.Handler used by the echo server.
+func EchoHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		e, err := newEcho(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(w).Encode(e)
+	})
+}
+
+// DecodeEcho decodes the JSON response body of the echo server.
+func DecodeEcho(body []byte) (*Echo, error) {
+	e := &Echo{}
+	if err := json.Unmarshal(body, e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func newEcho(r *http.Request) (*Echo, error) {
+	e := &Echo{
+		Method: r.Method,
+		URL:    r.URL.RequestURI(),
+		Host:   r.Host,
+		Header: r.Header,
+	}
+	for _, v := range r.Header.Values("Content-Encoding") {
+		for _, ce := range strings.Split(v, ",") {
+			if ce = strings.TrimSpace(ce); ce != "" && ce != "identity" {
+				e.ContentEncodings = append(e.ContentEncodings, strings.ToLower(ce))
+			}
+		}
+	}
+	body, err := req.DecodeRequestBody(r)
+	if err != nil {
+		return nil, err
+	}
+	e.Body = string(body)
+
+	mediaType, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch {
+	case mediaType == "application/x-www-form-urlencoded":
+		e.Form, err = url.ParseQuery(e.Body)
+		if err != nil {
+			return nil, err
+		}
+	case strings.HasPrefix(mediaType, "multipart/"):
+		if err = e.parseMultipart(body, params["boundary"]); err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+func (e *Echo) parseMultipart(body []byte, boundary string) error {
+	e.Form = make(url.Values)
+	e.Files = make(map[string][]*EchoFile)
+	mr := multipart.NewReader(bytes.NewReader(body), boundary)
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		content, err := io.ReadAll(p)
+		if err != nil {
+			return err
+		}
+		if p.FileName() == "" {
+			e.Form.Add(p.FormName(), string(content))
+			continue
+		}
+		e.Files[p.FormName()] = append(e.Files[p.FormName()], &EchoFile{
+			Filename: p.FileName(),
+			Header:   http.Header(p.Header),
+			Content:  string(content),
+		})
+	}
+}
+
+// AssertMultipartField asserts the echoed request has the multipart field
+// with the specified value.
+func AssertMultipartField(t testing.TB, e *Echo, name, value string) {
+	t.Helper()
+	values, ok := e.Form[name]
+	if !ok {
+		t.Errorf("multipart field %q is not received", name)
+		return
+	}
+	for _, v := range values {
+		if v == value {
+			return
+		}
+	}
+	t.Errorf("multipart field %q expected [%s], got %q", name, value, values)
+}
+
+// AssertMultipartFile asserts the echoed request has the multipart file with
+// the specified field name, filename and content.
+func AssertMultipartFile(t testing.TB, e *Echo, field, filename, content string) {
+	t.Helper()
+	files, ok := e.Files[field]
+	if !ok {
+		t.Errorf("multipart file %q is not received", field)
+		return
+	}
+	for _, f := range files {
+		if f.Filename != filename {
+			continue
+		}
+		if f.Content != content {
+			t.Errorf("multipart file %q (%s) expected content [%s], got [%s]", field, filename, content, f.Content)
+		}
+		return
+	}
+	t.Errorf("multipart file %q with filename %q is not received", field, filename)
+}
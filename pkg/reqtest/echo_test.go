@@ -0,0 +1,80 @@
+package reqtest_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/imroc/req/v3"
+	"github.com/imroc/req/v3/pkg/reqtest"
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestEchoServer(t *testing.T) {
+	ts := reqtest.NewEchoServer()
+	defer ts.Close()
+	c := req.C().SetBaseURL(ts.URL)
+
+	echo := func(r *req.Request, method, url string) *reqtest.Echo {
+		t.Helper()
+		resp, err := r.Send(method, url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		e, err := reqtest.DecodeEcho(resp.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return e
+	}
+
+	e := echo(c.R().SetHeader("X-Test", "test").SetQueryParam("a", "b").SetBodyString("hello"), "PUT", "/echo")
+	if e.Method != "PUT" || e.URL != "/echo?a=b" || e.Header.Get("X-Test") != "test" || e.Body != "hello" {
+		t.Errorf("unexpected echo: %+v", e)
+	}
+
+	var gz bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	gw.Write([]byte("gzip body"))
+	gw.Close()
+	var br bytes.Buffer
+	bw := brotli.NewWriter(&br)
+	bw.Write([]byte("br body"))
+	bw.Close()
+	zw, _ := zstd.NewWriter(nil)
+	zs := zw.EncodeAll([]byte("zstd body"), nil)
+	var gzbr bytes.Buffer
+	bw = brotli.NewWriter(&gzbr)
+	bw.Write(gz.Bytes())
+	bw.Close()
+
+	for _, tc := range []struct {
+		encoding string
+		body     []byte
+		expected string
+	}{
+		{"gzip", gz.Bytes(), "gzip body"},
+		{"br", br.Bytes(), "br body"},
+		{"zstd", zs, "zstd body"},
+		{"gzip, br", gzbr.Bytes(), "gzip body"},
+	} {
+		e = echo(c.R().SetHeader("Content-Encoding", tc.encoding).SetBodyBytes(tc.body), "POST", "/")
+		if e.Body != tc.expected {
+			t.Errorf("%s: expected body [%s], got [%s]", tc.encoding, tc.expected, e.Body)
+		}
+	}
+
+	e = echo(c.R().SetFormData(map[string]string{"name": "roc"}).
+		SetFileBytes("file", "hello.txt", []byte("hello world")), "POST", "/upload")
+	reqtest.AssertMultipartField(t, e, "name", "roc")
+	reqtest.AssertMultipartFile(t, e, "file", "hello.txt", "hello world")
+	if e.File("file") == nil || e.FormValue("name") != "roc" {
+		t.Errorf("unexpected multipart echo: %+v", e)
+	}
+
+	e = echo(c.R().SetFormData(map[string]string{"name": "roc"}), "POST", "/form")
+	if e.FormValue("name") != "roc" {
+		t.Errorf("unexpected form echo: %+v", e)
+	}
+}
@@ -0,0 +1,226 @@
+// Package wirecapture reads and writes the wire capture of req, which records
+// the plaintext application data sent and received on each connection, see
+// Client.EnableWireCapture.
+//
+// The capture starts with the 8 bytes magic "REQWIRE1", followed by the
+// records, each record is encoded in big endian as:
+//
+//	time      int64   // unix nanoseconds
+//	conn      uint32  // connection id, starts from 1
+//	direction uint8   // see Direction
+//	length    uint32  // length of data
+//	data      [length]byte
+package wirecapture
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Magic is the magic at the beginning of the capture.
+const Magic = "REQWIRE1"
+
+const recordHeaderSize = 8 + 4 + 1 + 4
+
+// ErrBadMagic is returned by Reader if the capture does not start with Magic.
+var ErrBadMagic = errors.New("wirecapture: bad magic")
+
+// Direction is the direction of the record.
+type Direction uint8
+
+const (
+	// Open is the record written when the connection is opened, which data
+	// is "local -> remote" address.
+	Open Direction = iota
+	// Sent is the data sent to the peer.
+	Sent
+	// Received is the data received from the peer.
+	Received
+	// Close is the record written when the connection is closed.
+	Close
+)
+
+func (d Direction) String() string {
+	switch d {
+	case Open:
+		return "open"
+	case Sent:
+		return "sent"
+	case Received:
+		return "received"
+	case Close:
+		return "close"
+	}
+	return "direction(" + strconv.Itoa(int(d)) + ")"
+}
+
+// Record is a record of the capture.
+type Record struct {
+	Time      time.Time
+	Conn      uint32
+	Direction Direction
+	Data      []byte
+}
+
+// Writer writes the capture, it is safe for concurrent use.
+type Writer struct {
+	mu     sync.Mutex
+	w      io.Writer
+	magic  bool
+	conns  atomic.Uint32
+	header [recordHeaderSize]byte
+}
+
+// NewWriter create a Writer which writes the capture to w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// WriteRecord writes the record.
+func (w *Writer) WriteRecord(r Record) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.magic {
+		if _, err := io.WriteString(w.w, Magic); err != nil {
+			return err
+		}
+		w.magic = true
+	}
+	h := w.header[:]
+	binary.BigEndian.PutUint64(h, uint64(r.Time.UnixNano()))
+	binary.BigEndian.PutUint32(h[8:], r.Conn)
+	h[12] = byte(r.Direction)
+	binary.BigEndian.PutUint32(h[13:], uint32(len(r.Data)))
+	if _, err := w.w.Write(h); err != nil {
+		return err
+	}
+	_, err := w.w.Write(r.Data)
+	return err
+}
+
+// WrapConn returns the connection which records the data sent and received
+// on conn with a new connection id, the errors of writing the capture are
+// ignored in order not to break the connection.
+func (w *Writer) WrapConn(conn net.Conn) net.Conn {
+	c := &Conn{Conn: conn, w: w, id: w.conns.Add(1)}
+	c.write(Open, []byte(conn.LocalAddr().String()+" -> "+conn.RemoteAddr().String()))
+	return c
+}
+
+// Conn is the connection returned by Writer.WrapConn.
+type Conn struct {
+	net.Conn
+	w         *Writer
+	id        uint32
+	closeOnce sync.Once
+}
+
+func (c *Conn) write(d Direction, p []byte) {
+	c.w.WriteRecord(Record{Time: time.Now(), Conn: c.id, Direction: d, Data: p})
+}
+
+// Read implements net.Conn.
+func (c *Conn) Read(p []byte) (n int, err error) {
+	n, err = c.Conn.Read(p)
+	if n > 0 {
+		c.write(Received, p[:n])
+	}
+	return
+}
+
+// Write implements net.Conn.
+func (c *Conn) Write(p []byte) (n int, err error) {
+	n, err = c.Conn.Write(p)
+	if n > 0 {
+		c.write(Sent, p[:n])
+	}
+	return
+}
+
+// Close implements net.Conn.
+func (c *Conn) Close() error {
+	c.closeOnce.Do(func() {
+		c.write(Close, nil)
+	})
+	return c.Conn.Close()
+}
+
+// NetConn returns the wrapped connection.
+func (c *Conn) NetConn() net.Conn {
+	return c.Conn
+}
+
+// Reader reads the capture.
+type Reader struct {
+	r     *bufio.Reader
+	magic bool
+}
+
+// NewReader create a Reader which reads the capture from r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+// Next returns the next record, and io.EOF if there is no more record.
+func (r *Reader) Next() (*Record, error) {
+	if !r.magic {
+		var magic [len(Magic)]byte
+		if _, err := io.ReadFull(r.r, magic[:]); err != nil {
+			if err == io.ErrUnexpectedEOF {
+				return nil, ErrBadMagic
+			}
+			return nil, err
+		}
+		if string(magic[:]) != Magic {
+			return nil, ErrBadMagic
+		}
+		r.magic = true
+	}
+	var h [recordHeaderSize]byte
+	if _, err := io.ReadFull(r.r, h[:]); err != nil {
+		return nil, err
+	}
+	rec := &Record{
+		Time:      time.Unix(0, int64(binary.BigEndian.Uint64(h[:]))),
+		Conn:      binary.BigEndian.Uint32(h[8:]),
+		Direction: Direction(h[12]),
+		Data:      make([]byte, binary.BigEndian.Uint32(h[13:])),
+	}
+	if _, err := io.ReadFull(r.r, rec.Data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return rec, nil
+}
+
+// Dump prints the records of the capture read from r to w in a human
+// readable format, one line per record, with the data quoted, which is
+// convenient to be wrapped into a command line tool, e.g.
+//
+//	wirecapture.Dump(os.Stdout, os.Stdin)
+func Dump(w io.Writer, r io.Reader) error {
+	cr := NewReader(r)
+	for {
+		rec, err := cr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s #%d %s %d %q\n", rec.Time.Format(time.RFC3339Nano), rec.Conn, rec.Direction, len(rec.Data), rec.Data)
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package req
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/imroc/req/v3/internal/netutil"
+)
+
+// ConnPoolStats is the statistics of the idle connections of the Transport.
+type ConnPoolStats struct {
+	// Idle is the number of idle connections, including the HTTP2
+	// connections negotiated with ALPN, which are shared by the requests
+	// and stay in the pool while in use.
+	Idle int
+	// IdlePerHost is the number of idle connections per "host:port".
+	IdlePerHost map[string]int
+	// HTTP2PerHost is the number of HTTP2 connections per "host:port",
+	// including both the forced (EnableForceHTTP2) and the ALPN negotiated
+	// ones, the latter are also counted in IdlePerHost.
+	HTTP2PerHost map[string]int
+	// HTTP3PerHost is the number of established HTTP3 connections per
+	// "host:port".
+	HTTP3PerHost map[string]int
+	// QueuedPerPriority is the number of requests waiting for a
+	// connection per priority (see Request.SetPriority), e.g. limited by
+	// the MaxConnsPerHost.
+	QueuedPerPriority map[int]int
+}
+
+// ConnPoolStats returns the statistics of the idle connections, and the
+// HTTP2 and HTTP3 connections which are shared by the requests.
+func (t *Transport) ConnPoolStats() ConnPoolStats {
+	stats := ConnPoolStats{
+		IdlePerHost:       make(map[string]int),
+		HTTP2PerHost:      make(map[string]int),
+		HTTP3PerHost:      make(map[string]int),
+		QueuedPerPriority: make(map[int]int),
+	}
+	// The request waits in both queues until either an idle connection or
+	// a dial slot is available.
+	queued := make(map[*wantConn]bool)
+	countQueued := func(w *wantConn) {
+		if w.waiting() && !queued[w] {
+			queued[w] = true
+			stats.QueuedPerPriority[w.priority]++
+		}
+	}
+	t.idleMu.Lock()
+	for key, conns := range t.idleConn {
+		stats.Idle += len(conns)
+		stats.IdlePerHost[key.addr] += len(conns)
+	}
+	for _, q := range t.idleConnWait {
+		q.all(countQueued)
+	}
+	t.idleMu.Unlock()
+	t.connsPerHostMu.Lock()
+	for _, q := range t.connsPerHostWait {
+		q.all(countQueued)
+	}
+	t.connsPerHostMu.Unlock()
+	if t.t2 != nil {
+		for addr, conns := range t.t2.ClientConns() {
+			stats.HTTP2PerHost[addr] += len(conns)
+		}
+	}
+	if t.t3 != nil {
+		for addr, n := range t.t3.ConnCount() {
+			stats.HTTP3PerHost[addr] += n
+		}
+	}
+	return stats
+}
+
+// preconnect establishes a connection to the origin of u ahead of the
+// requests through the same path of the requests (proxy, dial and tls
+// fingerprint included), which is put into the pool as idle. The HTTP1
+// connection is closed if it is still unused after ttl, zero means only the
+// idle timeout of the Transport applies.
+func (t *Transport) preconnect(ctx context.Context, u *url.URL, ttl time.Duration) error {
+	switch t.forceHttpVersion {
+	case h3:
+		return t.t3.AddConn(ctx, u.Host)
+	case h2:
+		return t.t2.Preconnect(ctx, netutil.AuthorityAddr(u.Scheme, u.Host))
+	}
+	pconn, err := t.getOriginConn(ctx, u)
+	if err != nil {
+		return err
+	}
+	if pconn.alt != nil { // HTTP2, which has been put into the pool.
+		return nil
+	}
+	t.putOrCloseIdleConn(pconn)
+	if ttl > 0 {
+		t.idleMu.Lock()
+		idleAt := pconn.idleAt
+		t.idleMu.Unlock()
+		time.AfterFunc(ttl, func() {
+			t.closeConnIfUnused(pconn, idleAt)
+		})
+	}
+	return nil
+}
+
+// getOriginConn gets a connection to the origin of u for HTTP1 or HTTP2
+// negotiated with ALPN, which must be put back to the pool if it is HTTP1.
+func (t *Transport) getOriginConn(ctx context.Context, u *url.URL) (*persistConn, error) {
+	req := (&http.Request{
+		Method: http.MethodGet,
+		URL:    u,
+		Header: make(http.Header),
+		Host:   u.Host,
+	}).WithContext(ctx)
+	treq := &transportRequest{Request: req, ctx: ctx, cancel: func(error) {}}
+	cm, err := t.connectMethodForRequest(treq)
+	if err != nil {
+		return nil, err
+	}
+	return t.getConn(treq, cm)
+}
+
+// closeConnIfUnused closes the idle connection if it has not been used since
+// idleAt.
+func (t *Transport) closeConnIfUnused(pconn *persistConn, idleAt time.Time) {
+	t.idleMu.Lock()
+	defer t.idleMu.Unlock()
+	if _, ok := t.idleLRU.m[pconn]; !ok || !pconn.idleAt.Equal(idleAt) {
+		return
+	}
+	t.removeIdleConnLocked(pconn)
+	pconn.close(errIdleConnTimeout)
+}
+
+// WarmupConnections establishes the connections to the origins of the urls
+// ahead of the first requests, see Client.WarmupConnections.
+func (t *Transport) WarmupConnections(ctx context.Context, urls ...string) error {
+	var (
+		origins []*url.URL
+		errs    []error
+		seen    = make(map[string]bool)
+	)
+	for _, rawURL := range urls {
+		u, err := parseOrigin(rawURL)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("req: failed to warm up %s: %w", rawURL, err))
+			continue
+		}
+		if origin := u.String(); !seen[origin] {
+			seen[origin] = true
+			origins = append(origins, u)
+		}
+	}
+	results := make([]error, len(origins))
+	var wg sync.WaitGroup
+	for i, u := range origins {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := t.preconnect(ctx, u, 0); err != nil {
+				results[i] = fmt.Errorf("req: failed to warm up %s: %w", u, err)
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(append(errs, results...)...)
+}
+
+// Prewarm establishes n connections to the origin ahead of the burst of
+// requests, see Client.Prewarm.
+func (t *Transport) Prewarm(ctx context.Context, origin string, n int) error {
+	u, err := parseOrigin(origin)
+	if err != nil {
+		return fmt.Errorf("req: failed to prewarm %s: %w", origin, err)
+	}
+	if n <= 0 {
+		return nil
+	}
+	if t.forceHttpVersion == h2 || t.forceHttpVersion == h3 { // a single connection is shared.
+		if err = t.preconnect(ctx, u, 0); err != nil {
+			return fmt.Errorf("req: failed to prewarm %s: %w", u, err)
+		}
+		return nil
+	}
+	if t.MaxConnsPerHost > 0 && n > t.MaxConnsPerHost {
+		n = t.MaxConnsPerHost
+	}
+	if max := t.maxIdleConnsPerHost(); max > 0 && n > max {
+		n = max
+	}
+	conns := make([]*persistConn, n)
+	errs := make([]error, n)
+	conns[0], errs[0] = t.getOriginConn(ctx, u)
+	if conns[0] != nil && conns[0].alt != nil { // HTTP2 negotiated with ALPN.
+		return nil
+	}
+	if errs[0] == nil { // dial the rest only if the origin is reachable.
+		var wg sync.WaitGroup
+		for i := 1; i < n; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				conns[i], errs[i] = t.getOriginConn(ctx, u)
+			}()
+		}
+		wg.Wait()
+	}
+	// the connections are held until all are dialed, so that each of them
+	// is a distinct one.
+	for i, pconn := range conns {
+		if pconn != nil && pconn.alt == nil {
+			t.putOrCloseIdleConn(pconn)
+		}
+		if errs[i] != nil {
+			errs[i] = fmt.Errorf("req: failed to prewarm connection %d to %s: %w", i+1, u, errs[i])
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// PrewarmKeepAlive keeps the connections to the origin alive, see
+// Client.PrewarmKeepAlive.
+func (t *Transport) PrewarmKeepAlive(origin string, interval time.Duration) (stop func()) {
+	u, err := parseOrigin(origin)
+	if err != nil || interval <= 0 {
+		return func() {}
+	}
+	addr := netutil.AuthorityAddr(u.Scheme, u.Host)
+	done := make(chan struct{})
+	var once sync.Once
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			if !t.keepAliveConns(addr, interval) {
+				return
+			}
+		}
+	}()
+	return func() { once.Do(func() { close(done) }) }
+}
+
+// keepAliveConns pings the HTTP2 connections and resets the idle timer of
+// the idle HTTP1 connections to addr, returns false if there is no
+// connection to keep alive.
+func (t *Transport) keepAliveConns(addr string, timeout time.Duration) bool {
+	alive := false
+	t.idleMu.Lock()
+	for key, conns := range t.idleConn {
+		if key.addr != addr {
+			continue
+		}
+		for _, pconn := range conns {
+			alive = true
+			if pconn.alt == nil && pconn.idleTimer != nil && t.IdleConnTimeout > 0 {
+				pconn.idleAt = time.Now()
+				pconn.idleTimer.Reset(t.IdleConnTimeout)
+			}
+		}
+	}
+	t.idleMu.Unlock()
+	if t.t2 != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		for _, cc := range t.t2.ClientConns()[addr] {
+			if cc.Ping(ctx) == nil {
+				alive = true
+			}
+		}
+	}
+	if t.t3 != nil && t.t3.ConnCount()[addr] > 0 { // kept alive by QUIC.
+		alive = true
+	}
+	return alive
+}
+
+func parseOrigin(rawURL string) (*url.URL, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, errors.New("url must be absolute with http or https scheme")
+	}
+	return &url.URL{Scheme: u.Scheme, Host: u.Host}, nil
+}
@@ -0,0 +1,189 @@
+package req
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultProbeCacheTTL is the default duration which the result of
+// Client.ProbeResource is cached.
+const defaultProbeCacheTTL = 5 * time.Second
+
+// ResourceInfo is the information of the remote resource returned by
+// Client.ProbeResource.
+type ResourceInfo struct {
+	// URL is the final URL of the resource after redirects.
+	URL string
+	// ContentLength is the length of the resource, -1 if unknown.
+	ContentLength int64
+	// AcceptRanges reports whether the server supports range requests.
+	AcceptRanges bool
+	// ETag is the entity tag of the resource, empty if unknown.
+	ETag string
+	// LastModified is the last modified time of the resource, zero if unknown.
+	LastModified time.Time
+	// ContentType is the media type of the resource.
+	ContentType string
+}
+
+// ProbeResource probes the resource of the url without downloading it, which
+// reports whether the server supports range requests, the content length and
+// the validators of the resource, which is useful for the segmented or
+// resumable download. It tries HEAD first, and falls back to GET with
+// `Range: bytes=0-0` if HEAD is rejected by the server. The probe request is
+// sent through the client like other requests, so that it carries the common
+// headers and auth of the client and is handled by the middlewares.
+//
+// The result is cached for 5 seconds by default (see SetProbeCacheTTL), and
+// the concurrent probes of the same url share a single probe.
+func (c *Client) ProbeResource(ctx context.Context, url string) (*ResourceInfo, error) {
+	if c.probes == nil {
+		return c.probeResource(ctx, url)
+	}
+	return c.probes.get(url, func() (*ResourceInfo, error) {
+		return c.probeResource(ctx, url)
+	})
+}
+
+// SetProbeCacheTTL set the duration which the result of ProbeResource is
+// cached, default is 5 seconds, set to zero to disable the cache.
+func (c *Client) SetProbeCacheTTL(d time.Duration) *Client {
+	if c.probes == nil {
+		c.probes = newProbeCache()
+	}
+	c.probes.setTTL(d)
+	return c
+}
+
+func (c *Client) probeResource(ctx context.Context, url string) (*ResourceInfo, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	resp := c.Head(url).Do(ctx)
+	if resp.Err == nil && resp.IsSuccessState() {
+		return newResourceInfo(resp, false), nil
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	// HEAD is rejected, fall back to GET the first byte.
+	resp = c.Get(url).
+		SetHeader("Range", "bytes=0-0").
+		DisableAutoReadResponse().
+		Do(ctx)
+	if resp.Err != nil {
+		return nil, resp.Err
+	}
+	// discard the single byte, or the whole body if the range is ignored.
+	resp.Body.Close()
+	if !resp.IsSuccessState() {
+		return nil, fmt.Errorf("req: probe %s: bad status: %s", url, resp.Status)
+	}
+	return newResourceInfo(resp, resp.StatusCode == http.StatusPartialContent), nil
+}
+
+func newResourceInfo(resp *Response, partial bool) *ResourceInfo {
+	info := &ResourceInfo{
+		URL:           resp.Request.URL.String(),
+		ContentLength: resp.ContentLength,
+		ETag:          resp.Header.Get("ETag"),
+		ContentType:   resp.GetContentType(),
+	}
+	if resp.Response.Request != nil && resp.Response.Request.URL != nil {
+		info.URL = resp.Response.Request.URL.String()
+	}
+	if t, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		info.LastModified = t
+	}
+	for _, v := range strings.Split(resp.Header.Get("Accept-Ranges"), ",") {
+		if strings.EqualFold(strings.TrimSpace(v), "bytes") {
+			info.AcceptRanges = true
+		}
+	}
+	if partial {
+		info.AcceptRanges = true
+		info.ContentLength = -1
+		// Content-Range: bytes 0-0/1234
+		if _, size, ok := strings.Cut(resp.Header.Get("Content-Range"), "/"); ok {
+			if n, err := strconv.ParseInt(strings.TrimSpace(size), 10, 64); err == nil {
+				info.ContentLength = n
+			}
+		}
+	}
+	return info
+}
+
+type probeCall struct {
+	done chan struct{}
+	info *ResourceInfo
+	err  error
+	at   time.Time
+}
+
+// probeCache caches the results of ProbeResource, and deduplicates the
+// concurrent probes of the same url.
+type probeCache struct {
+	mu    sync.Mutex
+	ttl   time.Duration
+	calls map[string]*probeCall
+}
+
+func newProbeCache() *probeCache {
+	return &probeCache{
+		ttl:   defaultProbeCacheTTL,
+		calls: make(map[string]*probeCall),
+	}
+}
+
+func (pc *probeCache) setTTL(d time.Duration) {
+	pc.mu.Lock()
+	pc.ttl = d
+	clear(pc.calls)
+	pc.mu.Unlock()
+}
+
+func (pc *probeCache) get(url string, probe func() (*ResourceInfo, error)) (*ResourceInfo, error) {
+	pc.mu.Lock()
+	if call, ok := pc.calls[url]; ok {
+		select {
+		case <-call.done:
+			if time.Since(call.at) < pc.ttl {
+				pc.mu.Unlock()
+				info := *call.info
+				return &info, nil
+			}
+		default: // probing
+			pc.mu.Unlock()
+			<-call.done
+			if call.err != nil {
+				return nil, call.err
+			}
+			info := *call.info
+			return &info, nil
+		}
+	}
+	call := &probeCall{done: make(chan struct{})}
+	pc.calls[url] = call
+	pc.mu.Unlock()
+
+	call.info, call.err = probe()
+	call.at = time.Now()
+	pc.mu.Lock()
+	if call.err != nil || pc.ttl <= 0 { // only cache the successful result.
+		if pc.calls[url] == call {
+			delete(pc.calls, url)
+		}
+	}
+	pc.mu.Unlock()
+	close(call.done)
+	if call.err != nil {
+		return nil, call.err
+	}
+	info := *call.info
+	return &info, nil
+}
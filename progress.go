@@ -0,0 +1,68 @@
+package req
+
+import "time"
+
+// defaultProgressWindow is the default sliding window of the speed in
+// UploadInfo and DownloadInfo.
+const defaultProgressWindow = 3 * time.Second
+
+// SetProgressWindow set the sliding window of the Speed reported to the
+// UploadCallback and DownloadCallback, which smooths the speed over the
+// recent d, default is 3s. The shorter window reacts faster to the change
+// of the speed, while the longer one is more stable.
+func (r *Request) SetProgressWindow(d time.Duration) *Request {
+	r.progressWindow = d
+	return r
+}
+
+type progressSample struct {
+	at   time.Time
+	size int64
+}
+
+// progress computes the speed and the estimated remaining time of the
+// upload or download progress.
+type progress struct {
+	window  time.Duration
+	start   time.Time
+	samples []progressSample
+}
+
+func newProgress(start time.Time, window time.Duration) *progress {
+	if window <= 0 {
+		window = defaultProgressWindow
+	}
+	return &progress{
+		window:  window,
+		start:   start,
+		samples: []progressSample{{at: start}},
+	}
+}
+
+// update records size transferred at now, and returns the speed over the
+// window and the average speed in bytes per second, and the estimated
+// remaining time if total is known (positive).
+func (p *progress) update(now time.Time, size, total int64) (speed, avg float64, eta time.Duration) {
+	p.samples = append(p.samples, progressSample{at: now, size: size})
+	// keep the latest sample which is out of the window as the base.
+	i := 0
+	for i+2 < len(p.samples) && now.Sub(p.samples[i+1].at) >= p.window {
+		i++
+	}
+	p.samples = p.samples[i:]
+	base := p.samples[0]
+	if d := now.Sub(base.at); d > 0 {
+		speed = float64(size-base.size) / d.Seconds()
+	}
+	if d := now.Sub(p.start); d > 0 {
+		avg = float64(size) / d.Seconds()
+	}
+	rate := speed
+	if rate <= 0 { // stalled in the window.
+		rate = avg
+	}
+	if total > 0 && size < total && rate > 0 {
+		eta = time.Duration(float64(total-size) / rate * float64(time.Second))
+	}
+	return
+}
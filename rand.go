@@ -0,0 +1,98 @@
+package req
+
+import (
+	crand "crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"sync"
+)
+
+// lockedRand is the rand.Rand which is safe for concurrent use.
+type lockedRand struct {
+	mu     sync.Mutex
+	r      *rand.Rand
+	crypto bool // reads from crypto/rand.
+}
+
+// newLockedRand returns the lockedRand of src, which reads from crypto/rand
+// if src is nil.
+func newLockedRand(src rand.Source) *lockedRand {
+	if src == nil {
+		return &lockedRand{r: rand.New(cryptoSource{}), crypto: true}
+	}
+	return &lockedRand{r: rand.New(src)}
+}
+
+func (l *lockedRand) Int63n(n int64) int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.r.Int63n(n)
+}
+
+// Read fills p with the random bytes, which implements io.Reader.
+func (l *lockedRand) Read(p []byte) (int, error) {
+	if l.crypto {
+		return crand.Read(p)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.r.Read(p)
+}
+
+// cryptoSource is the rand.Source which reads from crypto/rand.
+type cryptoSource struct{}
+
+func (s cryptoSource) Int63() int64 {
+	return int64(s.Uint64() &^ (1 << 63))
+}
+
+func (cryptoSource) Uint64() uint64 {
+	var b [8]byte
+	crand.Read(b[:])
+	return binary.LittleEndian.Uint64(b[:])
+}
+
+func (cryptoSource) Seed(int64) {}
+
+var defaultRand = newLockedRand(nil)
+
+// SetRandSource set the source of the randomness of all the randomized
+// behaviors of the client, which makes them deterministic with the seeded
+// source in the tests, e.g. rand.NewSource(42). The source is used by:
+//   - The jitter of the retry backoff (SetCommonRetryBackoffInterval).
+//   - The multipart boundary, including the browser-like ones set by the
+//     impersonation (e.g. ImpersonateChrome).
+//   - The random part of the default request IDs (see SetRequestIDFunc).
+//
+// The TLS fingerprint randomization of utls draws from its own source. The
+// source is locked so that it is safe for concurrent use, and it's shared
+// with the clients cloned by Clone. Default is crypto/rand, so the boundaries
+// and request IDs are unpredictable, nil restores the default.
+func (c *Client) SetRandSource(src rand.Source) *Client {
+	if src == nil {
+		c.randSrc = nil
+	} else {
+		c.randSrc = newLockedRand(src)
+	}
+	return c
+}
+
+func (c *Client) getRand() *lockedRand {
+	if c == nil || c.randSrc == nil {
+		return defaultRand
+	}
+	return c.randSrc
+}
+
+// newMultipartBoundary returns the boundary of the multipart body generated
+// by the boundary function, or the random one in the format of
+// multipart.Writer.
+func (c *Client) newMultipartBoundary() string {
+	if c.multipartBoundaryFunc != nil {
+		return c.multipartBoundaryFunc(c)
+	}
+	var b [30]byte
+	c.getRand().Read(b[:])
+	return fmt.Sprintf("%x", b[:])
+}
@@ -0,0 +1,107 @@
+package req
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+)
+
+// ErrRawBodyTooLarge is returned when reading the raw body captured by
+// Request.EnableRawBody, if the raw body exceeds the max size.
+var ErrRawBodyTooLarge = errors.New("raw body exceeds the max size")
+
+// DisableAutoDecode disables decompressing and decoding the response body
+// of the request, independent of the client settings, the body is left
+// untouched (the original compressed bytes if compressed), and so do the
+// Content-Encoding and Content-Length headers. Accept-Encoding is not added
+// automatically, set it explicitly if the compressed body is expected.
+// The download callback reports the raw byte count in this mode.
+//
+// Note the global DisableAutoDecode wraps Client.DisableAutoDecode of the
+// default client, use R().DisableAutoDecode() for a single request.
+func (r *Request) DisableAutoDecode() *Request {
+	r.disableAutoDecode = true
+	return r
+}
+
+// EnableRawBody captures up to maxSize bytes of the raw response body before
+// decompression while the body is read, even when auto-decompression is
+// enabled, get it with Response.RawBody. Reading the captured raw body
+// returns ErrRawBodyTooLarge after maxSize bytes if the raw body is larger.
+func (r *Request) EnableRawBody(maxSize int64) *Request {
+	r.rawBodyMaxSize = maxSize
+	return r
+}
+
+// RawBody returns the raw response body before decompression:
+//   - If Request.EnableRawBody is called, returns the captured bytes which
+//     have been read from the body.
+//   - If Request.DisableAutoDecode is called, returns the body itself, which can
+//     only be consumed once if the body is not read automatically.
+//   - Otherwise returns nil.
+func (r *Response) RawBody() io.ReadCloser {
+	if r.rawBody != nil {
+		return r.rawBody.reader()
+	}
+	if r.Request == nil || !r.Request.disableAutoDecode || r.Response == nil {
+		return nil
+	}
+	if r.body != nil || r.spilled != nil {
+		return r.rereadableBody()
+	}
+	return r.Body
+}
+
+// rawBodyCapture tees the raw body into the buffer up to maxSize bytes.
+type rawBodyCapture struct {
+	mu        sync.Mutex
+	buf       bytes.Buffer
+	maxSize   int64
+	truncated bool
+}
+
+func (c *rawBodyCapture) wrap(rc io.ReadCloser) io.ReadCloser {
+	return &rawBodyReader{ReadCloser: rc, c: c}
+}
+
+func (c *rawBodyCapture) write(p []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if remain := c.maxSize - int64(c.buf.Len()); int64(len(p)) > remain {
+		p = p[:remain]
+		c.truncated = true
+	}
+	c.buf.Write(p)
+}
+
+func (c *rawBodyCapture) reader() io.ReadCloser {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var r io.Reader = bytes.NewReader(bytes.Clone(c.buf.Bytes()))
+	if c.truncated {
+		r = io.MultiReader(r, errReader{ErrRawBodyTooLarge})
+	}
+	return io.NopCloser(r)
+}
+
+type rawBodyReader struct {
+	io.ReadCloser
+	c *rawBodyCapture
+}
+
+func (r *rawBodyReader) Read(p []byte) (n int, err error) {
+	n, err = r.ReadCloser.Read(p)
+	if n > 0 {
+		r.c.write(p[:n])
+	}
+	return
+}
+
+type errReader struct {
+	err error
+}
+
+func (r errReader) Read(p []byte) (int, error) {
+	return 0, r.err
+}
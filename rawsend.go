@@ -0,0 +1,115 @@
+package req
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// SendRaw dials hostPort and writes the raw bytes of an HTTP/1.1 request
+// verbatim, then reads and parses the response, which is useful to test the
+// malformed or unusual requests, or to replay the captured traffic. The
+// proxy, TLS config and dialer of the client are used, the TLS connection
+// only negotiates HTTP/1.1, and the connection is tunneled with CONNECT if
+// an HTTP proxy is used. The request building, middlewares, retries,
+// redirects, cookies and dumps do not apply, the connection is not reused
+// and the body of the response is read before returning. The error is
+// returned if the response is not valid HTTP.
+func (c *Client) SendRaw(ctx context.Context, hostPort string, raw []byte, useTLS bool) (*Response, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	scheme := "http"
+	if useTLS {
+		scheme = "https"
+	}
+	// the method is required to parse the response, e.g. the response of
+	// HEAD has no body, the malformed request is assumed to be GET.
+	req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(raw)))
+	if err != nil {
+		req = &http.Request{Method: http.MethodGet, URL: &url.URL{Path: "/"}, Header: make(http.Header)}
+	}
+	req.URL.Scheme, req.URL.Host = scheme, hostPort
+	req.RequestURI = ""
+	req = req.WithContext(ctx)
+
+	r := c.R().SetContext(ctx)
+	r.Method, r.RawURL, r.URL, r.RawRequest = req.Method, req.URL.String(), req.URL, req
+	resp := &Response{Request: r}
+
+	conn, err := c.Transport.dialRaw(ctx, req, hostPort, useTLS)
+	if err != nil {
+		resp.Err = err
+		return resp, err
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	r.StartTime = time.Now()
+	if _, err = conn.Write(raw); err == nil {
+		resp.Response, err = http.ReadResponse(bufio.NewReader(conn), req)
+	}
+	if err == nil {
+		_, err = resp.ToBytes()
+		resp.Body = io.NopCloser(bytes.NewReader(resp.body))
+	}
+	conn.Close()
+	if err != nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	resp.Err = err
+	return resp, err
+}
+
+// dialRaw dials a connection to hostPort which is not managed by the
+// connection pool, see Client.SendRaw.
+func (t *Transport) dialRaw(ctx context.Context, req *http.Request, hostPort string, useTLS bool) (net.Conn, error) {
+	cm := connectMethod{targetScheme: req.URL.Scheme, targetAddr: hostPort, onlyH1: true}
+	if t.Proxy != nil {
+		var err error
+		if cm.proxyURL, err = t.Proxy(req); err != nil {
+			return nil, err
+		}
+	}
+	conn, err := t.dial(ctx, "tcp", cm.addr(), cm.proxyURL == nil)
+	if err != nil {
+		if cm.proxyURL != nil {
+			err = &net.OpError{Op: "proxyconnect", Net: "tcp", Err: err}
+		}
+		return nil, err
+	}
+	if cm.proxyURL != nil {
+		if cm.proxyURL.Scheme == "https" {
+			pc := &persistConn{t: t, conn: conn, cacheKey: cm.key()}
+			if err = pc.addTLS(ctx, cm.proxyURL.Hostname(), nil, true); err != nil {
+				return nil, &net.OpError{Op: "proxyconnect", Net: "tcp", Err: err}
+			}
+			conn = pc.conn
+		}
+		// the HTTP proxy is tunneled with CONNECT even for the plain HTTP
+		// target since the raw bytes are not rewritten for the proxy.
+		if err = t.connectProxy(ctx, cm, conn); err != nil {
+			return nil, fmt.Errorf("proxy connect to %s: %w", cm.targetAddr, err)
+		}
+	}
+	if useTLS {
+		host, _, err := net.SplitHostPort(hostPort)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		// the ALPN is not sent since only HTTP/1.1 is supported, which skips
+		// the check of the negotiated protocol.
+		pc := &persistConn{t: t, conn: conn, cacheKey: cm.key()}
+		if err = pc.addTLS(ctx, host, nil, true); err != nil {
+			return nil, err
+		}
+		conn = pc.conn
+	}
+	return conn, nil
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"net/url"
+	"sort"
 	"strings"
 )
 
@@ -132,3 +134,71 @@ func AlwaysCopyHeaderRedirectPolicy(headers ...string) RedirectPolicy {
 		return nil
 	}
 }
+
+// RedirectLoopError is returned if the same URL is visited twice with the
+// same method in the redirect chain, see Client.EnableRedirectLoopDetection.
+type RedirectLoopError struct {
+	// URL is the URL which is visited twice.
+	URL string
+	// Chain is the URLs of the redirect chain, which starts from the
+	// original request and ends with URL.
+	Chain []string
+}
+
+func (e *RedirectLoopError) Error() string {
+	return fmt.Sprintf("req: redirect loop detected, %s is visited twice: %s", e.URL, strings.Join(e.Chain, " -> "))
+}
+
+// EnableRedirectLoopDetection enables failing the redirect with
+// RedirectLoopError once the same URL is visited twice with the same method
+// in the redirect chain (e.g. A -> B -> A), rather than following the loop
+// until the max redirects of the redirect policy. The URLs are compared
+// after normalized, the scheme and host are case-insensitive, the default
+// port is ignored, the query params are sorted, and the fragment is
+// ignored.
+func (c *Client) EnableRedirectLoopDetection() *Client {
+	c.redirectLoopDetect = true
+	return c
+}
+
+// DisableRedirectLoopDetection disables the redirect loop detection enabled
+// by EnableRedirectLoopDetection (default).
+func (c *Client) DisableRedirectLoopDetection() *Client {
+	c.redirectLoopDetect = false
+	return c
+}
+
+func (c *Client) checkRedirectLoop(req *http.Request, via []*http.Request) error {
+	if !c.redirectLoopDetect {
+		return nil
+	}
+	sig := redirectSignature(req.Method, req.URL)
+	for _, r := range via {
+		if redirectSignature(r.Method, r.URL) != sig {
+			continue
+		}
+		chain := make([]string, 0, len(via)+1)
+		for _, r := range via {
+			chain = append(chain, r.URL.Redacted())
+		}
+		chain = append(chain, req.URL.Redacted())
+		return &RedirectLoopError{URL: req.URL.Redacted(), Chain: chain}
+	}
+	return nil
+}
+
+// redirectSignature returns the method and the normalized URL.
+func redirectSignature(method string, u *url.URL) string {
+	scheme := strings.ToLower(u.Scheme)
+	host := strings.ToLower(u.Hostname())
+	if port := u.Port(); port != "" && !(scheme == "http" && port == "80" || scheme == "https" && port == "443") {
+		host = net.JoinHostPort(host, port)
+	}
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	query := strings.Split(u.RawQuery, "&")
+	sort.Strings(query)
+	return method + " " + scheme + "://" + host + path + "?" + strings.Join(query, "&")
+}
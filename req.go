@@ -5,9 +5,11 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"time"
 )
 
-type kv struct {
+// KV is a key-value pair.
+type KV struct {
 	Key   string
 	Value string
 }
@@ -15,12 +17,12 @@ type kv struct {
 // ContentDisposition represents parameters in `Content-Disposition`
 // MIME header of multipart request.
 type ContentDisposition struct {
-	kv []kv
+	kv []KV
 }
 
 // Add adds a new key-value pair of Content-Disposition
 func (c *ContentDisposition) Add(key, value string) *ContentDisposition {
-	c.kv = append(c.kv, kv{Key: key, Value: value})
+	c.kv = append(c.kv, KV{Key: key, Value: value})
 	return c
 }
 
@@ -66,6 +68,15 @@ type UploadInfo struct {
 	FileSize int64
 	// uploaded file length in bytes.
 	UploadedSize int64
+	// Speed is the upload speed in bytes per second over the recent
+	// window, see Request.SetProgressWindow.
+	Speed float64
+	// AverageSpeed is the upload speed in bytes per second since the file
+	// upload started.
+	AverageSpeed float64
+	// ETA is the estimated remaining time of the file upload, zero if the
+	// FileSize is unknown or the upload is done.
+	ETA time.Duration
 }
 
 // UploadCallback is the callback which will be invoked during
@@ -78,6 +89,15 @@ type DownloadInfo struct {
 	Response *Response
 	// downloaded body length in bytes.
 	DownloadedSize int64
+	// Speed is the download speed in bytes per second over the recent
+	// window, see Request.SetProgressWindow.
+	Speed float64
+	// AverageSpeed is the download speed in bytes per second since the
+	// download started.
+	AverageSpeed float64
+	// ETA is the estimated remaining time of the download, zero if the
+	// Content-Length is unknown or the download is done.
+	ETA time.Duration
 }
 
 // DownloadCallback is the callback which will be invoked during
@@ -1,11 +1,14 @@
 package req
 
 import (
+	"bytes"
+	"compress/gzip"
 	"encoding/json"
 	"encoding/xml"
 	"fmt"
 	"go/token"
 	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -15,7 +18,9 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 	"unsafe"
 
 	"github.com/imroc/req/v3/internal/header"
@@ -46,11 +51,36 @@ func createTestServer() *httptest.Server {
 
 func handleHTTP(w http.ResponseWriter, r *http.Request) {
 	w.Header().Add("Method", r.Method)
+	if r.URL.Path == "/payload" { // echo the body of any method.
+		b, _ := io.ReadAll(r.Body)
+		w.Write(b)
+		return
+	}
 	switch r.Method {
 	case http.MethodGet:
 		handleGet(w, r)
 	case http.MethodPost:
 		handlePost(w, r)
+	case http.MethodHead:
+		handleHead(w, r)
+	}
+}
+
+var cacheRequests atomic.Int64
+
+var probeModTime = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+func handleProbe(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("ETag", `"probe"`)
+	http.ServeContent(w, r, "probe.txt", probeModTime, strings.NewReader("hello probe"))
+}
+
+func handleHead(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/probe":
+		handleProbe(w, r)
+	case "/probe-no-head", "/bad-request":
+		w.WriteHeader(http.StatusMethodNotAllowed)
 	}
 }
 
@@ -144,6 +174,31 @@ func handlePost(w http.ResponseWriter, r *http.Request) {
 		w.Write(ret)
 	case "/search":
 		handleSearch(w, r)
+	case "/graphql":
+		var req struct {
+			Query         string         `json:"query"`
+			OperationName string         `json:"operationName"`
+			Variables     map[string]any `json:"variables"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		w.Header().Set(header.ContentType, header.JsonContentType)
+		if req.Variables["id"] == "bad" {
+			w.Write([]byte(`{"data":null,"errors":[{"message":"user not found","locations":[{"line":1,"column":3}],"path":["user",0]}]}`))
+			return
+		}
+		result, _ := json.Marshal(map[string]any{"data": req})
+		w.Write(result)
+	case "/jsonrpc":
+		handleJSONRPC(w, r)
+	case "/token":
+		r.ParseForm()
+		id, secret, _ := r.BasicAuth()
+		if r.FormValue("grant_type") != "client_credentials" || id != "id" || secret != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set(header.ContentType, header.JsonContentType)
+		w.Write([]byte(`{"access_token":"goodtoken","token_type":"Bearer","expires_in":3600}`))
 	case "/redirect":
 		io.Copy(io.Discard, r.Body)
 		w.Header().Set(header.Location, "/")
@@ -163,6 +218,50 @@ func handlePost(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func handleJSONRPC(w http.ResponseWriter, r *http.Request) {
+	type call struct {
+		JSONRPC string          `json:"jsonrpc"`
+		Method  string          `json:"method"`
+		Params  []int           `json:"params"`
+		ID      json.RawMessage `json:"id"`
+	}
+	handle := func(c call) map[string]any {
+		resp := map[string]any{"jsonrpc": "2.0", "id": c.ID}
+		switch {
+		case c.JSONRPC != "2.0":
+			resp["error"] = map[string]any{"code": -32600, "message": "Invalid Request"}
+		case c.Method == "add":
+			sum := 0
+			for _, p := range c.Params {
+				sum += p
+			}
+			resp["result"] = sum
+		default:
+			resp["error"] = map[string]any{"code": -32601, "message": "Method not found", "data": c.Method}
+		}
+		return resp
+	}
+	body, _ := io.ReadAll(r.Body)
+	w.Header().Set(header.ContentType, header.JsonContentType)
+	var batch []call
+	if err := json.Unmarshal(body, &batch); err == nil {
+		var results []map[string]any
+		for i := len(batch) - 1; i >= 0; i-- { // responds in the reverse order.
+			if batch[i].ID != nil {
+				results = append(results, handle(batch[i]))
+			}
+		}
+		json.NewEncoder(w).Encode(results)
+		return
+	}
+	var c call
+	if err := json.Unmarshal(body, &c); err != nil {
+		w.Write([]byte(`{"jsonrpc":"2.0","error":{"code":-32700,"message":"Parse error"},"id":null}`))
+		return
+	}
+	json.NewEncoder(w).Encode(handle(c))
+}
+
 func handleGetUserProfile(w http.ResponseWriter, r *http.Request) {
 	user := strings.TrimLeft(r.URL.Path, "/user")
 	user = strings.TrimSuffix(user, "/profile")
@@ -229,6 +328,9 @@ func handleGet(w http.ResponseWriter, r *http.Request) {
 	switch r.URL.Path {
 	case "/":
 		w.Write([]byte("TestGet: text response"))
+	case "/big-header":
+		w.Header().Set("X-Big", strings.Repeat("a", 64<<10))
+		w.Write([]byte("TestGet: big header"))
 	case "/status":
 		r.ParseForm()
 		code := r.FormValue("code")
@@ -250,8 +352,19 @@ func handleGet(w http.ResponseWriter, r *http.Request) {
 		}
 		result := url.QueryEscape(string(bs))
 		w.Write([]byte(result))
+	case "/form-urlencoded":
+		w.Header().Set(header.ContentType, header.FormContentType)
+		w.Write([]byte("name=roc&age=18&tags=a&tags=b&score=9.5&active=true&ignored=x"))
 	case "/bad-request":
 		w.WriteHeader(http.StatusBadRequest)
+	case "/bad-gateway":
+		w.Header().Set(header.ContentType, "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusBadGateway)
+		w.Write([]byte("<html><body>502 Bad Gateway</body></html>"))
+	case "/bad-json-error":
+		w.Header().Set(header.ContentType, header.JsonContentType)
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"error_code": "not a number"`))
 	case "/too-many":
 		w.WriteHeader(http.StatusTooManyRequests)
 		w.Header().Set(header.ContentType, header.JsonContentType)
@@ -259,6 +372,12 @@ func handleGet(w http.ResponseWriter, r *http.Request) {
 	case "/chunked":
 		w.Header().Add("Trailer", "Expires")
 		w.Write([]byte(`This is a chunked body`))
+	case "/chunked-size":
+		size, _ := strconv.Atoi(r.URL.Query().Get("size"))
+		for i := 0; i < size; i += 1024 {
+			w.Write(bytes.Repeat([]byte("h"), min(1024, size-i)))
+			w.(http.Flusher).Flush()
+		}
 	case "/host-header":
 		w.Write([]byte(r.Host))
 	case "/json":
@@ -282,14 +401,23 @@ func handleGet(w http.ResponseWriter, r *http.Request) {
 	case "/unlimited-redirect":
 		w.Header().Set("Location", "/unlimited-redirect")
 		w.WriteHeader(http.StatusMovedPermanently)
+	case "/redirect-to-host-header":
+		location := "/host-header"
+		if r.URL.Query().Get("cross") != "" {
+			addr := r.Context().Value(http.LocalAddrContextKey).(net.Addr).(*net.TCPAddr)
+			location = fmt.Sprintf("https://localhost:%d/host-header", addr.Port)
+		}
+		w.Header().Set("Location", location)
+		w.WriteHeader(http.StatusFound)
 	case "/redirect-to-other":
 		w.Header().Set("Location", "http://dummy.local/test")
 		w.WriteHeader(http.StatusMovedPermanently)
 	case "/pragma":
 		w.Header().Add("Pragma", "no-cache")
-	case "/payload":
-		b, _ := io.ReadAll(r.Body)
-		w.Write(b)
+	case "/bytes":
+		n, _ := strconv.Atoi(r.URL.Query().Get("n"))
+		w.Header().Set("Content-Length", strconv.Itoa(n))
+		w.Write(bytes.Repeat([]byte("a"), n))
 	case "/gbk":
 		w.Header().Set(header.ContentType, "text/plain; charset=gbk")
 		w.Write(toGbk("我是roc"))
@@ -300,10 +428,79 @@ func handleGet(w http.ResponseWriter, r *http.Request) {
 		}
 		w.Header().Set(header.ContentType, "text/html")
 		w.Write(b)
+	case "/redirect-to-meta-refresh":
+		w.Header().Set(header.Location, "/meta-refresh?n=1")
+		w.WriteHeader(http.StatusFound)
+	case "/meta-refresh":
+		n, _ := strconv.Atoi(r.URL.Query().Get("n"))
+		target := fmt.Sprintf("/meta-refresh?n=%d", n-1)
+		switch {
+		case r.URL.Query().Get("cross") != "":
+			addr := r.Context().Value(http.LocalAddrContextKey).(net.Addr).(*net.TCPAddr)
+			target = fmt.Sprintf("https://localhost:%d/header", addr.Port)
+		case n <= 0:
+			w.Header().Set(header.ContentType, "text/html")
+			w.Write([]byte("<html><body>done</body></html>"))
+			return
+		case r.URL.Query().Get("header") != "":
+			w.Header().Set("Refresh", "0; url="+target+"&header=1")
+			w.Write([]byte("refresh by header"))
+			return
+		}
+		w.Header().Set(header.ContentType, "text/html; charset=utf-8")
+		fmt.Fprintf(w, `<html><head><meta http-equiv="Refresh" content="%s; URL='%s'"></head><body></body></html>`, r.URL.Query().Get("delay"), target)
+	case "/compressed":
+		w.Header().Set("X-Accept-Encoding", r.Header.Get("Accept-Encoding"))
+		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			w.Write([]byte("hello compressed"))
+			return
+		}
+		var buf bytes.Buffer
+		gw := gzip.NewWriter(&buf)
+		gw.Write([]byte("hello compressed"))
+		gw.Close()
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+		w.Write(buf.Bytes())
+	case "/csrf":
+		http.SetCookie(w, &http.Cookie{Name: "csrftoken", Value: "cookie-token"})
+		w.Header().Set("X-Next-CSRF-Token", "header-token")
+		w.Header().Set(header.ContentType, "text/html; charset=utf-8")
+		w.Write([]byte(`<html><head><meta name="csrf-token" content="meta-token"></head>` +
+			`<body><form><input type="hidden" name="_csrf" value="input-token"/></form></body></html>`))
+	case "/early-hints-preconnect":
+		for _, origin := range r.URL.Query()["origin"] {
+			w.Header().Add("Link", "<"+origin+">; rel=preconnect")
+		}
+		w.Header().Add("Link", "</style.css>; rel=preload; as=style")
+		w.WriteHeader(http.StatusEarlyHints)
+		w.Write([]byte("ok"))
+	case "/early-hints":
+		w.Header().Set("Link", "</style.css>; rel=preload; as=style")
+		w.WriteHeader(http.StatusEarlyHints)
+		w.Header().Set("Link", "</script.js>; rel=preload; as=script")
+		w.WriteHeader(http.StatusEarlyHints)
+		w.Header().Del("Link")
+		w.Write([]byte("ok"))
+	case "/pages":
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		if page == 0 {
+			page = 1
+		}
+		if page < 3 || r.URL.Query().Get("loop") != "" {
+			w.Header().Add("Link", fmt.Sprintf(`</pages?page=%d&loop=%s>; rel="next", </pages?page=3>; rel="last"`, page+1, r.URL.Query().Get("loop")))
+		}
+		w.Write([]byte(fmt.Sprintf("page-%d", page)))
+	case "/set-cookie-redirect":
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc"})
+		w.Header().Set(header.Location, "/header")
+		w.WriteHeader(http.StatusFound)
 	case "/header":
 		b, _ := json.Marshal(r.Header)
 		w.Header().Set(header.ContentType, header.JsonContentType)
 		w.Write(b)
+	case "/accept-ch":
+		w.Header().Set("Accept-CH", r.URL.Query().Get("ch"))
 	case "/user-agent":
 		w.Write([]byte(r.Header.Get(header.UserAgent)))
 	case "/content-type":
@@ -330,6 +527,53 @@ func handleGet(w http.ResponseWriter, r *http.Request) {
 			}
 			i += n
 		}
+	case "/duplicate-headers":
+		w.Header()["X-Dup"] = []string{"a", "b"}
+		w.Header()["Warning"] = []string{`199 - "first"`, `199 - "second"`}
+	case "/sleep":
+		ms, _ := strconv.Atoi(r.URL.Query().Get("ms"))
+		time.Sleep(time.Duration(ms) * time.Millisecond)
+		w.Write([]byte("awake"))
+	case "/stream":
+		// writes 3 chunks with the interval, and stalls before the last one.
+		interval, _ := strconv.Atoi(r.URL.Query().Get("interval"))
+		stall, _ := strconv.Atoi(r.URL.Query().Get("stall"))
+		for i := 0; i < 3; i++ {
+			d := time.Duration(interval) * time.Millisecond
+			if i == 2 {
+				d += time.Duration(stall) * time.Millisecond
+			}
+			select {
+			case <-time.After(d):
+			case <-r.Context().Done():
+				return
+			}
+			fmt.Fprintf(w, "data-%d\n", i)
+			w.(http.Flusher).Flush()
+		}
+	case "/cache":
+		n := cacheRequests.Add(1)
+		q := r.URL.Query()
+		if etag := q.Get("etag"); etag != "" {
+			w.Header().Set("ETag", `"`+etag+`"`)
+			if r.Header.Get("If-None-Match") != "" && q.Get("fail") != "" {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			if r.Header.Get("If-None-Match") == `"`+etag+`"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+		if cc := q.Get("cc"); cc != "" {
+			w.Header().Set("Cache-Control", cc)
+		}
+		if vary := q.Get("vary"); vary != "" {
+			w.Header().Set("Vary", vary)
+		}
+		fmt.Fprintf(w, "response %d", n)
+	case "/probe", "/probe-no-head":
+		handleProbe(w, r)
 	case "/protected":
 		auth := r.Header.Get("Authorization")
 		if auth == "Bearer goodtoken" {
@@ -12,6 +12,7 @@ import (
 	"path/filepath"
 	"reflect"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/go-querystring/query"
@@ -45,6 +46,8 @@ type Request struct {
 
 	isMultiPart              bool
 	disableAutoReadResponse  bool
+	unbufferedBody           bool
+	gzipIntegrityCheck       bool
 	forceChunkedEncoding     bool
 	isSaveResponse           bool
 	close                    bool
@@ -54,20 +57,58 @@ type Request struct {
 	uploadCallbackInterval   time.Duration
 	downloadCallback         DownloadCallback
 	downloadCallbackInterval time.Duration
+	progressWindow           time.Duration
 	unReplayableBody         io.ReadCloser
 	retryOption              *retryOption
+	retryOptionModified      bool
 	bodyReadCloser           io.ReadCloser
 	dumpOptions              *DumpOptions
 	marshalBody              any
 	ctx                      context.Context
+	attemptContextFunc       func(parent context.Context, attempt int) context.Context
 	uploadFiles              []*FileUpload
+	multipartParts           []multipartPart
+	multipartOrder           []string
+	multipartBoundary        string
+	multipartMixed           *multipartMixed
 	uploadReader             []io.ReadCloser
 	outputFile               string
 	output                   io.Writer
 	trace                    *clientTrace
-	dumpBuffer               *bytes.Buffer
+	dumpBuffer               *dumpBuffer
+	conditionalDump          bool
+	absoluteURI              bool
 	responseReturnTime       time.Time
 	afterResponse            []ResponseMiddleware
+	errorBodyLimit           *int
+	stdRequest               *http.Request
+	graphQL                  *graphQLRequest
+	jsonRPCBatch             []JSONRPCCall
+	precondition             func(ctx context.Context) error
+	paginateFunc             PaginateFunc
+	informationalHooks       []func(status int, header http.Header)
+	host                     string
+	disableAutoDecode        bool
+	rawBodyMaxSize           int64
+	hostAcrossRedirects      bool
+	maxPages                 int
+	debugLog                 *bool
+	allowBody                *bool
+	earlyResponse            bool
+	priority                 int
+	outputs                  []io.Writer
+	requestID                string
+	rawHeaders               bool
+	expectedLength           *expectedLength
+	responseHeaderTimeout    time.Duration
+	headerTimeout            time.Duration
+	bodyIdleTimeout          time.Duration
+	forwarded                *forwardedInfo
+	pathPrefix               string
+	beforeRequest            []RequestMiddleware
+	wireHashAlgo             string
+	wireHasher               *wireHasher
+	rawQuery                 *string
 }
 
 type GetContentFunc func() (io.ReadCloser, error)
@@ -89,9 +130,12 @@ func (r *Request) TraceInfo() TraceInfo {
 	}
 
 	ti := TraceInfo{
-		IsConnReused:  ct.gotConnInfo.Reused,
-		IsConnWasIdle: ct.gotConnInfo.WasIdle,
-		ConnIdleTime:  ct.gotConnInfo.IdleTime,
+		IsConnReused:     ct.gotConnInfo.Reused,
+		IsConnWasIdle:    ct.gotConnInfo.WasIdle,
+		ConnIdleTime:     ct.gotConnInfo.IdleTime,
+		IsHTTP3Fallback:  ct.http3Fallback.fallback,
+		HTTP3AttemptTime: ct.http3Fallback.attemptTime,
+		DialedAddr:       ct.dialedAddr,
 	}
 
 	endTime := ct.endTime
@@ -151,6 +195,49 @@ func (r *Request) TraceInfo() TraceInfo {
 	return ti
 }
 
+// FullURL returns the final url of the request (set by SetURL) without sending
+// it, which is resolved in the same way as the request is sent, with the path
+// prefix, path params, base URL and query params of the client and request
+// applied, useful for logging or signing the request ahead.
+func (r *Request) FullURL() (string, error) {
+	if r.client.urlNormalizer == nil {
+		u, err := buildRequestURL(r.client, r)
+		if err != nil {
+			return "", err
+		}
+		return u.String(), nil
+	}
+	u, err := normalizeRequestURL(r.client, r)
+	if err != nil {
+		return "", err
+	}
+	setRequestQuery(r.client, r, u)
+	return u.String(), nil
+}
+
+// Reset resets the request so that it can be repopulated and sent again,
+// which behaves the same as a new request created by Client.R, and reuses
+// the maps of the headers, path params, query params and form data to
+// reduce allocations in hot loops. Only the client of the request is kept,
+// all the other settings are cleared, including the method, url, headers,
+// body, result and error targets, context, retry, dump and trace settings.
+// Note the Response of the previous send refers to the request, and should
+// not be used after Reset.
+func (r *Request) Reset() *Request {
+	headers, pathParams, queryParams, formData := r.Headers, r.PathParams, r.QueryParams, r.FormData
+	c := r.client
+	*r = Request{
+		client:      c,
+		retryOption: c.retryOption.Clone(),
+	}
+	clear(headers)
+	clear(pathParams)
+	clear(queryParams)
+	clear(formData)
+	r.Headers, r.PathParams, r.QueryParams, r.FormData = headers, pathParams, queryParams, formData
+	return r
+}
+
 // HeaderToString get all header as string.
 func (r *Request) HeaderToString() string {
 	return convertHeaderToString(r.Headers)
@@ -168,8 +255,9 @@ func (r *Request) SetFormDataFromValues(data urlpkg.Values) *Request {
 	if r.FormData == nil {
 		r.FormData = urlpkg.Values{}
 	}
-	for k, v := range data {
-		for _, kv := range v {
+	for _, k := range sortedKeys(data) {
+		r.trackFormField(k)
+		for _, kv := range data[k] {
 			r.FormData.Add(k, kv)
 		}
 	}
@@ -182,8 +270,9 @@ func (r *Request) SetFormData(data map[string]string) *Request {
 	if r.FormData == nil {
 		r.FormData = urlpkg.Values{}
 	}
-	for k, v := range data {
-		r.FormData.Set(k, v)
+	for _, k := range sortedKeys(data) {
+		r.trackFormField(k)
+		r.FormData.Set(k, data[k])
 	}
 	return r
 }
@@ -194,6 +283,17 @@ func (r *Request) SetOrderedFormData(kvs ...string) *Request {
 	return r
 }
 
+// SetOrderedFormDataKV set the ordered form data from key-value pairs, which
+// is the same as SetOrderedFormData, the keys are encoded in the exact order
+// and the duplicate keys are kept, which is required by the signing schemes
+// of some APIs.
+func (r *Request) SetOrderedFormDataKV(kvs ...KV) *Request {
+	for _, kv := range kvs {
+		r.OrderedFormData = append(r.OrderedFormData, kv.Key, kv.Value)
+	}
+	return r
+}
+
 // SetFormDataAnyType set the form data from a map, which value could be any type,
 // will convert to string automatically.
 // It will not been used if request method does not allow payload.
@@ -201,8 +301,9 @@ func (r *Request) SetFormDataAnyType(data map[string]any) *Request {
 	if r.FormData == nil {
 		r.FormData = urlpkg.Values{}
 	}
-	for k, v := range data {
-		r.FormData.Set(k, fmt.Sprint(v))
+	for _, k := range sortedKeys(data) {
+		r.trackFormField(k)
+		r.FormData.Set(k, fmt.Sprint(data[k]))
 	}
 	return r
 }
@@ -232,6 +333,18 @@ func (r *Request) SetQueryString(query string) *Request {
 	return r
 }
 
+// SetRawQueryString set the raw query string of the URL verbatim, which is
+// sent byte-for-byte as it is without being parsed or re-encoded, e.g. the
+// pre-encoded query covered by a signature (OAuth 1.0). It overrides the
+// query params set by SetQueryParam and its variants (including the ones of
+// the client) and the query in the URL of the request. It applies to the
+// original request only, the redirected request uses the query of the
+// redirect location.
+func (r *Request) SetRawQueryString(query string) *Request {
+	r.rawQuery = &query
+	return r
+}
+
 // SetQueryParamsFromValues sets query parameters from a url.Values map.
 // This method allows direct configuration of query parameters from url.Values,
 // which is commonly used with libraries like go-querystring.
@@ -353,6 +466,7 @@ func (r *Request) SetFileUpload(uploads ...FileUpload) *Request {
 		}
 		if shouldAppend {
 			r.uploadFiles = append(r.uploadFiles, &upload)
+			r.multipartParts = append(r.multipartParts, multipartPart{file: &upload})
 		}
 	}
 	return r
@@ -437,6 +551,15 @@ func (r *Request) SetErrorResult(err any) *Request {
 	return r
 }
 
+// SetErrorBodyLimit set the maximum number of bytes of the raw response body
+// that will be captured and exposed by Response.ErrorBodySnippet, which
+// overrides the client-level limit set by Client.SetCommonErrorBodyLimit.
+// Capture is disabled if n is negative or zero.
+func (r *Request) SetErrorBodyLimit(n int) *Request {
+	r.errorBodyLimit = &n
+	return r
+}
+
 // SetBearerAuthToken set bearer auth token for the request.
 func (r *Request) SetBearerAuthToken(token string) *Request {
 	return r.SetHeader(header.Authorization, "Bearer "+token)
@@ -488,7 +611,8 @@ func (r *Request) SetHeader(key, value string) *Request {
 }
 
 // SetHeadersNonCanonical set headers from a map for the request which key is a
-// non-canonical key (keep case unchanged), only valid for HTTP/1.1.
+// non-canonical key (keep case unchanged), only valid for HTTP/1.1, see
+// SetHeaderNonCanonical.
 func (r *Request) SetHeadersNonCanonical(hdrs map[string]string) *Request {
 	for k, v := range hdrs {
 		r.SetHeaderNonCanonical(k, v)
@@ -497,11 +621,16 @@ func (r *Request) SetHeadersNonCanonical(hdrs map[string]string) *Request {
 }
 
 // SetHeaderNonCanonical set a header for the request which key is a
-// non-canonical key (keep case unchanged), only valid for HTTP/1.1.
+// non-canonical key (keep case unchanged), e.g. "X-AUTH-TOKEN", the key is
+// sent with the exact casing in HTTP/1.1 and so is it in the dump, and the
+// header with the same key in other casing (including the common header of
+// the client) is replaced. HTTP/2 and HTTP/3 always send the lowercase keys
+// per spec, which is reported in the debug log.
 func (r *Request) SetHeaderNonCanonical(key, value string) *Request {
 	if r.Headers == nil {
 		r.Headers = make(http.Header)
 	}
+	deleteHeaderSpellings(r.Headers, key)
 	r.Headers[key] = append(r.Headers[key], value)
 	return r
 }
@@ -568,6 +697,24 @@ func (r *Request) SetOutput(output io.Writer) *Request {
 	return r
 }
 
+// AddOutput add an io.Writer that response Body will be downloaded to, which
+// can be called multiple times to write to multiple outputs simultaneously
+// (e.g. write to disk, hash and upload at the same time), besides the output
+// set by SetOutput or SetOutputFile. The body is written to each output in
+// the order they are added, a write error on any output aborts the download
+// with an *OutputError identifying the failed output. The auto-decode and
+// download callback apply once for all outputs, and the body is not available
+// by Response.Bytes.
+func (r *Request) AddOutput(output io.Writer) *Request {
+	if output == nil {
+		r.client.log.Warnf("nil io.Writer is not allowed in AddOutput")
+		return r
+	}
+	r.outputs = append(r.outputs, output)
+	r.isSaveResponse = true
+	return r
+}
+
 // SetQueryParams set URL query parameters from a map for the request.
 func (r *Request) SetQueryParams(params map[string]string) *Request {
 	for k, v := range params {
@@ -659,6 +806,9 @@ func (r *Request) Do(ctx ...context.Context) *Response {
 	if r.retryOption != nil && r.retryOption.MaxRetries != 0 && r.unReplayableBody != nil { // retryable request should not have unreplayable Body
 		return r.newErrorResponse(errRetryableWithUnReplayableBody)
 	}
+	if err := r.client.checkConfig(); err != nil {
+		return r.newErrorResponse(err)
+	}
 	resp, _ := r.do()
 	return resp
 }
@@ -671,19 +821,45 @@ func (r *Request) do() (resp *Response, err error) {
 		if err != nil && resp.Err == nil {
 			resp.Err = err
 		}
+		if r.dumpBuffer != nil && r.getDumpOptions().Attempts == DumpFailedAttempts && resp.Err == nil && !resp.IsErrorState() {
+			r.dumpBuffer.dropAttempt(r.RetryAttempt)
+		}
 	}()
 
+	start := time.Now()
+	r.RetryAttempt = 0
+	if r.wireHashAlgo != "" {
+		r.wireHasher = newWireHasher(r.wireHashAlgo)
+	}
+	r.initRequestID()
 	for {
 		if r.Headers == nil {
 			r.Headers = make(http.Header)
 		}
+		if r.client.urlNormalizer != nil {
+			var u *urlpkg.URL
+			if u, err = normalizeRequestURL(r.client, r); err != nil {
+				return
+			}
+			r.RawURL = u.String()
+		}
 		for _, f := range r.client.udBeforeRequest {
-			if err = f(r.client, r); err != nil {
+			if err = r.client.runRequestMiddleware(f, r); err != nil {
+				return
+			}
+		}
+		for _, f := range r.beforeRequest {
+			if err = r.client.runRequestMiddleware(f, r); err != nil {
 				return
 			}
 		}
 		for _, f := range r.client.beforeRequest {
-			if err = f(r.client, r); err != nil {
+			if err = r.client.runRequestMiddleware(f, r); err != nil {
+				return
+			}
+		}
+		if r.precondition != nil {
+			if err = r.client.runPrecondition(r.precondition, r.Context()); err != nil {
 				return
 			}
 		}
@@ -699,7 +875,7 @@ func (r *Request) do() (resp *Response, err error) {
 		contextCanceled := errors.Is(err, context.Canceled)
 
 		for _, f := range r.afterResponse {
-			if err = f(r.client, resp); err != nil {
+			if err = r.client.runResponseMiddleware(f, resp); err != nil {
 				return
 			}
 		}
@@ -712,38 +888,108 @@ func (r *Request) do() (resp *Response, err error) {
 		needRetry := err != nil                             // default behaviour: retry if error occurs
 		if l := len(r.retryOption.RetryConditions); l > 0 { // override default behaviour if custom RetryConditions has been set.
 			for i := l - 1; i >= 0; i-- {
-				needRetry = r.retryOption.RetryConditions[i](resp, err)
+				var e error
+				needRetry, e = r.client.runRetryCondition(r.retryOption.RetryConditions[i], resp, err)
+				if e != nil {
+					err = e
+					return
+				}
 				if needRetry {
 					break
 				}
 			}
 		}
+		if !needRetry {
+			needRetry = r.retryOption.isRetryStatus(resp)
+		}
 		if !needRetry { // no retry is needed.
 			return
 		}
 
+		var interval time.Duration
+		if fn := r.retryOption.RetryInterval; fn != nil {
+			if interval = fn(resp, r.RetryAttempt+1, time.Since(start)); interval < 0 { // stop retrying.
+				return
+			}
+		}
+
 		// need retry, attempt to retry
 		r.RetryAttempt++
 		if l := len(r.retryOption.RetryHooks); l > 0 {
 			for i := l - 1; i >= 0; i-- { // run retry hooks in reverse order
-				r.retryOption.RetryHooks[i](resp, err)
+				if e := r.client.runRetryHook(r.retryOption.RetryHooks[i], resp, err); e != nil {
+					err = e
+					return
+				}
+			}
+		}
+		if r.retryOption.RetryInterval == nil {
+			interval = r.retryOption.GetRetryInterval(resp, r.RetryAttempt)
+		}
+		if fn := r.client.onRetry; fn != nil {
+			hookStart := time.Now()
+			info := RetryInfo{
+				Attempt:  r.RetryAttempt,
+				Delay:    interval,
+				Elapsed:  time.Since(start),
+				Method:   r.Method,
+				URL:      r.requestURL(),
+				Response: resp,
+				Err:      err,
 			}
+			if e := r.client.runOnRetry(fn, info); e != nil {
+				err = e
+				return
+			}
+			interval -= time.Since(hookStart)
+		}
+		if err = sleepRetryInterval(r.Context(), interval); err != nil {
+			// the error of the previous attempt is stale.
+			resp.Err = err
+			return
 		}
-		time.Sleep(r.retryOption.GetRetryInterval(resp, r.RetryAttempt))
 
 		// clean up before retry
-		if r.dumpBuffer != nil {
+		if r.dumpBuffer != nil && r.getDumpOptions().Attempts == DumpFinalAttempt {
 			r.dumpBuffer.Reset()
 		}
 		if r.trace != nil {
 			r.trace = &clientTrace{}
 		}
-		resp.body = nil
+		resp.resetBody()
 		resp.result = nil
 		resp.error = nil
 	}
 }
 
+// sleepRetryInterval waits for the retry interval, returns the error which
+// wraps the error of ctx if it's done during the wait.
+func sleepRetryInterval(ctx context.Context, interval time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return canceledError(ctx, fmt.Errorf("request cancelled during retry backoff: %w", err))
+	}
+	if interval <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return canceledError(ctx, fmt.Errorf("request cancelled during retry backoff: %w", ctx.Err()))
+	}
+}
+
+// requestURL returns the url of the request, which is the parsed url if the
+// request has been built.
+func (r *Request) requestURL() string {
+	if r.URL != nil {
+		return r.URL.String()
+	}
+	return r.RawURL
+}
+
 // Send fires http request with specified method and url, returns the
 // *Response which is always not nil, and the error is not nil if error occurs.
 func (r *Request) Send(method, url string) (*Response, error) {
@@ -861,7 +1107,46 @@ func (r *Request) Head(url string) (*Response, error) {
 	return r.Send(http.MethodHead, url)
 }
 
+// EnableEarlyResponse enables returning the final response which is received
+// while the request body is still being sent, e.g. the server rejects the
+// upload early with 413 because of the quota, and aborts sending the rest of
+// the body promptly, instead of sending the whole body or returning the
+// error of the write. The HTTP1 connection is closed once the response is
+// read since the request is incomplete, and the HTTP2 and HTTP3 stream is
+// reset. Note it changes the error semantics, the server sees an incomplete
+// request body, and an HTTP2 server which responds 2xx before reading the
+// full-duplex body does not get the rest of it.
+func (r *Request) EnableEarlyResponse() *Request {
+	r.earlyResponse = true
+	return r
+}
+
+// SetPriority set the priority of the request, default is 0, the higher
+// priority request acquires the connection first when the requests are
+// waiting for the connection (e.g. limited by the MaxConnsPerHost of the
+// transport), and FIFO within the same priority, see
+// Transport.SetPriorityAging to avoid starving the low priority requests.
+// The priority is also signaled to the server, which is mapped to the
+// weight of the HTTP2 stream if Transport.SetHTTP2HeaderPriority is set,
+// and the urgency of the HTTP3 priority header (RFC 9218), where 0 is the
+// default urgency 3 and each priority above lowers the urgency by one.
+func (r *Request) SetPriority(p int) *Request {
+	r.priority = p
+	return r
+}
+
+// AllowBodyOnMethod set whether the body of the request is sent regardless
+// of the method, which overrides Client.SetAllowBodyOnMethod, e.g. send a
+// GET request with body to a search API, or strip the body of a POST request.
+func (r *Request) AllowBodyOnMethod(allow bool) *Request {
+	r.allowBody = &allow
+	return r
+}
+
 // SetBody set the request Body, accepts string, []byte, io.Reader, map and struct.
+// Note the body is stripped from GET, HEAD, DELETE and OPTIONS requests by
+// default, which is a breaking change since the body of GET and DELETE
+// requests was sent before, see Client.SetAllowBodyOnMethod.
 func (r *Request) SetBody(body any) *Request {
 	if body == nil {
 		return r
@@ -959,6 +1244,109 @@ func (r *Request) SetBodyXmlMarshal(v any) *Request {
 	return r.SetBodyXmlBytes(b)
 }
 
+// SetBodyTemplate set the request Body that rendered from the Go text/template
+// with data, the compiled template is cached by the template string. The
+// Content-Type is detected from the rendered body if it's not set, call
+// SetContentType to set it explicitly.
+//
+// Note that text/template never escapes the values, use the builtin "json"
+// function (e.g. {{json .Name}}) to render a quoted JSON string, or the
+// builtin "xml" function (e.g. {{xml .Name}}) to escape XML character data.
+func (r *Request) SetBodyTemplate(tmpl string, data any) *Request {
+	b, err := renderBodyTemplate(tmpl, data)
+	if err != nil {
+		r.appendError(err)
+		return r
+	}
+	return r.SetBodyBytes(b)
+}
+
+// SetBodyJsonTemplate is similar to SetBodyTemplate, and set Content-Type
+// header as "application/json; charset=utf-8"
+func (r *Request) SetBodyJsonTemplate(tmpl string, data any) *Request {
+	r.SetContentType(header.JsonContentType)
+	return r.SetBodyTemplate(tmpl, data)
+}
+
+// SetBodyXmlTemplate is similar to SetBodyTemplate, and set Content-Type
+// header as "text/xml; charset=utf-8"
+func (r *Request) SetBodyXmlTemplate(tmpl string, data any) *Request {
+	r.SetContentType(header.XmlContentType)
+	return r.SetBodyTemplate(tmpl, data)
+}
+
+// PreconditionError is the error returned when the precondition set by
+// Request.SetPrecondition fails, and the request is never sent.
+type PreconditionError struct {
+	Err error
+}
+
+func (e *PreconditionError) Error() string {
+	return "precondition failed: " + e.Err.Error()
+}
+
+func (e *PreconditionError) Unwrap() error {
+	return e.Err
+}
+
+// SetHost overrides the host of the request, which is sent as the Host header
+// in HTTP/1.1 and the `:authority` pseudo-header in HTTP/2 and HTTP/3, and it
+// takes precedence over the Host header set by SetHeader. The dial address and
+// the TLS server name (SNI) are still derived from the URL, set ServerName of
+// the TLS client config to override the SNI separately.
+//
+// The override persists on redirects to the same host, and is dropped on
+// redirects to other hosts, unless EnableHostOverrideAcrossRedirects is called.
+func (r *Request) SetHost(host string) *Request {
+	r.host = host
+	return r
+}
+
+// EnableHostOverrideAcrossRedirects makes the host set by SetHost persist on
+// redirects to other hosts.
+func (r *Request) EnableHostOverrideAcrossRedirects() *Request {
+	r.hostAcrossRedirects = true
+	return r
+}
+
+// SetAbsoluteURI set whether to send the absolute-form request URI in the
+// request line, e.g. `GET http://example.com/path HTTP/1.1`, instead of the
+// origin-form `GET /path HTTP/1.1`, which is required when sending the request
+// to a forward proxy directly without CONNECT, or by some test servers. It
+// only applies to HTTP/1.1, and is a no-op in HTTP/2 and HTTP/3 which always
+// send the scheme and authority as pseudo-headers.
+func (r *Request) SetAbsoluteURI(enable bool) *Request {
+	r.absoluteURI = enable
+	return r
+}
+
+// DisableHostOverrideAcrossRedirects makes the host set by SetHost dropped on
+// redirects to other hosts (default).
+func (r *Request) DisableHostOverrideAcrossRedirects() *Request {
+	r.hostAcrossRedirects = false
+	return r
+}
+
+// OnInformationalResponse adds a callback which is invoked for each
+// informational (1xx) response received before the final response, in the
+// order they are received, e.g. read the `Link` headers carried by
+// 103 Early Hints for preloading. It works for HTTP/1.1, HTTP/2 and HTTP/3,
+// and the final response is unaffected.
+func (r *Request) OnInformationalResponse(fn func(status int, header http.Header)) *Request {
+	r.informationalHooks = append(r.informationalHooks, fn)
+	return r
+}
+
+// SetPrecondition set the precondition function which is invoked right before
+// the round trip of each attempt, after all request middlewares, if it returns
+// an error, the request is aborted and never sent, and the error is returned
+// as *PreconditionError. Useful for last-moment checks like whether the circuit
+// is open, or whether the context has been cancelled.
+func (r *Request) SetPrecondition(fn func(ctx context.Context) error) *Request {
+	r.precondition = fn
+	return r
+}
+
 // SetContentType set the `Content-Type` for the request.
 func (r *Request) SetContentType(contentType string) *Request {
 	return r.SetHeader(header.ContentType, contentType)
@@ -973,6 +1361,15 @@ func (r *Request) Context() context.Context {
 	return r.ctx
 }
 
+// rawContext returns the context of the underlying http.Request if the
+// request has been sent, which carries the request-scoped settings.
+func (r *Request) rawContext() context.Context {
+	if r.RawRequest != nil {
+		return r.RawRequest.Context()
+	}
+	return r.Context()
+}
+
 // SetContext method sets the context.Context for current Request. It allows
 // to interrupt the request execution if ctx.Done() channel is closed.
 // See https://blog.golang.org/context article and the "context" package
@@ -987,6 +1384,60 @@ func (r *Request) SetContext(ctx context.Context) *Request {
 	return r
 }
 
+// SetAttemptContextFunc set the function which derives the context of each
+// attempt from the request context (parent) before the round trip, attempt
+// is the retry attempt which is 0 for the first attempt, e.g. start a child
+// span for each attempt. The derived context is always cancelled once the
+// parent is cancelled, even if it is not derived from the parent. The
+// parent is still used for the cancellation between the attempts (e.g. the
+// retry backoff).
+func (r *Request) SetAttemptContextFunc(fn func(parent context.Context, attempt int) context.Context) *Request {
+	r.attemptContextFunc = fn
+	return r
+}
+
+// attemptParentKey marks the parent passed to the attemptContextFunc, which
+// tells whether the derived context inherits the cancellation of the parent.
+type attemptParentKey struct{}
+
+// attemptContext returns the context of the current attempt derived by the
+// attemptContextFunc, which is cancelled with the parent, and the function
+// which releases it once the round trip of the attempt finishes.
+func (r *Request) attemptContext() (context.Context, func()) {
+	parent := r.Context()
+	marker := new(byte)
+	ctx := r.attemptContextFunc(context.WithValue(parent, attemptParentKey{}, marker), r.RetryAttempt)
+	if ctx == nil {
+		return parent, func() {}
+	}
+	inherited := parent.Done() == nil || ctx.Done() != nil && ctx.Value(attemptParentKey{}) == marker
+	ctx, cancel := context.WithCancelCause(ctx)
+	stop := func() bool { return false }
+	if !inherited {
+		stop = context.AfterFunc(parent, func() {
+			cancel(context.Cause(parent))
+		})
+	}
+	return ctx, func() {
+		stop()
+		cancel(nil)
+	}
+}
+
+// attemptBody releases the context of the attempt when the response body
+// is closed.
+type attemptBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *attemptBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
+
 // SetContextData sets the key-value pair data for current Request, so you
 // can access some extra context info for current Request in hook or middleware.
 func (r *Request) SetContextData(key, val any) *Request {
@@ -1011,12 +1462,34 @@ func (r *Request) EnableAutoReadResponse() *Request {
 	return r
 }
 
+// EnableUnbufferedBody hands the response body over to the caller as it comes
+// from the connection, without ever reading it into memory, e.g. to stream it
+// to the downstream in a proxy. The body is not auto-read, unmarshalled,
+// charset-decoded, body-dumped or cached, regardless of the client settings.
+// Transparent decompression still applies, unless DisableAutoDecode is called.
+//
+// Read the body from Response.UnbufferedBody, and close it to return the
+// connection to the pool. Response.ToBytes, Response.ToString and the
+// unmarshal methods of Response return ErrUnbufferedBody instead of reading
+// the body.
+func (r *Request) EnableUnbufferedBody() *Request {
+	r.unbufferedBody = true
+	return r
+}
+
 // DisableTrace disables trace.
 func (r *Request) DisableTrace() *Request {
 	r.trace = nil
 	return r
 }
 
+// EnableRawHeaders enables recording the raw header fields of the response,
+// see Response.RawHeaders.
+func (r *Request) EnableRawHeaders() *Request {
+	r.rawHeaders = true
+	return r
+}
+
 // EnableTrace enables trace (http3 currently does not support trace).
 func (r *Request) EnableTrace() *Request {
 	if r.trace == nil {
@@ -1025,9 +1498,9 @@ func (r *Request) EnableTrace() *Request {
 	return r
 }
 
-func (r *Request) getDumpBuffer() *bytes.Buffer {
+func (r *Request) getDumpBuffer() *dumpBuffer {
 	if r.dumpBuffer == nil {
-		r.dumpBuffer = new(bytes.Buffer)
+		r.dumpBuffer = new(dumpBuffer)
 	}
 	return r.dumpBuffer
 }
@@ -1045,12 +1518,40 @@ func (r *Request) getDumpOptions() *DumpOptions {
 	return r.dumpOptions
 }
 
+// SetDumpTo set the io.Writer which the dump of the request is written to
+// (default is the buffer of Response.Dump), call EnableDump or its variants
+// to enable the dump.
+func (r *Request) SetDumpTo(output io.Writer) *Request {
+	if output == nil {
+		output = r.getDumpBuffer()
+	}
+	r.getDumpOptions().Output = output
+	return r
+}
+
 // EnableDumpTo enables dump and save to the specified io.Writer.
 func (r *Request) EnableDumpTo(output io.Writer) *Request {
 	r.getDumpOptions().Output = output
 	return r.EnableDump()
 }
 
+// EnableDumpToBuffer enables dump and save to the buffer of the request, which
+// is isolated from the dump of other requests, even if they are concurrent,
+// get the dump with Response.Dump. The DumpOptions of the request is kept
+// except the output, and the dump of the last attempt is kept if retried.
+func (r *Request) EnableDumpToBuffer() *Request {
+	o := r.getDumpOptions()
+	o.Output = r.getDumpBuffer()
+	o.RequestOutput = nil
+	o.ResponseOutput = nil
+	o.RequestHeaderOutput = nil
+	o.RequestBodyOutput = nil
+	o.ResponseHeaderOutput = nil
+	o.ResponseBodyOutput = nil
+	o.Async = false
+	return r.EnableDump()
+}
+
 // EnableDumpToFile enables dump and save to the specified filename.
 func (r *Request) EnableDumpToFile(filename string) *Request {
 	file, err := os.Create(filename)
@@ -1131,6 +1632,27 @@ func (r *Request) EnableDumpWithoutResponseBody() *Request {
 	return r.EnableDump()
 }
 
+// EnableDebugLog enables debug level log for the request, even if it is
+// disabled at client level, the log is written by the logger of the client,
+// retries and redirects of the request are included.
+//
+// Note the global EnableDebugLog and DisableDebugLog wrap the methods of the
+// default client, use R().EnableDebugLog() for a single request.
+func (r *Request) EnableDebugLog() *Request {
+	enabled := true
+	r.debugLog = &enabled
+	return r
+}
+
+// DisableDebugLog disables debug level log for the request, even if it is
+// enabled at client level (e.g. DevMode), which can be used to silence a
+// noisy request, use R().DisableDebugLog() with the default client.
+func (r *Request) DisableDebugLog() *Request {
+	enabled := false
+	r.debugLog = &enabled
+	return r
+}
+
 // EnableForceChunkedEncoding enables force using chunked encoding when uploading.
 func (r *Request) EnableForceChunkedEncoding() *Request {
 	r.forceChunkedEncoding = true
@@ -1156,6 +1678,7 @@ func (r *Request) DisableForceMultipart() *Request {
 }
 
 func (r *Request) getRetryOption() *retryOption {
+	r.retryOptionModified = true // the retry settings of the host profile is not applied.
 	if r.retryOption == nil {
 		r.retryOption = newDefaultRetryOption()
 	}
@@ -1182,6 +1705,15 @@ func (r *Request) SetRetryInterval(getRetryIntervalFunc GetRetryIntervalFunc) *R
 	return r
 }
 
+// SetRetryIntervalFunc sets the RetryIntervalFunc, which computes the interval
+// with the response, the attempt number and the elapsed time, and supersedes
+// the interval set by SetRetryInterval, SetRetryFixedInterval and
+// SetRetryBackoffInterval. Return a negative duration to stop retrying.
+func (r *Request) SetRetryIntervalFunc(fn RetryIntervalFunc) *Request {
+	r.getRetryOption().RetryInterval = fn
+	return r
+}
+
 // SetRetryFixedInterval set retry to use a fixed interval.
 func (r *Request) SetRetryFixedInterval(interval time.Duration) *Request {
 	r.getRetryOption().GetRetryInterval = func(resp *Response, attempt int) time.Duration {
@@ -1229,6 +1761,28 @@ func (r *Request) AddRetryCondition(condition RetryConditionFunc) *Request {
 	return r
 }
 
+// AddRetryStatusCodes adds the status codes which the request should retry on,
+// in addition to the client-level ones, e.g.
+//
+//	req.AddRetryStatusCodes(req.DefaultRetryableStatusCodes()...)
+//
+// It composes with the retry conditions, the request retries if any of them
+// matches. Note the retry is not limited to idempotent methods, make sure the
+// request is safe to retry.
+func (r *Request) AddRetryStatusCodes(codes ...int) *Request {
+	ro := r.getRetryOption()
+	ro.RetryStatusCodes = append(ro.RetryStatusCodes, codes...)
+	return r
+}
+
+// AddRetryStatusRange adds the range of status codes (both inclusive) which
+// the request should retry on, see AddRetryStatusCodes.
+func (r *Request) AddRetryStatusRange(min, max int) *Request {
+	ro := r.getRetryOption()
+	ro.RetryStatusRanges = append(ro.RetryStatusRanges, statusRange{min, max})
+	return r
+}
+
 // SetClient change the client of request dynamically.
 func (r *Request) SetClient(client *Client) *Request {
 	if client != nil {
@@ -1237,6 +1791,15 @@ func (r *Request) SetClient(client *Client) *Request {
 	return r
 }
 
+// Attempt returns the current attempt number of the request, 0 is the
+// first try and it's incremented before each retry. It can be read inside
+// the request middleware and the body getters, e.g. to sign the request
+// with a fresh timestamp or nonce on every attempt. It's reset to 0 when the
+// request is sent again or Reset.
+func (r *Request) Attempt() int {
+	return r.RetryAttempt
+}
+
 // GetClient returns the current client used by request.
 func (r *Request) GetClient() *Client {
 	return r.client
@@ -1,21 +1,43 @@
 package req
 
 import (
+	"bufio"
 	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"errors"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"encoding/xml"
 	"fmt"
+	"hash/crc32"
 	"io"
+	"mime"
+	"mime/multipart"
+	"net"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+
 	"github.com/imroc/req/v3/internal/header"
 	"github.com/imroc/req/v3/internal/tests"
+	"github.com/imroc/req/v3/internal/transport"
+	"github.com/imroc/req/v3/pkg/wirecapture"
 )
 
 func TestMustSendMethods(t *testing.T) {
@@ -188,6 +210,119 @@ func testEnableDump(t *testing.T, fn func(r *Request) (de dumpExpected)) {
 	testDump(c.EnableForceHTTP1())
 }
 
+func TestRequestDebugLog(t *testing.T) {
+	buf := new(bytes.Buffer)
+	c := tc().SetLogger(NewLogger(buf, "", 0))
+
+	// enabled for a single request, including its redirects and retries.
+	resp, err := c.R().EnableDebugLog().Get("/redirect-to-host-header")
+	assertSuccess(t, resp, err)
+	tests.AssertContains(t, buf.String(), "<redirect> get", true)
+	tests.AssertContains(t, buf.String(), "/host-header", true)
+	buf.Reset()
+	resp, err = c.R().EnableDebugLog().
+		SetRetryCount(1).
+		SetRetryFixedInterval(time.Millisecond).
+		AddRetryCondition(func(resp *Response, err error) bool {
+			return resp.StatusCode == http.StatusTooManyRequests
+		}).
+		Get("/too-many")
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, 2, strings.Count(buf.String(), "GET "+c.BaseURL+"/too-many"))
+
+	// not affect other requests.
+	buf.Reset()
+	resp, err = c.R().Get("/redirect-to-host-header")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, "", buf.String())
+
+	// silenced for a single request in DevMode.
+	c.DevMode().EnableDumpAllTo(io.Discard).SetLogger(NewLogger(buf, "", 0))
+	resp, err = c.R().DisableDebugLog().Get("/redirect-to-host-header")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, "", buf.String())
+	resp, err = c.R().Get("/redirect-to-host-header")
+	assertSuccess(t, resp, err)
+	tests.AssertContains(t, buf.String(), "<redirect> get", true)
+
+	// the debug function of the transport respects the switch as well.
+	buf.Reset()
+	var debugLogs []string
+	debugf := func(format string, v ...any) {
+		debugLogs = append(debugLogs, fmt.Sprintf(format, v...))
+	}
+	c.GetTransport().SetDebug(debugf)
+	resp, err = c.R().DisableDebugLog().Get("/redirect-to-host-header")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, "", buf.String())
+	tr := T().SetDebug(debugf)
+	tr.DebugfContext(transport.WithDebugLog(context.Background(), false), "silenced")
+	tr.DebugfContext(context.Background(), "logged")
+	tests.AssertEqual(t, []string{"logged"}, debugLogs)
+
+	// dump a single request to the per-request writer.
+	dumpBuf := new(bytes.Buffer)
+	c = tc()
+	resp, err = c.R().SetDumpTo(dumpBuf).EnableDump().Get("/")
+	assertSuccess(t, resp, err)
+	tests.AssertContains(t, dumpBuf.String(), ":method: get", true)
+	tests.AssertEqual(t, "", resp.Dump())
+}
+
+func TestRequestID(t *testing.T) {
+	// the request ID is opt-in.
+	c := tc()
+	resp, err := c.R().EnableDump().Get("/")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, "", resp.RequestID())
+	tests.AssertEqual(t, false, strings.Contains(resp.Dump(), "request-id"))
+
+	c = tc().EnableRequestID()
+	resp, err = c.R().Get("/")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, 26, len(resp.RequestID()))
+	resp2, err := c.R().Get("/")
+	assertSuccess(t, resp2, err)
+	tests.AssertEqual(t, true, resp.RequestID() != resp2.RequestID())
+
+	// injected as header, and the existing header is reused.
+	n := 0
+	c.SetRequestIDFunc(func() string {
+		n++
+		return fmt.Sprintf("id-%d", n)
+	}).EnableRequestIDHeader("")
+	h := make(http.Header)
+	resp, err = c.R().SetSuccessResult(&h).Get("/header")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, "id-1", resp.RequestID())
+	tests.AssertEqual(t, "id-1", h.Get(DefaultRequestIDHeader))
+	resp, err = c.R().SetHeader("X-Request-ID", "mine").SetSuccessResult(&h).Get("/header")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, "mine", resp.RequestID())
+	tests.AssertEqual(t, "mine", h.Get(DefaultRequestIDHeader))
+
+	// shared by retries with the attempt suffix in debug logs and dumps.
+	buf := new(bytes.Buffer)
+	c.SetLogger(NewLogger(buf, "", 0)).EnableDebugLog()
+	var ids []string
+	resp, err = c.R().EnableDump().
+		SetRetryCount(1).
+		SetRetryFixedInterval(time.Millisecond).
+		AddRetryCondition(func(resp *Response, err error) bool {
+			return resp.StatusCode == http.StatusTooManyRequests
+		}).
+		AddRetryHook(func(resp *Response, err error) {
+			ids = append(ids, resp.Request.RequestID())
+		}).
+		Get("/too-many")
+	tests.AssertNoError(t, err)
+	ids = append(ids, resp.RequestID())
+	tests.AssertEqual(t, []string{"id-2", "id-2"}, ids)
+	tests.AssertContains(t, buf.String(), "[id-2] http/2", true)
+	tests.AssertContains(t, buf.String(), "[id-2#1] http/2", true)
+	tests.AssertContains(t, resp.Dump(), "* request-id: id-2#1\r\n", true)
+}
+
 func TestEnableDump(t *testing.T) {
 	testCases := []func(r *Request) (d dumpExpected){
 		func(r *Request) (de dumpExpected) {
@@ -260,6 +395,27 @@ func TestEnableDumpTo(t *testing.T) {
 	tests.AssertEqual(t, true, buff.Len() > 0)
 }
 
+func TestEnableDumpToBuffer(t *testing.T) {
+	c := tc().EnableDumpAllTo(io.Discard)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			resp, err := c.R().EnableDumpToBuffer().
+				SetQueryParam("n", strconv.Itoa(i)).
+				SetBody(fmt.Sprintf("body-%d", i)).
+				Post("/")
+			assertSuccess(t, resp, err)
+			dump := resp.Dump()
+			tests.AssertContains(t, dump, fmt.Sprintf("n=%d", i), true)
+			tests.AssertContains(t, dump, fmt.Sprintf("body-%d", i), true)
+			tests.AssertEqual(t, 1, strings.Count(dump, ":method:"))
+		}(i)
+	}
+	wg.Wait()
+}
+
 func TestEnableDumpToFIle(t *testing.T) {
 	tmpFile := "tmp_dumpfile_req"
 	resp, err := tc().R().EnableDumpToFile(tests.GetTestFilePath(tmpFile)).Get("/")
@@ -479,6 +635,196 @@ func TestSetBody(t *testing.T) {
 	}
 }
 
+func TestSetBodyTemplate(t *testing.T) {
+	c := tc()
+	data := map[string]any{"Name": `roc "imroc"`, "Tag": "<go> & <req>"}
+	testCases := []struct {
+		SetBody     func(r *Request)
+		ContentType string
+		Body        string
+	}{
+		{
+			SetBody: func(r *Request) {
+				r.SetBodyTemplate("hello {{.Name}}", data)
+			},
+			ContentType: header.PlainTextContentType,
+			Body:        `hello roc "imroc"`,
+		},
+		{
+			SetBody: func(r *Request) {
+				r.SetBodyJsonTemplate(`{"query":"user","name":{{json .Name}}}`, data)
+			},
+			ContentType: header.JsonContentType,
+			Body:        `{"query":"user","name":"roc \"imroc\""}`,
+		},
+		{
+			SetBody: func(r *Request) {
+				r.SetBodyXmlTemplate("<tag>{{xml .Tag}}</tag>", data)
+			},
+			ContentType: header.XmlContentType,
+			Body:        "<tag>&lt;go&gt; &amp; &lt;req&gt;</tag>",
+		},
+		{
+			SetBody: func(r *Request) {
+				r.SetBodyJsonTemplate(`{"name":{{json .Name}}}`, data).SetContentType("application/graphql")
+			},
+			ContentType: "application/graphql",
+			Body:        `{"name":"roc \"imroc\""}`,
+		},
+	}
+	for _, tc := range testCases {
+		r := c.R()
+		tc.SetBody(r)
+		var e Echo
+		resp, err := r.SetSuccessResult(&e).Post("/echo")
+		assertSuccess(t, resp, err)
+		tests.AssertEqual(t, tc.ContentType, e.Header.Get(header.ContentType))
+		tests.AssertEqual(t, tc.Body, e.Body)
+	}
+
+	// compiled template is cached.
+	tmpl := "cached {{.Name}}"
+	c.R().SetBodyTemplate(tmpl, data)
+	t1, ok := bodyTemplates.Load(tmpl)
+	tests.AssertEqual(t, true, ok)
+	c.R().SetBodyTemplate(tmpl, data)
+	t2, _ := bodyTemplates.Load(tmpl)
+	tests.AssertEqual(t, t1, t2)
+
+	_, err := c.R().SetBodyTemplate("{{.Name", data).Post("/echo")
+	tests.AssertNotNil(t, err)
+}
+
+func TestGraphQL(t *testing.T) {
+	type graphQLEcho struct {
+		Data struct {
+			Query         string         `json:"query"`
+			OperationName string         `json:"operationName"`
+			Variables     map[string]any `json:"variables"`
+		} `json:"data"`
+	}
+	c := tc()
+	var result graphQLEcho
+	resp, err := c.R().
+		SetGraphQLQuery("query GetUser($id: ID!) { user(id: $id) { name } }", map[string]any{"id": "1"}).
+		SetGraphQLOperationName("GetUser").
+		SetSuccessResult(&result).
+		Post("/graphql")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, "query GetUser($id: ID!) { user(id: $id) { name } }", result.Data.Query)
+	tests.AssertEqual(t, "GetUser", result.Data.OperationName)
+	tests.AssertEqual(t, "1", result.Data.Variables["id"])
+	tests.AssertEqual(t, header.JsonContentType, resp.Request.Headers.Get(header.ContentType))
+	tests.AssertEqual(t, 0, len(resp.GraphQLErrors()))
+
+	// the method is set as POST.
+	resp = c.R().
+		SetURL("/graphql").
+		SetGraphQLMutation("mutation { deleteUser(id: $id) }", map[string]any{"id": "bad"}).
+		Do()
+	assertSuccess(t, resp, resp.Err)
+	tests.AssertEqual(t, http.MethodPost, resp.Request.Method)
+	errs := resp.GraphQLErrors()
+	tests.AssertEqual(t, 1, len(errs))
+	tests.AssertEqual(t, "user not found", errs[0].Message)
+	tests.AssertEqual(t, 1, errs[0].Locations[0].Line)
+	tests.AssertEqual(t, "user not found (path: user.0)", errs[0].Error())
+
+	c.EnableGraphQLErrorsAsError()
+	_, err = c.R().
+		SetGraphQLQuery("query { user(id: $id) { name } }", map[string]any{"id": "bad"}).
+		Post("/graphql")
+	var gerrs GraphQLErrors
+	tests.AssertEqual(t, true, errors.As(err, &gerrs))
+	tests.AssertEqual(t, "graphql: user not found (path: user.0)", err.Error())
+
+	// only valid for GraphQL request.
+	resp, err = c.R().SetBodyJsonString(`{"variables":{"id":"bad"}}`).Post("/graphql")
+	assertSuccess(t, resp, err)
+}
+
+func TestJSONRPC(t *testing.T) {
+	c := tc()
+	var sum int
+	resp, err := c.R().SetJSONRPC("add", []int{1, 2}, 1).Post("/jsonrpc")
+	assertSuccess(t, resp, err)
+	tests.AssertNoError(t, resp.JSONRPCResult(&sum))
+	tests.AssertEqual(t, 3, sum)
+	tests.AssertEqual(t, header.JsonContentType, resp.Request.Headers.Get(header.ContentType))
+
+	resp, err = c.R().SetJSONRPC("sub", []int{1, 2}, "a").Post("/jsonrpc")
+	assertSuccess(t, resp, err)
+	err = resp.JSONRPCResult(&sum)
+	var rpcErr *JSONRPCError
+	tests.AssertEqual(t, true, errors.As(err, &rpcErr))
+	tests.AssertEqual(t, -32601, rpcErr.Code)
+	tests.AssertEqual(t, "Method not found", rpcErr.Message)
+	tests.AssertEqual(t, `"sub"`, string(rpcErr.Data))
+	tests.AssertEqual(t, "jsonrpc: Method not found (code -32601)", err.Error())
+
+	resp, err = c.R().SetBodyString("{").Post("/jsonrpc")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, true, errors.As(resp.JSONRPCResult(nil), &rpcErr))
+	tests.AssertEqual(t, -32700, rpcErr.Code)
+	tests.AssertErrorContains(t, c.R().MustGet("/").JSONRPCResult(nil), "jsonrpc: invalid response")
+
+	// the results are ordered as the calls, and the notification has no result.
+	resp, err = c.R().SetJSONRPCBatch([]JSONRPCCall{
+		{Method: "add", Params: []int{1, 2}, ID: 1},
+		{Method: "add", Params: []int{3}},
+		{Method: "sub", ID: "2"},
+		{Method: "add", Params: []int{3, 4}, ID: 3},
+	}).Post("/jsonrpc")
+	assertSuccess(t, resp, err)
+	results, err := resp.JSONRPCBatchResults()
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, 3, len(results))
+	tests.AssertEqual(t, "1", string(results[0].ID))
+	tests.AssertNoError(t, results[0].Unmarshal(&sum))
+	tests.AssertEqual(t, 3, sum)
+	tests.AssertEqual(t, `"2"`, string(results[1].ID))
+	tests.AssertErrorContains(t, results[1].Unmarshal(&sum), "Method not found")
+	tests.AssertNoError(t, results[2].Unmarshal(&sum))
+	tests.AssertEqual(t, 7, sum)
+}
+
+func TestSetPrecondition(t *testing.T) {
+	c := tc()
+	r := c.R()
+	var url string
+	resp, err := r.SetPrecondition(func(ctx context.Context) error {
+		url = r.URL.String() // the request is fully prepared
+		return nil
+	}).Get("/")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, getTestServerURL()+"/", url)
+
+	errOpen := errors.New("circuit open")
+	sent := false
+	resp, err = tc().WrapRoundTripFunc(func(rt RoundTripper) RoundTripFunc {
+		return func(req *Request) (*Response, error) {
+			sent = true
+			return rt.RoundTrip(req)
+		}
+	}).R().SetPrecondition(func(ctx context.Context) error {
+		return errOpen
+	}).SetRetryCount(3).Get("/")
+	var pe *PreconditionError
+	tests.AssertEqual(t, true, errors.As(err, &pe))
+	tests.AssertEqual(t, true, errors.Is(err, errOpen))
+	tests.AssertEqual(t, false, sent)
+	tests.AssertEqual(t, 0, resp.Request.RetryAttempt)
+	tests.AssertIsNil(t, resp.Response)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = c.R().SetContext(ctx).SetPrecondition(func(ctx context.Context) error {
+		return ctx.Err()
+	}).Get("/")
+	tests.AssertEqual(t, true, errors.As(err, &pe))
+	tests.AssertEqual(t, true, errors.Is(err, context.Canceled))
+}
+
 func TestCookie(t *testing.T) {
 	headers := make(http.Header)
 	resp, err := tc().R().SetCookies(
@@ -568,6 +914,66 @@ func TestSetHeaderNonCanonical(t *testing.T) {
 	tests.AssertEqual(t, true, strings.Contains(resp.Dump(), key))
 }
 
+func TestFullURL(t *testing.T) {
+	c := tc().SetBaseURL("https://api.example.com/v1").
+		SetCommonPathParam("org", "my org").
+		SetCommonQueryParam("token", "a&b").
+		SetCommonQueryParam("lang", "en")
+	r := c.R().SetURL("/orgs/{org}/users/{id}?sort=name").
+		SetPathParam("id", "1/2").
+		SetQueryParam("lang", "zh")
+	u, err := r.FullURL()
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, "https://api.example.com/v1/orgs/my%20org/users/1%2F2?sort=name&lang=zh&token=a%26b", u)
+	tests.AssertIsNil(t, r.URL) // the request is not modified.
+
+	// identical to the url which is sent.
+	c = tc().SetCommonQueryParam("a", "1")
+	r = c.Group("/user").R().SetURL("{name}/profile").SetPathParam("name", "imroc").SetQueryParam("b", "2")
+	u, err = r.FullURL()
+	tests.AssertNoError(t, err)
+	resp, err := r.Get(r.RawURL)
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, resp.Request.URL.String(), u)
+	tests.AssertEqual(t, getTestServerURL()+"/user/imroc/profile?a=1&b=2", u)
+
+	// absolute url is not joined.
+	u, err = tc().R().SetURL("http://example.com/{p}").SetPathParam("p", "x").FullURL()
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, "http://example.com/x", u)
+
+	_, err = tc().R().SetURL("http://[::1]:namedport").FullURL()
+	tests.AssertNotNil(t, err)
+}
+
+func TestSetRawQueryString(t *testing.T) {
+	const raw = "b=2&a=%7e%20x+y&a=1&sig=abc%2F%3D%3d&empty"
+	c := tc().SetCommonQueryParam("common", "1")
+	resp, err := c.R().
+		SetQueryParam("key", "value").
+		SetRawQueryString(raw).
+		Get("/query-parameter?in=url")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, raw, resp.String())
+
+	u, err := c.R().SetRawQueryString(raw).SetURL("/query-parameter").FullURL()
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, true, strings.HasSuffix(u, "/query-parameter?"+raw))
+
+	// the redirected request uses the query of the redirect location.
+	var queries []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.RawQuery)
+		if r.URL.Path == "/" {
+			http.Redirect(w, r, "/next?page=2", http.StatusFound)
+		}
+	}))
+	defer ts.Close()
+	resp, err = C().R().SetRawQueryString(raw).Get(ts.URL)
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, []string{raw, "page=2"}, queries)
+}
+
 func TestQueryParam(t *testing.T) {
 	testWithAllTransport(t, testQueryParam)
 }
@@ -758,6 +1164,67 @@ func testError(t *testing.T, c *Client) {
 	tests.AssertEqual(t, 10000, em.ErrorCode)
 }
 
+func TestEmptyBodyResult(t *testing.T) {
+	testWithAllTransport(t, testEmptyBodyResult)
+}
+
+func testEmptyBodyResult(t *testing.T, c *Client) {
+	for _, code := range []int{http.StatusOK, http.StatusNoContent, http.StatusResetContent} {
+		v := UserInfo{Username: "roc"}
+		resp, err := c.R().SetResult(&v).SetQueryParam("code", strconv.Itoa(code)).Get("/status")
+		tests.AssertNoError(t, err)
+		tests.AssertEqual(t, code, resp.StatusCode)
+		tests.AssertEqual(t, true, resp.IsSuccess())
+		tests.AssertEqual(t, "roc", v.Username)
+	}
+
+	// only 204 is skipped if the empty body is not treated as no error.
+	c.SetTreatEmptyBodyAsNoError(false)
+	v := UserInfo{Username: "roc"}
+	resp, err := c.R().SetResult(&v).SetQueryParam("code", "204").Get("/status")
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, true, resp.IsSuccess())
+	tests.AssertEqual(t, "roc", v.Username)
+	_, err = c.R().SetResult(&v).SetQueryParam("code", "200").Get("/status")
+	tests.AssertNotNil(t, err)
+}
+
+func TestErrorBodySnippet(t *testing.T) {
+	testWithAllTransport(t, testErrorBodySnippet)
+}
+
+func testErrorBodySnippet(t *testing.T, c *Client) {
+	var errMsg ErrorMessage
+	resp, err := c.R().SetErrorResult(&errMsg).Get("/bad-gateway")
+	assertIsError(t, resp, err)
+	tests.AssertEqual(t, http.StatusBadGateway, resp.StatusCode)
+	tests.AssertIsNil(t, resp.ErrorResult())
+	tests.AssertEqual(t, "<html><body>502 Bad Gateway</body></html>", resp.ErrorBodySnippet())
+
+	resp, err = c.R().SetErrorResult(&errMsg).SetErrorBodyLimit(12).Get("/bad-gateway")
+	assertIsError(t, resp, err)
+	tests.AssertEqual(t, "<html><body>", resp.ErrorBodySnippet())
+	// zero overrides the limit of the client rather than being ignored.
+	resp, err = c.R().SetErrorResult(&errMsg).SetErrorBodyLimit(0).Get("/bad-gateway")
+	assertIsError(t, resp, err)
+	tests.AssertEqual(t, "", resp.ErrorBodySnippet())
+
+	resp, err = c.R().SetErrorResult(&errMsg).Get("/bad-json-error")
+	assertIsError(t, resp, err)
+	tests.AssertEqual(t, http.StatusInternalServerError, resp.StatusCode)
+	tests.AssertIsNil(t, resp.ErrorResult())
+	tests.AssertEqual(t, `{"error_code": "not a number"`, resp.ErrorBodySnippet())
+
+	resp, err = c.R().SetQueryParam("username", "").SetErrorResult(&errMsg).Get("/search")
+	assertIsError(t, resp, err)
+	tests.AssertEqual(t, "", resp.ErrorBodySnippet())
+
+	c.SetCommonErrorBodyLimit(-1)
+	resp, err = c.R().SetErrorResult(&errMsg).Get("/bad-gateway")
+	assertIsError(t, resp, err)
+	tests.AssertEqual(t, "", resp.ErrorBodySnippet())
+}
+
 func TestForm(t *testing.T) {
 	testWithAllTransport(t, testForm)
 }
@@ -1040,6 +1507,103 @@ func TestDownloadCallback(t *testing.T) {
 	tests.AssertEqual(t, true, n > 0)
 }
 
+func TestProgressSpeed(t *testing.T) {
+	start := time.Now()
+	pg := newProgress(start, 2*time.Second)
+	// 1000 B/s for 4s, then 4000 B/s for 2s.
+	var size int64
+	var speed, avg float64
+	var eta time.Duration
+	for i := 1; i <= 12; i++ {
+		if i <= 8 {
+			size += 500
+		} else {
+			size += 2000
+		}
+		speed, avg, eta = pg.update(start.Add(time.Duration(i)*500*time.Millisecond), size, 20000)
+		if i == 8 {
+			tests.AssertEqual(t, 1000.0, speed)
+			tests.AssertEqual(t, 1000.0, avg)
+			tests.AssertEqual(t, 16*time.Second, eta)
+		}
+	}
+	// the speed over the 2s window only reflects the new rate.
+	tests.AssertEqual(t, 4000.0, speed)
+	tests.AssertEqual(t, 2000.0, avg)
+	tests.AssertEqual(t, 2*time.Second, eta)
+	_, _, eta = pg.update(start.Add(7*time.Second), 20000, 20000)
+	tests.AssertEqual(t, time.Duration(0), eta)
+
+	// the timed writes of the upload.
+	body := bytes.Repeat([]byte("a"), 1000)
+	r := tc().R()
+	r.SetFileReader("file", "a.txt", &slowChunkReader{data: body, chunk: 100, delay: 10 * time.Millisecond})
+	r.uploadFiles[0].FileSize = int64(len(body))
+	var last UploadInfo
+	r.SetUploadCallbackWithInterval(func(info UploadInfo) {
+		last = info
+	}, 0).SetProgressWindow(50 * time.Millisecond)
+	resp, err := r.Post("/raw-upload")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, int64(len(body)), last.UploadedSize)
+	// about 10000 B/s, with the tolerance of the scheduling.
+	if last.Speed < 2000 || last.Speed > 20000 || last.AverageSpeed < 2000 || last.AverageSpeed > 20000 {
+		t.Errorf("unexpected upload speed %.0f B/s, average %.0f B/s", last.Speed, last.AverageSpeed)
+	}
+}
+
+type slowChunkReader struct {
+	data  []byte
+	chunk int
+	delay time.Duration
+}
+
+func (r *slowChunkReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, io.EOF
+	}
+	time.Sleep(r.delay)
+	n := copy(p[:min(len(p), r.chunk)], r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestAddOutput(t *testing.T) {
+	buf1 := new(bytes.Buffer)
+	buf2 := new(bytes.Buffer)
+	var downloaded int64
+	resp, err := tc().R().
+		SetOutput(buf1).
+		AddOutput(buf2).
+		SetDownloadCallback(func(info DownloadInfo) {
+			downloaded = info.DownloadedSize
+		}).Get("/")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, "TestGet: text response", buf1.String())
+	tests.AssertEqual(t, "TestGet: text response", buf2.String())
+	tests.AssertEqual(t, int64(buf1.Len()), downloaded)
+	tests.AssertEqual(t, 0, len(resp.Bytes()))
+
+	// only the outputs added by AddOutput.
+	buf1.Reset()
+	resp, err = tc().R().AddOutput(buf1).Get("/")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, "TestGet: text response", buf1.String())
+
+	buf1.Reset()
+	_, err = tc().R().AddOutput(buf1).AddOutput(failingWriter{}).Get("/")
+	var outputErr *OutputError
+	tests.AssertEqual(t, true, errors.As(err, &outputErr))
+	tests.AssertEqual(t, 1, outputErr.Index)
+	tests.AssertErrorContains(t, err, "output #1: disk full")
+}
+
 func TestRequestDisableAutoReadResponse(t *testing.T) {
 	testWithAllTransport(t, func(t *testing.T, c *Client) {
 		resp, err := c.R().DisableAutoReadResponse().Get("/")
@@ -1066,3 +1630,1200 @@ func TestRestoreResponseBody(t *testing.T) {
 	tests.AssertNoError(t, err)
 	tests.AssertEqual(t, true, len(body) > 0)
 }
+
+func TestPages(t *testing.T) {
+	c := tc()
+	var pages []string
+	for resp, err := range c.R().SetURL("/pages").SetPaginateByLinkHeader().Pages(context.Background()) {
+		assertSuccess(t, resp, err)
+		pages = append(pages, resp.String())
+	}
+	tests.AssertEqual(t, []string{"page-1", "page-2", "page-3"}, pages)
+
+	// max pages
+	var lastErr error
+	n := 0
+	for resp, err := range c.R().SetURL("/pages?loop=1").SetPaginateByLinkHeader().SetMaxPages(5).Pages(context.Background()) {
+		if err != nil {
+			tests.AssertEqual(t, true, resp == nil)
+			lastErr = err
+			break
+		}
+		n++
+	}
+	tests.AssertEqual(t, 5, n)
+	tests.AssertEqual(t, true, errors.Is(lastErr, ErrMaxPagesExceeded))
+
+	// the error of the paginate func
+	n = 0
+	lastErr = nil
+	for resp, err := range c.R().SetURL("/pages").SetPaginateFunc(func(resp *Response) (string, error) {
+		return "", errors.New("bad page")
+	}).Pages(context.Background()) {
+		if err != nil {
+			tests.AssertEqual(t, true, resp == nil)
+			lastErr = err
+			continue
+		}
+		n++
+	}
+	tests.AssertEqual(t, 1, n)
+	tests.AssertErrorContains(t, lastErr, "bad page")
+
+	// context cancellation
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	n = 0
+	lastErr = nil
+	for _, err := range c.R().SetURL("/pages?loop=1").SetPaginateByLinkHeader().Pages(ctx) {
+		if err != nil {
+			lastErr = err
+			break
+		}
+		n++
+		if n == 2 {
+			cancel()
+		}
+	}
+	tests.AssertEqual(t, 2, n)
+	tests.AssertEqual(t, true, errors.Is(lastErr, context.Canceled))
+
+	// break early
+	n = 0
+	for range c.R().SetURL("/pages").SetPaginateByLinkHeader().Pages(context.Background()) {
+		n++
+		break
+	}
+	tests.AssertEqual(t, 1, n)
+}
+
+func testOnInformationalResponse(t *testing.T, c *Client) {
+	buf := new(bytes.Buffer)
+	var statuses []int
+	var links []string
+	resp, err := c.R().EnableDumpTo(buf).
+		OnInformationalResponse(func(status int, header http.Header) {
+			statuses = append(statuses, status)
+			links = append(links, header.Get("Link"))
+		}).
+		Get("/early-hints")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, "ok", resp.String())
+	tests.AssertEqual(t, "", resp.GetHeader("Link"))
+	tests.AssertEqual(t, []int{http.StatusEarlyHints, http.StatusEarlyHints}, statuses)
+	tests.AssertEqual(t, []string{
+		"</style.css>; rel=preload; as=style",
+		"</script.js>; rel=preload; as=script",
+	}, links)
+	tests.AssertContains(t, buf.String(), "</script.js>; rel=preload; as=script", true)
+}
+
+func TestEnableEarlyHintsPreconnect(t *testing.T) {
+	origin := strings.Replace(getTestServerURL(), "127.0.0.1", "localhost", 1)
+	dialed := make(chan error, 10)
+	c := tc().EnableForceHTTP1().
+		OnEarlyHintsPreconnect(func(o string, err error) {
+			tests.AssertEqual(t, origin, o)
+			dialed <- err
+		}).
+		EnableEarlyHintsPreconnect(1)
+	hinted := "/early-hints-preconnect?origin=" + url.QueryEscape(origin+"/path")
+	// at most 1 origin is pre-warmed for each response.
+	resp, err := c.R().Get(hinted + "&origin=https://unreachable.invalid")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, "ok", resp.String())
+	select {
+	case err = <-dialed:
+		tests.AssertNoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("preconnect is not dialed")
+	}
+	host := strings.TrimPrefix(origin, "https://")
+	tests.AssertEqual(t, 1, c.GetTransport().ConnPoolStats().IdlePerHost[host])
+
+	// deduplicated within the ttl.
+	resp, err = c.R().Get(hinted)
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, 0, len(dialed))
+
+	// the warmed connection is reused.
+	resp, err = c.R().Get(origin + "/")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, true, resp.ConnReused())
+
+	// disabled by default.
+	c = tc().EnableForceHTTP1()
+	resp, err = c.R().Get(hinted)
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, 0, c.GetTransport().ConnPoolStats().IdlePerHost[host])
+}
+
+func TestWarmupConnections(t *testing.T) {
+	host := strings.TrimPrefix(getTestServerURL(), "https://")
+	c := tc().EnableForceHTTP1()
+	err := c.WarmupConnections(context.Background(), getTestServerURL()+"/path", getTestServerURL())
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, 1, c.GetTransport().ConnPoolStats().IdlePerHost[host])
+	resp, err := c.R().Get("/")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, true, resp.ConnReused())
+
+	c = tc()
+	tests.AssertNoError(t, c.WarmupConnections(context.Background(), getTestServerURL()))
+	resp, err = c.R().Get("/")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, "HTTP/2.0", resp.Proto)
+	tests.AssertEqual(t, true, resp.ConnReused())
+
+	// the errors of each origin are joined.
+	err = c.WarmupConnections(context.Background(), "/relative", "https://127.0.0.1:1", getTestServerURL())
+	tests.AssertErrorContains(t, err, "failed to warm up /relative")
+	tests.AssertErrorContains(t, err, "failed to warm up https://127.0.0.1:1")
+	tests.AssertEqual(t, false, strings.Contains(err.Error(), getTestServerURL()))
+
+	h3URL, stop := startHTTP3TestServer(t)
+	defer stop()
+	c = C().SetBaseURL(h3URL).EnableInsecureSkipVerify().EnableForceHTTP3()
+	tests.AssertNoError(t, c.WarmupConnections(context.Background(), h3URL))
+	resp, err = c.R().Get("/")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, "HTTP/3.0", resp.Proto)
+	tests.AssertEqual(t, true, resp.ConnReused())
+}
+
+func TestPrewarm(t *testing.T) {
+	ctx := context.Background()
+	host := strings.TrimPrefix(getTestServerURL(), "https://")
+	c := tc().EnableForceHTTP1()
+	c.GetTransport().MaxIdleConnsPerHost = 10
+	tests.AssertNoError(t, c.Prewarm(ctx, getTestServerURL(), 3))
+	tests.AssertEqual(t, 3, c.GetTransport().ConnPoolStats().IdlePerHost[host])
+	resp, err := c.R().Get("/")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, true, resp.ConnReused())
+	// the idle connections count towards n.
+	tests.AssertNoError(t, c.Prewarm(ctx, getTestServerURL(), 2))
+	tests.AssertEqual(t, 3, c.GetTransport().ConnPoolStats().IdlePerHost[host])
+
+	// capped by MaxConnsPerHost.
+	c = tc().EnableForceHTTP1()
+	c.GetTransport().SetMaxConnsPerHost(2)
+	tests.AssertNoError(t, c.Prewarm(ctx, getTestServerURL(), 5))
+	tests.AssertEqual(t, 2, c.GetTransport().ConnPoolStats().IdlePerHost[host])
+
+	// a single HTTP2 connection is shared.
+	c = tc()
+	tests.AssertNoError(t, c.Prewarm(ctx, getTestServerURL(), 3))
+	stats := c.GetTransport().ConnPoolStats()
+	tests.AssertEqual(t, 1, stats.IdlePerHost[host])
+	tests.AssertEqual(t, 1, stats.HTTP2PerHost[host])
+	c = tc().EnableForceHTTP2()
+	tests.AssertNoError(t, c.Prewarm(ctx, getTestServerURL(), 3))
+	stats = c.GetTransport().ConnPoolStats()
+	tests.AssertEqual(t, 0, stats.Idle)
+	tests.AssertEqual(t, 1, stats.HTTP2PerHost[host])
+
+	h3URL, stop := startHTTP3TestServer(t)
+	defer stop()
+	c = C().EnableInsecureSkipVerify().EnableForceHTTP3()
+	tests.AssertNoError(t, c.Prewarm(ctx, h3URL, 3))
+	tests.AssertEqual(t, 1, c.GetTransport().ConnPoolStats().HTTP3PerHost[strings.TrimPrefix(h3URL, "https://")])
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	err = c.Prewarm(timeoutCtx, "https://127.0.0.1:1", 2)
+	tests.AssertErrorContains(t, err, "failed to prewarm https://127.0.0.1:1")
+	c = tc().EnableForceHTTP1()
+	err = c.Prewarm(ctx, "https://127.0.0.1:1", 2)
+	tests.AssertErrorContains(t, err, "failed to prewarm connection 1 to https://127.0.0.1:1")
+}
+
+func TestPrewarmKeepAlive(t *testing.T) {
+	host := strings.TrimPrefix(getTestServerURL(), "https://")
+	c := tc().EnableForceHTTP1()
+	c.GetTransport().SetIdleConnTimeout(300 * time.Millisecond)
+	tests.AssertNoError(t, c.Prewarm(context.Background(), getTestServerURL(), 2))
+	stop := c.PrewarmKeepAlive(getTestServerURL(), 50*time.Millisecond)
+	time.Sleep(600 * time.Millisecond)
+	tests.AssertEqual(t, 2, c.GetTransport().ConnPoolStats().IdlePerHost[host])
+	stop()
+	stop()
+	time.Sleep(600 * time.Millisecond)
+	tests.AssertEqual(t, 0, c.GetTransport().ConnPoolStats().IdlePerHost[host])
+
+	c = tc().EnableForceHTTP2()
+	tests.AssertNoError(t, c.Prewarm(context.Background(), getTestServerURL(), 1))
+	stop = c.PrewarmKeepAlive(getTestServerURL(), 10*time.Millisecond)
+	defer stop()
+	time.Sleep(50 * time.Millisecond)
+	tests.AssertEqual(t, 1, c.GetTransport().ConnPoolStats().HTTP2PerHost[host])
+}
+
+func TestOnInformationalResponse(t *testing.T) {
+	t.Run("h1", func(t *testing.T) {
+		testOnInformationalResponse(t, tc().EnableForceHTTP1())
+	})
+	t.Run("h2", func(t *testing.T) {
+		testOnInformationalResponse(t, tc().EnableForceHTTP2())
+	})
+	t.Run("h3", func(t *testing.T) {
+		url, stop := startHTTP3TestServer(t)
+		defer stop()
+		testOnInformationalResponse(t, C().SetBaseURL(url).EnableInsecureSkipVerify().EnableForceHTTP3())
+	})
+}
+
+func testSetHost(t *testing.T, c *Client, wire string) {
+	buf := new(bytes.Buffer)
+	resp, err := c.R().EnableDumpTo(buf).SetHeader("Host", "ignored.example.com").SetHost("other.example.com").Get("/host-header")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, "other.example.com", resp.String())
+	tests.AssertContains(t, buf.String(), wire, true)
+	tests.AssertContains(t, buf.String(), "ignored.example.com", false)
+}
+
+func TestSetHost(t *testing.T) {
+	t.Run("h1", func(t *testing.T) {
+		testSetHost(t, tc().EnableForceHTTP1(), "host: other.example.com\r\n")
+	})
+	t.Run("h2", func(t *testing.T) {
+		testSetHost(t, tc().EnableForceHTTP2(), ":authority: other.example.com\r\n")
+	})
+	t.Run("h3", func(t *testing.T) {
+		url, stop := startHTTP3TestServer(t)
+		defer stop()
+		testSetHost(t, C().SetBaseURL(url).EnableInsecureSkipVerify().EnableForceHTTP3(), ":authority: other.example.com\r\n")
+	})
+
+	c := tc()
+	// persists on redirects to the same host.
+	resp, err := c.R().SetHost("other.example.com").Get("/redirect-to-host-header")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, "other.example.com", resp.String())
+
+	// dropped on redirects to other hosts by default.
+	resp, err = c.R().SetHost("other.example.com").Get("/redirect-to-host-header?cross=1")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, "localhost", strings.Split(resp.String(), ":")[0])
+
+	resp, err = c.R().SetHost("other.example.com").EnableHostOverrideAcrossRedirects().Get("/redirect-to-host-header?cross=1")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, "other.example.com", resp.String())
+}
+
+func TestSetAbsoluteURI(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	tests.AssertNoError(t, err)
+	defer ln.Close()
+	lines := make(chan string, 2)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				br := bufio.NewReader(conn)
+				for {
+					req, err := http.ReadRequest(br)
+					if err != nil {
+						return
+					}
+					lines <- req.Method + " " + req.RequestURI
+					conn.Write([]byte("HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n"))
+				}
+			}()
+		}
+	}()
+
+	c := C()
+	url := "http://" + ln.Addr().String() + "/path?a=b"
+	resp, err := c.R().Get(url)
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, "GET /path?a=b", <-lines)
+	resp, err = c.R().SetAbsoluteURI(true).Get(url)
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, "GET "+url, <-lines)
+
+	// no-op in HTTP/2.
+	resp, err = tc().R().SetAbsoluteURI(true).Get("/")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, 2, resp.ProtoMajor)
+}
+
+func TestSetOrderedFormDataKV(t *testing.T) {
+	c := tc()
+	var e Echo
+	resp, err := c.R().
+		SetOrderedFormDataKV(KV{"b", "2"}, KV{"a", "1 +&"}, KV{"b", "3"}).
+		SetSuccessResult(&e).
+		Post("/echo")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, "b=2&a=1+%2B%26&b=3", e.Body)
+	tests.AssertEqual(t, header.FormContentType, e.Header.Get(header.ContentType))
+
+	// the charset param of the form content type is kept.
+	ct := header.FormContentType + "; charset=utf-8"
+	resp, err = c.R().
+		SetContentType(ct).
+		SetFormData(map[string]string{"a": "1"}).
+		SetSuccessResult(&e).
+		Post("/echo")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, "a=1", e.Body)
+	tests.AssertEqual(t, ct, e.Header.Get(header.ContentType))
+}
+
+func TestSetFormDataNested(t *testing.T) {
+	data := map[string]any{
+		"name": "a&b=c [d]",
+		"items": []any{
+			map[string]any{"name": "x", "price": 1.5},
+			map[string]string{"name": "y/z"},
+		},
+		"tags": []string{"a", "b"},
+		"deep": map[string]any{"l1": map[string]any{"l2": []int{1, 2}}},
+		"nil":  nil,
+		"none": []string{},
+	}
+	c := tc()
+	var e Echo
+	resp, err := c.R().SetFormDataNested(data).SetSuccessResult(&e).Post("/echo")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, header.FormContentType, e.Header.Get(header.ContentType))
+	values, err := url.ParseQuery(e.Body)
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, url.Values{
+		"deep[l1][l2][0]": {"1"},
+		"deep[l1][l2][1]": {"2"},
+		"items[0][name]":  {"x"},
+		"items[0][price]": {"1.5"},
+		"items[1][name]":  {"y/z"},
+		"name":            {"a&b=c [d]"},
+		"tags[0]":         {"a"},
+		"tags[1]":         {"b"},
+	}, values)
+	tests.AssertEqual(t, true, strings.HasPrefix(e.Body, "deep%5Bl1%5D%5Bl2%5D%5B0%5D=1&"))
+	tests.AssertEqual(t, true, strings.Contains(e.Body, "name=a%26b%3Dc+%5Bd%5D"))
+
+	// the elements of an array of maps are kept together.
+	c.SetFormArrayStyle(FormArrayBrackets)
+	resp, err = c.R().SetFormDataNested(data).SetSuccessResult(&e).Post("/echo")
+	assertSuccess(t, resp, err)
+	values, err = url.ParseQuery(e.Body)
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, []string{"a", "b"}, values["tags[]"])
+	tests.AssertEqual(t, []string{"1", "2"}, values["deep[l1][l2][]"])
+	tests.AssertEqual(t, true, strings.Contains(e.Body, "items%5B%5D%5Bname%5D=x&items%5B%5D%5Bprice%5D=1.5&items%5B%5D%5Bname%5D=y%2Fz"))
+}
+
+func TestSetExpectedContentLength(t *testing.T) {
+	// the server closes the connection after sending a truncated body
+	// without Content-Length, which looks successful.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	tests.AssertNoError(t, err)
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				http.ReadRequest(bufio.NewReader(conn))
+				conn.Write([]byte("HTTP/1.1 200 OK\r\nConnection: close\r\n\r\nhello"))
+			}()
+		}
+	}()
+	url := "http://" + ln.Addr().String()
+
+	c := C()
+	resp, err := c.R().SetExpectedContentLength(5).Get(url)
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, "hello", resp.String())
+
+	_, err = c.R().SetExpectedContentLength(10).Get(url)
+	var mismatch *ContentLengthMismatchError
+	tests.AssertEqual(t, true, errors.As(err, &mismatch))
+	tests.AssertEqual(t, int64(10), mismatch.Expected)
+	tests.AssertEqual(t, int64(5), mismatch.Actual)
+	tests.AssertEqual(t, false, mismatch.Decompressed)
+
+	outFile := t.TempDir() + "/truncated"
+	_, err = c.R().SetExpectedContentLength(10).SetOutputFile(outFile).Get(url)
+	tests.AssertEqual(t, true, errors.As(err, &mismatch))
+	tests.AssertEqual(t, int64(5), mismatch.Actual)
+
+	// the wire length of the compressed body differs from the decompressed one.
+	c = tc()
+	resp, err = c.R().SetExpectedDecompressedLength(16).Get("/compressed")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, "hello compressed", resp.String())
+	tests.AssertContains(t, resp.GetHeader("X-Accept-Encoding"), "gzip", true)
+
+	_, err = c.R().SetExpectedContentLength(16).Get("/compressed")
+	tests.AssertEqual(t, true, errors.As(err, &mismatch))
+	tests.AssertEqual(t, int64(16), mismatch.Expected)
+	tests.AssertEqual(t, false, mismatch.Decompressed)
+	wireLength := mismatch.Actual
+
+	resp, err = c.R().SetExpectedContentLength(wireLength).SetExpectedDecompressedLength(16).Get("/compressed")
+	assertSuccess(t, resp, err)
+
+	_, err = c.R().SetExpectedDecompressedLength(20).Get("/compressed")
+	tests.AssertEqual(t, true, errors.As(err, &mismatch))
+	tests.AssertEqual(t, true, mismatch.Decompressed)
+	tests.AssertEqual(t, int64(16), mismatch.Actual)
+}
+
+func TestStreamTimeouts(t *testing.T) {
+	testStreamTimeouts := func(t *testing.T, c *Client) {
+		// the body streams longer than the timeouts, but each gap is short.
+		resp, err := c.R().
+			SetResponseHeaderTimeout(200 * time.Millisecond).
+			SetBodyIdleTimeout(200 * time.Millisecond).
+			Get("/stream?interval=100")
+		assertSuccess(t, resp, err)
+		tests.AssertEqual(t, "data-0\ndata-1\ndata-2\n", resp.String())
+
+		_, err = c.R().SetResponseHeaderTimeout(50 * time.Millisecond).Get("/sleep?ms=500")
+		var headerErr *ResponseHeaderTimeoutError
+		tests.AssertEqual(t, true, errors.As(err, &headerErr))
+		tests.AssertEqual(t, 50*time.Millisecond, headerErr.Duration)
+
+		// the header timeout does not limit the body read.
+		resp, err = c.R().SetHeaderTimeout(50 * time.Millisecond).Get("/stream?stall=200")
+		assertSuccess(t, resp, err)
+		tests.AssertEqual(t, "data-0\ndata-1\ndata-2\n", resp.String())
+		_, err = c.R().SetHeaderTimeout(50 * time.Millisecond).Get("/sleep?ms=500")
+		var hopErr *HeaderTimeoutError
+		tests.AssertEqual(t, true, errors.As(err, &hopErr))
+		tests.AssertEqual(t, 50*time.Millisecond, hopErr.Duration)
+
+		_, err = c.R().SetBodyIdleTimeout(100 * time.Millisecond).Get("/stream?stall=1000")
+		var idleErr *BodyIdleTimeoutError
+		tests.AssertEqual(t, true, errors.As(err, &idleErr))
+		tests.AssertEqual(t, int64(len("data-0\ndata-1\n")), idleErr.Read)
+
+		// the time spent by the consumer of the body is not counted.
+		resp, err = c.R().SetBodyIdleTimeout(100 * time.Millisecond).DisableAutoReadResponse().Get("/stream")
+		assertSuccess(t, resp, err)
+		time.Sleep(200 * time.Millisecond)
+		b, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		tests.AssertNoError(t, err)
+		tests.AssertEqual(t, "data-0\ndata-1\ndata-2\n", string(b))
+	}
+	testWithAllTransport(t, testStreamTimeouts)
+
+	url, stop := startHTTP3TestServer(t)
+	defer stop()
+	testStreamTimeouts(t, C().SetBaseURL(url).EnableInsecureSkipVerify().EnableForceHTTP3())
+}
+
+func TestForwardedHeaders(t *testing.T) {
+	c := tc()
+	var h http.Header
+	resp, err := c.R().
+		SetHeader("Forwarded", `for=192.0.2.43`).
+		SetHeader("X-Forwarded-For", "192.0.2.43").
+		SetForwardedFor("2001:db8:cafe::17").
+		EnableForwardedHeader("HTTPS", "example.com:8443").
+		SetSuccessResult(&h).
+		Get("/header")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, `for=192.0.2.43, for="[2001:db8:cafe::17]";host="example.com:8443";proto=https`, h.Get("Forwarded"))
+	tests.AssertEqual(t, "192.0.2.43, 2001:db8:cafe::17", h.Get("X-Forwarded-For"))
+	tests.AssertEqual(t, "https", h.Get("X-Forwarded-Proto"))
+	tests.AssertEqual(t, "example.com:8443", h.Get("X-Forwarded-Host"))
+
+	testCases := []struct {
+		node, forwarded string
+	}{
+		{"192.0.2.60", "for=192.0.2.60"},
+		{"192.0.2.60:4711", `for="192.0.2.60:4711"`},
+		{"[2001:db8::1]:80", `for="[2001:db8::1]:80"`},
+		{"_hidden", "for=_hidden"},
+		{"unknown", "for=unknown"},
+		{`bad"node`, `for="bad\"node"`},
+	}
+	for _, tc := range testCases {
+		h = nil
+		resp, err = c.R().SetForwardedFor(tc.node).SetSuccessResult(&h).Get("/header")
+		assertSuccess(t, resp, err)
+		tests.AssertEqual(t, tc.forwarded, h.Get("Forwarded"))
+		tests.AssertEqual(t, "", h.Get("X-Forwarded-Proto"))
+	}
+
+	// the common headers of the client are extended, not modified.
+	c = tc().
+		SetCommonHeader("Forwarded", "for=_proxy").
+		SetCommonForwardedFor("198.51.100.17").
+		EnableCommonForwardedHeader("http", "")
+	for i := 0; i < 2; i++ {
+		resp, err = c.R().SetSuccessResult(&h).Get("/header")
+		assertSuccess(t, resp, err)
+		tests.AssertEqual(t, "for=_proxy, for=198.51.100.17;proto=http", h.Get("Forwarded"))
+		tests.AssertEqual(t, "198.51.100.17", h.Get("X-Forwarded-For"))
+		tests.AssertEqual(t, "http", h.Get("X-Forwarded-Proto"))
+	}
+	resp, err = c.R().SetForwardedFor("203.0.113.1").SetSuccessResult(&h).Get("/header")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, "for=_proxy, for=203.0.113.1;proto=http", h.Get("Forwarded"))
+}
+
+func TestSetHeaderNonCanonicalOnWire(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	tests.AssertNoError(t, err)
+	defer ln.Close()
+	heads := make(chan string, 1)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				br := bufio.NewReader(conn)
+				var head strings.Builder
+				for {
+					line, err := br.ReadString('\n')
+					if err != nil {
+						return
+					}
+					head.WriteString(line)
+					if line == "\r\n" {
+						break
+					}
+				}
+				heads <- head.String()
+				conn.Write([]byte("HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n"))
+			}()
+		}
+	}()
+
+	c := C().SetCommonHeader("X-Auth-Token", "common")
+	resp, err := c.R().
+		EnableDumpWithoutResponse().
+		SetHeaderNonCanonical("X-AUTH-TOKEN", "secret").
+		Get("http://" + ln.Addr().String())
+	assertSuccess(t, resp, err)
+	head := <-heads
+	tests.AssertEqual(t, true, strings.Contains(head, "\r\nX-AUTH-TOKEN: secret\r\n"))
+	tests.AssertEqual(t, false, strings.Contains(head, "X-Auth-Token"))
+	tests.AssertEqual(t, true, strings.Contains(resp.Dump(), "X-AUTH-TOKEN: secret"))
+
+	// replaces the header in other casing of the client.
+	c = C().SetCommonHeader("X-Auth-Token", "canonical").SetCommonHeaderNonCanonical("x-auth-TOKEN", "common")
+	resp, err = c.R().Get("http://" + ln.Addr().String())
+	assertSuccess(t, resp, err)
+	head = <-heads
+	tests.AssertEqual(t, true, strings.Contains(head, "\r\nx-auth-TOKEN: common\r\n"))
+	tests.AssertEqual(t, false, strings.Contains(head, "canonical"))
+
+	// lowercase in HTTP/2, which is reported in the debug log.
+	buf := new(bytes.Buffer)
+	c = tc().EnableForceHTTP2().EnableDebugLog().SetLogger(NewLogger(buf, "", 0))
+	resp, err = c.R().SetHeaderNonCanonical("X-AUTH-TOKEN", "secret").Get("/header")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, true, strings.Contains(buf.String(), "[X-AUTH-TOKEN] are sent in lowercase in HTTP/2.0"))
+}
+
+func TestSetFormDataEncoded(t *testing.T) {
+	value := []byte("hello ~~~??? world") // not url-safe once base64 encoded.
+	form := make(url.Values)
+	resp, err := tc().R().
+		SetFormDataEncoded("raw", value, FieldEncodingRaw).
+		SetFormDataEncoded("b64", value, FieldEncodingBase64).
+		SetFormDataEncoded("b64url", value, FieldEncodingBase64URL).
+		SetFormDataEncoded("gzb64", value, FieldEncodingGzipBase64).
+		SetFormDataEncoded("gzb64url", value, FieldEncodingGzipBase64URL).
+		SetSuccessResult(&form).
+		Post("/form")
+	assertSuccess(t, resp, err)
+
+	tests.AssertEqual(t, string(value), form.Get("raw"))
+	b, err := base64.StdEncoding.DecodeString(form.Get("b64"))
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, value, b)
+	tests.AssertEqual(t, false, strings.ContainsAny(form.Get("b64url"), "+/"))
+	b, err = base64.URLEncoding.DecodeString(form.Get("b64url"))
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, value, b)
+
+	gunzip := func(enc *base64.Encoding, s string) []byte {
+		b, err := enc.DecodeString(s)
+		tests.AssertNoError(t, err)
+		r, err := gzip.NewReader(bytes.NewReader(b))
+		tests.AssertNoError(t, err)
+		b, err = io.ReadAll(r) // verifies the checksum and size.
+		tests.AssertNoError(t, err)
+		return b
+	}
+	tests.AssertEqual(t, value, gunzip(base64.StdEncoding, form.Get("gzb64")))
+	tests.AssertEqual(t, value, gunzip(base64.URLEncoding, form.Get("gzb64url")))
+}
+
+func TestAttemptDumps(t *testing.T) {
+	c := tc()
+	resp, err := c.R().EnableDump().Get("/redirect-to-meta-refresh")
+	assertSuccess(t, resp, err)
+	dumps := resp.Dumps()
+	tests.AssertEqual(t, 2, len(dumps))
+	var all string
+	for i, d := range dumps {
+		tests.AssertEqual(t, 0, d.Attempt)
+		tests.AssertEqual(t, i, d.Hop)
+		tests.AssertEqual(t, false, d.Time.IsZero())
+		tests.AssertEqual(t, true, strings.HasPrefix(d.Content, fmt.Sprintf("* attempt: 0, hop: %d, url: %s, time: ", i, d.URL)))
+		all += d.Content
+	}
+	tests.AssertEqual(t, true, strings.HasSuffix(dumps[0].URL, "/redirect-to-meta-refresh"))
+	tests.AssertEqual(t, true, strings.HasSuffix(dumps[1].URL, "/meta-refresh?n=1"))
+	tests.AssertEqual(t, true, strings.Contains(dumps[0].Content, "302"))
+	tests.AssertEqual(t, false, strings.Contains(dumps[0].Content, "<html>"))
+	tests.AssertEqual(t, true, strings.Contains(dumps[1].Content, "<html>"))
+	tests.AssertEqual(t, resp.Dump(), all)
+
+	attempts := func(policy DumpAttempts) []int {
+		resp, err := c.R().
+			SetDumpOptions(&DumpOptions{RequestHeader: true, ResponseHeader: true, Attempts: policy}).
+			EnableDump().
+			SetRetryCount(3).
+			SetRetryFixedInterval(time.Millisecond).
+			SetRetryCondition(func(resp *Response, err error) bool {
+				return resp.Request.RetryAttempt < 2
+			}).
+			Get("/")
+		assertSuccess(t, resp, err)
+		var attempts []int
+		for _, d := range resp.Dumps() {
+			tests.AssertEqual(t, 0, d.Hop)
+			tests.AssertEqual(t, true, strings.Contains(d.Content, ":path: /"))
+			attempts = append(attempts, d.Attempt)
+		}
+		return attempts
+	}
+	tests.AssertEqual(t, []int{0, 1, 2}, attempts(DumpAllAttempts))
+	tests.AssertEqual(t, []int{2}, attempts(DumpFinalAttempt))
+	tests.AssertEqual(t, []int{0, 1}, attempts(DumpFailedAttempts))
+
+	// the final attempt is kept if it fails.
+	resp, err = c.R().
+		SetDumpOptions(&DumpOptions{ResponseHeader: true, Attempts: DumpFailedAttempts}).
+		EnableDump().
+		SetRetryCount(1).
+		SetRetryFixedInterval(time.Millisecond).
+		AddRetryCondition(func(resp *Response, err error) bool {
+			return resp.StatusCode == http.StatusTooManyRequests
+		}).
+		Get("/too-many")
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, 2, len(resp.Dumps()))
+	tests.AssertEqual(t, 1, resp.Dumps()[1].Attempt)
+}
+
+func TestRequestReset(t *testing.T) {
+	c := tc()
+	r := c.R()
+	resp, err := r.SetBody("first").
+		SetHeader("X-Once", "1").
+		SetQueryParam("q", "1").
+		SetRetryCount(1).
+		EnableDump().
+		Post("/payload")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, "first", resp.String())
+	tests.AssertContains(t, resp.Dump(), "x-once", true)
+
+	tests.AssertEqual(t, r, r.Reset())
+	tests.AssertEqual(t, c.R().retryOption, r.retryOption)
+	tests.AssertEqual(t, "", r.Method)
+	tests.AssertEqual(t, "", r.RawURL)
+	tests.AssertEqual(t, 0, len(r.Headers))
+	tests.AssertEqual(t, 0, len(r.QueryParams))
+	tests.AssertEqual(t, true, r.Context() == context.Background())
+	resp, err = r.SetBody("second").Post("/payload")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, "second", resp.String())
+	tests.AssertEqual(t, "", resp.Request.RawRequest.Header.Get("X-Once"))
+	tests.AssertEqual(t, "", resp.Request.RawRequest.URL.RawQuery)
+	tests.AssertEqual(t, "", resp.Dump())
+
+	// the same as a new request.
+	var got, want http.Header
+	resp, err = r.Reset().SetSuccessResult(&got).Get("/header")
+	assertSuccess(t, resp, err)
+	resp, err = c.R().SetSuccessResult(&want).Get("/header")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, want, got)
+}
+
+type countingReader struct {
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	atomic.AddInt64(&r.n, int64(len(p)))
+	return len(p), nil
+}
+
+func TestEnableEarlyResponse(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.CopyN(io.Discard, r.Body, 1024)
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		w.Write([]byte("quota exceeded"))
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	const size = 1 << 30
+	for _, c := range []*Client{
+		C().EnableInsecureSkipVerify().EnableForceHTTP1(),
+		C().EnableInsecureSkipVerify().EnableForceHTTP2(),
+	} {
+		body := new(countingReader)
+		resp, err := c.R().
+			EnableEarlyResponse().
+			SetBody(io.LimitReader(body, size)).
+			Post(server.URL)
+		tests.AssertNoError(t, err)
+		tests.AssertEqual(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+		tests.AssertEqual(t, "quota exceeded", resp.String())
+		tests.AssertEqual(t, true, atomic.LoadInt64(&body.n) < 16<<20)
+
+		// the connection is still usable after the early response.
+		resp, err = c.R().SetBody("small").Post(server.URL)
+		tests.AssertNoError(t, err)
+		tests.AssertEqual(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+	}
+}
+
+func TestMultipartOrderAndBoundary(t *testing.T) {
+	part := func(name, value string) string {
+		return "--my-boundary\r\nContent-Disposition: form-data; name=\"" + name + "\"\r\n\r\n" + value + "\r\n"
+	}
+	filePart := "--my-boundary\r\nContent-Disposition: form-data; name=\"file\"; filename=\"a.txt\"\r\n" +
+		"Content-Type: application/octet-stream\r\n\r\nhello\r\n"
+	send := func(r *Request) (*Response, string) {
+		e := new(Echo)
+		resp, err := r.
+			SetMultipartBoundary("my-boundary").
+			EnableDump().
+			SetSuccessResult(e).
+			Post("/echo")
+		assertSuccess(t, resp, err)
+		tests.AssertEqual(t, "multipart/form-data; boundary=my-boundary", e.Header.Get(header.ContentType))
+		return resp, e.Body
+	}
+
+	// the parts are in the call order, the fields of a map are sorted.
+	resp, body := send(tc().R().
+		SetFormData(map[string]string{"z": "1"}).
+		SetFileBytes("file", "a.txt", []byte("hello")).
+		SetFormData(map[string]string{"b": "2", "a": "3"}).
+		SetFormData(map[string]string{"z": "4"}))
+	tests.AssertEqual(t, part("z", "4")+filePart+part("a", "3")+part("b", "2")+"--my-boundary--\r\n", body)
+	tests.AssertEqual(t, true, strings.Contains(resp.Dump(), body))
+
+	// reorder the parts, the file is the last.
+	_, body = send(tc().R().
+		SetFileBytes("file", "a.txt", []byte("hello")).
+		SetFormDataAnyType(map[string]any{"a": 1, "b": 2, "c": 3}).
+		SetMultipartOrder("c", "a", "b"))
+	tests.AssertEqual(t, part("c", "3")+part("a", "1")+part("b", "2")+filePart+"--my-boundary--\r\n", body)
+
+	_, body = send(tc().R().
+		SetOrderedFormData("y", "1", "x", "2").
+		SetFileBytes("file", "a.txt", []byte("hello")).
+		SetMultipartOrder("file", "x"))
+	tests.AssertEqual(t, filePart+part("x", "2")+part("y", "1")+"--my-boundary--\r\n", body)
+
+	for _, b := range []string{"", "ends with space ", "bad*char", strings.Repeat("b", 71)} {
+		_, err := tc().R().SetMultipartBoundary(b).SetFormData(map[string]string{"a": "1"}).EnableForceMultipart().Post("/echo")
+		tests.AssertErrorContains(t, err, "invalid multipart boundary")
+	}
+}
+
+func TestSetMultipartMixed(t *testing.T) {
+	large := strings.Repeat("large part ", 100000)
+	parts := func() []MixedPart {
+		return []MixedPart{
+			{Header: http.Header{"Content-Type": {"application/json"}}, Body: strings.NewReader(`{"a":1}`)},
+			{Header: http.Header{"Content-Type": {"text/plain"}, "Content-Id": {"<large>"}}, Body: strings.NewReader(large)},
+			{Body: nil},
+		}
+	}
+	check := func(e *Echo) {
+		mediaType, params, err := mime.ParseMediaType(e.Header.Get(header.ContentType))
+		tests.AssertNoError(t, err)
+		tests.AssertEqual(t, "multipart/mixed", mediaType)
+		mr := multipart.NewReader(strings.NewReader(e.Body), params["boundary"])
+		var got []string
+		for {
+			p, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			}
+			tests.AssertNoError(t, err)
+			b, err := io.ReadAll(p)
+			tests.AssertNoError(t, err)
+			got = append(got, p.Header.Get("Content-Type")+"|"+p.Header.Get("Content-Id")+"|"+string(b))
+		}
+		tests.AssertEqual(t, []string{`application/json||{"a":1}`, "text/plain|<large>|" + large, "||"}, got)
+	}
+
+	e := new(Echo)
+	resp, err := tc().R().SetMultipartMixed(parts()...).SetSuccessResult(e).Post("/echo")
+	assertSuccess(t, resp, err)
+	check(e)
+
+	e = new(Echo)
+	resp, err = tc().EnableForceHTTP1().R().
+		SetMultipartBoundary("my boundary").
+		SetMultipartMixed(parts()...).
+		SetSuccessResult(e).
+		Post("/echo")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, `multipart/mixed; boundary="my boundary"`, e.Header.Get(header.ContentType))
+	check(e)
+
+	// the seekable bodies are rewound when retry.
+	e = new(Echo)
+	retry := func(resp *Response, err error) bool { return resp.Request.RetryAttempt == 0 }
+	resp, err = tc().R().
+		SetRetryCount(1).
+		SetRetryCondition(retry).
+		SetMultipartMixed(parts()...).
+		SetSuccessResult(e).
+		Post("/echo")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, 1, resp.Request.RetryAttempt)
+	check(e)
+
+	_, err = tc().R().
+		SetRetryCount(1).
+		SetRetryCondition(retry).
+		SetMultipartMixed(MixedPart{Body: io.MultiReader(strings.NewReader("once"))}).
+		Post("/echo")
+	tests.AssertErrorContains(t, err, "can not be sent again")
+}
+
+func TestEnableWireHashing(t *testing.T) {
+	sum := func(s string) string {
+		h := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(h[:])
+	}
+
+	// the exact bytes of HTTP/1.1, which are compared with the wire capture.
+	buf := new(bytes.Buffer)
+	c := tc().EnableForceHTTP1().EnableWireCapture(buf)
+	resp, err := c.R().EnableWireHashing("sha256").SetBody("hello wire").Post("/echo")
+	assertSuccess(t, resp, err)
+	c.GetTransport().CloseIdleConnections()
+	var sent, received strings.Builder
+	r := wirecapture.NewReader(bytes.NewReader(buf.Bytes()))
+	for {
+		rec, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		tests.AssertNoError(t, err)
+		switch rec.Direction {
+		case wirecapture.Sent:
+			sent.Write(rec.Data)
+		case wirecapture.Received:
+			received.Write(rec.Data)
+		}
+	}
+	h := resp.WireHash()
+	tests.AssertEqual(t, true, h.Exact)
+	tests.AssertEqual(t, "HTTP/1.1", h.Proto)
+	tests.AssertEqual(t, "sha256", h.Algorithm)
+	tests.AssertEqual(t, sum(sent.String()), resp.RequestWireHash())
+	tests.AssertEqual(t, int64(sent.Len()), resp.RequestWireBytes())
+	tests.AssertEqual(t, sum(received.String()), resp.ResponseWireHash())
+	tests.AssertEqual(t, int64(received.Len()), resp.ResponseWireBytes())
+	tests.AssertEqual(t, 0, len(resp.WireHashHistory()))
+
+	// the canonical serialization of HTTP/2 and HTTP/3, the request header
+	// fields are sorted, so the hash is reproducible.
+	canonical := func(dump string) string {
+		head, body, _ := strings.Cut(dump, "\r\n\r\n")
+		var pseudo, fields []string
+		for _, line := range strings.Split(head, "\r\n") {
+			if strings.HasPrefix(line, "* ") { // the attempt and request id lines.
+				continue
+			}
+			if strings.HasPrefix(line, ":") {
+				pseudo = append(pseudo, line+"\r\n")
+			} else {
+				fields = append(fields, line+"\r\n")
+			}
+		}
+		sort.Strings(fields)
+		return strings.Join(pseudo, "") + strings.Join(fields, "") + "\r\n" + strings.TrimSuffix(body, "\r\n\r\n")
+	}
+	url, stop := startHTTP3TestServer(t)
+	defer stop()
+	for _, c := range []*Client{tc().EnableForceHTTP2(), C().SetBaseURL(url).EnableInsecureSkipVerify().EnableForceHTTP3()} {
+		var hashes []string
+		for i := 0; i < 2; i++ {
+			resp, err = c.R().EnableWireHashing("sha256").
+				SetHeader("X-B", "b").SetHeader("X-A", "a").
+				SetBody("hello wire").EnableDumpWithoutResponse().Post("/echo")
+			assertSuccess(t, resp, err)
+			tests.AssertEqual(t, false, resp.WireHash().Exact)
+			tests.AssertEqual(t, resp.Proto, resp.WireHash().Proto)
+			hashes = append(hashes, resp.RequestWireHash())
+		}
+		tests.AssertEqual(t, hashes[0], hashes[1])
+		s := canonical(resp.Dump())
+		tests.AssertContains(t, s, "\r\n\r\nhello wire", true)
+		tests.AssertEqual(t, sum(s), resp.RequestWireHash())
+		tests.AssertEqual(t, int64(len(s)), resp.RequestWireBytes())
+		tests.AssertEqual(t, true, resp.ResponseWireBytes() > int64(len(resp.String())))
+	}
+	c = tc().EnableForceHTTP2()
+
+	// the retries and redirects are recorded in the history.
+	resp, _ = c.R().EnableWireHashing("sha1").
+		SetRetryCount(1).SetRetryFixedInterval(time.Millisecond).
+		AddRetryCondition(func(resp *Response, err error) bool {
+			return resp.GetStatusCode() == http.StatusTooManyRequests
+		}).Get("/too-many")
+	history := resp.WireHashHistory()
+	tests.AssertEqual(t, 1, len(history))
+	tests.AssertEqual(t, 0, history[0].Attempt)
+	tests.AssertEqual(t, 1, resp.WireHash().Attempt)
+	tests.AssertEqual(t, 40, len(resp.RequestWireHash()))
+	resp, err = c.R().EnableWireHashing("sha256").SetBody("hello wire").Post("/redirect")
+	assertSuccess(t, resp, err)
+	history = resp.WireHashHistory()
+	tests.AssertEqual(t, 1, len(history))
+	tests.AssertEqual(t, 0, history[0].Hop)
+	tests.AssertEqual(t, 1, resp.WireHash().Hop)
+	tests.AssertEqual(t, true, history[0].Request != resp.RequestWireHash())
+
+	_, err = c.R().EnableWireHashing("md4").Get("/")
+	tests.AssertErrorContains(t, err, "unsupported wire hash algorithm")
+	resp, err = c.R().Get("/")
+	assertSuccess(t, resp, err)
+	tests.AssertIsNil(t, resp.WireHash())
+}
+
+func TestDecodeRequestBody(t *testing.T) {
+	const content = "hello, compressed request body"
+	encode := func(encoding string, data []byte) []byte {
+		buf := new(bytes.Buffer)
+		var w io.WriteCloser
+		switch encoding {
+		case "gzip":
+			w = gzip.NewWriter(buf)
+		case "deflate":
+			w = zlib.NewWriter(buf)
+		case "raw-deflate":
+			w, _ = flate.NewWriter(buf, flate.DefaultCompression)
+		case "br":
+			w = brotli.NewWriter(buf)
+		case "zstd":
+			w, _ = zstd.NewWriter(buf)
+		}
+		w.Write(data)
+		w.Close()
+		return buf.Bytes()
+	}
+	// zstd frames concatenated, which should be decoded as a whole.
+	zstdFrames := append(encode("zstd", []byte(content[:10])), encode("zstd", []byte(content[10:]))...)
+	testCases := []struct {
+		encoding string
+		body     []byte
+	}{
+		{"gzip", encode("gzip", []byte(content))},
+		{"x-gzip", encode("gzip", []byte(content))},
+		{"deflate", encode("deflate", []byte(content))},
+		{"deflate", encode("raw-deflate", []byte(content))},
+		{"br", encode("br", []byte(content))},
+		{"zstd", encode("zstd", []byte(content))},
+		{"zstd", zstdFrames},
+		{"gzip, br", encode("br", encode("gzip", []byte(content)))},
+		{"identity", []byte(content)},
+	}
+	for _, tc := range testCases {
+		r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(tc.body))
+		r.Header.Set("Content-Encoding", tc.encoding)
+		body, err := DecodeRequestBody(r)
+		tests.AssertNoError(t, err)
+		tests.AssertEqual(t, content, string(body))
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(content))
+	r.Header.Set("Content-Encoding", "compress")
+	_, err := DecodeRequestBody(r)
+	tests.AssertErrorContains(t, err, `unsupported content encoding "compress"`)
+	r = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(content))
+	r.Header.Set("Content-Encoding", "zstd")
+	_, err = DecodeRequestBody(r)
+	tests.AssertErrorContains(t, err, "failed to decode zstd content")
+
+	var hits atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		body, err := DecodeRequestBody(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Write(body)
+	}))
+	defer ts.Close()
+	c := C().SetRequestCompressionVerify(true)
+	for _, encoding := range []string{"gzip", "br", "zstd"} {
+		resp, err := c.R().SetHeader("Content-Encoding", encoding).SetBody(encode(encoding, []byte(content))).Post(ts.URL)
+		assertSuccess(t, resp, err)
+		tests.AssertEqual(t, content, resp.String())
+	}
+	tests.AssertEqual(t, int32(3), hits.Load())
+	// gzip body with the mismatched header fails without being sent.
+	_, err = c.R().SetHeader("Content-Encoding", "br").SetBody(encode("gzip", []byte(content))).Post(ts.URL)
+	tests.AssertErrorContains(t, err, `request body does not match Content-Encoding "br"`)
+	tests.AssertEqual(t, int32(3), hits.Load())
+}
+
+func TestSetPriority(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	var mu sync.Mutex
+	var served []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/block" {
+			close(started)
+			<-release
+		}
+		mu.Lock()
+		served = append(served, r.URL.Path)
+		mu.Unlock()
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	c := C()
+	c.GetTransport().SetMaxConnsPerHost(1)
+	var wg sync.WaitGroup
+	send := func(path string, priority int) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := c.R().SetPriority(priority).Get(ts.URL + path)
+			assertSuccess(t, resp, err)
+		}()
+	}
+	waitQueued := func(priority, n int) {
+		for i := 0; c.GetTransport().ConnPoolStats().QueuedPerPriority[priority] != n; i++ {
+			if i > 500 {
+				t.Fatalf("%d requests of priority %d are not queued", n, priority)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	send("/block", 0)
+	<-started
+	send("/low1", 0)
+	waitQueued(0, 1)
+	send("/low2", 0)
+	waitQueued(0, 2)
+	send("/high", 5)
+	waitQueued(5, 1)
+	release <- struct{}{}
+	wg.Wait()
+	tests.AssertEqual(t, "/block,/high,/low1,/low2", strings.Join(served, ","))
+	tests.AssertEqual(t, 0, c.GetTransport().ConnPoolStats().QueuedPerPriority[0])
+
+	// the aging raises the priority of the request which waits long.
+	now := time.Now()
+	var q wantConnQueue
+	old := &wantConn{aging: time.Minute, queuedAt: now.Add(-10 * time.Minute)}
+	high := &wantConn{priority: 5, aging: time.Minute, queuedAt: now}
+	q.pushPriority(old)
+	q.pushPriority(high)
+	tests.AssertEqual(t, true, q.popFront() == old)
+	tests.AssertEqual(t, true, q.popFront() == high)
+	tests.AssertEqual(t, true, q.popFront() == nil)
+
+	// cleaning removes exactly the front wantConns which are not waiting.
+	waiting := &wantConn{aging: time.Minute, queuedAt: now}
+	done := &wantConn{priority: 5, aging: time.Minute, queuedAt: now, done: true}
+	q.pushPriority(waiting)
+	q.pushPriority(done)
+	tests.AssertEqual(t, true, q.cleanFrontNotWaiting())
+	tests.AssertEqual(t, 1, q.len())
+	tests.AssertEqual(t, true, q.peekFront() == waiting)
+	tests.AssertEqual(t, false, q.cleanFrontNotWaiting())
+}
+
+func TestEnableGzipIntegrityCheck(t *testing.T) {
+	gzipMember := func(s string) []byte {
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		w.Write([]byte(s))
+		w.Close()
+		return buf.Bytes()
+	}
+	valid := append(gzipMember(`["a",`), gzipMember(`"b"]`)...)
+	corrupted := bytes.Clone(valid)
+	corrupted[len(corrupted)-8] ^= 0xff
+	truncated := valid[:len(valid)-8]
+	bodies := map[string][]byte{"/valid": valid, "/corrupted": corrupted, "/truncated": truncated}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(bodies[r.URL.Path])
+	})
+	h1 := httptest.NewServer(handler)
+	defer h1.Close()
+	h2 := httptest.NewUnstartedServer(handler)
+	h2.EnableHTTP2 = true
+	h2.StartTLS()
+	defer h2.Close()
+
+	for _, url := range []string{h1.URL, h2.URL} {
+		c := tc().SetBaseURL(url)
+		var v []string
+		resp, err := c.R().EnableGzipIntegrityCheck().SetSuccessResult(&v).Get("/valid")
+		assertSuccess(t, resp, err)
+		tests.AssertEqual(t, []string{"a", "b"}, v)
+
+		_, err = c.R().EnableGzipIntegrityCheck().Get("/corrupted")
+		var ie *GzipIntegrityError
+		tests.AssertEqual(t, true, errors.As(err, &ie))
+		tests.AssertEqual(t, true, errors.Is(err, gzip.ErrChecksum))
+		tests.AssertEqual(t, 1, ie.Member)
+		tests.AssertEqual(t, false, ie.Truncated)
+		tests.AssertEqual(t, crc32.ChecksumIEEE([]byte(`"b"]`)), ie.ActualCRC)
+		tests.AssertEqual(t, ie.ActualCRC^0xff, ie.ExpectedCRC)
+		tests.AssertEqual(t, uint32(4), ie.ExpectedSize)
+
+		_, err = c.R().EnableGzipIntegrityCheck().Get("/truncated")
+		tests.AssertEqual(t, true, errors.As(err, &ie))
+		tests.AssertEqual(t, true, ie.Truncated)
+		tests.AssertEqual(t, true, errors.Is(err, io.ErrUnexpectedEOF))
+
+		// the streamed body is verified even if the array is decoded
+		// without reading to the end.
+		resp, err = c.R().EnableGzipIntegrityCheck().DisableAutoReadResponse().Get("/corrupted")
+		tests.AssertNoError(t, err)
+		err = IterateJSONArray(resp, "", func(s string) error { return nil })
+		tests.AssertEqual(t, true, errors.As(err, &ie))
+
+		// closing the body which is not read verifies the trailer.
+		resp, err = c.R().EnableGzipIntegrityCheck().DisableAutoReadResponse().Get("/corrupted")
+		tests.AssertNoError(t, err)
+		tests.AssertEqual(t, true, errors.As(resp.Body.Close(), &ie))
+		resp, err = c.R().EnableGzipIntegrityCheck().DisableAutoReadResponse().Get("/valid")
+		tests.AssertNoError(t, err)
+		tests.AssertNoError(t, resp.Body.Close())
+	}
+}
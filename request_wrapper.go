@@ -32,6 +32,12 @@ func SetOrderedFormData(kvs ...string) *Request {
 	return defaultClient.R().SetOrderedFormData(kvs...)
 }
 
+// SetOrderedFormDataKV is a global wrapper methods which delegated
+// to the default client, create a request and SetOrderedFormDataKV for request.
+func SetOrderedFormDataKV(kvs ...KV) *Request {
+	return defaultClient.R().SetOrderedFormDataKV(kvs...)
+}
+
 // SetFormDataAnyType is a global wrapper methods which delegated
 // to the default client, create a request and SetFormDataAnyType for request.
 func SetFormDataAnyType(data map[string]any) *Request {
@@ -50,6 +56,12 @@ func SetQueryString(query string) *Request {
 	return defaultClient.R().SetQueryString(query)
 }
 
+// SetRawQueryString is a global wrapper methods which delegated
+// to the default client, create a request and SetRawQueryString for request.
+func SetRawQueryString(query string) *Request {
+	return defaultClient.R().SetRawQueryString(query)
+}
+
 // SetQueryParamsFromValues is a global wrapper methods which delegated
 // to the default client, create a request and SetQueryParamsFromValues for request.
 func SetQueryParamsFromValues(params url.Values) *Request {
@@ -120,6 +132,12 @@ func SetErrorResult(error any) *Request {
 	return defaultClient.R().SetErrorResult(error)
 }
 
+// SetErrorBodyLimit is a global wrapper methods which delegated
+// to the default client, create a request and SetErrorBodyLimit for request.
+func SetErrorBodyLimit(n int) *Request {
+	return defaultClient.R().SetErrorBodyLimit(n)
+}
+
 // SetBearerAuthToken is a global wrapper methods which delegated
 // to the default client, create a request and SetBearerAuthToken for request.
 func SetBearerAuthToken(token string) *Request {
@@ -168,6 +186,12 @@ func SetOutputFile(file string) *Request {
 	return defaultClient.R().SetOutputFile(file)
 }
 
+// AddOutput is a global wrapper methods which delegated
+// to the default client, create a request and AddOutput for request.
+func AddOutput(output io.Writer) *Request {
+	return defaultClient.R().AddOutput(output)
+}
+
 // SetOutput is a global wrapper methods which delegated
 // to the default client, create a request and SetOutput for request.
 func SetOutput(output io.Writer) *Request {
@@ -342,6 +366,108 @@ func SetBodyXmlString(body string) *Request {
 	return defaultClient.R().SetBodyXmlString(body)
 }
 
+// SetBodyTemplate is a global wrapper methods which delegated
+// to the default client, create a request and SetBodyTemplate for request.
+func SetBodyTemplate(tmpl string, data any) *Request {
+	return defaultClient.R().SetBodyTemplate(tmpl, data)
+}
+
+// SetBodyJsonTemplate is a global wrapper methods which delegated
+// to the default client, create a request and SetBodyJsonTemplate for request.
+func SetBodyJsonTemplate(tmpl string, data any) *Request {
+	return defaultClient.R().SetBodyJsonTemplate(tmpl, data)
+}
+
+// SetBodyXmlTemplate is a global wrapper methods which delegated
+// to the default client, create a request and SetBodyXmlTemplate for request.
+func SetBodyXmlTemplate(tmpl string, data any) *Request {
+	return defaultClient.R().SetBodyXmlTemplate(tmpl, data)
+}
+
+// SetGraphQLQuery is a global wrapper methods which delegated
+// to the default client, create a request and SetGraphQLQuery for request.
+func SetGraphQLQuery(query string, variables map[string]any) *Request {
+	return defaultClient.R().SetGraphQLQuery(query, variables)
+}
+
+// SetGraphQLMutation is a global wrapper methods which delegated
+// to the default client, create a request and SetGraphQLMutation for request.
+func SetGraphQLMutation(mutation string, variables map[string]any) *Request {
+	return defaultClient.R().SetGraphQLMutation(mutation, variables)
+}
+
+// SetJSONRPC is a global wrapper methods which delegated
+// to the default client, create a request and SetJSONRPC for request.
+func SetJSONRPC(method string, params, id any) *Request {
+	return defaultClient.R().SetJSONRPC(method, params, id)
+}
+
+// SetJSONRPCBatch is a global wrapper methods which delegated
+// to the default client, create a request and SetJSONRPCBatch for request.
+func SetJSONRPCBatch(calls []JSONRPCCall) *Request {
+	return defaultClient.R().SetJSONRPCBatch(calls)
+}
+
+// SetGraphQLOperationName is a global wrapper methods which delegated
+// to the default client, create a request and SetGraphQLOperationName for request.
+func SetGraphQLOperationName(name string) *Request {
+	return defaultClient.R().SetGraphQLOperationName(name)
+}
+
+// EnableRawBody is a global wrapper methods which delegated
+// to the default client, create a request and EnableRawBody for request.
+func EnableRawBody(maxSize int64) *Request {
+	return defaultClient.R().EnableRawBody(maxSize)
+}
+
+// SetHost is a global wrapper methods which delegated
+// to the default client, create a request and SetHost for request.
+func SetHost(host string) *Request {
+	return defaultClient.R().SetHost(host)
+}
+
+// EnableHostOverrideAcrossRedirects is a global wrapper methods which delegated
+// to the default client, create a request and EnableHostOverrideAcrossRedirects for request.
+func EnableHostOverrideAcrossRedirects() *Request {
+	return defaultClient.R().EnableHostOverrideAcrossRedirects()
+}
+
+// DisableHostOverrideAcrossRedirects is a global wrapper methods which delegated
+// to the default client, create a request and DisableHostOverrideAcrossRedirects for request.
+func DisableHostOverrideAcrossRedirects() *Request {
+	return defaultClient.R().DisableHostOverrideAcrossRedirects()
+}
+
+// OnInformationalResponse is a global wrapper methods which delegated
+// to the default client, create a request and OnInformationalResponse for request.
+func OnInformationalResponse(fn func(status int, header http.Header)) *Request {
+	return defaultClient.R().OnInformationalResponse(fn)
+}
+
+// SetPrecondition is a global wrapper methods which delegated
+// to the default client, create a request and SetPrecondition for request.
+func SetPrecondition(fn func(ctx context.Context) error) *Request {
+	return defaultClient.R().SetPrecondition(fn)
+}
+
+// SetPaginateFunc is a global wrapper methods which delegated
+// to the default client, create a request and SetPaginateFunc for request.
+func SetPaginateFunc(fn PaginateFunc) *Request {
+	return defaultClient.R().SetPaginateFunc(fn)
+}
+
+// SetPaginateByLinkHeader is a global wrapper methods which delegated
+// to the default client, create a request and SetPaginateByLinkHeader for request.
+func SetPaginateByLinkHeader() *Request {
+	return defaultClient.R().SetPaginateByLinkHeader()
+}
+
+// SetMaxPages is a global wrapper methods which delegated
+// to the default client, create a request and SetMaxPages for request.
+func SetMaxPages(n int) *Request {
+	return defaultClient.R().SetMaxPages(n)
+}
+
 // SetBodyXmlBytes is a global wrapper methods which delegated
 // to the default client, create a request and SetBodyXmlBytes for request.
 func SetBodyXmlBytes(body []byte) *Request {
@@ -366,12 +492,24 @@ func SetContext(ctx context.Context) *Request {
 	return defaultClient.R().SetContext(ctx)
 }
 
+// SetAttemptContextFunc is a global wrapper methods which delegated
+// to the default client, create a request and SetAttemptContextFunc for request.
+func SetAttemptContextFunc(fn func(parent context.Context, attempt int) context.Context) *Request {
+	return defaultClient.R().SetAttemptContextFunc(fn)
+}
+
 // DisableTrace is a global wrapper methods which delegated
 // to the default client, create a request and DisableTrace for request.
 func DisableTrace() *Request {
 	return defaultClient.R().DisableTrace()
 }
 
+// EnableRawHeaders is a global wrapper methods which delegated
+// to the default client, create a request and EnableRawHeaders for request.
+func EnableRawHeaders() *Request {
+	return defaultClient.R().EnableRawHeaders()
+}
+
 // EnableTrace is a global wrapper methods which delegated
 // to the default client, create a request and EnableTrace for request.
 func EnableTrace() *Request {
@@ -402,12 +540,24 @@ func DisableForceMultipart() *Request {
 	return defaultClient.R().DisableForceMultipart()
 }
 
+// SetDumpTo is a global wrapper methods which delegated
+// to the default client, create a request and SetDumpTo for request.
+func SetDumpTo(output io.Writer) *Request {
+	return defaultClient.R().SetDumpTo(output)
+}
+
 // EnableDumpTo is a global wrapper methods which delegated
 // to the default client, create a request and EnableDumpTo for request.
 func EnableDumpTo(output io.Writer) *Request {
 	return defaultClient.R().EnableDumpTo(output)
 }
 
+// EnableDumpToBuffer is a global wrapper methods which delegated
+// to the default client, create a request and EnableDumpToBuffer for request.
+func EnableDumpToBuffer() *Request {
+	return defaultClient.R().EnableDumpToBuffer()
+}
+
 // EnableDumpToFile is a global wrapper methods which delegated
 // to the default client, create a request and EnableDumpToFile for request.
 func EnableDumpToFile(filename string) *Request {
@@ -474,6 +624,12 @@ func SetRetryInterval(getRetryIntervalFunc GetRetryIntervalFunc) *Request {
 	return defaultClient.R().SetRetryInterval(getRetryIntervalFunc)
 }
 
+// SetRetryIntervalFunc is a global wrapper methods which delegated
+// to the default client, create a request and SetRetryIntervalFunc for request.
+func SetRetryIntervalFunc(fn RetryIntervalFunc) *Request {
+	return defaultClient.R().SetRetryIntervalFunc(fn)
+}
+
 // SetRetryFixedInterval is a global wrapper methods which delegated
 // to the default client, create a request and SetRetryFixedInterval for request.
 func SetRetryFixedInterval(interval time.Duration) *Request {
@@ -510,6 +666,18 @@ func AddRetryCondition(condition RetryConditionFunc) *Request {
 	return defaultClient.R().AddRetryCondition(condition)
 }
 
+// AddRetryStatusCodes is a global wrapper methods which delegated
+// to the default client, create a request and AddRetryStatusCodes for request.
+func AddRetryStatusCodes(codes ...int) *Request {
+	return defaultClient.R().AddRetryStatusCodes(codes...)
+}
+
+// AddRetryStatusRange is a global wrapper methods which delegated
+// to the default client, create a request and AddRetryStatusRange for request.
+func AddRetryStatusRange(min, max int) *Request {
+	return defaultClient.R().AddRetryStatusRange(min, max)
+}
+
 // SetUploadCallback is a global wrapper methods which delegated
 // to the default client, create a request and SetUploadCallback for request.
 func SetUploadCallback(callback UploadCallback) *Request {
@@ -528,6 +696,12 @@ func SetDownloadCallback(callback DownloadCallback) *Request {
 	return defaultClient.R().SetDownloadCallback(callback)
 }
 
+// SetProgressWindow is a global wrapper methods which delegated
+// to the default client, create a request and SetProgressWindow for request.
+func SetProgressWindow(d time.Duration) *Request {
+	return defaultClient.R().SetProgressWindow(d)
+}
+
 // SetDownloadCallbackWithInterval is a global wrapper methods which delegated
 // to the default client, create a request and SetDownloadCallbackWithInterval for request.
 func SetDownloadCallbackWithInterval(callback DownloadCallback, minInterval time.Duration) *Request {
@@ -539,3 +713,123 @@ func SetDownloadCallbackWithInterval(callback DownloadCallback, minInterval time
 func EnableCloseConnection() *Request {
 	return defaultClient.R().EnableCloseConnection()
 }
+
+// SetAbsoluteURI is a global wrapper methods which delegated
+// to the default client, create a request and SetAbsoluteURI for request.
+func SetAbsoluteURI(enable bool) *Request {
+	return defaultClient.R().SetAbsoluteURI(enable)
+}
+
+// SetExpectedContentLength is a global wrapper methods which delegated
+// to the default client, create a request and SetExpectedContentLength for request.
+func SetExpectedContentLength(n int64) *Request {
+	return defaultClient.R().SetExpectedContentLength(n)
+}
+
+// SetExpectedDecompressedLength is a global wrapper methods which delegated
+// to the default client, create a request and SetExpectedDecompressedLength for request.
+func SetExpectedDecompressedLength(n int64) *Request {
+	return defaultClient.R().SetExpectedDecompressedLength(n)
+}
+
+// SetResponseHeaderTimeout is a global wrapper methods which delegated
+// to the default client, create a request and SetResponseHeaderTimeout for request.
+func SetResponseHeaderTimeout(d time.Duration) *Request {
+	return defaultClient.R().SetResponseHeaderTimeout(d)
+}
+
+// SetHeaderTimeout is a global wrapper methods which delegated
+// to the default client, create a request and SetHeaderTimeout for request.
+func SetHeaderTimeout(d time.Duration) *Request {
+	return defaultClient.R().SetHeaderTimeout(d)
+}
+
+// SetBodyIdleTimeout is a global wrapper methods which delegated
+// to the default client, create a request and SetBodyIdleTimeout for request.
+func SetBodyIdleTimeout(d time.Duration) *Request {
+	return defaultClient.R().SetBodyIdleTimeout(d)
+}
+
+// SetForwardedFor is a global wrapper methods which delegated
+// to the default client, create a request and SetForwardedFor for request.
+func SetForwardedFor(clientIP string) *Request {
+	return defaultClient.R().SetForwardedFor(clientIP)
+}
+
+// EnableForwardedHeader is a global wrapper methods which delegated
+// to the default client, create a request and EnableForwardedHeader for request.
+func EnableForwardedHeader(proto, host string) *Request {
+	return defaultClient.R().EnableForwardedHeader(proto, host)
+}
+
+// EnableUnbufferedBody is a global wrapper methods which delegated
+// to the default client, create a request and EnableUnbufferedBody for request.
+func EnableUnbufferedBody() *Request {
+	return defaultClient.R().EnableUnbufferedBody()
+}
+
+// SetFormDataNested is a global wrapper methods which delegated
+// to the default client, create a request and SetFormDataNested for request.
+func SetFormDataNested(data map[string]any) *Request {
+	return defaultClient.R().SetFormDataNested(data)
+}
+
+// AllowBodyOnMethod is a global wrapper methods which delegated
+// to the default client, create a request and AllowBodyOnMethod for request.
+func AllowBodyOnMethod(allow bool) *Request {
+	return defaultClient.R().AllowBodyOnMethod(allow)
+}
+
+// SetFormDataEncoded is a global wrapper methods which delegated
+// to the default client, create a request and SetFormDataEncoded for request.
+func SetFormDataEncoded(field string, value []byte, enc FieldEncoding) *Request {
+	return defaultClient.R().SetFormDataEncoded(field, value, enc)
+}
+
+// EnableEarlyResponse is a global wrapper methods which delegated
+// to the default client, create a request and EnableEarlyResponse for request.
+func EnableEarlyResponse() *Request {
+	return defaultClient.R().EnableEarlyResponse()
+}
+
+// SetPriority is a global wrapper methods which delegated
+// to the default client, create a request and SetPriority for request.
+func SetPriority(p int) *Request {
+	return defaultClient.R().SetPriority(p)
+}
+
+// SetMultipartBoundary is a global wrapper methods which delegated
+// to the default client, create a request and SetMultipartBoundary for request.
+func SetMultipartBoundary(boundary string) *Request {
+	return defaultClient.R().SetMultipartBoundary(boundary)
+}
+
+// SetMultipartOrder is a global wrapper methods which delegated
+// to the default client, create a request and SetMultipartOrder for request.
+func SetMultipartOrder(fieldNames ...string) *Request {
+	return defaultClient.R().SetMultipartOrder(fieldNames...)
+}
+
+// EnableWireHashing is a global wrapper methods which delegated
+// to the default client, create a request and EnableWireHashing for request.
+func EnableWireHashing(algo string) *Request {
+	return defaultClient.R().EnableWireHashing(algo)
+}
+
+// SetMultipartMixed is a global wrapper methods which delegated
+// to the default client, create a request and SetMultipartMixed for request.
+func SetMultipartMixed(parts ...MixedPart) *Request {
+	return defaultClient.R().SetMultipartMixed(parts...)
+}
+
+// EnableGzipIntegrityCheck is a global wrapper methods which delegated
+// to the default client, create a request and EnableGzipIntegrityCheck for request.
+func EnableGzipIntegrityCheck() *Request {
+	return defaultClient.R().EnableGzipIntegrityCheck()
+}
+
+// DisableGzipIntegrityCheck is a global wrapper methods which delegated
+// to the default client, create a request and DisableGzipIntegrityCheck for request.
+func DisableGzipIntegrityCheck() *Request {
+	return defaultClient.R().DisableGzipIntegrityCheck()
+}
@@ -0,0 +1,135 @@
+package req
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/imroc/req/v3/internal/dump"
+	"github.com/imroc/req/v3/internal/util"
+)
+
+// DefaultRequestIDHeader is the default header name which the request ID is
+// injected as, see Client.EnableRequestIDHeader.
+const DefaultRequestIDHeader = "X-Request-ID"
+
+// EnableRequestID enables generating the ID of each logical request, which
+// is shared by the retries and redirects of the request, and is exposed by
+// Request.RequestID and Response.RequestID, and is written before the debug
+// logs and dumps of the request, which can be used to correlate the dumps,
+// debug logs and hooks of the same request.
+func (c *Client) EnableRequestID() *Client {
+	c.requestIDEnabled = true
+	return c
+}
+
+// DisableRequestID disables generating the ID of each logical request
+// (default), it's still generated if EnableRequestIDHeader is set.
+func (c *Client) DisableRequestID() *Client {
+	c.requestIDEnabled = false
+	return c
+}
+
+// SetRequestIDFunc set the function which generates the ID of each logical
+// request, default generates a ULID, it enables the request ID if fn is not
+// nil, see EnableRequestID.
+func (c *Client) SetRequestIDFunc(fn func() string) *Client {
+	c.requestIDFunc = fn
+	if fn != nil {
+		c.requestIDEnabled = true
+	}
+	return c
+}
+
+// EnableRequestIDHeader enables injecting the request ID as the outgoing
+// header with the name ("X-Request-ID" if empty), which generates the request
+// ID even if EnableRequestID is not set. If the header is already present on
+// the request, its value is reused as the request ID rather than being
+// overwritten.
+func (c *Client) EnableRequestIDHeader(name string) *Client {
+	if name == "" {
+		name = DefaultRequestIDHeader
+	}
+	c.requestIDHeader = name
+	return c
+}
+
+// DisableRequestIDHeader disables injecting the request ID as the outgoing
+// header (default).
+func (c *Client) DisableRequestIDHeader() *Client {
+	c.requestIDHeader = ""
+	return c
+}
+
+// RequestID returns the ID of the logical request, which is generated when
+// the request is sent, it's empty if the request ID is not enabled, see
+// Client.EnableRequestID.
+func (r *Request) RequestID() string {
+	return r.requestID
+}
+
+// RequestID returns the ID of the logical request of the response, see
+// Client.EnableRequestID.
+func (r *Response) RequestID() string {
+	if r.Request == nil {
+		return ""
+	}
+	return r.Request.RequestID()
+}
+
+// initRequestID generates the ID of the logical request if enabled and not
+// yet, or reuses the ID header which is already present on the request.
+func (r *Request) initRequestID() {
+	c := r.client
+	if r.requestID != "" || (!c.requestIDEnabled && c.requestIDHeader == "") {
+		return
+	}
+	if name := c.requestIDHeader; name != "" {
+		id := r.Headers.Get(name)
+		if id == "" {
+			id = c.Headers.Get(name)
+		}
+		if id != "" {
+			r.requestID = id
+			return
+		}
+	}
+	if c.requestIDFunc != nil {
+		r.requestID = c.requestIDFunc()
+	} else {
+		r.requestID = util.NewULID(c.getRand())
+	}
+	if name := c.requestIDHeader; name != "" {
+		r.SetHeader(name, r.requestID)
+	}
+}
+
+// requestLabel returns the request ID with the retry attempt suffix if it is
+// a retry, e.g. "01J5R6Y3ZJ0E8F5Q9W2K4X7M1N#1".
+func (r *Request) requestLabel() string {
+	if r.RetryAttempt > 0 {
+		return fmt.Sprintf("%s#%d", r.requestID, r.RetryAttempt)
+	}
+	return r.requestID
+}
+
+func requestLabelFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	label, _ := ctx.Value(requestIDKey).(string)
+	return label
+}
+
+// dumpRequestID writes the request label before the dump of each hop of the
+// request, so that the dump sections can be correlated with the request.
+func (c *Client) dumpRequestID(ctx context.Context) {
+	label := requestLabelFromContext(ctx)
+	if label == "" {
+		return
+	}
+	for _, d := range dump.GetDumpers(ctx, c.Dump) {
+		if d.RequestHeader() || d.RequestBody() || d.ResponseHeader() || d.ResponseBody() {
+			d.DumpDefault([]byte("* request-id: " + label + "\r\n"))
+		}
+	}
+}
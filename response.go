@@ -1,12 +1,19 @@
 package req
 
 import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/imroc/req/v3/internal/header"
+	"github.com/imroc/req/v3/internal/transport"
 	"github.com/imroc/req/v3/internal/util"
 )
 
@@ -19,11 +26,19 @@ type Response struct {
 	// ResponseMiddleware that doesn't need to be executed when err occurs.
 	Err error
 	// Request is the Response's related Request.
-	Request    *Request
-	body       []byte
-	receivedAt time.Time
-	error      any
-	result     any
+	Request     *Request
+	ctx         context.Context // the context of the attempt.
+	body        []byte
+	spilled     *spilledBody
+	receivedAt  time.Time
+	rawHeaders  transport.RawHeaders
+	rawBody     *rawBodyCapture
+	record      *roundTripRecord
+	cacheStatus CacheStatus
+	error       any
+	result      any
+
+	errorBodySnippet string
 }
 
 // IsSuccess method returns true if no error occurs and HTTP status `code >= 200 and <= 299`
@@ -122,11 +137,112 @@ func (r *Response) ErrorResult() any {
 	return r.error
 }
 
+// ErrorBodySnippet returns the leading bytes of the raw response body (up to the
+// limit set by Client.SetCommonErrorBodyLimit or Request.SetErrorBodyLimit)
+// when the response is in ErrorState and the body was not unmarshalled into the
+// error result, either because its `Content-Type` has no registered decoder
+// (e.g. an HTML error page returned by a proxy) or because unmarshalling failed.
+// Otherwise, return "".
+func (r *Response) ErrorBodySnippet() string {
+	return r.errorBodySnippet
+}
+
 // TraceInfo returns the TraceInfo from Request.
 func (r *Response) TraceInfo() TraceInfo {
 	return r.Request.TraceInfo()
 }
 
+// Protocol returns the negotiated protocol of the response, which is
+// "HTTP/1.1" (or "HTTP/1.0"), "h2" or "h3", and is the protocol of the
+// final hop if redirected. Returns empty string if there is no response.
+func (r *Response) Protocol() string {
+	if r.Response == nil {
+		return ""
+	}
+	switch r.ProtoMajor {
+	case 2:
+		return "h2"
+	case 3:
+		return "h3"
+	}
+	return r.Proto
+}
+
+// connInfo returns the connection of the final hop recorded by the
+// transports.
+func (r *Response) connInfo() transport.ConnInfo {
+	if r.record == nil {
+		return transport.ConnInfo{}
+	}
+	return r.record.connInfo
+}
+
+// ConnReused reports whether the connection of the response (the final hop
+// if redirected) has been previously used for another request.
+func (r *Response) ConnReused() bool {
+	return r.connInfo().Reused
+}
+
+// LocalAddr returns the local address of the connection of the response
+// (the final hop if redirected), could be nil if no connection was obtained.
+func (r *Response) LocalAddr() net.Addr {
+	return r.connInfo().LocalAddr
+}
+
+// RemoteAddr returns the remote address of the connection of the response
+// (the final hop if redirected), could be nil if no connection was obtained.
+func (r *Response) RemoteAddr() net.Addr {
+	return r.connInfo().RemoteAddr
+}
+
+// RawHeaders returns the header fields of the response (the final hop if
+// redirected) in the received order, the duplicate fields are kept as is.
+// In HTTP/1.x, the keys are in their original case as sent on the wire, and
+// the values are the raw values with leading spaces trimmed. In HTTP/2 and
+// HTTP/3, the keys are lowercase which is required by the protocol, the
+// pseudo-headers (e.g. ":status") are excluded, and the order is the order
+// of the decoded fields of the HEADERS frame. Returns nil if no header is
+// received, and the trailers are not included. It's only recorded if enabled
+// by Client.EnableRawHeadersAll or Request.EnableRawHeaders.
+func (r *Response) RawHeaders() []KV {
+	if len(r.rawHeaders.Fields) == 0 {
+		return nil
+	}
+	headers := make([]KV, len(r.rawHeaders.Fields))
+	for i, f := range r.rawHeaders.Fields {
+		headers[i] = KV{Key: f.Key, Value: f.Value}
+	}
+	return headers
+}
+
+// HeaderOrder returns the canonical keys of the response header in the order
+// of their first occurrence in RawHeaders, without duplicates.
+func (r *Response) HeaderOrder() []string {
+	if len(r.rawHeaders.Fields) == 0 {
+		return nil
+	}
+	var keys []string
+	seen := make(map[string]bool, len(r.rawHeaders.Fields))
+	for _, f := range r.rawHeaders.Fields {
+		key := http.CanonicalHeaderKey(f.Key)
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// TLSConnectionState returns the TLS connection state of the response (the
+// final hop if redirected), which contains the TLS version and cipher suite,
+// it's nil if the response was not received over TLS.
+func (r *Response) TLSConnectionState() *tls.ConnectionState {
+	if r.Response == nil {
+		return nil
+	}
+	return r.TLS
+}
+
 // TotalTime returns the total time of the request, from request we sent to response we received.
 func (r *Response) TotalTime() time.Duration {
 	if r.Request.trace != nil {
@@ -155,11 +271,7 @@ func (r *Response) UnmarshalJson(v any) error {
 	if r.Err != nil {
 		return r.Err
 	}
-	b, err := r.ToBytes()
-	if err != nil {
-		return err
-	}
-	return r.Request.client.jsonUnmarshal(b, v)
+	return r.unmarshalJson(v)
 }
 
 // UnmarshalXml unmarshalls XML response body into the specified object.
@@ -167,11 +279,7 @@ func (r *Response) UnmarshalXml(v any) error {
 	if r.Err != nil {
 		return r.Err
 	}
-	b, err := r.ToBytes()
-	if err != nil {
-		return err
-	}
-	return r.Request.client.xmlUnmarshal(b, v)
+	return r.unmarshalXml(v)
 }
 
 // Unmarshal unmarshalls response body into the specified object according
@@ -196,6 +304,47 @@ func (r *Response) Into(v any) error {
 	return r.Unmarshal(v)
 }
 
+// UnmarshalInto unmarshalls response body into each of the specified objects
+// in turn according to response `Content-Type`, e.g. decode the data and the
+// metadata at the top level into different structs instead of a giant one.
+// The body is read once and buffered, so it only works if the body has not
+// been consumed elsewhere (e.g. Request.SetOutput), the configured decoder
+// of the client is used.
+func (r *Response) UnmarshalInto(targets ...any) error {
+	for _, v := range targets {
+		if err := r.Unmarshal(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UnmarshalField unmarshalls a single top-level field of the JSON response
+// body into the specified object, returns an error if the field does not
+// exist. Like UnmarshalInto, it only works if the body has not been consumed
+// elsewhere, the configured JSON decoder of the client is used.
+func (r *Response) UnmarshalField(field string, v any) error {
+	if r.Err != nil {
+		return r.Err
+	}
+	if util.IsXMLType(r.GetContentType()) {
+		return errors.New("req: UnmarshalField only supports JSON body")
+	}
+	b, err := r.ToBytes()
+	if err != nil {
+		return err
+	}
+	var fields map[string]json.RawMessage
+	if err = r.Request.client.jsonUnmarshal(b, &fields); err != nil {
+		return err
+	}
+	raw, ok := fields[field]
+	if !ok {
+		return fmt.Errorf("req: field %q not found in response body", field)
+	}
+	return r.Request.client.jsonUnmarshal(raw, util.GetPointer(v))
+}
+
 // Set response body with byte array content
 func (r *Response) SetBody(body []byte) {
 	r.body = body
@@ -210,18 +359,39 @@ func (r *Response) SetBodyString(body string) {
 // nil if not read, the following cases are already read:
 //  1. `Request.SetResult` or `Request.SetError` is called.
 //  2. `Client.DisableAutoReadResponse` and `Request.DisableAutoReadResponse` is not
-//     called, and also `Request.SetOutput` and `Request.SetOutputFile` is not called.
+//     called, and also `Request.SetOutput`, `Request.SetOutputFile` and
+//     `Request.AddOutput` is not called, use `Request.AddOutput` with a
+//     bytes.Buffer to keep a copy of the body if needed when downloading.
+//
+// The body spilled to a temp file (see Client.SetBodySpillThreshold) is read
+// from the file on each call, up to the first 16MB, use ToBytes or
+// BodyReader to read the whole body.
 func (r *Response) Bytes() []byte {
+	if r.spilled != nil {
+		b, _ := io.ReadAll(io.LimitReader(r.spilled.reader(), maxSpilledBytes))
+		return b
+	}
 	return r.body
 }
 
+// maxSpilledBytes is the max size of the spilled body read by Bytes and
+// String.
+const maxSpilledBytes = 16 << 20
+
 // String returns the response body as string that have already been read, could be
 // nil if not read, the following cases are already read:
 //  1. `Request.SetResult` or `Request.SetError` is called.
 //  2. `Client.DisableAutoReadResponse` and `Request.DisableAutoReadResponse` is not
 //     called, and also `Request.SetOutput` and `Request.SetOutputFile` is not called.
+//
+// It is the message of ErrUnbufferedBody with `Request.EnableUnbufferedBody`,
+// since the body is never read, use `Response.ToString` to get the error
+// itself. The spilled body is read in the same way as Bytes.
 func (r *Response) String() string {
-	return string(r.body)
+	if r.Request != nil && r.Request.unbufferedBody && r.Err == nil {
+		return ErrUnbufferedBody.Error()
+	}
+	return string(r.Bytes())
 }
 
 // ToString returns the response body as string, read body if not have been read.
@@ -230,38 +400,53 @@ func (r *Response) ToString() (string, error) {
 	return string(b), err
 }
 
+// ErrUnbufferedBody is returned when reading the response body of a request
+// with Request.EnableUnbufferedBody, use Response.UnbufferedBody instead.
+var ErrUnbufferedBody = errors.New("req: the response body is unbuffered, read it from Response.UnbufferedBody")
+
+// UnbufferedBody returns the response body of a request with
+// Request.EnableUnbufferedBody, which is streamed from the connection and
+// must be closed by the caller, could be nil if there is no response.
+func (r *Response) UnbufferedBody() io.ReadCloser {
+	if r.Response == nil {
+		return nil
+	}
+	return r.Body
+}
+
 // ToBytes returns the response body as []byte, read body if not have been read.
+// The body spilled to a temp file (see Client.SetBodySpillThreshold) is loaded
+// into memory on each call, use BodyReader to avoid it.
 func (r *Response) ToBytes() (body []byte, err error) {
 	if r.Err != nil {
 		return nil, r.Err
 	}
-	if r.body != nil {
-		return r.body, nil
+	if err = r.readBody(); err != nil {
+		return r.body, err
 	}
-	if r.Response == nil || r.Response.Body == nil {
-		return []byte{}, nil
+	if r.spilled != nil {
+		return io.ReadAll(r.spilled.reader())
 	}
-	defer func() {
-		r.Body.Close()
-		if err != nil {
-			r.Err = err
-		}
-		r.body = body
-	}()
-	body, err = io.ReadAll(r.Body)
-	r.setReceivedAt()
-	if err == nil && r.Request.client.responseBodyTransformer != nil {
-		body, err = r.Request.client.responseBodyTransformer(body, r.Request, r)
+	if r.body == nil {
+		return []byte{}, nil
 	}
-	return
+	return r.body, nil
 }
 
 // Dump return the string content that have been dumped for the request.
-// `Request.Dump` or `Request.DumpXXX` MUST have been called.
+// `Request.EnableDump`, `Request.EnableDumpToBuffer` or `Request.EnableDumpXXX`
+// MUST have been called, and the dump is not written to other outputs.
 func (r *Response) Dump() string {
 	return r.Request.getDumpBuffer().String()
 }
 
+// Dumps returns the dump of the request segmented by the attempts and
+// redirect hops (see DumpOptions.Attempts), the concatenated content of
+// which is the same as Dump, the same requirements of Dump apply.
+func (r *Response) Dumps() []AttemptDump {
+	return r.Request.getDumpBuffer().attemptDumps()
+}
+
 // GetStatus returns the response status.
 func (r *Response) GetStatus() string {
 	if r.Response == nil {
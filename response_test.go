@@ -0,0 +1,946 @@
+package req
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"net/url"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/imroc/req/v3/internal/testcert"
+	"github.com/imroc/req/v3/internal/tests"
+	"github.com/quic-go/quic-go/http3"
+)
+
+func startHTTP3TestServer(t *testing.T) (string, func()) {
+	return startHTTP3TestServerWithHandler(t, http.HandlerFunc(handleHTTP))
+}
+
+func startHTTP3TestServerWithHandler(t *testing.T, handler http.Handler) (string, func()) {
+	cert, err := tls.X509KeyPair(testcert.LocalhostCert, testcert.LocalhostKey)
+	tests.AssertNoError(t, err)
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	tests.AssertNoError(t, err)
+	server := &http3.Server{
+		Handler:   handler,
+		TLSConfig: http3.ConfigureTLSConfig(&tls.Config{Certificates: []tls.Certificate{cert}}),
+	}
+	go server.Serve(conn)
+	return "https://" + conn.LocalAddr().String(), func() {
+		server.Close()
+		conn.Close()
+	}
+}
+
+func testResponseConnInfo(t *testing.T, c *Client, protocol string) {
+	resp, err := c.R().Get("/")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, protocol, resp.Protocol())
+	tests.AssertEqual(t, false, resp.ConnReused())
+	tests.AssertNotNil(t, resp.LocalAddr())
+	tests.AssertNotNil(t, resp.RemoteAddr())
+	tests.AssertEqual(t, c.BaseURL, "https://"+resp.RemoteAddr().String())
+	tests.AssertNotNil(t, resp.TLSConnectionState())
+	tests.AssertEqual(t, true, resp.TLSConnectionState().Version >= tls.VersionTLS12)
+	tests.AssertEqual(t, true, resp.TLSConnectionState().CipherSuite != 0)
+
+	resp, err = c.R().Get("/")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, true, resp.ConnReused())
+
+	// reports the final hop of redirects.
+	resp, err = c.R().Post("/redirect")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, "/", resp.Response.Request.URL.Path)
+	tests.AssertEqual(t, protocol, resp.Protocol())
+	tests.AssertNotNil(t, resp.RemoteAddr())
+}
+
+func TestResponseConnInfo(t *testing.T) {
+	t.Run("h1", func(t *testing.T) {
+		testResponseConnInfo(t, tc().EnableForceHTTP1(), "HTTP/1.1")
+	})
+	t.Run("h2", func(t *testing.T) {
+		testResponseConnInfo(t, tc().EnableForceHTTP2(), "h2")
+	})
+	t.Run("h3", func(t *testing.T) {
+		url, stop := startHTTP3TestServer(t)
+		defer stop()
+		testResponseConnInfo(t, C().SetBaseURL(url).EnableInsecureSkipVerify().EnableForceHTTP3(), "h3")
+	})
+
+	resp := &Response{}
+	tests.AssertEqual(t, "", resp.Protocol())
+	tests.AssertIsNil(t, resp.TLSConnectionState())
+	tests.AssertIsNil(t, resp.RemoteAddr())
+}
+
+func testRawHeaders(t *testing.T, c *Client, lowercase bool) {
+	resp, err := c.R().Get("/duplicate-headers")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, []string{"a", "b"}, resp.GetHeaderValues("X-Dup"))
+
+	var dups, warnings []string
+	for _, h := range resp.RawHeaders() {
+		tests.AssertEqual(t, lowercase, h.Key == strings.ToLower(h.Key))
+		switch http.CanonicalHeaderKey(h.Key) {
+		case "X-Dup":
+			dups = append(dups, h.Value)
+		case "Warning":
+			warnings = append(warnings, h.Value)
+		}
+	}
+	tests.AssertEqual(t, []string{"a", "b"}, dups)
+	tests.AssertEqual(t, []string{`199 - "first"`, `199 - "second"`}, warnings)
+
+	order := resp.HeaderOrder()
+	tests.AssertEqual(t, len(resp.Header), len(order))
+	tests.AssertEqual(t, 1, strings.Count(strings.Join(order, ","), "X-Dup"))
+}
+
+func TestRawHeaders(t *testing.T) {
+	t.Run("h1", func(t *testing.T) {
+		testRawHeaders(t, tc().EnableForceHTTP1().EnableRawHeadersAll(), false)
+	})
+	t.Run("h2", func(t *testing.T) {
+		testRawHeaders(t, tc().EnableForceHTTP2().EnableRawHeadersAll(), true)
+	})
+	t.Run("h3", func(t *testing.T) {
+		url, stop := startHTTP3TestServer(t)
+		defer stop()
+		testRawHeaders(t, C().SetBaseURL(url).EnableInsecureSkipVerify().EnableForceHTTP3().EnableRawHeadersAll(), true)
+	})
+
+	// the raw headers are only recorded if enabled.
+	resp, err := tc().R().Get("/duplicate-headers")
+	assertSuccess(t, resp, err)
+	tests.AssertIsNil(t, resp.RawHeaders())
+	resp, err = tc().R().EnableRawHeaders().Get("/duplicate-headers")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, true, len(resp.RawHeaders()) > 0)
+
+	resp = &Response{}
+	tests.AssertIsNil(t, resp.RawHeaders())
+	tests.AssertIsNil(t, resp.HeaderOrder())
+}
+
+func testRawBody(t *testing.T, c *Client) {
+	// auto-decompressed by default.
+	resp, err := c.R().Get("/compressed")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, "hello compressed", resp.String())
+	tests.AssertEqual(t, "gzip", resp.GetHeader("X-Accept-Encoding"))
+	tests.AssertIsNil(t, resp.RawBody())
+
+	// capture the raw body while auto-decompressing.
+	resp, err = c.R().EnableRawBody(1024).Get("/compressed")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, "hello compressed", resp.String())
+	tests.AssertEqual(t, "", resp.GetHeader("Content-Encoding"))
+	gr, err := gzip.NewReader(resp.RawBody())
+	tests.AssertNoError(t, err)
+	b, err := io.ReadAll(gr)
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, "hello compressed", string(b))
+
+	resp, err = c.R().EnableRawBody(5).Get("/compressed")
+	assertSuccess(t, resp, err)
+	b, err = io.ReadAll(resp.RawBody())
+	tests.AssertEqual(t, ErrRawBodyTooLarge, err)
+	tests.AssertEqual(t, 5, len(b))
+
+	// body and headers are left untouched.
+	resp, err = c.R().DisableAutoDecode().SetHeader("Accept-Encoding", "gzip").Get("/compressed")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, "gzip", resp.GetHeader("X-Accept-Encoding"))
+	tests.AssertEqual(t, "gzip", resp.GetHeader("Content-Encoding"))
+	tests.AssertEqual(t, strconv.Itoa(len(resp.Bytes())), resp.GetHeader("Content-Length"))
+	raw, err := io.ReadAll(resp.RawBody())
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, resp.Bytes(), raw)
+	gr, err = gzip.NewReader(bytes.NewReader(raw))
+	tests.AssertNoError(t, err)
+	b, err = io.ReadAll(gr)
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, "hello compressed", string(b))
+
+	// Accept-Encoding is not added automatically.
+	resp, err = c.R().DisableAutoDecode().Get("/compressed")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, "", resp.GetHeader("X-Accept-Encoding"))
+	tests.AssertEqual(t, "hello compressed", resp.String())
+}
+
+func TestRawBody(t *testing.T) {
+	t.Run("h1", func(t *testing.T) {
+		testRawBody(t, tc().EnableForceHTTP1())
+	})
+	t.Run("h2", func(t *testing.T) {
+		testRawBody(t, tc().EnableForceHTTP2())
+	})
+	t.Run("h3", func(t *testing.T) {
+		url, stop := startHTTP3TestServer(t)
+		defer stop()
+		testRawBody(t, C().SetBaseURL(url).EnableInsecureSkipVerify().EnableForceHTTP3())
+	})
+}
+
+func TestUnmarshalInto(t *testing.T) {
+	c := tc()
+	resp, err := c.R().Get("/json")
+	assertSuccess(t, resp, err)
+	type User struct {
+		Name string `json:"name"`
+	}
+	var user User
+	var m map[string]any
+	tests.AssertNoError(t, resp.UnmarshalInto(&user, &m))
+	tests.AssertEqual(t, "roc", user.Name)
+	tests.AssertEqual(t, "roc", m["name"])
+
+	resp.SetBodyString(`{"data": {"name": "roc"}, "meta": {"total": 2}}`)
+	var meta struct {
+		Total int `json:"total"`
+	}
+	user = User{}
+	tests.AssertNoError(t, resp.UnmarshalField("data", &user))
+	tests.AssertNoError(t, resp.UnmarshalField("meta", &meta))
+	tests.AssertEqual(t, "roc", user.Name)
+	tests.AssertEqual(t, 2, meta.Total)
+	tests.AssertErrorContains(t, resp.UnmarshalField("none", &meta), `field "none" not found`)
+
+	resp, err = c.R().Get("/xml")
+	assertSuccess(t, resp, err)
+	tests.AssertErrorContains(t, resp.UnmarshalField("name", &user), "only supports JSON")
+}
+
+func TestUnmarshalForm(t *testing.T) {
+	c := tc()
+	resp, err := c.R().Get("/form-urlencoded")
+	assertSuccess(t, resp, err)
+
+	var form struct {
+		Name    string   `form:"name"`
+		Age     int      `form:"age"`
+		Tags    []string `form:"tags"`
+		Score   *float64 `form:"score"`
+		Active  bool     `form:"active"`
+		Ignored string   `form:"-"`
+		Missing string   `form:"missing"`
+	}
+	tests.AssertNoError(t, resp.UnmarshalForm(&form))
+	tests.AssertEqual(t, "roc", form.Name)
+	tests.AssertEqual(t, 18, form.Age)
+	tests.AssertEqual(t, []string{"a", "b"}, form.Tags)
+	tests.AssertNotNil(t, form.Score)
+	tests.AssertEqual(t, 9.5, *form.Score)
+	tests.AssertEqual(t, true, form.Active)
+	tests.AssertEqual(t, "", form.Ignored)
+	tests.AssertEqual(t, "", form.Missing)
+
+	var values url.Values
+	tests.AssertNoError(t, resp.UnmarshalForm(&values))
+	tests.AssertEqual(t, []string{"a", "b"}, values["tags"])
+	var m map[string]string
+	tests.AssertNoError(t, resp.UnmarshalForm(&m))
+	tests.AssertEqual(t, "a", m["tags"])
+
+	var bad struct {
+		Name int `form:"name"`
+	}
+	tests.AssertErrorContains(t, resp.UnmarshalForm(&bad), `field "name"`)
+	tests.AssertErrorContains(t, resp.UnmarshalForm(form), "requires a non-nil pointer")
+}
+
+func TestUnbufferedBody(t *testing.T) {
+	testWithAllTransport(t, testUnbufferedBody)
+}
+
+func testUnbufferedBody(t *testing.T, c *Client) {
+	buf := new(bytes.Buffer)
+	c.EnableDumpAllTo(buf).SetCommonErrorResult(&struct{}{})
+	var result struct {
+		Name string `json:"name"`
+	}
+	resp, err := c.R().EnableUnbufferedBody().SetSuccessResult(&result).Get("/chunked-size?size=10000")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, ErrUnbufferedBody.Error(), resp.String())
+	tests.AssertIsNil(t, resp.Bytes())
+	_, err = resp.ToString()
+	tests.AssertEqual(t, ErrUnbufferedBody, err)
+	tests.AssertEqual(t, ErrUnbufferedBody, resp.Unmarshal(&result))
+	b, err := io.ReadAll(resp.UnbufferedBody())
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, strings.Repeat("h", 10000), string(b))
+	tests.AssertNoError(t, resp.UnbufferedBody().Close())
+	tests.AssertContains(t, buf.String(), "/chunked-size?size=10000", true)
+	tests.AssertEqual(t, false, strings.Contains(buf.String(), "hhhh"))
+
+	// no charset decode.
+	resp, err = c.R().EnableUnbufferedBody().Get("/gbk")
+	assertSuccess(t, resp, err)
+	b, err = io.ReadAll(resp.UnbufferedBody())
+	resp.UnbufferedBody().Close()
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, toGbk("我是roc"), b)
+
+	// the error result is not unmarshalled.
+	resp, err = c.R().EnableUnbufferedBody().Get("/bad-request")
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, http.StatusBadRequest, resp.StatusCode)
+	tests.AssertIsNil(t, resp.ErrorResult())
+	resp.UnbufferedBody().Close()
+}
+
+func BenchmarkUnbufferedBody(b *testing.B) {
+	for _, size := range []int{1 << 10, 1 << 20} {
+		body := bytes.Repeat([]byte("h"), size)
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Length", strconv.Itoa(size))
+			w.Write(body)
+		}))
+		c := C()
+		b.Run(strconv.Itoa(size), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				resp, err := c.R().EnableUnbufferedBody().Get(ts.URL)
+				if err != nil {
+					b.Fatal(err)
+				}
+				io.Copy(io.Discard, resp.UnbufferedBody())
+				resp.UnbufferedBody().Close()
+			}
+		})
+		ts.Close()
+	}
+}
+
+func TestResponseDiscard(t *testing.T) {
+	testWithAllTransport(t, func(t *testing.T, c *Client) {
+		c.DisableAutoReadResponse()
+		resp, err := c.R().Get("/bytes?n=100")
+		assertSuccess(t, resp, err)
+		tests.AssertNoError(t, resp.Discard())
+		resp, err = c.R().Get("/bytes?n=100")
+		assertSuccess(t, resp, err)
+		tests.AssertEqual(t, true, resp.ConnReused())
+		tests.AssertEqual(t, ResponseDrainStats{Drained: 1}, c.GetResponseDrainStats())
+
+		// the large body is closed.
+		tests.AssertNoError(t, resp.Discard())
+		resp, err = c.SetResponseDrainLimit(10).R().Get("/bytes?n=100")
+		assertSuccess(t, resp, err)
+		tests.AssertNoError(t, resp.Discard())
+		tests.AssertEqual(t, ResponseDrainStats{Drained: 2, Closed: 1}, c.GetResponseDrainStats())
+		resp, err = c.R().Get("/bytes?n=1")
+		assertSuccess(t, resp, err)
+		tests.AssertEqual(t, resp.ProtoMajor == 2, resp.ConnReused()) // the HTTP1 connection is closed.
+		tests.AssertNoError(t, resp.Discard())
+
+		// the abandoned body is drained once garbage collected.
+		c.SetResponseDrainLimit(defaultResponseDrainLimit)
+		func() {
+			resp, err := c.R().Get("/bytes?n=100")
+			assertSuccess(t, resp, err)
+		}()
+		deadline := time.Now().Add(5 * time.Second)
+		for c.GetResponseDrainStats().Drained < 4 && time.Now().Before(deadline) {
+			runtime.GC()
+			time.Sleep(10 * time.Millisecond)
+		}
+		tests.AssertEqual(t, ResponseDrainStats{Drained: 4, Closed: 1}, c.GetResponseDrainStats())
+		resp, err = c.R().Get("/bytes?n=1")
+		assertSuccess(t, resp, err)
+		tests.AssertEqual(t, true, resp.ConnReused())
+		tests.AssertNoError(t, resp.Discard())
+
+		// the abandoned body is released once the context is done.
+		ctx, cancel := context.WithCancel(context.Background())
+		resp, err = c.R().SetContext(ctx).Get("/bytes?n=100")
+		assertSuccess(t, resp, err)
+		cancel()
+		deadline = time.Now().Add(5 * time.Second)
+		for stats := c.GetResponseDrainStats(); stats.Drained+stats.Closed < 7 && time.Now().Before(deadline); stats = c.GetResponseDrainStats() {
+			time.Sleep(10 * time.Millisecond)
+		}
+		stats := c.GetResponseDrainStats()
+		tests.AssertEqual(t, uint64(7), stats.Drained+stats.Closed)
+		runtime.KeepAlive(resp)
+	})
+
+	// the body which has been read is not affected.
+	c := tc()
+	resp, err := c.R().Get("/bytes?n=100")
+	assertSuccess(t, resp, err)
+	tests.AssertNoError(t, resp.Discard())
+	tests.AssertEqual(t, 100, len(resp.String()))
+	tests.AssertEqual(t, ResponseDrainStats{}, c.GetResponseDrainStats())
+}
+
+func TestDecompressionLimit(t *testing.T) {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	gw.Write([]byte(`{"data":"`))
+	gw.Write(bytes.Repeat([]byte("a"), 4<<20))
+	gw.Write([]byte(`"}`))
+	gw.Close()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(buf.Bytes())
+	}))
+	defer ts.Close()
+
+	// the ratio.
+	c := C().SetMaxDecompressionRatio(100)
+	resp, err := c.R().Get(ts.URL)
+	var bombErr *DecompressionBombError
+	tests.AssertEqual(t, true, errors.Is(err, ErrDecompressionBomb))
+	tests.AssertEqual(t, true, errors.As(err, &bombErr))
+	tests.AssertEqual(t, true, bombErr.Decompressed > 100*bombErr.Compressed)
+	tests.AssertEqual(t, true, bombErr.Decompressed <= 4<<20)
+	tests.AssertNotNil(t, resp)
+
+	// the size, which applies to the unmarshal and the output.
+	c = C().SetMaxDecompressionRatio(0).SetMaxDecompressedSize(1 << 20)
+	var result map[string]string
+	_, err = c.R().SetSuccessResult(&result).Get(ts.URL)
+	tests.AssertEqual(t, true, errors.Is(err, ErrDecompressionBomb))
+	_, err = c.R().SetOutput(io.Discard).Get(ts.URL)
+	tests.AssertEqual(t, true, errors.Is(err, ErrDecompressionBomb))
+	_, err = c.R().EnableDumpWithoutRequest().Get(ts.URL)
+	tests.AssertEqual(t, true, errors.Is(err, ErrDecompressionBomb))
+
+	// the limits are disabled.
+	c = C().SetMaxDecompressionRatio(0).SetMaxDecompressedSize(0)
+	resp, err = c.R().SetSuccessResult(&result).Get(ts.URL)
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, 4<<20, len(result["data"]))
+
+	// the raw body is not limited.
+	c = C().SetMaxDecompressedSize(1 << 20)
+	resp, err = c.R().DisableAutoDecode().SetHeader("Accept-Encoding", "gzip").Get(ts.URL)
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, buf.Len(), len(resp.Bytes()))
+}
+
+type recordingT struct {
+	errs []string
+}
+
+func (t *recordingT) Helper() {}
+
+func (t *recordingT) Errorf(format string, args ...any) {
+	t.errs = append(t.errs, fmt.Sprintf(format, args...))
+}
+
+func TestExpect(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("X-Request-Id", "0f8fad5b-d9cb-469f-a165-70867728950e")
+		w.Write([]byte(`{"data":{"id":42,"big":12345678901234567890,"ratio":0.5,"items":[{"name":"a"},{"name":"b"}],"ok":true,"none":null}}`))
+	}))
+	defer server.Close()
+
+	c := C().DisableAutoReadResponse()
+	resp, err := c.R().Get(server.URL)
+	tests.AssertNoError(t, err)
+	err = resp.Expect().
+		Status(200).
+		StatusSuccess().
+		ContentType("application/json").
+		ContentType("application/json; charset=utf-8").
+		Header("X-Request-Id", "0f8fad5b-d9cb-469f-a165-70867728950e").
+		HeaderMatches("X-Request-Id", `^[0-9a-f-]{36}$`).
+		JSONPath("data.id", 42).
+		JSONPath("data.id", 42.0).
+		JSONPath("data.id", json.Number("42")).
+		JSONPath("data.big", json.Number("12345678901234567890")).
+		JSONPath("data.ratio", float32(0.5)).
+		JSONPath("data.items[1].name", "b").
+		JSONPath("data.items", []map[string]string{{"name": "a"}, {"name": "b"}}).
+		JSONPath("data.ok", true).
+		JSONPath("data.none", nil).
+		Done()
+	tests.AssertNoError(t, err)
+	// the body is still readable.
+	tests.AssertContains(t, resp.String(), `"id":42`, true)
+	b, err := io.ReadAll(resp.Body)
+	tests.AssertNoError(t, err)
+	tests.AssertContains(t, string(b), `"id":42`, true)
+
+	// all the failures are accumulated.
+	rt := new(recordingT)
+	err = resp.ExpectT(rt).
+		Status(201, 204).
+		ContentType("text/plain").
+		Header("X-Missing", "v").
+		HeaderMatches("X-Request-Id", `^\d+$`).
+		JSONPath("data.id", 43).
+		JSONPath("data.big", uint64(12345678901234567891)).
+		JSONPath("data.items", []map[string]string{{"name": "a"}, {"name": "c"}}).
+		JSONPath("data.items.2", "x").
+		JSONPath("data.missing", "x").
+		Done()
+	want := []string{
+		"req: expect status [201 204], got 200",
+		`req: expect content type "text/plain", got "application/json; charset=utf-8"`,
+		`req: expect header X-Missing to be "v", got none`,
+		`req: expect header X-Request-Id to match "^\\d+$", got "0f8fad5b-d9cb-469f-a165-70867728950e"`,
+		`req: expect JSON path "data.id" to be 43, got 42: data.id is 42, not 43`,
+		`req: expect JSON path "data.big" to be 12345678901234567891, got 12345678901234567890: data.big is 12345678901234567890, not 12345678901234567891`,
+		`req: expect JSON path "data.items" to be [{"name":"a"},{"name":"c"}], got [{"name":"a"},{"name":"b"}]: data.items.1.name is "b", not "c"`,
+		`req: expect JSON path "data.items.2": "data.items.2" not found, the array length is 2`,
+		`req: expect JSON path "data.missing": "data.missing" not found`,
+	}
+	tests.AssertEqual(t, want, rt.errs)
+	tests.AssertEqual(t, strings.Join(want, "\n"), err.Error())
+
+	// the expectations are skipped if the request failed.
+	resp, _ = c.R().Get("http://127.0.0.1:1")
+	rt = new(recordingT)
+	err = resp.ExpectT(rt).Status(200).JSONPath("a", 1).Done()
+	tests.AssertEqual(t, 1, len(rt.errs))
+	tests.AssertErrorContains(t, err, "expect response, got error")
+}
+
+func TestMultipartResponse(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mw := multipart.NewWriter(w)
+		w.Header().Set("Content-Type", `multipart/related; type="application/json"; boundary=`+mw.Boundary())
+		pw, _ := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {"application/json"}, "Content-Id": {"<root>"}})
+		pw.Write([]byte(`{"name":"roc"}`))
+		nestedBody := new(bytes.Buffer)
+		nested := multipart.NewWriter(nestedBody)
+		np, _ := nested.CreatePart(textproto.MIMEHeader{"Content-Type": {"text/plain"}})
+		np.Write([]byte("hello"))
+		np, _ = nested.CreatePart(textproto.MIMEHeader{"Content-Type": {"text/html"}})
+		np.Write([]byte("<p>hello</p>"))
+		nested.Close()
+		pw, _ = mw.CreatePart(textproto.MIMEHeader{"Content-Type": {nested.FormDataContentType()}})
+		pw.Write(nestedBody.Bytes())
+		mw.Close()
+	}))
+	defer ts.Close()
+
+	check := func(resp *Response) {
+		t.Helper()
+		mr, err := resp.Multipart()
+		tests.AssertNoError(t, err)
+		defer mr.Close()
+		tests.AssertEqual(t, "multipart/related", mr.MediaType)
+		tests.AssertEqual(t, "application/json", mr.Params["type"])
+
+		part, err := mr.Next()
+		tests.AssertNoError(t, err)
+		tests.AssertEqual(t, "<root>", part.Header.Get("Content-Id"))
+		tests.AssertEqual(t, "application/json", part.ContentType())
+		body, err := io.ReadAll(part.Body)
+		tests.AssertNoError(t, err)
+		tests.AssertEqual(t, `{"name":"roc"}`, string(body))
+
+		part, err = mr.Next()
+		tests.AssertNoError(t, err)
+		nested, err := part.Multipart()
+		tests.AssertNoError(t, err)
+		tests.AssertEqual(t, "multipart/form-data", nested.MediaType)
+		var got []string
+		for {
+			p, err := nested.Next()
+			if err == io.EOF {
+				break
+			}
+			tests.AssertNoError(t, err)
+			b, err := io.ReadAll(p.Body)
+			tests.AssertNoError(t, err)
+			got = append(got, p.ContentType()+": "+string(b))
+		}
+		tests.AssertEqual(t, []string{"text/plain: hello", "text/html: <p>hello</p>"}, got)
+
+		_, err = mr.Next()
+		tests.AssertEqual(t, io.EOF, err)
+	}
+
+	c := C()
+	resp, err := c.R().Get(ts.URL)
+	tests.AssertNoError(t, err)
+	check(resp)
+
+	resp, err = c.R().DisableAutoReadResponse().Get(ts.URL)
+	tests.AssertNoError(t, err)
+	check(resp)
+
+	resp, err = c.R().Get(ts.URL + "/not-multipart")
+	tests.AssertNoError(t, err)
+	resp.Header.Set("Content-Type", "application/json")
+	_, err = resp.Multipart()
+	tests.AssertErrorContains(t, err, "is not multipart")
+	resp.Header.Set("Content-Type", "multipart/mixed")
+	_, err = resp.Multipart()
+	tests.AssertErrorContains(t, err, "missing boundary")
+}
+
+func TestBodySpillThreshold(t *testing.T) {
+	const threshold = 64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n, _ := strconv.Atoi(r.URL.Query().Get("n"))
+		if r.URL.Path == "/broken" {
+			w.Header().Set("Content-Length", strconv.Itoa(n+100))
+			w.Write(bytes.Repeat([]byte("a"), n))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		// {"data":"aaa..."} whose length is n.
+		fmt.Fprintf(w, `{"data":"%s"}`, strings.Repeat("a", n-11))
+	}))
+	defer ts.Close()
+
+	dir := t.TempDir()
+	spilledFiles := func() int {
+		entries, err := os.ReadDir(dir)
+		tests.AssertNoError(t, err)
+		return len(entries)
+	}
+	c := C().SetBodySpillThreshold(threshold).SetBodySpillDir(dir)
+	var result struct {
+		Data string `json:"data"`
+	}
+
+	// the body of the threshold size is kept in memory.
+	resp, err := c.R().SetSuccessResult(&result).SetQueryParam("n", strconv.Itoa(threshold)).Get(ts.URL)
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, threshold, len(resp.Bytes()))
+	tests.AssertEqual(t, threshold-11, len(result.Data))
+	tests.AssertEqual(t, 0, spilledFiles())
+
+	// the larger body is spilled.
+	resp, err = c.R().SetSuccessResult(&result).SetQueryParam("n", strconv.Itoa(threshold+1)).Get(ts.URL)
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, threshold+1, len(resp.Bytes()))
+	tests.AssertEqual(t, `{"data":"a`, resp.String()[:10])
+	tests.AssertEqual(t, threshold-10, len(result.Data))
+	tests.AssertEqual(t, 1, spilledFiles())
+	br, err := resp.BodyReader()
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, int64(threshold+1), br.Size())
+	p := make([]byte, 8)
+	_, err = br.ReadAt(p, 1)
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, `"data":"`, string(p))
+	body, err := resp.ToBytes()
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, threshold+1, len(body))
+	result.Data = ""
+	tests.AssertNoError(t, resp.Unmarshal(&result))
+	tests.AssertEqual(t, threshold-10, len(result.Data))
+	tests.AssertNoError(t, resp.Close())
+	tests.AssertEqual(t, 0, spilledFiles())
+
+	// the temp file is removed if reading the body fails.
+	resp, err = c.R().SetQueryParam("n", strconv.Itoa(threshold*2)).Get(ts.URL + "/broken")
+	tests.AssertNotNil(t, err)
+	tests.AssertEqual(t, 0, spilledFiles())
+
+	// the temp file is removed if the response is garbage collected.
+	func() {
+		resp, err := c.R().SetQueryParam("n", strconv.Itoa(threshold*2)).Get(ts.URL)
+		assertSuccess(t, resp, err)
+	}()
+	tests.AssertEqual(t, 1, spilledFiles())
+	for i := 0; i < 50 && spilledFiles() > 0; i++ {
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+	}
+	tests.AssertEqual(t, 0, spilledFiles())
+}
+
+func TestCanceledError(t *testing.T) {
+	reached := make(chan struct{}, 1)
+	release := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/headers":
+			reached <- struct{}{}
+		case "/body":
+			w.Header().Set("Content-Length", "100")
+			w.Write([]byte("partial"))
+			w.(http.Flusher).Flush()
+			reached <- struct{}{}
+		case "/unavailable":
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		default:
+			w.Write([]byte("ok"))
+			return
+		}
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	})
+	ts := httptest.NewUnstartedServer(handler)
+	ts.EnableHTTP2 = true
+	ts.StartTLS()
+	defer ts.Close()
+
+	cert, err := tls.X509KeyPair(testcert.LocalhostCert, testcert.LocalhostKey)
+	tests.AssertNoError(t, err)
+	h3conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	tests.AssertNoError(t, err)
+	h3server := &http3.Server{
+		Handler:   handler,
+		TLSConfig: http3.ConfigureTLSConfig(&tls.Config{Certificates: []tls.Certificate{cert}}),
+	}
+	go h3server.Serve(h3conn)
+	defer h3server.Close()
+	h3URL := "https://" + h3conn.LocalAddr().String()
+
+	// the silent servers which never complete the handshake.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	tests.AssertNoError(t, err)
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			reached <- struct{}{}
+			go func() {
+				<-release
+				conn.Close()
+			}()
+		}
+	}()
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	tests.AssertNoError(t, err)
+	defer udp.Close()
+	defer close(release) // unblock the handlers before closing the servers.
+
+	newClient := func(proto string) *Client {
+		c := C().EnableInsecureSkipVerify()
+		switch proto {
+		case "h1":
+			c.EnableForceHTTP1()
+			c.MaxConnsPerHost = 1
+		case "h2":
+			c.EnableForceHTTP2()
+		case "h3":
+			c.EnableForceHTTP3()
+		}
+		return c
+	}
+	blockingDial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		reached <- struct{}{}
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	type phase struct {
+		name string
+		url  string
+		// setup prepares the client or the request, the returned function
+		// waits until the phase is reached.
+		setup func(c *Client, r *Request) (wait func())
+		// reusable reports whether the client is still usable after the
+		// cancellation, which verifies the connection is released.
+		reusable bool
+	}
+	waitReached := func(c *Client, r *Request) func() {
+		return func() { <-reached }
+	}
+	phases := map[string][]phase{
+		"h1": {
+			{name: "queued", url: "/", setup: func(c *Client, r *Request) func() {
+				// occupy the only connection, so that the request is queued.
+				ctx, cancel := context.WithCancel(context.Background())
+				go c.R().SetContext(ctx).Get(ts.URL + "/headers")
+				<-reached
+				return func() {
+					time.Sleep(100 * time.Millisecond)
+					t.Cleanup(cancel)
+				}
+			}},
+			{name: "dialing", setup: func(c *Client, r *Request) func() {
+				c.SetDial(blockingDial)
+				return waitReached(c, r)
+			}},
+			{name: "handshaking", url: "https://" + ln.Addr().String(), setup: waitReached},
+			{name: "awaiting headers", url: "/headers", setup: waitReached, reusable: true},
+			{name: "reading body", url: "/body", setup: waitReached, reusable: true},
+			{name: "sleeping between retries", url: "/unavailable", setup: func(c *Client, r *Request) func() {
+				r.SetRetryCount(1).SetRetryFixedInterval(time.Hour).
+					SetRetryCondition(func(resp *Response, err error) bool {
+						return err == nil && resp.StatusCode == http.StatusServiceUnavailable
+					}).
+					AddRetryHook(func(resp *Response, err error) {
+						reached <- struct{}{}
+					})
+				return waitReached(c, r)
+			}, reusable: true},
+		},
+		"h2": {
+			{name: "dialing", setup: func(c *Client, r *Request) func() {
+				// the forced HTTP2 dials with the TLS dial function.
+				c.SetDialTLS(blockingDial)
+				return waitReached(c, r)
+			}},
+			{name: "handshaking", url: "https://" + ln.Addr().String(), setup: waitReached},
+			{name: "awaiting headers", url: "/headers", setup: waitReached, reusable: true},
+			{name: "reading body", url: "/body", setup: waitReached, reusable: true},
+		},
+		"h3": {
+			{name: "handshaking", url: "https://" + udp.LocalAddr().String(), setup: func(c *Client, r *Request) func() {
+				return func() { time.Sleep(100 * time.Millisecond) }
+			}},
+			{name: "awaiting headers", url: "/headers", setup: waitReached, reusable: true},
+			{name: "reading body", url: "/body", setup: waitReached, reusable: true},
+		},
+	}
+	cause := errors.New("user gave up")
+	for _, proto := range []string{"h1", "h2", "h3"} {
+		baseURL := ts.URL
+		if proto == "h3" {
+			baseURL = h3URL
+		}
+		for _, p := range phases[proto] {
+			c := newClient(proto)
+			ctx, cancel := context.WithCancelCause(context.Background())
+			r := c.R().SetContext(ctx)
+			wait := p.setup(c, r)
+			var canceledAt time.Time
+			go func() {
+				wait()
+				canceledAt = time.Now()
+				cancel(cause)
+			}()
+			url := p.url
+			if !strings.HasPrefix(url, "https://") {
+				url = baseURL + url
+			}
+			_, err := r.Get(url)
+			name := proto + " " + p.name
+			var ce *CanceledError
+			if !errors.As(err, &ce) {
+				t.Fatalf("%s: expect CanceledError, got %v", name, err)
+			}
+			if d := time.Since(canceledAt); d > 2*time.Second {
+				t.Errorf("%s: expect to be aborted in time, took %s", name, d)
+			}
+			tests.AssertEqual(t, true, errors.Is(err, context.Canceled))
+			tests.AssertEqual(t, cause, errors.Unwrap(err))
+			tests.AssertErrorContains(t, err, cause.Error())
+			if p.reusable {
+				resp, err := c.R().Get(baseURL + "/")
+				assertSuccess(t, resp, err)
+			}
+		}
+	}
+
+	// the deadline exceeded.
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	go func() { <-reached }()
+	_, err = newClient("h1").R().SetContext(ctx).Get(ts.URL + "/headers")
+	tests.AssertEqual(t, true, errors.Is(err, context.DeadlineExceeded))
+	tests.AssertEqual(t, context.DeadlineExceeded, errors.Unwrap(err))
+}
+
+func TestIterateJSONArray(t *testing.T) {
+	const n = 1000
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/malformed" {
+			io.WriteString(w, `[{"id":1},{"id":2,]`)
+			return
+		}
+		io.WriteString(w, `{"meta":{"skip":[1,{"a":[]}]},"data":{"total":1000,"items":[`)
+		for i := 0; i < n; i++ {
+			if i > 0 {
+				io.WriteString(w, ",")
+			}
+			fmt.Fprintf(w, `{"id":%d}`, i)
+		}
+		io.WriteString(w, `]}}`)
+	}))
+	defer ts.Close()
+
+	type item struct {
+		ID int `json:"id"`
+	}
+	c := C()
+	resp, err := c.R().DisableAutoReadResponse().Get(ts.URL)
+	tests.AssertNoError(t, err)
+	count := 0
+	err = IterateJSONArray(resp, "data.items", func(it item) error {
+		tests.AssertEqual(t, count, it.ID)
+		count++
+		return nil
+	})
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, n, count)
+
+	// the error of fn aborts the iteration.
+	stop := errors.New("stop")
+	resp, err = c.R().DisableAutoReadResponse().Get(ts.URL)
+	tests.AssertNoError(t, err)
+	count = 0
+	err = IterateJSONArray(resp, "data.items", func(it item) error {
+		if count++; count == 10 {
+			return stop
+		}
+		return nil
+	})
+	tests.AssertEqual(t, stop, err)
+	tests.AssertEqual(t, 10, count)
+
+	// the read body is iterated as well.
+	resp, err = c.R().Get(ts.URL)
+	tests.AssertNoError(t, err)
+	count = 0
+	err = IterateJSONArray(resp, "data.items", func(it map[string]int) error {
+		count++
+		return nil
+	})
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, n, count)
+
+	resp, err = c.R().Get(ts.URL)
+	tests.AssertNoError(t, err)
+	err = IterateJSONArray(resp, "data.missing", func(it item) error { return nil })
+	tests.AssertErrorContains(t, err, `json path "data.missing" not found`)
+	err = IterateJSONArray(resp, "", func(it item) error { return nil })
+	tests.AssertErrorContains(t, err, "json body is not an array")
+
+	resp, err = c.R().DisableAutoReadResponse().Get(ts.URL + "/malformed")
+	tests.AssertNoError(t, err)
+	count = 0
+	err = IterateJSONArray(resp, "", func(it item) error {
+		count++
+		return nil
+	})
+	var streamErr *JSONStreamError
+	tests.AssertEqual(t, true, errors.As(err, &streamErr))
+	tests.AssertEqual(t, int64(19), streamErr.Offset)
+	tests.AssertEqual(t, 1, count)
+
+	resp, err = c.R().SetOutput(io.Discard).Get(ts.URL)
+	tests.AssertNoError(t, err)
+	err = IterateJSONArray(resp, "", func(it item) error { return nil })
+	tests.AssertErrorContains(t, err, "does not work with SetOutput")
+}
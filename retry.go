@@ -2,7 +2,7 @@ package req
 
 import (
 	"math"
-	"math/rand"
+	"net/http"
 	"time"
 )
 
@@ -17,17 +17,45 @@ type RetryConditionFunc func(resp *Response, err error) bool
 // RetryHookFunc is a retry hook which will be executed before a retry.
 type RetryHookFunc func(resp *Response, err error)
 
+// RetryInfo is the read-only information of a retry, see Client.OnRetry.
+type RetryInfo struct {
+	// Attempt is the attempt number of the retry, starts from 1.
+	Attempt int
+	// Delay is the delay which is about to be waited before the retry.
+	Delay time.Duration
+	// Elapsed is the elapsed time since the first attempt.
+	Elapsed time.Duration
+	// Method is the method of the request.
+	Method string
+	// URL is the url of the request.
+	URL string
+	// Response is the response of the last attempt, which triggers the retry.
+	Response *Response
+	// Err is the error of the last attempt, which triggers the retry.
+	Err error
+}
+
 // GetRetryIntervalFunc is a function that determines how long should
 // sleep between retry attempts.
 type GetRetryIntervalFunc func(resp *Response, attempt int) time.Duration
 
+// RetryIntervalFunc is a function that determines how long should sleep
+// before the retry attempt, with the response of the last attempt, the
+// attempt number of the retry (starts from 1) and the elapsed time since
+// the first attempt. A negative duration stops retrying.
+type RetryIntervalFunc func(resp *Response, attempt int, elapsed time.Duration) time.Duration
+
 func backoffInterval(min, max time.Duration) GetRetryIntervalFunc {
 	base := float64(min)
 	capLevel := float64(max)
 	return func(resp *Response, attempt int) time.Duration {
 		temp := math.Min(capLevel, base*math.Exp2(float64(attempt)))
 		halfTemp := int64(temp / 2)
-		sleep := halfTemp + rand.Int63n(halfTemp)
+		var c *Client
+		if resp != nil && resp.Request != nil {
+			c = resp.Request.client
+		}
+		sleep := halfTemp + c.getRand().Int63n(halfTemp)
 		return time.Duration(sleep)
 	}
 }
@@ -38,11 +66,49 @@ func newDefaultRetryOption() *retryOption {
 	}
 }
 
+// DefaultRetryableStatusCodes returns the status codes which are commonly
+// considered as transient and retryable: 429, 502, 503 and 504.
+func DefaultRetryableStatusCodes() []int {
+	return []int{
+		http.StatusTooManyRequests,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout,
+	}
+}
+
+type statusRange struct {
+	Min, Max int
+}
+
 type retryOption struct {
-	MaxRetries       int
-	GetRetryInterval GetRetryIntervalFunc
-	RetryConditions  []RetryConditionFunc
-	RetryHooks       []RetryHookFunc
+	MaxRetries        int
+	GetRetryInterval  GetRetryIntervalFunc
+	RetryInterval     RetryIntervalFunc
+	RetryConditions   []RetryConditionFunc
+	RetryHooks        []RetryHookFunc
+	RetryStatusCodes  []int
+	RetryStatusRanges []statusRange
+}
+
+// isRetryStatus reports whether the status code of the response matches
+// the retry status codes or ranges.
+func (ro *retryOption) isRetryStatus(resp *Response) bool {
+	if resp == nil || resp.Response == nil {
+		return false
+	}
+	code := resp.StatusCode
+	for _, c := range ro.RetryStatusCodes {
+		if c == code {
+			return true
+		}
+	}
+	for _, r := range ro.RetryStatusRanges {
+		if code >= r.Min && code <= r.Max {
+			return true
+		}
+	}
+	return false
 }
 
 func (ro *retryOption) Clone() *retryOption {
@@ -52,8 +118,11 @@ func (ro *retryOption) Clone() *retryOption {
 	o := &retryOption{
 		MaxRetries:       ro.MaxRetries,
 		GetRetryInterval: ro.GetRetryInterval,
+		RetryInterval:    ro.RetryInterval,
 	}
 	o.RetryConditions = append(o.RetryConditions, ro.RetryConditions...)
 	o.RetryHooks = append(o.RetryHooks, ro.RetryHooks...)
+	o.RetryStatusCodes = append(o.RetryStatusCodes, ro.RetryStatusCodes...)
+	o.RetryStatusRanges = append(o.RetryStatusRanges, ro.RetryStatusRanges...)
 	return o
 }
@@ -2,9 +2,14 @@ package req
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"io"
 	"math"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"strconv"
 	"testing"
 	"time"
 
@@ -49,6 +54,34 @@ func TestRetryFixedInterval(t *testing.T) {
 	})
 }
 
+func TestRetryIntervalFunc(t *testing.T) {
+	var attempts []int
+	testRetry(t, func(r *Request) {
+		r.SetRetryFixedInterval(time.Hour).SetRetryIntervalFunc(func(resp *Response, attempt int, elapsed time.Duration) time.Duration {
+			tests.AssertEqual(t, http.StatusTooManyRequests, resp.StatusCode)
+			tests.AssertEqual(t, true, elapsed > 0)
+			attempts = append(attempts, attempt)
+			return time.Millisecond
+		})
+	})
+	tests.AssertEqual(t, []int{1, 2, 3}, attempts)
+
+	// a negative duration stops retrying.
+	c := tc().SetCommonRetryCount(5).
+		SetCommonRetryCondition(func(resp *Response, err error) bool {
+			return resp.StatusCode == http.StatusTooManyRequests
+		}).
+		SetCommonRetryIntervalFunc(func(resp *Response, attempt int, elapsed time.Duration) time.Duration {
+			if attempt > 2 {
+				return -1
+			}
+			return time.Millisecond
+		})
+	resp, err := c.R().Get("/too-many")
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, 2, resp.Request.RetryAttempt)
+}
+
 func TestAddRetryHook(t *testing.T) {
 	test := "test1"
 	testRetry(t, func(r *Request) {
@@ -115,6 +148,52 @@ func TestAddRetryCondition(t *testing.T) {
 
 }
 
+func TestRetryOnStatusCodes(t *testing.T) {
+	resp, err := tc().SetCommonRetryCount(2).
+		SetRetryOnStatusCodes(DefaultRetryableStatusCodes()...).
+		R().Get("/too-many")
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, 2, resp.Request.RetryAttempt)
+
+	resp, err = tc().SetCommonRetryCount(2).
+		SetRetryOnStatusCodes(http.StatusServiceUnavailable).
+		R().Get("/too-many")
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, 0, resp.Request.RetryAttempt)
+
+	// request-level codes are added to client-level ones.
+	resp, err = tc().SetCommonRetryCount(2).
+		SetRetryOnStatusCodes(http.StatusServiceUnavailable).
+		R().AddRetryStatusCodes(http.StatusTooManyRequests).Get("/too-many")
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, 2, resp.Request.RetryAttempt)
+
+	resp, err = tc().SetCommonRetryCount(2).SetRetryOnStatusRange(400, 499).R().Get("/bad-request")
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, 2, resp.Request.RetryAttempt)
+
+	resp, err = tc().R().SetRetryCount(2).AddRetryStatusRange(500, 599).Get("/bad-request")
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, 0, resp.Request.RetryAttempt)
+
+	// composes with retry conditions (OR).
+	resp, err = tc().R().SetRetryCount(2).
+		AddRetryCondition(func(resp *Response, err error) bool {
+			return false
+		}).
+		AddRetryStatusCodes(http.StatusTooManyRequests).Get("/too-many")
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, 2, resp.Request.RetryAttempt)
+
+	resp, err = tc().R().SetRetryCount(2).
+		AddRetryCondition(func(resp *Response, err error) bool {
+			return resp.StatusCode == http.StatusBadRequest
+		}).
+		AddRetryStatusCodes(http.StatusTooManyRequests).Get("/bad-request")
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, 2, resp.Request.RetryAttempt)
+}
+
 func TestRetryWithUnreplayableBody(t *testing.T) {
 	_, err := tc().R().
 		SetRetryCount(1).
@@ -196,3 +275,173 @@ func TestRetryTurnedOffWhenRetryCountEqZero(t *testing.T) {
 	tests.AssertIsNil(t, resp.Response)
 	tests.AssertEqual(t, 0, resp.Request.RetryAttempt)
 }
+
+func TestOnRetry(t *testing.T) {
+	var infos []RetryInfo
+	c := tc().
+		SetCommonRetryCount(2).
+		SetCommonRetryFixedInterval(100 * time.Millisecond).
+		SetCommonRetryCondition(func(resp *Response, err error) bool {
+			return resp.StatusCode == http.StatusTooManyRequests
+		}).
+		OnRetry(func(info RetryInfo) {
+			infos = append(infos, info)
+			time.Sleep(100 * time.Millisecond) // deducted from the delay.
+		})
+	start := time.Now()
+	resp, err := c.R().Get("/too-many")
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, http.StatusTooManyRequests, resp.StatusCode)
+	tests.AssertEqual(t, 2, len(infos))
+	tests.AssertEqual(t, true, time.Since(start) < 350*time.Millisecond)
+	for i, info := range infos {
+		tests.AssertEqual(t, i+1, info.Attempt)
+		tests.AssertEqual(t, 100*time.Millisecond, info.Delay)
+		tests.AssertEqual(t, http.MethodGet, info.Method)
+		tests.AssertEqual(t, getTestServerURL()+"/too-many", info.URL)
+		tests.AssertEqual(t, http.StatusTooManyRequests, info.Response.StatusCode)
+		tests.AssertNoError(t, info.Err)
+	}
+	tests.AssertEqual(t, true, infos[1].Elapsed >= 100*time.Millisecond)
+}
+
+func TestRequestAttempt(t *testing.T) {
+	var middlewareAttempts, bodyAttempts []int
+	c := tc().OnBeforeRequest(func(client *Client, r *Request) error {
+		middlewareAttempts = append(middlewareAttempts, r.Attempt())
+		return nil
+	})
+	r := c.R().
+		AllowBodyOnMethod(true).
+		SetRetryCount(3).
+		SetRetryFixedInterval(time.Millisecond).
+		SetRetryCondition(func(resp *Response, err error) bool {
+			return resp.StatusCode == http.StatusTooManyRequests
+		})
+	r.SetBody(func() (io.ReadCloser, error) {
+		bodyAttempts = append(bodyAttempts, r.Attempt())
+		return io.NopCloser(bytes.NewReader([]byte("body"))), nil
+	})
+	resp, err := r.Get("/too-many")
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, 3, resp.Request.Attempt())
+	tests.AssertEqual(t, []int{0, 1, 2, 3}, middlewareAttempts)
+	tests.AssertEqual(t, []int{0, 1, 2, 3}, bodyAttempts)
+
+	// it starts from 0 when the request is sent again.
+	middlewareAttempts = nil
+	_, err = r.SetRetryCount(0).Get("/too-many")
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, []int{0}, middlewareAttempts)
+}
+
+func TestRetryCancelledDuringBackoff(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	tests.AssertNoError(t, err)
+	addr := ln.Addr().String()
+	ln.Close() // the connection is refused.
+
+	attempts := 0
+	r := func(ctx context.Context) *Request {
+		return tc().R().
+			SetContext(ctx).
+			SetRetryCount(3).
+			SetRetryFixedInterval(time.Second).
+			AddRetryHook(func(resp *Response, err error) {
+				attempts++
+			})
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	start := time.Now()
+	_, err = r(ctx).Get("http://" + addr)
+	tests.AssertEqual(t, true, errors.Is(err, context.Canceled))
+	tests.AssertErrorContains(t, err, "request cancelled during retry backoff")
+	tests.AssertEqual(t, true, time.Since(start) < time.Second)
+	tests.AssertEqual(t, 1, attempts)
+
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	resp, err := r(ctx).Get("http://" + addr)
+	tests.AssertEqual(t, true, errors.Is(err, context.DeadlineExceeded))
+	tests.AssertEqual(t, err, resp.Err)
+}
+
+func TestSetAttemptContextFunc(t *testing.T) {
+	type attemptKey struct{}
+	// the first two attempts fail, the third one blocks until cancelled.
+	var inflight = make(chan struct{}, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Attempt") != "2" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		inflight <- struct{}{}
+		<-r.Context().Done()
+	}))
+	defer ts.Close()
+
+	for _, derive := range []bool{true, false} {
+		var attempts []int
+		var seen []any
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			<-inflight
+			cancel()
+		}()
+		c := C().
+			OnBeforeRequest(func(client *Client, req *Request) error {
+				req.SetHeader("X-Attempt", strconv.Itoa(req.RetryAttempt))
+				return nil
+			}).
+			WrapRoundTripFunc(func(rt RoundTripper) RoundTripFunc {
+				return func(req *Request) (*Response, error) {
+					resp, err := rt.RoundTrip(req)
+					seen = append(seen, req.RawRequest.Context().Value(attemptKey{}))
+					return resp, err
+				}
+			})
+		_, err := c.R().
+			SetContext(ctx).
+			SetRetryCount(5).
+			SetRetryFixedInterval(time.Millisecond).
+			SetRetryCondition(func(resp *Response, err error) bool {
+				return err == nil && resp.StatusCode == http.StatusServiceUnavailable
+			}).
+			SetAttemptContextFunc(func(parent context.Context, attempt int) context.Context {
+				attempts = append(attempts, attempt)
+				if derive {
+					return context.WithValue(parent, attemptKey{}, attempt)
+				}
+				// not derived from the parent, which is still cancelled
+				// with the parent.
+				return context.WithValue(context.Background(), attemptKey{}, attempt)
+			}).
+			Get(ts.URL)
+		tests.AssertErrorContains(t, err, "context canceled")
+		tests.AssertEqual(t, []int{0, 1, 2}, attempts)
+		tests.AssertEqual(t, []any{0, 1, 2}, seen)
+	}
+
+	// the context of the attempt is released once the round trip finishes,
+	// or the unread body is closed.
+	var attemptCtx context.Context
+	c := tc().WrapRoundTripFunc(func(rt RoundTripper) RoundTripFunc {
+		return func(req *Request) (*Response, error) {
+			resp, err := rt.RoundTrip(req)
+			attemptCtx = req.RawRequest.Context()
+			return resp, err
+		}
+	})
+	derive := func(parent context.Context, attempt int) context.Context {
+		return context.WithValue(parent, attemptKey{}, attempt)
+	}
+	resp, err := c.R().SetAttemptContextFunc(derive).Get("/")
+	assertSuccess(t, resp, err)
+	tests.AssertNotNil(t, attemptCtx.Err())
+	resp, err = c.R().SetAttemptContextFunc(derive).DisableAutoReadResponse().Get("/")
+	assertSuccess(t, resp, err)
+	tests.AssertIsNil(t, attemptCtx.Err())
+	resp.Body.Close()
+	tests.AssertNotNil(t, attemptCtx.Err())
+}
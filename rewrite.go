@@ -0,0 +1,502 @@
+package req
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// RewriteRuleError is the error of the invalid rewrite rules, which is
+// returned by Client.LoadRewriteRules and Client.ReloadRules.
+type RewriteRuleError struct {
+	// Line is the line of the invalid rule or value, starts from 1.
+	Line int
+	// Field is the path of the invalid field (e.g. "rules[1].match.host"),
+	// empty if the error is not related to a field.
+	Field string
+	Err   error
+}
+
+func (e *RewriteRuleError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("req: invalid rewrite rules at line %d: %v", e.Line, e.Err)
+	}
+	return fmt.Sprintf("req: invalid rewrite rules at line %d, field %s: %v", e.Line, e.Field, e.Err)
+}
+
+func (e *RewriteRuleError) Unwrap() error {
+	return e.Err
+}
+
+// rewriteRulesSpec is the schema of the rewrite rules file.
+type rewriteRulesSpec struct {
+	DryRun bool              `json:"dry_run"`
+	Rules  []json.RawMessage `json:"rules"`
+}
+
+type rewriteRuleSpec struct {
+	Name     string             `json:"name"`
+	Match    rewriteMatchSpec   `json:"match"`
+	Actions  rewriteActionsSpec `json:"actions"`
+	Terminal bool               `json:"terminal"`
+}
+
+type rewriteMatchSpec struct {
+	Host    string   `json:"host"`
+	Path    string   `json:"path"`
+	Method  string   `json:"method"`
+	Headers []string `json:"headers"`
+}
+
+type rewriteActionsSpec struct {
+	Host          string            `json:"host"`
+	Path          string            `json:"path"`
+	SetHeaders    map[string]string `json:"set_headers"`
+	RemoveHeaders []string          `json:"remove_headers"`
+	SetQuery      map[string]string `json:"set_query"`
+	Protocol      string            `json:"protocol"`
+}
+
+// rewriteProtocols are the protocols which can be forced by the rules.
+var rewriteProtocols = map[string]Protocol{
+	"http1": ProtocolHTTP1,
+	"http2": ProtocolHTTP2,
+	"http3": ProtocolHTTP3,
+}
+
+type rewriteRule struct {
+	name    string
+	line    int
+	host    *regexp.Regexp
+	path    *regexp.Regexp
+	method  string
+	headers []string
+
+	setHost       string
+	setPath       string
+	setHeaders    map[string]string
+	removeHeaders []string
+	setQuery      map[string]string
+	protocol      Protocol
+
+	terminal bool
+}
+
+// rewriteRules is the rules engine of the client, the rules are replaced as
+// a whole when reloaded.
+type rewriteRules struct {
+	mu     sync.RWMutex
+	rules  []*rewriteRule
+	dryRun bool
+
+	// transports are the dedicated transports of the forced protocols.
+	transports map[Protocol]*hostProfileEntry
+}
+
+func newRewriteRules() *rewriteRules {
+	rr := &rewriteRules{transports: make(map[Protocol]*hostProfileEntry)}
+	for _, p := range []Protocol{ProtocolHTTP1, ProtocolHTTP2, ProtocolHTTP3} {
+		rr.transports[p] = &hostProfileEntry{profile: HostProfile{Protocol: p}}
+	}
+	return rr
+}
+
+func (rr *rewriteRules) Clone() *rewriteRules {
+	if rr == nil {
+		return nil
+	}
+	cc := newRewriteRules()
+	rr.mu.RLock()
+	cc.rules, cc.dryRun = rr.rules, rr.dryRun
+	rr.mu.RUnlock()
+	return cc
+}
+
+// LoadRewriteRules loads the rules which rewrite the requests before they
+// are sent, e.g. redirect the requests of some paths to the staging host in
+// the test. The rules are JSON like:
+//
+//	{
+//	  "dry_run": false,
+//	  "rules": [
+//	    {
+//	      "name": "staging",
+//	      "match": {"host": "^api\\.example\\.com$", "path": "^/v1/(.*)$", "method": "GET", "headers": ["X-Debug"]},
+//	      "actions": {
+//	        "host": "staging.example.com",
+//	        "path": "/v2/$1",
+//	        "set_headers": {"X-Env": "staging"},
+//	        "remove_headers": ["Authorization"],
+//	        "set_query": {"debug": "1"},
+//	        "protocol": "http1"
+//	      },
+//	      "terminal": true
+//	    }
+//	  ]
+//	}
+//
+// The host and path of the match are regular expressions which match the
+// host (including the port if any) and path of the request url, the method
+// is matched case-insensitively, and all the headers must be present. The
+// host and path of the actions replace the matches of the regular
+// expressions if set, which may reference the submatches like "$1", or
+// replace the whole value otherwise. The protocol is one of "http1", "http2"
+// and "http3", the requests forcing a protocol are sent with a dedicated
+// transport cloned from the client transport.
+//
+// The rules are evaluated in order after the common headers and the host
+// profiles (see SetHostProfile) are applied, and the evaluation stops at the
+// first matched rule marked as terminal. If dry_run is true, the changes are
+// logged rather than applied. The loading fails with RewriteRuleError which
+// reports the line and field of the invalid rule, and the rules loaded
+// before are kept in that case. Use ReloadRules to replace the rules while
+// the client is in use.
+func (c *Client) LoadRewriteRules(r io.Reader) error {
+	if c.rewriteRules != nil {
+		return c.ReloadRules(r)
+	}
+	rules, dryRun, err := parseRewriteRules(r)
+	if err != nil {
+		return err
+	}
+	rr := newRewriteRules()
+	rr.rules, rr.dryRun = rules, dryRun
+	c.rewriteRules = rr
+	c.httpClient.Transport = c.newHttpTransport()
+	return nil
+}
+
+// ReloadRules replaces the rewrite rules loaded by LoadRewriteRules, which
+// is safe to call while the requests are being sent, the requests which
+// have started evaluating the rules use the old rules. The old rules are
+// kept if the new rules are invalid.
+func (c *Client) ReloadRules(r io.Reader) error {
+	if c.rewriteRules == nil {
+		return c.LoadRewriteRules(r)
+	}
+	rules, dryRun, err := parseRewriteRules(r)
+	if err != nil {
+		return err
+	}
+	rr := c.rewriteRules
+	rr.mu.Lock()
+	rr.rules, rr.dryRun = rules, dryRun
+	rr.mu.Unlock()
+	return nil
+}
+
+func parseRewriteRules(r io.Reader) (rules []*rewriteRule, dryRun bool, err error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, false, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var spec rewriteRulesSpec
+	if err = dec.Decode(&spec); err != nil {
+		return nil, false, newRewriteDecodeError(data, 0, "", err)
+	}
+	offsets := rewriteRuleOffsets(data)
+	for i, raw := range spec.Rules {
+		var offset int64
+		if i < len(offsets) {
+			offset = offsets[i]
+		}
+		rule, err := parseRewriteRule(data, offset, raw, fmt.Sprintf("rules[%d]", i))
+		if err != nil {
+			return nil, false, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, spec.DryRun, nil
+}
+
+// parseRewriteRule parses the rule at the offset of the data.
+func parseRewriteRule(data []byte, offset int64, raw json.RawMessage, field string) (*rewriteRule, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	var spec rewriteRuleSpec
+	if err := dec.Decode(&spec); err != nil {
+		if isUnknownFieldError(err) { // locate the unknown field of the nested object.
+			var sections map[string]json.RawMessage
+			_ = json.Unmarshal(raw, &sections)
+			for name, v := range map[string]any{"match": new(rewriteMatchSpec), "actions": new(rewriteActionsSpec)} {
+				sub, ok := sections[name]
+				if !ok {
+					continue
+				}
+				d := json.NewDecoder(bytes.NewReader(sub))
+				d.DisallowUnknownFields()
+				if e := d.Decode(v); e != nil && isUnknownFieldError(e) {
+					i := bytes.Index(raw, sub)
+					return nil, newRewriteDecodeError(data, offset+int64(max(i, 0)), field+"."+name, e)
+				}
+			}
+		}
+		return nil, newRewriteDecodeError(data, offset, field, err)
+	}
+	fieldErr := func(name, key string, err error) error {
+		line := lineOfOffset(data, offset)
+		if i := bytes.Index(raw, []byte(`"`+key+`"`)); i >= 0 {
+			line = lineOfOffset(data, offset+int64(i))
+		}
+		return &RewriteRuleError{Line: line, Field: field + "." + name, Err: err}
+	}
+	rule := &rewriteRule{
+		name:          spec.Name,
+		line:          lineOfOffset(data, offset),
+		method:        strings.ToUpper(spec.Match.Method),
+		setHost:       spec.Actions.Host,
+		setPath:       spec.Actions.Path,
+		setHeaders:    spec.Actions.SetHeaders,
+		removeHeaders: spec.Actions.RemoveHeaders,
+		setQuery:      spec.Actions.SetQuery,
+		protocol:      rewriteProtocols[spec.Actions.Protocol],
+		terminal:      spec.Terminal,
+	}
+	var err error
+	if spec.Match.Host != "" {
+		if rule.host, err = regexp.Compile(spec.Match.Host); err != nil {
+			return nil, fieldErr("match.host", "host", err)
+		}
+	}
+	if spec.Match.Path != "" {
+		if rule.path, err = regexp.Compile(spec.Match.Path); err != nil {
+			return nil, fieldErr("match.path", "path", err)
+		}
+	}
+	for i, h := range spec.Match.Headers {
+		if h == "" {
+			return nil, fieldErr(fmt.Sprintf("match.headers[%d]", i), "headers", errors.New("empty header name"))
+		}
+		rule.headers = append(rule.headers, http.CanonicalHeaderKey(h))
+	}
+	if spec.Actions.Protocol != "" && rule.protocol == ProtocolAuto {
+		return nil, fieldErr("actions.protocol", "protocol", fmt.Errorf(`unsupported protocol %q, must be one of "http1", "http2" and "http3"`, spec.Actions.Protocol))
+	}
+	return rule, nil
+}
+
+// rewriteRuleOffsets returns the offsets of the rules in the data, which is
+// valid JSON.
+func rewriteRuleOffsets(data []byte) (offsets []int64) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if _, err := dec.Token(); err != nil { // {
+		return
+	}
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return
+		}
+		if key != "rules" {
+			var skip json.RawMessage
+			if dec.Decode(&skip) != nil {
+				return
+			}
+			continue
+		}
+		if t, err := dec.Token(); err != nil || t != json.Delim('[') {
+			return
+		}
+		for dec.More() {
+			offset := dec.InputOffset()
+			// skip the separator before the rule.
+			for offset < int64(len(data)) && strings.IndexByte(", \t\r\n", data[offset]) >= 0 {
+				offset++
+			}
+			var skip json.RawMessage
+			if dec.Decode(&skip) != nil {
+				return
+			}
+			offsets = append(offsets, offset)
+		}
+		return
+	}
+	return
+}
+
+func newRewriteDecodeError(data []byte, offset int64, field string, err error) error {
+	var (
+		syntaxErr *json.SyntaxError
+		typeErr   *json.UnmarshalTypeError
+	)
+	switch {
+	case errors.As(err, &syntaxErr):
+		offset += syntaxErr.Offset
+	case errors.As(err, &typeErr):
+		offset += typeErr.Offset
+		if typeErr.Field != "" {
+			if field != "" {
+				field += "."
+			}
+			field += typeErr.Field
+		}
+		err = fmt.Errorf("cannot use %s as %s", typeErr.Value, typeErr.Type)
+	default:
+		if name, ok := strings.CutPrefix(err.Error(), unknownFieldErrorPrefix); ok {
+			name = strings.Trim(name, `"`)
+			if i := bytes.Index(data[offset:], []byte(`"`+name+`"`)); i >= 0 {
+				offset += int64(i)
+			}
+			if field != "" {
+				field += "."
+			}
+			field += name
+			err = errors.New("unknown field")
+		}
+	}
+	return &RewriteRuleError{Line: lineOfOffset(data, offset), Field: field, Err: err}
+}
+
+const unknownFieldErrorPrefix = "json: unknown field "
+
+func isUnknownFieldError(err error) bool {
+	return strings.HasPrefix(err.Error(), unknownFieldErrorPrefix)
+}
+
+func lineOfOffset(data []byte, offset int64) int {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	return bytes.Count(data[:offset], []byte("\n")) + 1
+}
+
+// applyRewriteRules applies the rewrite rules loaded by LoadRewriteRules to
+// the request.
+func applyRewriteRules(c *Client, r *Request) error {
+	rr := c.rewriteRules
+	if rr == nil || r.URL == nil {
+		return nil
+	}
+	rr.mu.RLock()
+	rules, dryRun := rr.rules, rr.dryRun
+	rr.mu.RUnlock()
+	for _, rule := range rules {
+		if !rule.match(r) {
+			continue
+		}
+		changes := rule.apply(r, dryRun)
+		if dryRun && len(changes) > 0 {
+			c.log.Debugf("rewrite rule %q (line %d) would change %s %s: %s", rule.name, rule.line, r.Method, r.URL.String(), strings.Join(changes, ", "))
+		}
+		if rule.terminal {
+			break
+		}
+	}
+	return nil
+}
+
+func (rule *rewriteRule) match(r *Request) bool {
+	if rule.method != "" && rule.method != strings.ToUpper(r.Method) {
+		return false
+	}
+	if rule.host != nil && !rule.host.MatchString(r.URL.Host) {
+		return false
+	}
+	if rule.path != nil && !rule.path.MatchString(r.URL.Path) {
+		return false
+	}
+	for _, h := range rule.headers {
+		if len(r.Headers[h]) == 0 && !hasHeaderSpelling(r.Headers, h) {
+			return false
+		}
+	}
+	return true
+}
+
+// apply applies the actions to the request and returns the changes, the
+// request is not modified if dryRun is true.
+func (rule *rewriteRule) apply(r *Request, dryRun bool) (changes []string) {
+	if rule.setHost != "" {
+		host := rule.setHost
+		if rule.host != nil {
+			host = rule.host.ReplaceAllString(r.URL.Host, rule.setHost)
+		}
+		if host != r.URL.Host {
+			changes = append(changes, fmt.Sprintf("host %q -> %q", r.URL.Host, host))
+			if !dryRun {
+				r.URL.Host = host
+			}
+		}
+	}
+	if rule.setPath != "" {
+		path := rule.setPath
+		if rule.path != nil {
+			path = rule.path.ReplaceAllString(r.URL.Path, rule.setPath)
+		}
+		if path != r.URL.Path {
+			changes = append(changes, fmt.Sprintf("path %q -> %q", r.URL.Path, path))
+			if !dryRun {
+				r.URL.Path, r.URL.RawPath = path, ""
+			}
+		}
+	}
+	if len(rule.setQuery) > 0 {
+		query := r.URL.Query()
+		for _, k := range sortedKeys(rule.setQuery) {
+			changes = append(changes, fmt.Sprintf("set query %s=%s", k, rule.setQuery[k]))
+			query.Set(k, rule.setQuery[k])
+		}
+		if !dryRun {
+			r.URL.RawQuery = query.Encode()
+		}
+	}
+	for _, k := range rule.removeHeaders {
+		if r.Headers.Get(k) == "" && !hasHeaderSpelling(r.Headers, k) {
+			continue
+		}
+		changes = append(changes, "remove header "+k)
+		if !dryRun {
+			r.Headers.Del(k)
+			deleteHeaderSpellings(r.Headers, http.CanonicalHeaderKey(k))
+		}
+	}
+	if len(rule.setHeaders) > 0 {
+		for _, k := range sortedKeys(rule.setHeaders) {
+			changes = append(changes, fmt.Sprintf("set header %s: %s", k, rule.setHeaders[k]))
+		}
+		if !dryRun {
+			if r.Headers == nil {
+				r.Headers = make(http.Header)
+			}
+			for k, v := range rule.setHeaders {
+				r.Headers.Set(k, v)
+			}
+		}
+	}
+	if rule.protocol != ProtocolAuto {
+		changes = append(changes, "force protocol HTTP/"+string(rule.protocol))
+		if !dryRun {
+			r.ctx = context.WithValue(r.Context(), rewriteProtocolKey, rule.protocol)
+		}
+	}
+	return
+}
+
+type rewriteProtocolKeyType int
+
+const rewriteProtocolKey rewriteProtocolKeyType = iota
+
+// rewriteTransport sends the requests with the dedicated transport of the
+// protocol forced by the rewrite rules.
+type rewriteTransport struct {
+	rt http.RoundTripper
+	c  *Client
+}
+
+func (t *rewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if p, ok := req.Context().Value(rewriteProtocolKey).(Protocol); ok {
+		if e := t.c.rewriteRules.transports[p]; e != nil {
+			return e.transport(t.c).RoundTrip(req)
+		}
+	}
+	return t.rt.RoundTrip(req)
+}
@@ -0,0 +1,446 @@
+package req
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrDisallowedByRobots is the error of the request which is disallowed by
+// the robots.txt of the origin, see Client.EnableRobotsTxt.
+var ErrDisallowedByRobots = errors.New("req: disallowed by robots.txt")
+
+// maxRobotsTxtSize is the max size of the robots.txt which is parsed, the
+// content after it is ignored (RFC 9309 requires at least 500 KiB).
+const maxRobotsTxtSize = 500 << 10
+
+type robotsRule struct {
+	allow   bool
+	pattern string
+}
+
+// robotsTxt is the rules of the robots.txt which apply to the user agent.
+type robotsTxt struct {
+	rules      []robotsRule
+	crawlDelay time.Duration
+	// disallowAll is set if the robots.txt is unreachable.
+	disallowAll bool
+}
+
+// parseRobotsTxt parses the robots.txt, and returns the rules of the groups
+// which match the product token of the agent, or the "*" groups if none
+// matches.
+func parseRobotsTxt(b []byte, agent string) *robotsTxt {
+	type group struct {
+		agents     []string
+		rules      []robotsRule
+		crawlDelay time.Duration
+	}
+	var groups []*group
+	var cur *group
+	inAgents := false
+	s := bufio.NewScanner(bytes.NewReader(b))
+	s.Buffer(make([]byte, 0, 4096), maxRobotsTxtSize)
+	for s.Scan() {
+		line := s.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+		switch key {
+		case "user-agent":
+			if !inAgents {
+				cur = &group{}
+				groups = append(groups, cur)
+				inAgents = true
+			}
+			cur.agents = append(cur.agents, robotsProductToken(value))
+			continue
+		case "allow", "disallow":
+			if cur != nil && value != "" {
+				cur.rules = append(cur.rules, robotsRule{allow: key == "allow", pattern: value})
+			}
+		case "crawl-delay":
+			if seconds, err := strconv.ParseFloat(value, 64); cur != nil && err == nil && seconds > 0 {
+				cur.crawlDelay = time.Duration(seconds * float64(time.Second))
+			}
+		}
+		inAgents = false
+	}
+
+	token := robotsProductToken(agent)
+	matched := func(g *group, agent string) bool {
+		for _, a := range g.agents {
+			if strings.EqualFold(a, agent) {
+				return true
+			}
+		}
+		return false
+	}
+	specific := false
+	for _, g := range groups {
+		if matched(g, token) {
+			specific = true
+			break
+		}
+	}
+	if !specific {
+		token = "*"
+	}
+	txt := &robotsTxt{}
+	for _, g := range groups {
+		if matched(g, token) {
+			txt.rules = append(txt.rules, g.rules...)
+			txt.crawlDelay = max(txt.crawlDelay, g.crawlDelay)
+		}
+	}
+	return txt
+}
+
+// robotsProductToken returns the product token of the user agent, e.g.
+// "MyBot" of "MyBot/1.0 (+https://example.com/bot)".
+func robotsProductToken(agent string) string {
+	if i := strings.IndexAny(agent, "/ "); i >= 0 {
+		agent = agent[:i]
+	}
+	return agent
+}
+
+// allowed reports whether the path (with the query) is allowed, the rule
+// with the longest matched pattern wins, and allow wins the tie.
+func (t *robotsTxt) allowed(path string) bool {
+	if path == "/robots.txt" {
+		return true
+	}
+	if t.disallowAll {
+		return false
+	}
+	longest, allow := -1, true
+	for _, r := range t.rules {
+		if n := len(r.pattern); (n > longest || n == longest && r.allow) && matchRobotsPattern(r.pattern, path) {
+			longest, allow = n, r.allow
+		}
+	}
+	return allow
+}
+
+// matchRobotsPattern reports whether the path matches the pattern, which
+// is a path prefix supporting the "*" wildcard and the "$" end anchor. The
+// prefixes of the pattern matched so far are tracked while scanning the path
+// once, which takes O(len(pattern)*len(path)) time whatever the wildcards.
+func matchRobotsPattern(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	if anchored {
+		pattern = pattern[:len(pattern)-1]
+	}
+	// matched[j] reports whether pattern[:j] matches the scanned path.
+	matched := make([]bool, len(pattern)+1)
+	matched[0] = true
+	for i := 0; ; i++ {
+		for j := 0; j < len(pattern); j++ {
+			if matched[j] && pattern[j] == '*' { // the wildcard matches nothing.
+				matched[j+1] = true
+			}
+		}
+		if matched[len(pattern)] && (!anchored || i == len(path)) {
+			return true
+		}
+		if i == len(path) {
+			return false
+		}
+		// scan backwards so that matched[j] is still the one of path[:i].
+		for j := len(pattern) - 1; j >= 0; j-- {
+			if pattern[j] != '*' { // the wildcard keeps matching.
+				matched[j+1] = matched[j] && pattern[j] == path[i]
+			}
+		}
+		matched[0] = false
+	}
+}
+
+func robotsPath(u *url.URL) string {
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+	return path
+}
+
+type robotsEntry struct {
+	ready   chan struct{}
+	txt     *robotsTxt
+	err     error
+	expires time.Time
+}
+
+// robotsChecker fetches and caches the robots.txt of the origins, and
+// enforces the rules and the crawl delay.
+type robotsChecker struct {
+	agent             string
+	ttl               time.Duration
+	allowOnError      bool
+	decision          func(req *http.Request) error
+	disableCrawlDelay bool
+
+	mu      sync.Mutex
+	entries map[string]*robotsEntry
+	next    map[string]time.Time
+}
+
+func newRobotsChecker(agent string, ttl time.Duration) *robotsChecker {
+	return &robotsChecker{
+		agent:   agent,
+		ttl:     ttl,
+		entries: make(map[string]*robotsEntry),
+		next:    make(map[string]time.Time),
+	}
+}
+
+func (rc *robotsChecker) Clone() *robotsChecker {
+	if rc == nil {
+		return nil
+	}
+	cc := newRobotsChecker(rc.agent, rc.ttl)
+	cc.allowOnError = rc.allowOnError
+	cc.decision = rc.decision
+	cc.disableCrawlDelay = rc.disableCrawlDelay
+	return cc
+}
+
+// get returns the robots.txt of the origin, which is fetched once by the
+// first request while the concurrent requests wait for it.
+func (rc *robotsChecker) get(c *Client, ctx context.Context, origin string) (*robotsTxt, error) {
+	for {
+		rc.mu.Lock()
+		e := rc.entries[origin]
+		if e != nil {
+			select {
+			case <-e.ready:
+				if !time.Now().Before(e.expires) {
+					e = nil
+				}
+			default:
+			}
+		}
+		if e == nil {
+			e = &robotsEntry{ready: make(chan struct{})}
+			rc.entries[origin] = e
+			rc.mu.Unlock()
+			e.txt, e.err = rc.fetch(c, ctx, origin)
+			e.expires = time.Now().Add(rc.ttl)
+			if e.err != nil { // not cached, e.g. the request is cancelled.
+				rc.mu.Lock()
+				if rc.entries[origin] == e {
+					delete(rc.entries, origin)
+				}
+				rc.mu.Unlock()
+			}
+			close(e.ready)
+			return e.txt, e.err
+		}
+		rc.mu.Unlock()
+		select {
+		case <-e.ready:
+			if e.err == nil {
+				return e.txt, nil
+			}
+			// the request which fetched it is cancelled, fetch again.
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+type robotsFetchKey struct{}
+
+// fetch fetches the robots.txt with the client, the request is marked so
+// that it is not checked recursively, and it's cancelled with ctx without
+// inheriting the values of it.
+func (rc *robotsChecker) fetch(c *Client, ctx context.Context, origin string) (*robotsTxt, error) {
+	fetchCtx, cancel := context.WithCancel(context.WithValue(context.Background(), robotsFetchKey{}, true))
+	defer cancel()
+	stop := context.AfterFunc(ctx, cancel)
+	defer stop()
+	resp, err := c.R().SetContext(fetchCtx).DisableAutoReadResponse().Get(origin + "/robots.txt")
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if err != nil && resp.Response == nil {
+		return rc.unreachable(), nil
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode <= 299:
+		b, err := io.ReadAll(io.LimitReader(resp.Body, maxRobotsTxtSize))
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return rc.unreachable(), nil
+		}
+		if len(b) == maxRobotsTxtSize { // drop the truncated line.
+			if i := bytes.LastIndexByte(b, '\n'); i >= 0 {
+				b = b[:i]
+			}
+		}
+		return parseRobotsTxt(b, rc.agent), nil
+	case resp.StatusCode >= 400 && resp.StatusCode <= 499:
+		return &robotsTxt{}, nil
+	}
+	return rc.unreachable(), nil
+}
+
+// unreachable returns the rules if the robots.txt is unreachable (5xx or
+// the request failed), which disallows all unless allowOnError is set.
+func (rc *robotsChecker) unreachable() *robotsTxt {
+	return &robotsTxt{disallowAll: !rc.allowOnError}
+}
+
+// wait waits for the crawl delay of the origin since the last request.
+func (rc *robotsChecker) wait(ctx context.Context, origin string, delay time.Duration) error {
+	rc.mu.Lock()
+	now := time.Now()
+	at := rc.next[origin]
+	if at.Before(now) {
+		at = now
+	}
+	rc.next[origin] = at.Add(delay)
+	rc.mu.Unlock()
+	d := at.Sub(now)
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type robotsTransport struct {
+	rt http.RoundTripper
+	c  *Client
+}
+
+func (t *robotsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rc := t.c.robots
+	ctx := req.Context()
+	if rc == nil || ctx.Value(robotsFetchKey{}) != nil || (req.URL.Scheme != "http" && req.URL.Scheme != "https") {
+		return t.rt.RoundTrip(req)
+	}
+	origin := req.URL.Scheme + "://" + req.URL.Host
+	txt, err := rc.get(t.c, ctx, origin)
+	if err == nil && !txt.allowed(robotsPath(req.URL)) {
+		err = fmt.Errorf("%w: %s", ErrDisallowedByRobots, req.URL.Redacted())
+		if rc.decision != nil {
+			err = rc.decision(req)
+		}
+	}
+	if err == nil && txt.crawlDelay > 0 && !rc.disableCrawlDelay {
+		err = rc.wait(ctx, origin, txt.crawlDelay)
+	}
+	if err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	return t.rt.RoundTrip(req)
+}
+
+// EnableRobotsTxt enables obeying the robots.txt of the origins for the
+// crawler-style usage. Before the first request to an origin, its
+// "/robots.txt" is fetched with the client itself (which is not checked
+// recursively) and cached for cacheTTL, and the Allow and Disallow rules
+// of the group matching the product token of userAgent (e.g. "MyBot" of
+// "MyBot/1.0"), or the "*" group if none matches, are evaluated against
+// the path and query of each request (including the redirects). The most
+// specific (longest) rule wins, "*" and "$" in the rules are supported.
+// The disallowed request fails with ErrDisallowedByRobots, use
+// SetRobotsTxtDecisionFunc to decide it instead. The requests to the
+// origin are spaced by the Crawl-delay of the group, see
+// DisableRobotsTxtCrawlDelay.
+//
+// The 4xx response of the robots.txt (e.g. 404) allows all, while the 5xx
+// response or the failure to fetch it disallows all, see
+// SetRobotsTxtAllowOnError. Only the first 500 KiB of the robots.txt is
+// parsed, the rest is ignored.
+func (c *Client) EnableRobotsTxt(userAgent string, cacheTTL time.Duration) *Client {
+	rc := newRobotsChecker(userAgent, cacheTTL)
+	if c.robots != nil {
+		rc.allowOnError = c.robots.allowOnError
+		rc.decision = c.robots.decision
+		rc.disableCrawlDelay = c.robots.disableCrawlDelay
+	}
+	c.robots = rc
+	c.httpClient.Transport = c.newHttpTransport()
+	return c
+}
+
+// DisableRobotsTxt disables obeying the robots.txt enabled by
+// EnableRobotsTxt (default).
+func (c *Client) DisableRobotsTxt() *Client {
+	if c.robots == nil {
+		return c
+	}
+	c.robots = nil
+	c.httpClient.Transport = c.newHttpTransport()
+	return c
+}
+
+// SetRobotsTxtAllowOnError set whether to allow all if the robots.txt is
+// unreachable, that is the server responds 5xx or the request fails,
+// default is false which disallows all as RFC 9309 suggests.
+func (c *Client) SetRobotsTxtAllowOnError(allow bool) *Client {
+	if c.robots == nil {
+		c.log.Warnf("ignore SetRobotsTxtAllowOnError, call EnableRobotsTxt first")
+		return c
+	}
+	c.robots.allowOnError = allow
+	return c
+}
+
+// SetRobotsTxtDecisionFunc set the function which decides the request
+// disallowed by the robots.txt instead of failing it with
+// ErrDisallowedByRobots, return nil to send the request anyway (e.g. just
+// log it), or the error to fail the request with.
+func (c *Client) SetRobotsTxtDecisionFunc(fn func(req *http.Request) error) *Client {
+	if c.robots == nil {
+		c.log.Warnf("ignore SetRobotsTxtDecisionFunc, call EnableRobotsTxt first")
+		return c
+	}
+	c.robots.decision = fn
+	return c
+}
+
+// DisableRobotsTxtCrawlDelay disables spacing the requests to the origin by
+// the Crawl-delay of the robots.txt, e.g. if the requests are rate limited
+// elsewhere.
+func (c *Client) DisableRobotsTxtCrawlDelay() *Client {
+	if c.robots == nil {
+		c.log.Warnf("ignore DisableRobotsTxtCrawlDelay, call EnableRobotsTxt first")
+		return c
+	}
+	c.robots.disableCrawlDelay = true
+	return c
+}
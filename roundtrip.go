@@ -18,6 +18,12 @@ import (
 // Like the RoundTripper interface, the error types returned
 // by RoundTrip are unspecified.
 func (t *Transport) RoundTrip(req *http.Request) (resp *http.Response, err error) {
+	if t.clientHints != nil {
+		req = t.clientHints.apply(req)
+	}
+	if h := wireHasherFromContext(req.Context()); h != nil {
+		h.begin()
+	}
 	if t.wrappedRoundTrip != nil {
 		resp, err = t.wrappedRoundTrip.RoundTrip(req)
 	} else {
@@ -31,6 +37,10 @@ func (t *Transport) RoundTrip(req *http.Request) (resp *http.Response, err error
 			t.handleAltSvc(req, v)
 		}
 	}
+	if t.clientHints != nil {
+		t.clientHints.recordAcceptCH(req, resp)
+	}
+	t.handleWireHash(resp, req)
 	t.handleResponseBody(resp, req)
 	return
 }
@@ -0,0 +1,210 @@
+package req
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"runtime"
+	"sync"
+)
+
+// spilledBody is the response body which is spooled to a temp file, see
+// Client.SetBodySpillThreshold.
+type spilledBody struct {
+	f    *os.File
+	size int64
+
+	once sync.Once
+	err  error
+}
+
+func (s *spilledBody) reader() *io.SectionReader {
+	return io.NewSectionReader(s.f, 0, s.size)
+}
+
+// remove closes and removes the temp file, which is safe to be called
+// multiple times.
+func (s *spilledBody) remove() error {
+	s.once.Do(func() {
+		s.err = s.f.Close()
+		if err := os.Remove(s.f.Name()); s.err == nil {
+			s.err = err
+		}
+	})
+	return s.err
+}
+
+// SetBodySpillThreshold set the max size of the response body which is
+// buffered in memory when it's read (automatically or with
+// Response.ToBytes), the larger body is spooled to a temp file (see
+// SetBodySpillDir) instead, which is useful for the very large responses
+// that still need the random access, use Response.BodyReader to read the
+// body in memory or in the file uniformly. The spilled body is unmarshalled
+// from the file without loading it (unless the unmarshal function is
+// customized by SetJsonUnmarshal or SetXmlUnmarshal), Response.Bytes and
+// Response.String read up to the first 16MB from the file, while
+// Response.ToBytes loads the whole body into memory. The temp file is removed by Response.Close, or when the Response
+// is garbage collected as a safety net. The limits of the decompressed body
+// (see SetMaxDecompressedSize) apply to the spilled body as well. Zero or
+// negative disables spilling (default), and so does
+// SetResponseBodyTransformer which needs the whole body in memory.
+func (c *Client) SetBodySpillThreshold(n int64) *Client {
+	c.bodySpillThreshold = n
+	return c
+}
+
+// SetBodySpillDir set the directory of the temp files of the spilled
+// response bodies (see SetBodySpillThreshold), default is os.TempDir.
+func (c *Client) SetBodySpillDir(dir string) *Client {
+	c.bodySpillDir = dir
+	return c
+}
+
+// spillBody reads the body into memory up to the spill threshold, the
+// larger body is spooled to a temp file.
+func (c *Client) spillBody(body io.Reader) ([]byte, *spilledBody, error) {
+	threshold := c.bodySpillThreshold
+	b, err := io.ReadAll(io.LimitReader(body, threshold+1))
+	if err != nil || int64(len(b)) <= threshold {
+		return b, nil, err
+	}
+	f, err := os.CreateTemp(c.bodySpillDir, "req-body-*")
+	if err != nil {
+		return nil, nil, fmt.Errorf("req: failed to spill response body: %w", err)
+	}
+	s := &spilledBody{f: f}
+	n, err := io.Copy(f, io.MultiReader(bytes.NewReader(b), body))
+	if err != nil {
+		s.remove()
+		return nil, nil, err
+	}
+	s.size = n
+	return nil, s, nil
+}
+
+// readBody reads the body if it has not been read, which is spilled to a
+// temp file if it's too large, see Client.SetBodySpillThreshold.
+func (r *Response) readBody() (err error) {
+	if r.Err != nil {
+		return r.Err
+	}
+	if r.body != nil || r.spilled != nil {
+		return nil
+	}
+	if r.Request != nil && r.Request.unbufferedBody {
+		return ErrUnbufferedBody
+	}
+	if r.Response == nil || r.Response.Body == nil {
+		return nil
+	}
+	var body []byte
+	defer func() {
+		r.Body.Close()
+		if err != nil {
+			err = canceledError(r.ctx, err)
+			r.Err = err
+		}
+		r.body = body
+	}()
+	c := r.Request.client
+	if c.bodySpillThreshold > 0 && c.responseBodyTransformer == nil {
+		var s *spilledBody
+		body, s, err = c.spillBody(r.Body)
+		if s != nil {
+			r.spilled = s
+			runtime.AddCleanup(r, func(s *spilledBody) { s.remove() }, s)
+		}
+	} else {
+		body, err = io.ReadAll(r.Body)
+	}
+	r.setReceivedAt()
+	if err == nil && r.spilled == nil && c.responseBodyTransformer != nil {
+		body, err = c.responseBodyTransformer(body, r.Request, r)
+	}
+	return
+}
+
+// rereadableBody returns the body which has been read for re-reads.
+func (r *Response) rereadableBody() io.ReadCloser {
+	if r.spilled != nil {
+		return io.NopCloser(r.spilled.reader())
+	}
+	return io.NopCloser(bytes.NewReader(r.body))
+}
+
+// resetBody discards the read body before the response is replaced, e.g.
+// by the retry.
+func (r *Response) resetBody() {
+	r.body = nil
+	if r.spilled != nil {
+		r.spilled.remove()
+		r.spilled = nil
+	}
+}
+
+// BodyReader returns the reader of the response body which supports the
+// random access, the body is read if it has not been read. The reader reads
+// from memory or from the temp file if the body is spilled (see
+// Client.SetBodySpillThreshold) uniformly, and each call returns a new
+// reader which starts from the beginning.
+func (r *Response) BodyReader() (*io.SectionReader, error) {
+	if err := r.readBody(); err != nil {
+		return nil, err
+	}
+	if r.spilled != nil {
+		return r.spilled.reader(), nil
+	}
+	return io.NewSectionReader(bytes.NewReader(r.body), 0, int64(len(r.body))), nil
+}
+
+// Close releases the response, the spilled body (see
+// Client.SetBodySpillThreshold) is removed, and the unread body is
+// discarded (see Discard). The body can not be read after Close.
+func (r *Response) Close() error {
+	if r.spilled != nil {
+		return r.spilled.remove()
+	}
+	return r.Discard()
+}
+
+// unmarshalJson unmarshalls the JSON body, the spilled body is decoded from
+// the temp file without loading it unless the unmarshal function is
+// customized.
+func (r *Response) unmarshalJson(v any) error {
+	if err := r.readBody(); err != nil {
+		return err
+	}
+	c := r.Request.client
+	if r.spilled != nil && isSameFunc(c.jsonUnmarshal, json.Unmarshal) {
+		return json.NewDecoder(r.spilled.reader()).Decode(v)
+	}
+	b, err := r.ToBytes()
+	if err != nil {
+		return err
+	}
+	return c.jsonUnmarshal(b, v)
+}
+
+// unmarshalXml is similar to unmarshalJson, but for the XML body.
+func (r *Response) unmarshalXml(v any) error {
+	if err := r.readBody(); err != nil {
+		return err
+	}
+	c := r.Request.client
+	if r.spilled != nil && isSameFunc(c.xmlUnmarshal, xml.Unmarshal) {
+		return xml.NewDecoder(r.spilled.reader()).Decode(v)
+	}
+	b, err := r.ToBytes()
+	if err != nil {
+		return err
+	}
+	return c.xmlUnmarshal(b, v)
+}
+
+func isSameFunc(f1, f2 any) bool {
+	return reflect.ValueOf(f1).Pointer() == reflect.ValueOf(f2).Pointer()
+}
@@ -0,0 +1,296 @@
+package req
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// Sentinel errors of the host checks, which are wrapped in
+// HostNotAllowedError and can be checked with errors.Is.
+var (
+	ErrHostDenied      = errors.New("host is denied")
+	ErrHostNotAllowed  = errors.New("host is not in the allowed list")
+	ErrInternalAddress = errors.New("internal address is not allowed")
+)
+
+// HostNotAllowedError is returned if the connection to the host is rejected
+// by the host checks, see Client.SetAllowedHosts, Client.SetDeniedHosts,
+// Client.SetDialGuard and Client.EnableSSRFProtection. Err is one of the
+// ErrHost* errors, ErrInternalAddress or the error of the dial guard.
+type HostNotAllowedError struct {
+	Host string
+	// IP is the resolved IP which is about to be dialed, it's invalid if the
+	// host is rejected before the resolution.
+	IP  netip.Addr
+	Err error
+}
+
+func (e *HostNotAllowedError) Error() string {
+	if !e.IP.IsValid() {
+		return fmt.Sprintf("req: host %s is not allowed: %v", e.Host, e.Err)
+	}
+	return fmt.Sprintf("req: host %s (%s) is not allowed: %v", e.Host, e.IP, e.Err)
+}
+
+func (e *HostNotAllowedError) Unwrap() error {
+	return e.Err
+}
+
+// internalPrefixes is the ranges which are rejected when the SSRF protection
+// is enabled, besides the loopback, link-local, private and unspecified
+// addresses.
+var internalPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),      // carrier-grade NAT, e.g. 100.100.100.200 of the Alibaba Cloud metadata service.
+	netip.MustParsePrefix("192.0.0.0/24"),       // IETF protocol assignments.
+	netip.MustParsePrefix("198.18.0.0/15"),      // benchmarking.
+	netip.MustParsePrefix("255.255.255.255/32"), // broadcast.
+	netip.MustParsePrefix("fd00:ec2::254/128"),  // the AWS metadata service over IPv6.
+	netip.MustParsePrefix("64:ff9b::/96"),       // NAT64 which may map to the internal IPv4 addresses.
+}
+
+func isInternalAddr(addr netip.Addr) bool {
+	if isPrivateAddr(addr) || addr.IsMulticast() {
+		return true
+	}
+	for _, p := range internalPrefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// hostPattern is a pattern of the host checks, which is a host name, a
+// wildcard host name (e.g. "*.example.com"), an IP address or a CIDR.
+type hostPattern struct {
+	name   string
+	prefix netip.Prefix
+}
+
+func parseHostPattern(s string) hostPattern {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if prefix, err := netip.ParsePrefix(s); err == nil {
+		return hostPattern{prefix: prefix.Masked()}
+	}
+	if addr, err := netip.ParseAddr(strings.Trim(s, "[]")); err == nil {
+		addr = addr.Unmap()
+		return hostPattern{prefix: netip.PrefixFrom(addr, addr.BitLen())}
+	}
+	return hostPattern{name: strings.TrimSuffix(s, ".")}
+}
+
+func (p hostPattern) isIP() bool {
+	return p.prefix.IsValid()
+}
+
+func (p hostPattern) matchName(host string) bool {
+	if p.name == "" {
+		return false
+	}
+	if suffix, ok := strings.CutPrefix(p.name, "*"); ok { // "*.example.com" matches the subdomains.
+		return strings.HasSuffix(host, suffix)
+	}
+	return host == p.name
+}
+
+func (p hostPattern) matchIP(addr netip.Addr) bool {
+	return p.prefix.IsValid() && addr.IsValid() && p.prefix.Contains(addr)
+}
+
+// hostGuard is the host checks of the client, which is immutable once set
+// to the client, the setters create a modified copy.
+type hostGuard struct {
+	allowed   []hostPattern
+	denied    []hostPattern
+	ssrf      bool
+	dialGuard func(ctx context.Context, network, addr string, resolved []net.IP) error
+}
+
+func (g *hostGuard) clone() *hostGuard {
+	if g == nil {
+		return &hostGuard{}
+	}
+	gg := *g
+	return &gg
+}
+
+func (g *hostGuard) isEmpty() bool {
+	return len(g.allowed) == 0 && len(g.denied) == 0 && !g.ssrf && g.dialGuard == nil
+}
+
+func normalizeHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.Trim(host, "[]")), ".")
+}
+
+// checkHost checks the host name of the request before dialing, the host
+// which is an IP address is checked by checkIP as well.
+func (g *hostGuard) checkHost(host string) error {
+	host = normalizeHost(host)
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return g.checkIP(host, addr.Unmap())
+	}
+	for _, p := range g.denied {
+		if p.matchName(host) {
+			return &HostNotAllowedError{Host: host, Err: ErrHostDenied}
+		}
+	}
+	if len(g.allowed) == 0 || g.allowedName(host) {
+		return nil
+	}
+	for _, p := range g.allowed {
+		if p.isIP() { // the resolved IP may be allowed, which is checked when dialing.
+			return nil
+		}
+	}
+	return &HostNotAllowedError{Host: host, Err: ErrHostNotAllowed}
+}
+
+func (g *hostGuard) allowedName(host string) bool {
+	for _, p := range g.allowed {
+		if p.matchName(host) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkIP checks the IP which is about to be dialed for the host.
+func (g *hostGuard) checkIP(host string, addr netip.Addr) error {
+	for _, p := range g.denied {
+		if p.matchIP(addr) {
+			return &HostNotAllowedError{Host: host, IP: addr, Err: ErrHostDenied}
+		}
+	}
+	allowedIP := false
+	for _, p := range g.allowed {
+		if p.matchIP(addr) {
+			allowedIP = true
+			break
+		}
+	}
+	if len(g.allowed) > 0 && !allowedIP && !g.allowedName(host) {
+		return &HostNotAllowedError{Host: host, IP: addr, Err: ErrHostNotAllowed}
+	}
+	// only the explicitly allowed IP or CIDR bypasses the SSRF protection,
+	// the allowed host name may resolve to an internal address.
+	if g.ssrf && !allowedIP && isInternalAddr(addr) {
+		return &HostNotAllowedError{Host: host, IP: addr, Err: ErrInternalAddress}
+	}
+	return nil
+}
+
+// guardDial is the transport.Options.DialGuard of the host guard.
+func (g *hostGuard) guardDial(ctx context.Context, network, addr string, ip net.IP) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	host = normalizeHost(host)
+	if a, ok := netip.AddrFromSlice(ip); ok {
+		if err = g.checkIP(host, a.Unmap()); err != nil {
+			return err
+		}
+	}
+	if g.dialGuard != nil {
+		if err = g.dialGuard(ctx, network, addr, []net.IP{ip}); err != nil {
+			var hostErr *HostNotAllowedError
+			if errors.As(err, &hostErr) {
+				return err
+			}
+			a, _ := netip.AddrFromSlice(ip)
+			return &HostNotAllowedError{Host: host, IP: a.Unmap(), Err: err}
+		}
+	}
+	return nil
+}
+
+// checkRequestHost checks the host of the request and the redirects before
+// dialing.
+func (c *Client) checkRequestHost(req *http.Request) error {
+	if c.hostGuard == nil {
+		return nil
+	}
+	return c.hostGuard.checkHost(req.URL.Hostname())
+}
+
+func (c *Client) setHostGuard(g *hostGuard) *Client {
+	defer c.resetHostProfileTransports()
+	if g.isEmpty() {
+		c.hostGuard = nil
+		c.Transport.DialGuard = nil
+		return c
+	}
+	c.hostGuard = g
+	c.Transport.DialGuard = g.guardDial
+	return c
+}
+
+// SetAllowedHosts set the allow-list of the hosts, the requests (including
+// the redirects) to the other hosts fail with HostNotAllowedError. Each
+// pattern is a host name, a wildcard host name which matches the subdomains
+// (e.g. "*.example.com"), an IP address or a CIDR (e.g. "203.0.113.0/24"),
+// the IP and CIDR patterns are matched against the IP which is actually
+// dialed. Call it without patterns to clear the allow-list.
+func (c *Client) SetAllowedHosts(patterns ...string) *Client {
+	g := c.hostGuard.clone()
+	g.allowed = nil
+	for _, p := range patterns {
+		g.allowed = append(g.allowed, parseHostPattern(p))
+	}
+	return c.setHostGuard(g)
+}
+
+// SetDeniedHosts set the deny-list of the hosts, the requests (including
+// the redirects) to the matched hosts fail with HostNotAllowedError, which
+// takes precedence over the allow-list. The patterns are the same as
+// SetAllowedHosts. Call it without patterns to clear the deny-list.
+func (c *Client) SetDeniedHosts(patterns ...string) *Client {
+	g := c.hostGuard.clone()
+	g.denied = nil
+	for _, p := range patterns {
+		g.denied = append(g.denied, parseHostPattern(p))
+	}
+	return c.setHostGuard(g)
+}
+
+// SetDialGuard set the function which is called with the address and the
+// resolved IP of each connection to the origin server (including the
+// redirects and the UDP dial of HTTP3) right before connecting, the resolved
+// contains the IP which is actually dialed, so that DNS rebinding can not
+// bypass the check, it is called for each IP which is tried. The error
+// fails the request, wrapped in HostNotAllowedError. The connections to the
+// proxy are not checked, and the connections returned by the custom dial
+// functions (SetDial, SetDialTLS and SetHTTP3Dial) are checked with their
+// remote address after connecting.
+func (c *Client) SetDialGuard(fn func(ctx context.Context, network, addr string, resolved []net.IP) error) *Client {
+	g := c.hostGuard.clone()
+	g.dialGuard = fn
+	return c.setHostGuard(g)
+}
+
+// EnableSSRFProtection rejects the connections to the loopback, link-local
+// (including the 169.254.169.254 metadata service), private (RFC 1918 and
+// RFC 4193), unspecified, multicast, carrier-grade NAT and the other
+// internal addresses with HostNotAllowedError, which protects the service
+// which sends requests to the user-supplied URLs. The IP which is actually
+// dialed is checked, including the redirects and HTTP3. The IP and CIDR
+// patterns of SetAllowedHosts are exempted. Note the proxy resolves the
+// host names itself, the protection does not apply when a proxy is used.
+func (c *Client) EnableSSRFProtection() *Client {
+	g := c.hostGuard.clone()
+	g.ssrf = true
+	return c.setHostGuard(g)
+}
+
+// DisableSSRFProtection disables the SSRF protection (default).
+func (c *Client) DisableSSRFProtection() *Client {
+	g := c.hostGuard.clone()
+	g.ssrf = false
+	return c.setHostGuard(g)
+}
@@ -0,0 +1,335 @@
+package req
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/imroc/req/v3/internal/dump"
+)
+
+// StdClient returns a standard `http.Client` which sends requests through the
+// full pipeline of req's client, useful for integrating with libraries which
+// only accept `*http.Client` (e.g. oauth2, cloud SDKs and generated clients),
+// while still benefiting from req's features.
+//
+// Features that are active in this mode:
+//   - Request middlewares (OnBeforeRequest), client middlewares (WrapRoundTrip)
+//     and response middlewares (OnAfterResponse).
+//   - Common headers, cookies and query params, base URL is ignored if the
+//     requested URL is absolute.
+//   - Retry, only if the request body is replayable (http.Request.GetBody is
+//     set, or there is no body).
+//   - Redirect policies, the redirects are followed by req's client.
+//   - The cookie jar, which is shared with req's client.
+//   - Impersonation, TLS fingerprint, http2 and http3 settings, dump,
+//     debug log, trace and timeout.
+//
+// Features that are disabled in order to keep the raw semantics of net/http:
+//   - Auto-read response body, the `Response.Body` is streamed and must be
+//     closed by the caller.
+//   - Auto-decode the response body to utf-8.
+//   - Unmarshal the response body with SetCommonError or SetCommonErrorResult.
+//
+// Context and cancellation are passed through, and any error returned by req's
+// pipeline (including an error returned by response middlewares) is returned
+// as the error of `http.Client.Do`.
+func (c *Client) StdClient() *http.Client {
+	return &http.Client{
+		Transport: stdRoundTripper{c},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			// redirects have been followed by req's client.
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// RoundTripper returns the lower-level `http.RoundTripper` of the client,
+// which only provides the transport layer (impersonation, TLS fingerprint,
+// http2 and http3, transport middlewares, dump and auto-decode), without
+// retry, request and response middlewares, redirect and cookie jar.
+func (c *Client) RoundTripper() http.RoundTripper {
+	return c.httpClient.Transport
+}
+
+// SetRoundTripper set the external http.RoundTripper which all requests are
+// sent through, instead of req's own Transport, useful when the transport is
+// pre-configured by the platform (e.g. with mTLS and egress policy). Pass nil
+// to use req's own Transport again.
+//
+// The features which do not require owning the transport still work, such
+// as retry, request and response middlewares, client middlewares (WrapRoundTrip),
+// unmarshal, dump and auto-decode. The features which require owning the
+// transport, such as tls fingerprint impersonation, custom tls handshake,
+// custom dial, http3, and the protocol or tls config forced by the host
+// profiles (see SetHostProfile) or rewrite rules (see LoadRewriteRules), make
+// the request fail with an error wraps ErrUnsupportedWithExternalTransport
+// rather than being silently ignored.
+// Transport middlewares (Transport.WrapRoundTrip) are not applied, use client
+// middlewares instead.
+func (c *Client) SetRoundTripper(rt http.RoundTripper) *Client {
+	c.roundTripper = rt
+	c.httpClient.Transport = c.newHttpTransport()
+	return c
+}
+
+// WrapRoundTripper wraps the http.RoundTripper of the client, the wrappers see
+// the actual http.Request and http.Response, which is the escape hatch to plug
+// in decorators from the ecosystem, e.g. otelhttp.NewTransport:
+//
+//	client.WrapRoundTripper(func(rt http.RoundTripper) http.RoundTripper {
+//		return otelhttp.NewTransport(rt)
+//	})
+//
+// The wrappers are applied in the order of registration, so the last one is
+// the outermost. They wrap the whole transport stack, including the external
+// http.RoundTripper set by SetRoundTripper, the cookie jar and the response
+// cache, unlike Transport.WrapRoundTrip which only wraps req's own Transport.
+//
+// The retry loop, redirects and req's request and response middlewares sit
+// above the wrapped http.RoundTripper, so every retry attempt and every
+// redirect hop passes through the wrappers once, with its own http.Request.
+// The wrappers are called again whenever the transport stack is rebuilt (e.g.
+// by SetRoundTripper, SetResponseCache or Clone), so they should not keep
+// state of their own across calls.
+func (c *Client) WrapRoundTripper(wrappers ...HttpRoundTripWrapper) *Client {
+	if len(wrappers) == 0 {
+		return c
+	}
+	c.httpRoundTripWrappers = append(c.httpRoundTripWrappers, wrappers...)
+	c.httpClient.Transport = c.newHttpTransport()
+	return c
+}
+
+func (c *Client) newHttpTransport() http.RoundTripper {
+	var rt http.RoundTripper = c.Transport
+	if len(c.hostProfiles) > 0 {
+		rt = &hostProfileTransport{c: c}
+	}
+	if c.rewriteRules != nil {
+		rt = &rewriteTransport{rt: rt, c: c}
+	}
+	if c.roundTripper != nil {
+		rt = &externalTransport{rt: c.roundTripper, t: c.Transport, c: c}
+	}
+	if c.negativeCache != nil {
+		rt = &negativeCacheTransport{rt: rt, c: c}
+	}
+	rt = &dumpHopTransport{rt: rt}
+	if c.cookieJar != nil {
+		rt = &cookieJarTransport{rt: rt, c: c}
+	}
+	if c.strictPolicy != nil {
+		rt = &strictTransport{rt: rt, c: c}
+	}
+	if c.responseCache != nil {
+		rt = &cacheTransport{rt: rt, c: c}
+	}
+	if c.robots != nil {
+		rt = &robotsTransport{rt: rt, c: c}
+	}
+	for _, w := range c.httpRoundTripWrappers {
+		rt = w(rt)
+	}
+	return rt
+}
+
+type stdRoundTripper struct {
+	*Client
+}
+
+// RoundTrip implements http.RoundTripper, which converts the http.Request
+// into a Request and sends it through the client's pipeline.
+func (rt stdRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := rt.R()
+	r.stdRequest = req
+	r.disableAutoReadResponse = true
+	r.ctx = req.Context()
+	r.close = req.Close
+	r.Headers = req.Header.Clone()
+	if r.Headers == nil {
+		r.Headers = make(http.Header)
+	}
+	if req.Host != "" && req.Host != req.URL.Host {
+		r.Headers.Set("Host", req.Host)
+	}
+
+	body := &stdRequestBody{req: req}
+	if req.Body != nil && req.Body != http.NoBody {
+		r.GetBody = body.get
+		if req.GetBody == nil { // unreplayable body, never retry.
+			r.retryOption = nil
+		}
+	}
+	defer body.closeIfUnused()
+
+	resp, err := r.Send(req.Method, req.URL.String())
+	if err != nil {
+		if resp.Response != nil && resp.Body != nil {
+			resp.Body.Close()
+		}
+		return nil, err
+	}
+	return resp.Response, nil
+}
+
+// stdRequestBody sends the original body of the http.Request at the first
+// attempt, and the body returned by http.Request.GetBody at later attempts.
+type stdRequestBody struct {
+	req  *http.Request
+	mu   sync.Mutex
+	used bool
+}
+
+func (b *stdRequestBody) get() (io.ReadCloser, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.used {
+		b.used = true
+		return b.req.Body, nil
+	}
+	return b.req.GetBody()
+}
+
+// closeIfUnused closes the original body if it is never sent, which is
+// required by the contract of http.RoundTripper.
+func (b *stdRequestBody) closeIfUnused() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.used && b.req.Body != nil {
+		b.used = true
+		b.req.Body.Close()
+	}
+}
+
+// ErrUnsupportedWithExternalTransport is returned when a feature which
+// requires owning the transport is used with an external http.RoundTripper,
+// see NewClientWithRoundTripper and Client.SetRoundTripper.
+var ErrUnsupportedWithExternalTransport = errors.New("unsupported with external transport")
+
+// NewClientWithRoundTripper create a new client which sends all requests
+// through the provided http.RoundTripper, see Client.SetRoundTripper.
+func NewClientWithRoundTripper(rt http.RoundTripper) *Client {
+	return C().SetRoundTripper(rt)
+}
+
+// externalTransport sends requests through an external http.RoundTripper,
+// and provides the features which do not require owning the transport,
+// such as dump and auto-decode.
+type externalTransport struct {
+	rt http.RoundTripper
+	t  *Transport
+	c  *Client
+}
+
+func (et *externalTransport) checkUnsupported(req *http.Request) error {
+	t := et.t
+	var feature string
+	switch {
+	case et.forcedByRewriteRule(req):
+		feature = "protocol forced by rewrite rule"
+	case et.forcedByHostProfile(req):
+		feature = "protocol or tls config of host profile"
+	case t.TLSHandshakeContext != nil:
+		feature = "tls fingerprint and custom tls handshake"
+	case t.DialContext != nil || t.DialTLSContext != nil || t.Dialer != nil:
+		feature = "custom dial"
+	case t.t3 != nil:
+		feature = "http3"
+	default:
+		return nil
+	}
+	return fmt.Errorf("%s is %w", feature, ErrUnsupportedWithExternalTransport)
+}
+
+func (et *externalTransport) forcedByRewriteRule(req *http.Request) bool {
+	_, ok := req.Context().Value(rewriteProtocolKey).(Protocol)
+	return ok
+}
+
+func (et *externalTransport) forcedByHostProfile(req *http.Request) bool {
+	if len(et.c.hostProfiles) == 0 {
+		return false
+	}
+	e := et.c.hostProfile(req.URL.Host)
+	return e != nil && e.profile.needTransport()
+}
+
+// RoundTrip implements http.RoundTripper.
+func (et *externalTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := et.checkUnsupported(req); err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	if et.t.clientHints != nil {
+		req = et.t.clientHints.apply(req)
+	}
+	dumps := dump.GetDumpers(req.Context(), et.t.Dump)
+	if len(dumps) > 0 {
+		r := *req
+		req = &r
+		dumpRequestHeader(req, dumps)
+		if req.Body != nil && req.Body != http.NoBody {
+			req.Body = &dumpRequestBodyReadCloser{ReadCloser: req.Body, dumps: dumps}
+		}
+	}
+	resp, err := et.rt.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if ds := dump.GetResponseHeaderDumpers(req.Context(), et.t.Dump); ds.ShouldDump() {
+		dumpResponseHeader(resp, ds)
+	}
+	if et.t.clientHints != nil {
+		et.t.clientHints.recordAcceptCH(req, resp)
+	}
+	et.t.handleResponseBody(resp, req)
+	return resp, nil
+}
+
+func dumpRequestHeader(req *http.Request, dumps []*dump.Dumper) {
+	var buf bytes.Buffer
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	fmt.Fprintf(&buf, "%s %s HTTP/1.1\r\nHost: %s\r\n", req.Method, req.URL.RequestURI(), host)
+	req.Header.Write(&buf)
+	buf.WriteString("\r\n")
+	for _, d := range dumps {
+		if d.RequestHeader() {
+			d.DumpRequestHeader(buf.Bytes())
+		}
+	}
+}
+
+func dumpResponseHeader(resp *http.Response, ds dump.Dumpers) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s %s\r\n", resp.Proto, resp.Status)
+	resp.Header.Write(&buf)
+	buf.WriteString("\r\n")
+	ds.DumpResponseHeader(buf.Bytes())
+}
+
+type dumpRequestBodyReadCloser struct {
+	io.ReadCloser
+	dumps []*dump.Dumper
+}
+
+func (r *dumpRequestBodyReadCloser) Read(p []byte) (n int, err error) {
+	n, err = r.ReadCloser.Read(p)
+	for _, d := range r.dumps {
+		if d.RequestBody() {
+			d.DumpRequestBody(p[:n])
+			if err == io.EOF {
+				d.DumpDefault([]byte("\r\n\r\n"))
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,225 @@
+package req
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// ResponseHeaderTimeoutError is returned if the response headers are not
+// received in time, see Request.SetResponseHeaderTimeout.
+type ResponseHeaderTimeoutError struct {
+	Duration time.Duration
+}
+
+func (e *ResponseHeaderTimeoutError) Error() string {
+	return fmt.Sprintf("req: timeout awaiting response headers after %s", e.Duration)
+}
+
+// Timeout reports whether the error is a timeout, which is always true.
+func (e *ResponseHeaderTimeoutError) Timeout() bool { return true }
+
+// HeaderTimeoutError is returned if the first byte of the response is not
+// received in time after the request is written, see
+// Request.SetHeaderTimeout.
+type HeaderTimeoutError struct {
+	Duration time.Duration
+}
+
+func (e *HeaderTimeoutError) Error() string {
+	return fmt.Sprintf("req: no response received in %s after the request is written", e.Duration)
+}
+
+// Timeout reports whether the error is a timeout, which is always true.
+func (e *HeaderTimeoutError) Timeout() bool { return true }
+
+// BodyIdleTimeoutError is returned when reading the response body if no data
+// is received in time, see Request.SetBodyIdleTimeout.
+type BodyIdleTimeoutError struct {
+	Duration time.Duration
+	// Read is the number of bytes which have been read before the timeout.
+	Read int64
+}
+
+func (e *BodyIdleTimeoutError) Error() string {
+	return fmt.Sprintf("req: no response body data received in %s after reading %d bytes", e.Duration, e.Read)
+}
+
+// Timeout reports whether the error is a timeout, which is always true.
+func (e *BodyIdleTimeoutError) Timeout() bool { return true }
+
+// SetResponseHeaderTimeout set the timeout of waiting for the response
+// headers after the request is sent, including the redirects, which fails
+// with ResponseHeaderTimeoutError. Unlike the timeout of the client, it does
+// not limit the time of reading the body, which is useful for the streaming
+// endpoints, see SetBodyIdleTimeout to detect the dead streams. The timer
+// starts before connecting and spans all the redirects, see SetHeaderTimeout
+// for the timeout of each round trip. It works for HTTP1, HTTP2 and HTTP3.
+func (r *Request) SetResponseHeaderTimeout(d time.Duration) *Request {
+	r.responseHeaderTimeout = d
+	return r
+}
+
+// SetHeaderTimeout set the timeout of each round trip (including each
+// redirect) from the request is written to the first byte of the response
+// is received (TTFB), which fails with HeaderTimeoutError. The time of
+// connecting and uploading the body is not counted, and the body read is
+// only governed by the client timeout, the context and SetBodyIdleTimeout,
+// which is useful to fail fast on the unresponsive servers while streaming
+// the long-lived bodies like SSE. It can be used together with
+// SetResponseHeaderTimeout which bounds the whole wait. It works for HTTP1,
+// HTTP2 and HTTP3.
+func (r *Request) SetHeaderTimeout(d time.Duration) *Request {
+	r.headerTimeout = d
+	return r
+}
+
+// SetBodyIdleTimeout set the max time of waiting for the next data when
+// reading the response body, reading fails with BodyIdleTimeoutError if no
+// data is received in time. The timer only runs while the body is being
+// read, so the time spent by the consumer of the body (e.g. the download
+// writer or the callback of each chunk) is not counted. It works for HTTP1,
+// HTTP2 and HTTP3.
+func (r *Request) SetBodyIdleTimeout(d time.Duration) *Request {
+	r.bodyIdleTimeout = d
+	return r
+}
+
+// streamTimeouts runs the response header timer and the body idle timer of
+// the request, which cancel the request with the typed error as the cause.
+type streamTimeouts struct {
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	header *time.Timer
+	idle   time.Duration
+
+	mu  sync.Mutex
+	hop *time.Timer // the timer of SetHeaderTimeout.
+}
+
+func (c *Client) newStreamTimeouts(ctx context.Context, r *Request) (*streamTimeouts, context.Context) {
+	st := &streamTimeouts{idle: r.bodyIdleTimeout}
+	st.ctx, st.cancel = context.WithCancelCause(ctx)
+	if d := r.responseHeaderTimeout; d > 0 {
+		st.header = time.AfterFunc(d, func() {
+			c.debugf(st.ctx, "response header timeout (%s) fired, abort the request", d)
+			st.cancel(&ResponseHeaderTimeoutError{Duration: d})
+		})
+	}
+	if d := r.headerTimeout; d > 0 {
+		st.ctx = httptrace.WithClientTrace(st.ctx, &httptrace.ClientTrace{
+			WroteRequest: func(info httptrace.WroteRequestInfo) {
+				if info.Err == nil {
+					st.startHop(c, d)
+				}
+			},
+			GotFirstResponseByte: st.stopHop,
+		})
+	}
+	return st, st.ctx
+}
+
+// startHop starts the header timer of the round trip of which the request
+// has been written.
+func (st *streamTimeouts) startHop(c *Client, d time.Duration) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.hop != nil {
+		st.hop.Stop()
+	}
+	st.hop = time.AfterFunc(d, func() {
+		c.debugf(st.ctx, "header timeout (%s) fired, abort the request", d)
+		st.cancel(&HeaderTimeoutError{Duration: d})
+	})
+}
+
+func (st *streamTimeouts) stopHop() {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.hop != nil {
+		st.hop.Stop()
+		st.hop = nil
+	}
+}
+
+// headerDone stops the response header timer, and wraps the response body
+// with the body idle timer.
+func (st *streamTimeouts) headerDone(c *Client, resp *http.Response, err error) error {
+	if st.header != nil {
+		st.header.Stop()
+	}
+	st.stopHop()
+	if err != nil {
+		st.cancel(nil)
+		var timeoutErr *ResponseHeaderTimeoutError
+		if errors.As(context.Cause(st.ctx), &timeoutErr) {
+			return timeoutErr
+		}
+		var hopErr *HeaderTimeoutError
+		if errors.As(context.Cause(st.ctx), &hopErr) {
+			return hopErr
+		}
+		return err
+	}
+	if resp.Body == nil || resp.Body == http.NoBody {
+		st.cancel(nil)
+		return nil
+	}
+	resp.Body = &bodyIdleTimeoutReader{ReadCloser: resp.Body, st: st, c: c}
+	return nil
+}
+
+// bodyIdleTimeoutReader arms the body idle timer during each read, and
+// releases the request context when closed.
+type bodyIdleTimeoutReader struct {
+	io.ReadCloser
+	st    *streamTimeouts
+	c     *Client
+	timer *time.Timer
+	read  int64
+	once  sync.Once
+}
+
+func (r *bodyIdleTimeoutReader) Read(p []byte) (n int, err error) {
+	st := r.st
+	if st.idle > 0 {
+		if r.timer == nil {
+			r.timer = time.AfterFunc(st.idle, r.fire)
+		} else {
+			r.timer.Reset(st.idle)
+		}
+	}
+	n, err = r.ReadCloser.Read(p)
+	if r.timer != nil {
+		r.timer.Stop()
+	}
+	r.read += int64(n)
+	if err != nil && err != io.EOF {
+		var timeoutErr *BodyIdleTimeoutError
+		if errors.As(context.Cause(st.ctx), &timeoutErr) {
+			err = &BodyIdleTimeoutError{Duration: timeoutErr.Duration, Read: r.read}
+		}
+	}
+	return
+}
+
+func (r *bodyIdleTimeoutReader) fire() {
+	r.c.debugf(r.st.ctx, "body idle timeout (%s) fired, abort the response body stream", r.st.idle)
+	r.st.cancel(&BodyIdleTimeoutError{Duration: r.st.idle})
+}
+
+func (r *bodyIdleTimeoutReader) Close() error {
+	err := r.ReadCloser.Close()
+	r.once.Do(func() {
+		if r.timer != nil {
+			r.timer.Stop()
+		}
+		r.st.cancel(nil)
+	})
+	return err
+}
@@ -0,0 +1,299 @@
+package req
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// StrictPolicy is the policy of the strict mode, which rejects the suspicious
+// responses early, see Client.EnableStrictMode. Each check is enabled
+// individually, the zero value of each field disables the check.
+type StrictPolicy struct {
+	// AllowedContentTypes is the allow-list of the media types of the
+	// response, e.g. "application/json", the params are ignored and the
+	// subtype can be a wildcard, e.g. "text/*". The response which has a
+	// body and its media type is not in the list fails with
+	// ContentTypeNotAllowedError.
+	AllowedContentTypes []string
+	// MaxResponseSize is the max size of the response body, the response
+	// fails with ResponseTooLargeError if its Content-Length exceeds the
+	// limit, or when reading the body beyond the limit if the length is
+	// unknown.
+	MaxResponseSize int64
+	// RequireHTTPSRedirect rejects the redirects to non-HTTPS URLs with
+	// InsecureRedirectError.
+	RequireHTTPSRedirect bool
+	// DenyPrivateRedirect rejects the redirects to the hosts which resolve
+	// to private (RFC 1918 and RFC 4193), loopback, link-local or
+	// unspecified addresses with PrivateRedirectError, which mitigates SSRF
+	// when following user-supplied URLs.
+	DenyPrivateRedirect bool
+	// AllowedPrivateHosts is the allow-list of the private redirect check,
+	// each entry is a host name, an IP address or a CIDR, e.g. "10.0.0.0/8".
+	AllowedPrivateHosts []string
+	// RejectInvalidHeaders rejects the responses which header contains
+	// control characters with InvalidHeaderError.
+	RejectInvalidHeaders bool
+}
+
+// ContentTypeNotAllowedError is returned in strict mode if the media type of
+// the response is not in StrictPolicy.AllowedContentTypes.
+type ContentTypeNotAllowedError struct {
+	ContentType string
+}
+
+func (e *ContentTypeNotAllowedError) Error() string {
+	return fmt.Sprintf("req: content type %q of the response is not allowed", e.ContentType)
+}
+
+// ResponseTooLargeError is returned in strict mode if the response body
+// exceeds StrictPolicy.MaxResponseSize.
+type ResponseTooLargeError struct {
+	// ContentLength is the Content-Length of the response, -1 if unknown.
+	ContentLength int64
+	Limit         int64
+}
+
+func (e *ResponseTooLargeError) Error() string {
+	if e.ContentLength < 0 {
+		return fmt.Sprintf("req: response body exceeds the limit %d", e.Limit)
+	}
+	return fmt.Sprintf("req: response body size %d exceeds the limit %d", e.ContentLength, e.Limit)
+}
+
+// InsecureRedirectError is returned in strict mode if the response redirects
+// to a non-HTTPS URL and StrictPolicy.RequireHTTPSRedirect is enabled.
+type InsecureRedirectError struct {
+	URL string
+}
+
+func (e *InsecureRedirectError) Error() string {
+	return fmt.Sprintf("req: redirect to non-https url %s is not allowed", e.URL)
+}
+
+// PrivateRedirectError is returned in strict mode if the response redirects
+// to a private host and StrictPolicy.DenyPrivateRedirect is enabled.
+type PrivateRedirectError struct {
+	URL  string
+	Addr netip.Addr
+}
+
+func (e *PrivateRedirectError) Error() string {
+	return fmt.Sprintf("req: redirect to private address %s (%s) is not allowed", e.Addr, e.URL)
+}
+
+// InvalidHeaderError is returned in strict mode if the response header
+// contains control characters and StrictPolicy.RejectInvalidHeaders is
+// enabled.
+type InvalidHeaderError struct {
+	Key string
+}
+
+func (e *InvalidHeaderError) Error() string {
+	return fmt.Sprintf("req: response header %q contains control characters", e.Key)
+}
+
+// EnableStrictMode enables the strict mode, which rejects the suspicious
+// responses with the checks of the policy before the body is consumed, and
+// rejects the suspicious redirects before they are followed. The checks work
+// uniformly across HTTP1, HTTP2 and HTTP3.
+func (c *Client) EnableStrictMode(policy StrictPolicy) *Client {
+	c.strictPolicy = &policy
+	c.httpClient.Transport = c.newHttpTransport()
+	return c
+}
+
+// DisableStrictMode disables the strict mode (default).
+func (c *Client) DisableStrictMode() *Client {
+	c.strictPolicy = nil
+	c.httpClient.Transport = c.newHttpTransport()
+	return c
+}
+
+// checkStrictRedirect checks the redirect request in strict mode, the
+// redirects to the host of the initial request are not checked by the
+// private redirect check.
+func (c *Client) checkStrictRedirect(req *http.Request, via []*http.Request) error {
+	p := c.strictPolicy
+	if p == nil {
+		return nil
+	}
+	if p.RequireHTTPSRedirect && req.URL.Scheme != "https" {
+		return &InsecureRedirectError{URL: req.URL.String()}
+	}
+	if p.DenyPrivateRedirect && (len(via) == 0 || !strings.EqualFold(req.URL.Host, via[0].URL.Host)) {
+		return p.checkPrivateHost(req.Context(), req.URL.String(), req.URL.Hostname())
+	}
+	return nil
+}
+
+func (p *StrictPolicy) checkPrivateHost(ctx context.Context, rawURL, host string) error {
+	if p.isAllowedPrivate(host, netip.Addr{}) {
+		return nil
+	}
+	var addrs []netip.Addr
+	if addr, err := netip.ParseAddr(host); err == nil {
+		addrs = []netip.Addr{addr}
+	} else {
+		addrs, err = net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+		if err != nil {
+			return err
+		}
+	}
+	for _, addr := range addrs {
+		addr = addr.Unmap()
+		if isPrivateAddr(addr) && !p.isAllowedPrivate(host, addr) {
+			return &PrivateRedirectError{URL: rawURL, Addr: addr}
+		}
+	}
+	return nil
+}
+
+func (p *StrictPolicy) isAllowedPrivate(host string, addr netip.Addr) bool {
+	for _, allowed := range p.AllowedPrivateHosts {
+		if strings.EqualFold(allowed, host) {
+			return true
+		}
+		if !addr.IsValid() {
+			continue
+		}
+		if prefix, err := netip.ParsePrefix(allowed); err == nil && prefix.Contains(addr) {
+			return true
+		}
+		if a, err := netip.ParseAddr(allowed); err == nil && a.Unmap() == addr {
+			return true
+		}
+	}
+	return false
+}
+
+func isPrivateAddr(addr netip.Addr) bool {
+	return addr.IsPrivate() || addr.IsLoopback() || addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() || addr.IsUnspecified()
+}
+
+// checkResponse checks the response in strict mode before the body is
+// consumed.
+func (p *StrictPolicy) checkResponse(req *http.Request, resp *http.Response) error {
+	if p.RejectInvalidHeaders {
+		for k, vs := range resp.Header {
+			if hasControlChar(k) {
+				return &InvalidHeaderError{Key: k}
+			}
+			for _, v := range vs {
+				if hasControlChar(v) {
+					return &InvalidHeaderError{Key: k}
+				}
+			}
+		}
+	}
+	if !responseHasBody(req, resp) {
+		return nil
+	}
+	if len(p.AllowedContentTypes) > 0 {
+		ct := resp.Header.Get("Content-Type")
+		if !isAllowedContentType(ct, p.AllowedContentTypes) {
+			return &ContentTypeNotAllowedError{ContentType: ct}
+		}
+	}
+	if p.MaxResponseSize > 0 {
+		if resp.ContentLength > p.MaxResponseSize {
+			return &ResponseTooLargeError{ContentLength: resp.ContentLength, Limit: p.MaxResponseSize}
+		}
+		if resp.ContentLength < 0 {
+			resp.Body = &strictLimitReader{ReadCloser: resp.Body, remain: p.MaxResponseSize, limit: p.MaxResponseSize}
+		}
+	}
+	return nil
+}
+
+// responseHasBody reports whether the response may have a body, the
+// redirect responses are not checked, which are checked by the redirect
+// checks instead.
+func responseHasBody(req *http.Request, resp *http.Response) bool {
+	if req.Method == http.MethodHead || resp.ContentLength == 0 {
+		return false
+	}
+	switch {
+	case resp.StatusCode < 200, resp.StatusCode == http.StatusNoContent, resp.StatusCode == http.StatusNotModified:
+		return false
+	case resp.StatusCode >= 300 && resp.StatusCode < 400 && resp.Header.Get("Location") != "":
+		return false
+	}
+	return true
+}
+
+func isAllowedContentType(contentType string, allowed []string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, a := range allowed {
+		a = strings.ToLower(strings.TrimSpace(a))
+		if a == mediaType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(a, "/*"); ok && strings.HasPrefix(mediaType, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func hasControlChar(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if b := s[i]; (b < ' ' && b != '\t') || b == 0x7f {
+			return true
+		}
+	}
+	return false
+}
+
+// strictLimitReader fails with ResponseTooLargeError when reading beyond
+// the limit.
+type strictLimitReader struct {
+	io.ReadCloser
+	remain int64
+	limit  int64
+}
+
+func (r *strictLimitReader) Read(p []byte) (n int, err error) {
+	if r.remain < 0 {
+		return 0, &ResponseTooLargeError{ContentLength: -1, Limit: r.limit}
+	}
+	if int64(len(p)) > r.remain+1 {
+		p = p[:r.remain+1]
+	}
+	n, err = r.ReadCloser.Read(p)
+	r.remain -= int64(n)
+	if r.remain < 0 {
+		n += int(r.remain)
+		return n, &ResponseTooLargeError{ContentLength: -1, Limit: r.limit}
+	}
+	return
+}
+
+// strictTransport checks the responses of each round trip in strict mode,
+// including the redirect responses.
+type strictTransport struct {
+	rt http.RoundTripper
+	c  *Client
+}
+
+func (t *strictTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.rt.RoundTrip(req)
+	if err != nil || t.c.strictPolicy == nil {
+		return resp, err
+	}
+	if err = t.c.strictPolicy.checkResponse(req, resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp, nil
+}
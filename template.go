@@ -0,0 +1,52 @@
+package req
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"sync"
+	"text/template"
+)
+
+// bodyTemplates caches the compiled body templates by the template string.
+var bodyTemplates sync.Map
+
+// bodyTemplateFuncs are the functions available in body templates, which
+// can be used to escape values since text/template never escapes them.
+var bodyTemplateFuncs = template.FuncMap{
+	// json marshals the value as a JSON value, e.g. a quoted and escaped string.
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	// xml escapes the string as XML character data.
+	"xml": func(s string) (string, error) {
+		var buf bytes.Buffer
+		err := xml.EscapeText(&buf, []byte(s))
+		return buf.String(), err
+	},
+}
+
+func getBodyTemplate(tmpl string) (*template.Template, error) {
+	if t, ok := bodyTemplates.Load(tmpl); ok {
+		return t.(*template.Template), nil
+	}
+	t, err := template.New("body").Funcs(bodyTemplateFuncs).Parse(tmpl)
+	if err != nil {
+		return nil, err
+	}
+	actual, _ := bodyTemplates.LoadOrStore(tmpl, t)
+	return actual.(*template.Template), nil
+}
+
+func renderBodyTemplate(tmpl string, data any) ([]byte, error) {
+	t, err := getBodyTemplate(tmpl)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err = t.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
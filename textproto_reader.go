@@ -14,6 +14,7 @@ import (
 	"sync"
 
 	"github.com/imroc/req/v3/internal/dump"
+	"github.com/imroc/req/v3/internal/transport"
 )
 
 func isASCIILetter(b byte) bool {
@@ -31,6 +32,8 @@ type textprotoReader struct {
 	R        *bufio.Reader
 	buf      []byte // a reusable buffer for readContinuedLineSlice
 	readLine func() (line []byte, isPrefix bool, err error)
+	// rawHeaders records the header fields in the received order if not nil.
+	rawHeaders *[]transport.HeaderField
 }
 
 // NewReader returns a new textprotoReader reading from r.
@@ -287,6 +290,9 @@ func (r *textprotoReader) readMIMEHeader(maxMemory, maxHeaders int64) (textproto
 
 		// Skip initial spaces in value.
 		value := string(bytes.TrimLeft(v, " \t"))
+		if r.rawHeaders != nil {
+			*r.rawHeaders = append(*r.rawHeaders, transport.HeaderField{Key: string(k), Value: value})
+		}
 
 		vv := m[key]
 		if vv == nil {
@@ -107,6 +107,21 @@ type TraceInfo struct {
 
 	// LocalAddr returns the local network address.
 	LocalAddr net.Addr
+
+	// DialedAddr is the address (ip:port) which the new connection of the
+	// request was dialed to successfully, including the UDP dial of HTTP3,
+	// which reflects the order of the addresses returned by the DNS hook
+	// (see Client.OnDNSResolved), empty if the connection is reused.
+	DialedAddr string
+
+	// IsHTTP3Fallback is whether the request fell back to TCP because the
+	// QUIC handshake of HTTP3 was not completed within the fallback timeout
+	// or failed (see Client.SetHTTP3FallbackTimeout).
+	IsHTTP3Fallback bool
+
+	// HTTP3AttemptTime is a duration that the HTTP3 attempt took before
+	// falling back to TCP, if IsHTTP3Fallback is true.
+	HTTP3AttemptTime time.Duration
 }
 
 type clientTrace struct {
@@ -120,9 +135,12 @@ type clientTrace struct {
 	gotFirstResponseByte time.Time
 	endTime              time.Time
 	gotConnInfo          httptrace.GotConnInfo
+	dialedAddr           string
+	http3Fallback        http3Fallback
 }
 
 func (t *clientTrace) createContext(ctx context.Context) context.Context {
+	ctx = context.WithValue(ctx, http3FallbackKey, &t.http3Fallback)
 	return httptrace.WithClientTrace(
 		ctx,
 		&httptrace.ClientTrace{
@@ -142,6 +160,9 @@ func (t *clientTrace) createContext(ctx context.Context) context.Context {
 			},
 			ConnectDone: func(net, addr string, err error) {
 				t.connectDone = time.Now()
+				if err == nil {
+					t.dialedAddr = addr
+				}
 			},
 			GetConn: func(_ string) {
 				t.getConn = time.Now()
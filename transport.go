@@ -23,12 +23,15 @@ import (
 	"net"
 	"net/http"
 	"net/http/httptrace"
+	"net/netip"
 	"net/textproto"
 	"net/url"
 	"runtime"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 	_ "unsafe"
 
@@ -47,6 +50,7 @@ import (
 	"github.com/imroc/req/v3/internal/util"
 	"github.com/imroc/req/v3/pkg/altsvc"
 	reqtls "github.com/imroc/req/v3/pkg/tls"
+	"github.com/quic-go/quic-go"
 	htmlcharset "golang.org/x/net/html/charset"
 	"golang.org/x/text/encoding/ianaindex"
 
@@ -125,14 +129,40 @@ type Transport struct {
 	altSvcJar        altsvc.Jar
 	pendingAltSvcs   map[string]*pendingAltSvc
 	pendingAltSvcsMu sync.Mutex
+	clientHints      *clientHints
 
 	// Force using specific http version
 	forceHttpVersion httpVersion
 
+	// configGen is changed by the setters of the validated options, see
+	// configChanged.
+	configGen atomic.Uint64
+
 	transport.Options
 
 	t2 *h2internal.Transport // non-nil if http2 wired up
 	t3 *http3.Transport
+	// http3Dial is the customized function for creating QUIC connections.
+	http3Dial func(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (*quic.Conn, error)
+	// http3FallbackTimeout is how long to wait for the QUIC handshake before
+	// falling back to TCP, nil means defaultHTTP3FallbackTimeout.
+	http3FallbackTimeout *time.Duration
+	// http3CloseLateConn, if true, closes the QUIC connection established
+	// after falling back to TCP instead of adopting it.
+	http3CloseLateConn bool
+	// http3QUICConfig is the quic.Config of the QUIC connections, nil means
+	// the default config.
+	http3QUICConfig *quic.Config
+	// http3Datagrams enables the HTTP datagrams (RFC 9297) of HTTP3.
+	http3Datagrams bool
+	// http3Broken records the origins whose HTTP3 is broken until the time
+	// (see Client.DiagnoseH3), the alt-svc of which is ignored.
+	http3Broken   map[string]time.Time
+	http3BrokenMu sync.Mutex
+	// maxDecompressionRatio and maxDecompressedSize limit the automatic
+	// decompression, nil means the default limits.
+	maxDecompressionRatio *float64
+	maxDecompressedSize   *int64
 
 	// disableAutoDecode, if true, prevents auto detect response
 	// body's charset and decode it to utf-8
@@ -161,6 +191,7 @@ func T() *Transport {
 			TLSHandshakeTimeout:   10 * time.Second,
 			ExpectContinueTimeout: 1 * time.Second,
 			TLSClientConfig:       &tls.Config{NextProtos: []string{"http/1.1", "h2"}},
+			TLSIdentity:           new(atomic.Uint64),
 		},
 	}
 	t.t2 = &h2internal.Transport{Options: &t.Options}
@@ -264,6 +295,7 @@ func (t *Transport) GetMaxIdleConns() int {
 // connections across all hosts. Zero means no limit.
 func (t *Transport) SetMaxIdleConns(max int) *Transport {
 	t.MaxIdleConns = max
+	t.configChanged()
 	return t
 }
 
@@ -277,6 +309,15 @@ func (t *Transport) SetMaxConnsPerHost(max int) *Transport {
 	return t
 }
 
+// SetPriorityAging set the PriorityAging, which raises the priority (see
+// Request.SetPriority) of the request waiting for a connection by one for
+// each d it has waited, so that the low priority requests are not starved
+// by the high priority ones. Zero means no aging.
+func (t *Transport) SetPriorityAging(d time.Duration) *Transport {
+	t.PriorityAging = d
+	return t
+}
+
 // SetIdleConnTimeout set the IdleConnTimeout, which  is the maximum
 // amount of time an idle (keep-alive) connection will remain idle before
 // closing itself.
@@ -302,6 +343,7 @@ func (t *Transport) SetTLSHandshakeTimeout(timeout time.Duration) *Transport {
 // to read the response body.
 func (t *Transport) SetResponseHeaderTimeout(timeout time.Duration) *Transport {
 	t.ResponseHeaderTimeout = timeout
+	t.configChanged()
 	return t
 }
 
@@ -351,9 +393,11 @@ func (t *Transport) SetWriteBufferSize(size int) *Transport {
 }
 
 // SetMaxResponseHeaderBytes set the MaxResponseHeaderBytes, which specifies a limit on how many
-// response bytes are allowed in the server's response header.
+// response bytes are allowed in the server's response header of HTTP1 and HTTP3, the
+// response fails with ResponseHeaderTooLargeError if exceeded. HTTP2 is limited by
+// SetHTTP2MaxHeaderListSize, see Client.SetMaxResponseHeaderBytes which sets both.
 //
-// Zero means to use a default limit.
+// Zero means to use a default limit, which is 10MB.
 func (t *Transport) SetMaxResponseHeaderBytes(max int64) *Transport {
 	t.MaxResponseHeaderBytes = max
 	return t
@@ -447,10 +491,14 @@ func (t *Transport) SetHTTP2PriorityFrames(frames ...http2.PriorityFrame) *Trans
 // If non-nil, HTTP/2 support may not be enabled by default.
 func (t *Transport) SetTLSClientConfig(cfg *tls.Config) *Transport {
 	t.TLSClientConfig = cfg
+	t.configChanged()
 	return t
 }
 
-// SetDebug set the optional debug function.
+// SetDebug set the optional debug function, which respects the debug log
+// switch of the request (see Request.EnableDebugLog). Note the debug logs of
+// the requests of the Client are written by its logger (see
+// Client.SetLogger) instead.
 func (t *Transport) SetDebug(debugf func(format string, v ...any)) *Transport {
 	t.Debugf = debugf
 	return t
@@ -482,6 +530,162 @@ func (t *Transport) SetDial(fn func(ctx context.Context, network, addr string) (
 	return t
 }
 
+// SetHTTP3Dial set the customized function for creating QUIC connections of
+// HTTP3, which allows controlling the connection establishment, e.g. proxying
+// over UDP, custom congestion control, or reusing connections from an existing
+// pool. Pass nil to use the default dialer.
+func (t *Transport) SetHTTP3Dial(fn func(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (*quic.Conn, error)) *Transport {
+	t.http3Dial = fn
+	if t.t3 != nil {
+		t.t3.SetDialer(fn)
+	}
+	return t
+}
+
+// SetHTTP3FallbackTimeout set how long to wait for the QUIC handshake of
+// HTTP3 which is discovered by Alt-Svc before falling back to HTTP1 or HTTP2
+// over TCP, independent of the QUIC handshake and idle timeouts, default is
+// 750ms. The QUIC connection established later is adopted for subsequent
+// requests by default, see EnableHTTP3CloseLateConn. A non-positive value
+// disables the fallback, the request waits for the QUIC handshake.
+func (t *Transport) SetHTTP3FallbackTimeout(d time.Duration) *Transport {
+	t.http3FallbackTimeout = &d
+	return t
+}
+
+// EnableHTTP3CloseLateConn closes the QUIC connection which is established
+// after falling back to TCP (see SetHTTP3FallbackTimeout), instead of
+// adopting it for subsequent requests.
+func (t *Transport) EnableHTTP3CloseLateConn() *Transport {
+	t.http3CloseLateConn = true
+	return t
+}
+
+// DisableHTTP3CloseLateConn adopts the QUIC connection which is established
+// after falling back to TCP for subsequent requests (default).
+func (t *Transport) DisableHTTP3CloseLateConn() *Transport {
+	t.http3CloseLateConn = false
+	return t
+}
+
+// SetHTTP3QUICConfig set the quic.Config of the QUIC connections of HTTP3,
+// pass nil to use the default config. The EnableDatagrams of the config must
+// be set if EnableHTTP3Datagrams is enabled.
+func (t *Transport) SetHTTP3QUICConfig(cfg *quic.Config) *Transport {
+	t.http3QUICConfig = cfg
+	t.configChanged()
+	if t.t3 != nil {
+		t.t3.QUICConfig = cfg
+	}
+	return t
+}
+
+// EnableHTTP3Datagrams enables the HTTP datagrams (RFC 9297) of HTTP3, which
+// requires the QUIC datagrams, see SetHTTP3QUICConfig.
+func (t *Transport) EnableHTTP3Datagrams() *Transport {
+	t.http3Datagrams = true
+	t.configChanged()
+	if t.t3 != nil {
+		t.t3.EnableDatagrams = true
+	}
+	return t
+}
+
+// DisableHTTP3Datagrams disables the HTTP datagrams of HTTP3 (default).
+func (t *Transport) DisableHTTP3Datagrams() *Transport {
+	t.http3Datagrams = false
+	t.configChanged()
+	if t.t3 != nil {
+		t.t3.EnableDatagrams = false
+	}
+	return t
+}
+
+func (t *Transport) getHTTP3FallbackTimeout() time.Duration {
+	if t.http3FallbackTimeout == nil {
+		return defaultHTTP3FallbackTimeout
+	}
+	return *t.http3FallbackTimeout
+}
+
+// SetDialer set the net.Dialer used for creating TCP connections, which can be
+// used to bind a local address (the LocalAddr is also used to bind the UDP
+// socket of HTTP/3), or tune the timeout, keep-alive and Happy Eyeballs
+// fallback delay. It is ignored if custom DialContext function is set by
+// SetDial, and it also applies to connections to the proxy.
+func (t *Transport) SetDialer(d *net.Dialer) *Transport {
+	t.Dialer = d
+	return t
+}
+
+// SetLocalAddr set the local address to bind when dialing TCP connections (and
+// the UDP socket of HTTP/3), usually used on multi-homed hosts to choose the
+// source IP of the outgoing requests.
+func (t *Transport) SetLocalAddr(addr net.Addr) *Transport {
+	d := t.cloneDialer()
+	d.LocalAddr = addr
+	t.Dialer = d
+	return t
+}
+
+// cloneDialer returns a copy of the Dialer (an empty one if not set), which
+// is modified and set back instead of the Dialer passed by SetDialer, as it
+// may be shared with the caller.
+func (t *Transport) cloneDialer() *net.Dialer {
+	if t.Dialer == nil {
+		return &net.Dialer{}
+	}
+	d := *t.Dialer
+	return &d
+}
+
+// SetSocketOptions set the function which is called with the raw socket of
+// each TCP connection before connecting, and the UDP socket of HTTP/3 before
+// binding, which can be used to tune the socket options without replacing
+// the dial function, e.g. SO_MARK for policy routing. The error fails the
+// dial. It is ignored if custom DialContext function is set by SetDial.
+func (t *Transport) SetSocketOptions(fn func(network, address string, c syscall.RawConn) error) *Transport {
+	t.SocketOptions = fn
+	return t
+}
+
+// SetOnDNSResolved set the function which is called with the host and the
+// resolved addresses of each connection to be dialed (including the proxy
+// and the UDP dial of HTTP3), the returned addresses are dialed in order
+// until one succeeds (HTTP3 dials the first one only), so that it can
+// observe, reorder or filter the addresses. The dial fails with
+// DNSResolutionError if it returns no address. It is not called for the IP
+// literal hosts, and is ignored if custom DialContext function is set by
+// SetDial. It's called concurrently, and should not retain or modify the
+// addresses after returning.
+func (t *Transport) SetOnDNSResolved(fn func(host string, addrs []netip.Addr) []netip.Addr) *Transport {
+	t.OnDNSResolved = fn
+	return t
+}
+
+// SetTCPKeepAlive set the interval between the keep-alive probes of the TCP
+// connections, which detects the dead peers, a negative value disables the
+// keep-alive, zero uses the default value (15 seconds). It also applies to
+// the connections returned by the custom DialContext (SetDial), but not to
+// the connections of the custom DialTLSContext (SetDialTLS) and HTTP3 which
+// is not over TCP.
+func (t *Transport) SetTCPKeepAlive(d time.Duration) *Transport {
+	dialer := t.cloneDialer()
+	dialer.KeepAlive = d
+	t.Dialer = dialer
+	return t
+}
+
+// SetTCPNoDelay set the TCP_NODELAY option of the TCP connections, which is
+// enabled by default, disable it to let the system coalesce the small writes
+// (Nagle's algorithm). Like SetTCPKeepAlive, it also applies to the
+// connections returned by the custom DialContext (SetDial), but not to the
+// connections of the custom DialTLSContext (SetDialTLS) and HTTP3.
+func (t *Transport) SetTCPNoDelay(noDelay bool) *Transport {
+	t.TCPNoDelay = &noDelay
+	return t
+}
+
 // SetDialTLS set the custom DialTLSContext function, only valid for HTTP1 and HTTP2, which specifies
 // an optional dial function for creating TLS connections for non-proxied HTTPS requests (proxy will
 // not work if set).
@@ -492,6 +696,7 @@ func (t *Transport) SetDial(fn func(ctx context.Context, network, addr string) (
 // and TLSHandshakeTimeout are ignored. The returned net.Conn is assumed to already be past the TLS handshake.
 func (t *Transport) SetDialTLS(fn func(ctx context.Context, network, addr string) (net.Conn, error)) *Transport {
 	t.DialTLSContext = fn
+	t.configChanged()
 	return t
 }
 
@@ -500,9 +705,30 @@ func (t *Transport) SetDialTLS(fn func(ctx context.Context, network, addr string
 // used to customize the tls fingerprint.
 func (t *Transport) SetTLSHandshake(fn func(ctx context.Context, addr string, plainConn net.Conn) (conn net.Conn, tlsState *tls.ConnectionState, err error)) *Transport {
 	t.TLSHandshakeContext = fn
+	t.configChanged()
+	t.resetTLSIdentity()
 	return t
 }
 
+// configChanged invalidates the issues of the client options cached by
+// Client.checkConfig, which is called by the setters of the options which
+// are validated, see Client.Validate.
+func (t *Transport) configChanged() {
+	t.configGen.Add(1)
+}
+
+// tlsIdentitySeq generates the TLSIdentity of the transports.
+var tlsIdentitySeq atomic.Uint64
+
+// resetTLSIdentity sets a new TLSIdentity after the tls handshake is changed,
+// so the connections built with the previous handshake are not reused.
+func (t *Transport) resetTLSIdentity() {
+	if t.TLSIdentity == nil {
+		t.TLSIdentity = new(atomic.Uint64)
+	}
+	t.TLSIdentity.Store(tlsIdentitySeq.Add(1))
+}
+
 type pendingAltSvc struct {
 	CurrentIndex int
 	Entries      []*altsvc.AltSvc
@@ -514,6 +740,7 @@ type pendingAltSvc struct {
 // EnableForceHTTP1 enable force using HTTP1 (disabled by default).
 func (t *Transport) EnableForceHTTP1() *Transport {
 	t.forceHttpVersion = h1
+	t.configChanged()
 	return t
 }
 
@@ -521,12 +748,14 @@ func (t *Transport) EnableForceHTTP1() *Transport {
 // (disabled by default).
 func (t *Transport) EnableForceHTTP2() *Transport {
 	t.forceHttpVersion = h2
+	t.configChanged()
 	return t
 }
 
 // EnableH2C enables HTTP2 over TCP without TLS.
 func (t *Transport) EnableH2C() *Transport {
 	t.Options.EnableH2C = true
+	t.configChanged()
 	t.t2.AllowHTTP = true
 	t.DialTLSContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
 		return net.Dial(network, addr)
@@ -537,6 +766,7 @@ func (t *Transport) EnableH2C() *Transport {
 // DisableH2C disables HTTP2 over TCP without TLS.
 func (t *Transport) DisableH2C() *Transport {
 	t.Options.EnableH2C = false
+	t.configChanged()
 	t.t2.AllowHTTP = false
 	t.t2.DialTLSContext = nil
 	return t
@@ -556,13 +786,28 @@ func (t *Transport) EnableForceHTTP3() *Transport {
 // version (disabled by default).
 func (t *Transport) DisableForceHttpVersion() *Transport {
 	t.forceHttpVersion = ""
+	t.configChanged()
 	return t
 }
 
+// HTTP3ConnectionError is returned if the request failed because the HTTP3
+// connection was closed with an application error, which carries the QUIC
+// error code and reason passed to CloseWithError, use errors.As to get it.
+type HTTP3ConnectionError = http3.ConnectionError
+
+// DNSResolutionError is returned if the DNS hook (see
+// Client.OnDNSResolved) returns no address to dial for the host.
+type DNSResolutionError = transport.DNSResolutionError
+
+// ResponseHeaderTooLargeError is returned if the response headers exceed
+// the limit, see Client.SetMaxResponseHeaderBytes.
+type ResponseHeaderTooLargeError = transport.ResponseHeaderTooLargeError
+
 func (t *Transport) DisableHTTP3() {
 	t.altSvcJar = nil
 	t.pendingAltSvcs = nil
 	t.t3 = nil
+	t.configChanged()
 }
 
 func (t *Transport) EnableHTTP3() {
@@ -574,9 +819,7 @@ func (t *Transport) EnableHTTP3() {
 	ss := strings.Split(v, ".")
 
 	if len(ss) < 2 || ss[0] != "go1" {
-		if t.Debugf != nil {
-			t.Debugf("bad go version format: %s", v)
-		}
+		t.DebugfContext(context.Background(), "bad go version format: %s", v)
 		return
 	}
 
@@ -587,23 +830,50 @@ func (t *Transport) EnableHTTP3() {
 		t.pendingAltSvcs = make(map[string]*pendingAltSvc)
 	}
 	t3 := &http3.Transport{
-		Options: &t.Options,
+		Options:         &t.Options,
+		Dial:            t.http3Dial,
+		QUICConfig:      t.http3QUICConfig,
+		EnableDatagrams: t.http3Datagrams,
 	}
 	t.t3 = t3
+	t.configChanged()
 }
 
 type wrapResponseBodyKeyType int
 
-const wrapResponseBodyKey wrapResponseBodyKeyType = iota
+const (
+	wrapResponseBodyKey wrapResponseBodyKeyType = iota
+	disableAutoDecodeKey
+	hostOverrideKey
+	http3FallbackKey
+	requestIDKey
+	absoluteURIKey
+	wrapDecompressedBodyKey
+	unbufferedBodyKey
+	cacheStatusKey
+	dumpHopsKey
+	gzipIntegrityKey
+)
 
 type wrapResponseBodyFunc func(rc io.ReadCloser) io.ReadCloser
 
 func (t *Transport) handleResponseBody(res *http.Response, req *http.Request) {
+	if check, _ := req.Context().Value(gzipIntegrityKey).(bool); check {
+		checkGzipIntegrity(res)
+	}
 	if wrap, ok := req.Context().Value(wrapResponseBodyKey).(wrapResponseBodyFunc); ok {
 		t.wrapResponseBody(res, wrap)
 	}
-	t.autoDecodeResponseBody(res)
-	dump.WrapResponseBodyIfNeeded(res, req, t.Dump)
+	t.limitDecompression(res)
+	if wrap, ok := req.Context().Value(wrapDecompressedBodyKey).(wrapResponseBodyFunc); ok {
+		res.Body = wrap(res.Body)
+	}
+	if disabled, _ := req.Context().Value(disableAutoDecodeKey).(bool); !disabled {
+		t.autoDecodeResponseBody(req.Context(), res)
+	}
+	if unbuffered, _ := req.Context().Value(unbufferedBodyKey).(bool); !unbuffered {
+		dump.WrapResponseBodyIfNeeded(res, req, t.Dump)
+	}
 }
 
 var allowedProtocols = map[string]bool{
@@ -613,7 +883,7 @@ var allowedProtocols = map[string]bool{
 func (t *Transport) handleAltSvc(req *http.Request, value string) {
 	addr := netutil.AuthorityKey(req.URL)
 	as := t.altSvcJar.GetAltSvc(addr)
-	if as != nil {
+	if as != nil || t.isHTTP3Broken(addr) {
 		return
 	}
 
@@ -625,9 +895,7 @@ func (t *Transport) handleAltSvc(req *http.Request, value string) {
 	}
 	ass, err := altsvcutil.ParseHeader(value)
 	if err != nil {
-		if t.Debugf != nil {
-			t.Debugf("failed to parse alt-svc header: %s", err.Error())
-		}
+		t.DebugfContext(req.Context(), "failed to parse alt-svc header: %s", err.Error())
 		return
 	}
 	var entries []*altsvc.AltSvc
@@ -641,11 +909,13 @@ func (t *Transport) handleAltSvc(req *http.Request, value string) {
 			Entries: entries,
 		}
 		t.pendingAltSvcs[addr] = pas
-		go t.handlePendingAltSvc(req.URL, pas)
+		go t.handlePendingAltSvc(req.Context(), req.URL, pas)
 	}
 }
 
-func (t *Transport) handlePendingAltSvc(u *url.URL, pas *pendingAltSvc) {
+// handlePendingAltSvc tries the alt-svc entries, ctx is the context of the
+// request which advertises them, which is only used for the debug logs.
+func (t *Transport) handlePendingAltSvc(ctx context.Context, u *url.URL, pas *pendingAltSvc) {
 	for i := pas.CurrentIndex; i < len(pas.Entries); i++ {
 		switch pas.Entries[i].Protocol {
 		case "h3": // only support h3 in alt-svc for now
@@ -653,15 +923,11 @@ func (t *Transport) handlePendingAltSvc(u *url.URL, pas *pendingAltSvc) {
 			hostname := u2.Host
 			err := t.t3.AddConn(context.Background(), hostname)
 			if err != nil {
-				if t.Debugf != nil {
-					t.Debugf("failed to get http3 connection: %s", err.Error())
-				}
+				t.DebugfContext(ctx, "failed to get http3 connection: %s", err.Error())
 			} else {
 				pas.CurrentIndex = i
 				pas.Transport = t.t3
-				if t.Debugf != nil {
-					t.Debugf("detected that the server %s supports http3, will try to use http3 protocol in subsequent requests", hostname)
-				}
+				t.DebugfContext(ctx, "detected that the server %s supports http3, will try to use http3 protocol in subsequent requests", hostname)
 				return
 			}
 		}
@@ -679,7 +945,7 @@ func (t *Transport) wrapResponseBody(res *http.Response, wrap wrapResponseBodyFu
 	}
 }
 
-func (t *Transport) autoDecodeResponseBody(res *http.Response) {
+func (t *Transport) autoDecodeResponseBody(ctx context.Context, res *http.Response) {
 	if t.disableAutoDecode || res.Header.Get("Accept-Encoding") != "" {
 		return
 	}
@@ -695,9 +961,7 @@ func (t *Transport) autoDecodeResponseBody(res *http.Response) {
 	}
 	_, params, err := mime.ParseMediaType(contentType)
 	if err != nil {
-		if t.Debugf != nil {
-			t.Debugf("failed to parse content type %q: %v", contentType, err)
-		}
+		t.DebugfContext(ctx, "failed to parse content type %q: %v", contentType, err)
 	} else if charset, ok := params["charset"]; ok {
 		charset = strings.ToLower(charset)
 		if strings.Contains(charset, "utf-8") || strings.Contains(charset, "utf8") { // do not decode utf-8
@@ -707,20 +971,16 @@ func (t *Transport) autoDecodeResponseBody(res *http.Response) {
 		if enc == nil {
 			enc, err = ianaindex.MIME.Encoding(charset)
 			if err != nil || enc == nil {
-				if t.Debugf != nil {
-					t.Debugf("ignore charset %s which is detected in Content-Type but not supported", charset)
-				}
+				t.DebugfContext(ctx, "ignore charset %s which is detected in Content-Type but not supported", charset)
 				return
 			}
 		}
-		if t.Debugf != nil {
-			t.Debugf("charset %s detected in Content-Type, auto-decode to utf-8", charset)
-		}
+		t.DebugfContext(ctx, "charset %s detected in Content-Type, auto-decode to utf-8", charset)
 		decodeReader := enc.NewDecoder().Reader(res.Body)
 		res.Body = &decodeReaderCloser{res.Body, decodeReader}
 		return
 	}
-	res.Body = newAutoDecodeReadCloser(res.Body, t)
+	res.Body = newAutoDecodeReadCloser(ctx, res.Body, t)
 }
 
 func (t *Transport) writeBufferSize() int {
@@ -747,6 +1007,13 @@ func (t *Transport) Clone() *Transport {
 		autoDecodeContentType: t.autoDecodeContentType,
 		forceHttpVersion:      t.forceHttpVersion,
 		httpRoundTripWrappers: t.httpRoundTripWrappers,
+		http3Dial:             t.http3Dial,
+		http3FallbackTimeout:  t.http3FallbackTimeout,
+		http3CloseLateConn:    t.http3CloseLateConn,
+		http3QUICConfig:       t.http3QUICConfig,
+		http3Datagrams:        t.http3Datagrams,
+		maxDecompressionRatio: t.maxDecompressionRatio,
+		maxDecompressedSize:   t.maxDecompressedSize,
 	}
 	if len(tt.httpRoundTripWrappers) > 0 { // clone transport middleware
 		fn := func(req *http.Request) (*http.Response, error) {
@@ -774,6 +1041,9 @@ func (t *Transport) Clone() *Transport {
 	if t.t3 != nil {
 		tt.EnableHTTP3()
 	}
+	if t.clientHints != nil {
+		tt.clientHints = t.clientHints.clone()
+	}
 	return tt
 }
 
@@ -826,11 +1096,105 @@ func (tr *transportRequest) setError(err error) {
 	tr.mu.Unlock()
 }
 
+// defaultHTTP3FallbackTimeout is the default timeout of the QUIC handshake
+// before falling back to TCP.
+const defaultHTTP3FallbackTimeout = 750 * time.Millisecond
+
+// http3Fallback records whether the request fell back to TCP after the
+// HTTP3 attempt, and how long the attempt took.
+type http3Fallback struct {
+	fallback    bool
+	attemptTime time.Duration
+}
+
+// waitHTTP3Conn waits for the QUIC handshake to the URL within the fallback
+// timeout, returns whether the request should fall back to TCP, and the error
+// if the handshake failed rather than timed out, or the error of the request
+// context without falling back. The origin is marked as HTTP3 broken once it
+// falls back, so that the subsequent requests do not wait for the handshake
+// again, the mark is cleared once the late QUIC connection is adopted.
+func (t *Transport) waitHTTP3Conn(req *http.Request, u *url.URL) (fallback bool, err error) {
+	timeout := t.getHTTP3FallbackTimeout()
+	if timeout <= 0 {
+		return false, nil
+	}
+	ctx := req.Context()
+	addr := netutil.AuthorityKey(req.URL)
+	adoptLate := !t.http3CloseLateConn
+	marked := make(chan struct{})
+	defer close(marked)
+	start := time.Now()
+	err = t.t3.DialConnTimeout(ctx, u.Host, timeout, adoptLate, func(err error) {
+		if err == nil && adoptLate {
+			<-marked // the late handshake may complete before it's marked.
+			t.clearHTTP3Broken(addr)
+		}
+	})
+	if err == nil {
+		return false, nil
+	}
+	if ctx.Err() != nil {
+		return false, err
+	}
+	t.markHTTP3Broken(addr, defaultHTTP3BrokenTTL)
+	elapsed := time.Since(start)
+	if f, ok := req.Context().Value(http3FallbackKey).(*http3Fallback); ok {
+		f.fallback = true
+		f.attemptTime = elapsed
+	}
+	t.DebugfContext(req.Context(), "fallback to tcp after http3 attempt to %s took %v: %s", u.Host, elapsed, err.Error())
+	if err == http3.ErrDialTimeout {
+		err = nil
+	}
+	return true, err
+}
+
+// markHTTP3Broken steers the requests to addr away from HTTP3 for d, the
+// pending alt-svc of addr is dropped, and the alt-svc is ignored until then.
+func (t *Transport) markHTTP3Broken(addr string, d time.Duration) {
+	t.http3BrokenMu.Lock()
+	if t.http3Broken == nil {
+		t.http3Broken = make(map[string]time.Time)
+	}
+	t.http3Broken[addr] = time.Now().Add(d)
+	t.http3BrokenMu.Unlock()
+	t.pendingAltSvcsMu.Lock()
+	delete(t.pendingAltSvcs, addr)
+	t.pendingAltSvcsMu.Unlock()
+}
+
+// clearHTTP3Broken clears the mark of markHTTP3Broken.
+func (t *Transport) clearHTTP3Broken(addr string) {
+	t.http3BrokenMu.Lock()
+	delete(t.http3Broken, addr)
+	t.http3BrokenMu.Unlock()
+}
+
+func (t *Transport) isHTTP3Broken(addr string) bool {
+	t.http3BrokenMu.Lock()
+	defer t.http3BrokenMu.Unlock()
+	until, ok := t.http3Broken[addr]
+	if !ok {
+		return false
+	}
+	if time.Now().After(until) {
+		delete(t.http3Broken, addr)
+		return false
+	}
+	return true
+}
+
 func (t *Transport) roundTripAltSvc(req *http.Request, as *altsvc.AltSvc) (resp *http.Response, err error) {
 	r := req.Clone(req.Context())
 	r.URL = altsvcutil.ConvertURL(as, req.URL)
 	switch as.Protocol {
 	case "h3":
+		var fallback bool
+		if fallback, err = t.waitHTTP3Conn(req, r.URL); fallback {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
 		resp, err = t.t3.RoundTrip(r)
 	case "h2":
 		resp, err = t.t2.RoundTrip(r)
@@ -846,6 +1210,9 @@ func (t *Transport) checkAltSvc(req *http.Request) (resp *http.Response, err err
 		return
 	}
 	addr := netutil.AuthorityKey(req.URL)
+	if t.isHTTP3Broken(addr) {
+		return
+	}
 	t.pendingAltSvcsMu.Lock()
 	pas, ok := t.pendingAltSvcs[addr]
 	t.pendingAltSvcsMu.Unlock()
@@ -855,19 +1222,32 @@ func (t *Transport) checkAltSvc(req *http.Request) (resp *http.Response, err err
 			pas.LastTime = time.Now()
 			r := req.Clone(req.Context())
 			r.URL = altsvcutil.ConvertURL(pas.Entries[pas.CurrentIndex], req.URL)
-			resp, err = pas.Transport.RoundTrip(r)
+			var fallback bool
+			if pas.Transport == t.t3 {
+				fallback, err = t.waitHTTP3Conn(req, r.URL)
+				if err != nil && !fallback { // the request context is done.
+					pas.Mu.Unlock()
+					return nil, err
+				}
+			}
+			if !fallback {
+				resp, err = pas.Transport.RoundTrip(r)
+			}
 			if err != nil {
 				pas.Transport = nil
 				if pas.CurrentIndex+1 < len(pas.Entries) {
 					pas.CurrentIndex++
-					go t.handlePendingAltSvc(req.URL, pas)
+					go t.handlePendingAltSvc(req.Context(), req.URL, pas)
 				}
-			} else {
+			} else if !fallback { // keep pending if the handshake just timed out
 				t.altSvcJar.SetAltSvc(addr, pas.Entries[pas.CurrentIndex])
 				t.pendingAltSvcsMu.Lock()
 				delete(t.pendingAltSvcs, addr)
 				t.pendingAltSvcsMu.Unlock()
 			}
+			if fallback {
+				resp, err = nil, nil
+			}
 		}
 		pas.Mu.Unlock()
 		return
@@ -1273,6 +1653,7 @@ func (t *Transport) connectMethodForRequest(treq *transportRequest) (cm connectM
 		cm.proxyURL, err = t.Proxy(treq.Request)
 	}
 	cm.onlyH1 = t.forceHttpVersion == h1 || requestRequiresHTTP1(treq.Request)
+	cm.tlsIdentity = t.GetTLSIdentity()
 	return cm, err
 }
 
@@ -1521,7 +1902,7 @@ func (t *Transport) queueForIdleConn(w *wantConn) (delivered bool) {
 	}
 	q := t.idleConnWait[w.key]
 	q.cleanFrontNotWaiting()
-	q.pushBack(w)
+	q.pushPriority(w)
 	t.idleConnWait[w.key] = q
 	return false
 }
@@ -1568,15 +1949,48 @@ func (t *Transport) removeIdleConnLocked(pconn *persistConn) bool {
 
 var zeroDialer net.Dialer
 
-func (t *Transport) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+// dial dials addr, the DialGuard is applied if the connection is to the
+// origin server rather than the proxy.
+func (t *Transport) dial(ctx context.Context, network, addr string, origin bool) (net.Conn, error) {
 	if t.DialContext != nil {
 		c, err := t.DialContext(ctx, network, addr)
 		if c == nil && err == nil {
 			err = errors.New("net/http: Transport.DialContext hook returned (nil, nil)")
 		}
-		return c, err
+		if err != nil {
+			return c, err
+		}
+		if origin {
+			err = t.GuardConn(ctx, network, addr, c)
+		}
+		if err == nil {
+			err = t.ApplyTCPNoDelay(c)
+		}
+		if err == nil {
+			err = t.ApplyTCPKeepAlive(c)
+		}
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+		return c, nil
+	}
+	d := t.SocketDialer(t.Dialer)
+	if origin {
+		d = t.GuardDialer(d, addr)
+	}
+	if d == nil {
+		d = &zeroDialer
+	}
+	c, err := t.DialResolved(ctx, d, network, addr, d.DialContext)
+	if err != nil {
+		return nil, err
 	}
-	return zeroDialer.DialContext(ctx, network, addr)
+	if err = t.ApplyTCPNoDelay(c); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
 }
 
 // A wantConn records state about a wanted connection
@@ -1600,6 +2014,19 @@ type wantConn struct {
 	cancelCtx context.CancelFunc
 	done      bool             // true after delivered or canceled
 	result    chan connOrError // channel to deliver connection or error
+
+	priority int           // see Request.SetPriority
+	aging    time.Duration // see Options.PriorityAging
+	queuedAt time.Time
+}
+
+// effectivePriority returns the priority of w raised by the aging at now.
+func (w *wantConn) effectivePriority(now time.Time) int {
+	p := w.priority
+	if w.aging > 0 {
+		p += int(now.Sub(w.queuedAt) / w.aging)
+	}
+	return p
 }
 
 type connOrError struct {
@@ -1680,6 +2107,11 @@ type wantConnQueue struct {
 	head    []*wantConn
 	headPos int
 	tail    []*wantConn
+
+	// prioritized is set once a wantConn with the priority or aging is
+	// pushed by pushPriority, then the queue is ordered by the effective
+	// priority of the wantConns instead, and FIFO within the same one.
+	prioritized bool
 }
 
 // len returns the number of items in the queue.
@@ -1692,8 +2124,24 @@ func (q *wantConnQueue) pushBack(w *wantConn) {
 	q.tail = append(q.tail, w)
 }
 
+// pushPriority is similar to pushBack, but the queue is ordered by the
+// priority if w is prioritized.
+func (q *wantConnQueue) pushPriority(w *wantConn) {
+	if w.priority != 0 || w.aging > 0 {
+		q.prioritized = true
+	}
+	q.pushBack(w)
+}
+
 // popFront removes and returns the wantConn at the front of the queue.
 func (q *wantConnQueue) popFront() *wantConn {
+	if q.prioritized {
+		i := q.priorityFront()
+		if i < 0 {
+			return nil
+		}
+		return q.removeHead(i)
+	}
 	if q.headPos >= len(q.head) {
 		if len(q.tail) == 0 {
 			return nil
@@ -1709,6 +2157,12 @@ func (q *wantConnQueue) popFront() *wantConn {
 
 // peekFront returns the wantConn at the front of the queue without removing it.
 func (q *wantConnQueue) peekFront() *wantConn {
+	if q.prioritized {
+		if i := q.priorityFront(); i >= 0 {
+			return q.head[i]
+		}
+		return nil
+	}
 	if q.headPos < len(q.head) {
 		return q.head[q.headPos]
 	}
@@ -1718,27 +2172,68 @@ func (q *wantConnQueue) peekFront() *wantConn {
 	return nil
 }
 
-// cleanFrontNotWaiting pops any wantConns that are no longer waiting from the head of the
-// queue, reporting whether any were popped.
-func (q *wantConnQueue) cleanFrontNotWaiting() (cleaned bool) {
-	for {
+// priorityFront moves all the wantConns into head and returns the index
+// of the one with the highest effective priority, the earliest one wins
+// the tie. It returns -1 if the queue is empty.
+func (q *wantConnQueue) priorityFront() int {
+	if q.headPos > 0 || len(q.tail) > 0 {
+		head := make([]*wantConn, 0, q.len())
+		head = append(head, q.head[q.headPos:]...)
+		head = append(head, q.tail...)
+		q.head, q.headPos, q.tail = head, 0, nil
+	}
+	now := time.Now()
+	front, best := -1, 0
+	for i, w := range q.head {
+		if p := w.effectivePriority(now); front < 0 || p > best {
+			front, best = i, p
+		}
+	}
+	return front
+}
+
+// removeHead removes and returns the wantConn at index i of head, which is
+// only used after priorityFront.
+func (q *wantConnQueue) removeHead(i int) *wantConn {
+	w := q.head[i]
+	copy(q.head[i:], q.head[i+1:])
+	q.head[len(q.head)-1] = nil
+	q.head = q.head[:len(q.head)-1]
+	return w
+}
+
+// popFrontIf pops the wantConn at the front of the queue if f reports true
+// for it. The front is computed once, so the wantConn which is checked is
+// exactly the one popped, even if the effective priorities change between.
+func (q *wantConnQueue) popFrontIf(f func(*wantConn) bool) bool {
+	if !q.prioritized {
 		w := q.peekFront()
-		if w == nil || w.waiting() {
-			return cleaned
+		if w == nil || !f(w) {
+			return false
 		}
 		q.popFront()
+		return true
+	}
+	i := q.priorityFront()
+	if i < 0 || !f(q.head[i]) {
+		return false
+	}
+	q.removeHead(i)
+	return true
+}
+
+// cleanFrontNotWaiting pops any wantConns that are no longer waiting from the head of the
+// queue, reporting whether any were popped.
+func (q *wantConnQueue) cleanFrontNotWaiting() (cleaned bool) {
+	for q.popFrontIf(func(w *wantConn) bool { return !w.waiting() }) {
 		cleaned = true
 	}
+	return cleaned
 }
 
 // cleanFrontCanceled pops any wantConns with canceled dials from the head of the queue.
 func (q *wantConnQueue) cleanFrontCanceled() {
-	for {
-		w := q.peekFront()
-		if w == nil || w.cancelCtx != nil {
-			return
-		}
-		q.popFront()
+	for q.popFrontIf(func(w *wantConn) bool { return w.cancelCtx == nil }) {
 	}
 }
 
@@ -1789,6 +2284,9 @@ func (t *Transport) getConn(treq *transportRequest, cm connectMethod) (pc *persi
 		result:     make(chan connOrError, 1),
 		beforeDial: testHookPrePendingDial,
 		afterDial:  testHookPostPendingDial,
+		priority:   transport.GetPriority(ctx),
+		aging:      t.PriorityAging,
+		queuedAt:   time.Now(),
 	}
 	defer func() {
 		if err != nil {
@@ -1806,6 +2304,9 @@ func (t *Transport) getConn(treq *transportRequest, cm connectMethod) (pc *persi
 	case r := <-w.result:
 		// Trace success but only for HTTP/1.
 		// HTTP/2 calls trace.GotConn itself.
+		if r.pc != nil && r.pc.alt == nil {
+			transport.RecordConn(ctx, r.pc.conn, r.pc.isReused())
+		}
 		if r.pc != nil && r.pc.alt == nil && trace != nil && trace.GotConn != nil {
 			info := httptrace.GotConnInfo{
 				Conn:   r.pc.conn,
@@ -1869,7 +2370,7 @@ func (t *Transport) queueForDial(w *wantConn) {
 	}
 	q := t.connsPerHostWait[w.key]
 	q.cleanFrontNotWaiting()
-	q.pushBack(w)
+	q.pushPriority(w)
 	t.connsPerHostWait[w.key] = q
 }
 
@@ -2085,6 +2586,12 @@ func (t *Transport) dialConn(ctx context.Context, cm connectMethod) (pconn *pers
 		if err != nil {
 			return nil, wrapErr(err)
 		}
+		if cm.proxyURL == nil {
+			if err = t.GuardConn(ctx, "tcp", cm.addr(), pconn.conn); err != nil {
+				pconn.conn.Close()
+				return nil, err
+			}
+		}
 		if tc, ok := pconn.conn.(reqtls.Conn); ok {
 			// Handshake here, in case DialTLS didn't. TLSNextProto below
 			// depends on it for knowing the connection state.
@@ -2108,7 +2615,7 @@ func (t *Transport) dialConn(ctx context.Context, cm connectMethod) (pconn *pers
 			}
 		}
 	} else {
-		conn, err := t.dial(ctx, "tcp", cm.addr())
+		conn, err := t.dial(ctx, "tcp", cm.addr(), cm.proxyURL == nil)
 		if err != nil {
 			return nil, wrapErr(err)
 		}
@@ -2131,30 +2638,16 @@ func (t *Transport) dialConn(ctx context.Context, cm connectMethod) (pconn *pers
 		}
 	}
 
-	if t.Debugf != nil && cm.proxyURL != nil {
-		t.Debugf("connect %s via proxy %s", cm.targetAddr, cm.proxyURL.String())
+	if cm.proxyURL != nil {
+		t.DebugfContext(ctx, "connect %s via proxy %s", cm.targetAddr, cm.proxyURL.String())
 	}
 
 	// Proxy setup.
 	switch {
 	case cm.proxyURL == nil:
 		// Do nothing. Not using a proxy.
-	case cm.proxyURL.Scheme == "socks5" || cm.proxyURL.Scheme == "socks5h":
-		conn := pconn.conn
-		d := socks.NewDialer("tcp", conn.RemoteAddr().String())
-		if u := cm.proxyURL.User; u != nil {
-			auth := &socks.UsernamePassword{
-				Username: u.Username(),
-			}
-			auth.Password, _ = u.Password()
-			d.AuthMethods = []socks.AuthMethod{
-				socks.AuthMethodNotRequired,
-				socks.AuthMethodUsernamePassword,
-			}
-			d.Authenticate = auth.Authenticate
-		}
-		if _, err := d.DialWithConn(ctx, conn, "tcp", cm.targetAddr); err != nil {
-			conn.Close()
+	case cm.proxyURL.Scheme == "socks5" || cm.proxyURL.Scheme == "socks5h", cm.targetScheme == "https":
+		if err := t.connectProxy(ctx, cm, pconn.conn); err != nil {
 			return nil, err
 		}
 	case cm.targetScheme == "http":
@@ -2164,85 +2657,6 @@ func (t *Transport) dialConn(ctx context.Context, cm connectMethod) (pconn *pers
 				h.Set("Proxy-Authorization", pa)
 			}
 		}
-	case cm.targetScheme == "https":
-		conn := pconn.conn
-		var hdr http.Header
-		if t.GetProxyConnectHeader != nil {
-			var err error
-			hdr, err = t.GetProxyConnectHeader(ctx, cm.proxyURL, cm.targetAddr)
-			if err != nil {
-				conn.Close()
-				return nil, err
-			}
-		} else {
-			hdr = t.ProxyConnectHeader
-		}
-		if hdr == nil {
-			hdr = make(http.Header)
-		}
-		if pa := cm.proxyAuth(); pa != "" {
-			hdr = hdr.Clone()
-			hdr.Set("Proxy-Authorization", pa)
-		}
-		connectReq := &http.Request{
-			Method: "CONNECT",
-			URL:    &url.URL{Opaque: cm.targetAddr},
-			Host:   cm.targetAddr,
-			Header: hdr,
-		}
-
-		// Set a (long) timeout here to make sure we don't block forever
-		// and leak a goroutine if the connection stops replying after
-		// the TCP connect.
-		connectCtx, cancel := testHookProxyConnectTimeout(ctx, 1*time.Minute)
-		defer cancel()
-
-		didReadResponse := make(chan struct{}) // closed after CONNECT write+read is done or fails
-		var (
-			resp *http.Response
-			err  error // write or read error
-		)
-		// Write the CONNECT request & read the response.
-		go func() {
-			defer close(didReadResponse)
-			err = connectReq.Write(conn)
-			if err != nil {
-				return
-			}
-			// Okay to use and discard buffered reader here, because
-			// TLS server will not speak until spoken to.
-			br := bufio.NewReader(conn)
-			resp, err = http.ReadResponse(br, connectReq)
-		}()
-		select {
-		case <-connectCtx.Done():
-			conn.Close()
-			<-didReadResponse
-			return nil, connectCtx.Err()
-		case <-didReadResponse:
-			// resp or err now set
-		}
-		if err != nil {
-			conn.Close()
-			return nil, err
-		}
-
-		if t.OnProxyConnectResponse != nil {
-			err = t.OnProxyConnectResponse(ctx, cm.proxyURL, connectReq, resp)
-			if err != nil {
-				conn.Close()
-				return nil, err
-			}
-		}
-
-		if resp.StatusCode != 200 {
-			_, text, ok := util.CutString(resp.Status, " ")
-			conn.Close()
-			if !ok {
-				return nil, errors.New("unknown status code")
-			}
-			return nil, errors.New(text)
-		}
 	}
 
 	if cm.proxyURL != nil && cm.targetScheme == "https" {
@@ -2258,9 +2672,11 @@ func (t *Transport) dialConn(ctx context.Context, cm connectMethod) (pconn *pers
 		}
 	}
 
+	pconn.conn = t.WrapWireCapture(pconn.conn)
+
 	if s := pconn.tlsState; t.forceHttpVersion != h1 && s != nil && s.NegotiatedProtocolIsMutual && s.NegotiatedProtocol != "" {
 		if s.NegotiatedProtocol == h2internal.NextProtoTLS {
-			if used, err := t.t2.AddConn(pconn.conn, cm.targetAddr); err != nil {
+			if used, err := t.t2.AddConn(pconn.conn, cm.targetAddr, cm.tlsIdentity); err != nil {
 				go pconn.conn.Close()
 				return nil, err
 			} else if !used {
@@ -2278,6 +2694,109 @@ func (t *Transport) dialConn(ctx context.Context, cm connectMethod) (pconn *pers
 	return pconn, nil
 }
 
+// connectProxy establishes the tunnel to cm.targetAddr over conn, which is
+// connected to the proxy of cm, with the socks5 handshake or the CONNECT
+// request. The conn is closed if it fails.
+func (t *Transport) connectProxy(ctx context.Context, cm connectMethod, conn net.Conn) error {
+	if cm.proxyURL.Scheme == "socks5" || cm.proxyURL.Scheme == "socks5h" {
+		d := socks.NewDialer("tcp", conn.RemoteAddr().String())
+		if u := cm.proxyURL.User; u != nil {
+			auth := &socks.UsernamePassword{
+				Username: u.Username(),
+			}
+			auth.Password, _ = u.Password()
+			d.AuthMethods = []socks.AuthMethod{
+				socks.AuthMethodNotRequired,
+				socks.AuthMethodUsernamePassword,
+			}
+			d.Authenticate = auth.Authenticate
+		}
+		if _, err := d.DialWithConn(ctx, conn, "tcp", cm.targetAddr); err != nil {
+			conn.Close()
+			return err
+		}
+		return nil
+	}
+	var hdr http.Header
+	if t.GetProxyConnectHeader != nil {
+		var err error
+		hdr, err = t.GetProxyConnectHeader(ctx, cm.proxyURL, cm.targetAddr)
+		if err != nil {
+			conn.Close()
+			return err
+		}
+	} else {
+		hdr = t.ProxyConnectHeader
+	}
+	if hdr == nil {
+		hdr = make(http.Header)
+	}
+	if pa := cm.proxyAuth(); pa != "" {
+		hdr = hdr.Clone()
+		hdr.Set("Proxy-Authorization", pa)
+	}
+	connectReq := &http.Request{
+		Method: "CONNECT",
+		URL:    &url.URL{Opaque: cm.targetAddr},
+		Host:   cm.targetAddr,
+		Header: hdr,
+	}
+
+	// Set a (long) timeout here to make sure we don't block forever
+	// and leak a goroutine if the connection stops replying after
+	// the TCP connect.
+	connectCtx, cancel := testHookProxyConnectTimeout(ctx, 1*time.Minute)
+	defer cancel()
+
+	didReadResponse := make(chan struct{}) // closed after CONNECT write+read is done or fails
+	var (
+		resp *http.Response
+		err  error // write or read error
+	)
+	// Write the CONNECT request & read the response.
+	go func() {
+		defer close(didReadResponse)
+		err = connectReq.Write(conn)
+		if err != nil {
+			return
+		}
+		// Okay to use and discard buffered reader here, because
+		// TLS server will not speak until spoken to.
+		br := bufio.NewReader(conn)
+		resp, err = http.ReadResponse(br, connectReq)
+	}()
+	select {
+	case <-connectCtx.Done():
+		conn.Close()
+		<-didReadResponse
+		return connectCtx.Err()
+	case <-didReadResponse:
+		// resp or err now set
+	}
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	if t.OnProxyConnectResponse != nil {
+		err = t.OnProxyConnectResponse(ctx, cm.proxyURL, connectReq, resp)
+		if err != nil {
+			conn.Close()
+			return err
+		}
+	}
+
+	if resp.StatusCode != 200 {
+		_, text, ok := util.CutString(resp.Status, " ")
+		conn.Close()
+		if !ok {
+			return errors.New("unknown status code")
+		}
+		return errors.New(text)
+	}
+	return nil
+}
+
 // persistConnWriter is the io.Writer written to by pc.bw.
 // It accumulates the number of bytes written to the underlying conn,
 // so the retry logic can determine whether any bytes made it across
@@ -2291,6 +2810,9 @@ type persistConnWriter struct {
 func (w persistConnWriter) Write(p []byte) (n int, err error) {
 	n, err = w.pc.conn.Write(p)
 	w.pc.nwrite += int64(n)
+	if h := w.pc.wireHash.Load(); h != nil && n > 0 {
+		h.sent(p[:n], true)
+	}
 	return
 }
 
@@ -2298,6 +2820,9 @@ func (w persistConnWriter) Write(p []byte) (n int, err error) {
 // the Conn implements io.ReaderFrom, it can take advantage of optimizations
 // such as sendfile.
 func (w persistConnWriter) ReadFrom(r io.Reader) (n int64, err error) {
+	if w.pc.wireHash.Load() != nil { // hash the bytes written by Write.
+		return io.Copy(struct{ io.Writer }{w}, r)
+	}
 	n, err = io.Copy(w.pc.conn, r)
 	w.pc.nwrite += n
 	return
@@ -2330,6 +2855,8 @@ type connectMethod struct {
 	// be reused for different targetAddr values.
 	targetAddr string
 	onlyH1     bool // whether to disable HTTP/2 and force HTTP/1
+
+	tlsIdentity uint64 // the TLSIdentity of the transport
 }
 
 func (cm *connectMethod) key() connectMethodKey {
@@ -2342,10 +2869,11 @@ func (cm *connectMethod) key() connectMethodKey {
 		}
 	}
 	return connectMethodKey{
-		proxy:  proxyStr,
-		scheme: cm.targetScheme,
-		addr:   targetAddr,
-		onlyH1: cm.onlyH1,
+		proxy:       proxyStr,
+		scheme:      cm.targetScheme,
+		addr:        targetAddr,
+		onlyH1:      cm.onlyH1,
+		tlsIdentity: cm.tlsIdentity,
 	}
 }
 
@@ -2381,6 +2909,7 @@ func (cm *connectMethod) tlsHost() string {
 type connectMethodKey struct {
 	proxy, scheme, addr string
 	onlyH1              bool
+	tlsIdentity         uint64
 }
 
 func (k connectMethodKey) String() string {
@@ -2421,6 +2950,10 @@ type persistConn struct {
 
 	writeLoopDone chan struct{} // closed when write loop ends
 
+	// wireHash hashes the bytes of the current exchange, which is set by
+	// roundTrip, see Request.EnableWireHashing.
+	wireHash atomic.Pointer[wireHasher]
+
 	// Both guarded by Transport.idleMu:
 	idleAt    time.Time   // time it last become idle
 	idleTimer *time.Timer // holding an AfterFunc to close it
@@ -2490,6 +3023,10 @@ func (pc *persistConn) _readResponse(req *http.Request) (*http.Response, error)
 	}
 
 	// Parse the response headers.
+	var rawHeaders []transport.HeaderField
+	if transport.WantRawHeaders(req.Context()) {
+		tp.rawHeaders = &rawHeaders
+	}
 	mimeHeader, err := tp.ReadMIMEHeader()
 	if err != nil {
 		if err == io.EOF {
@@ -2498,6 +3035,9 @@ func (pc *persistConn) _readResponse(req *http.Request) (*http.Response, error)
 		return nil, err
 	}
 	resp.Header = http.Header(mimeHeader)
+	if tp.rawHeaders != nil && resp.StatusCode > 199 {
+		transport.RecordRawHeaders(req.Context(), rawHeaders)
+	}
 
 	fixPragmaCacheControl(resp.Header)
 
@@ -2524,6 +3064,9 @@ func (pc *persistConn) Read(p []byte) (n int, err error) {
 		p = p[:pc.readLimit]
 	}
 	n, err = pc.conn.Read(p)
+	if h := pc.wireHash.Load(); h != nil && n > 0 {
+		h.received(p[:n], true)
+	}
 	if err == io.EOF {
 		pc.sawEOF = true
 	}
@@ -2699,7 +3242,7 @@ func (pc *persistConn) readLoop() {
 
 		if err != nil {
 			if pc.readLimit <= 0 {
-				err = fmt.Errorf("net/http: server response headers exceeded %d bytes; aborted", pc.maxHeaderResponseSize())
+				err = &transport.ResponseHeaderTooLargeError{Proto: "HTTP/1.1", Limit: pc.maxHeaderResponseSize()}
 			}
 
 			select {
@@ -2784,7 +3327,7 @@ func (pc *persistConn) readLoop() {
 			resp.Header.Del("Content-Length")
 			resp.ContentLength = -1
 			resp.Uncompressed = true
-		} else if pc.t.AutoDecompression {
+		} else if pc.t.AutoDecompression && !transport.IsAutoDecompressDisabled(rc.treq.Request.Context()) {
 			contentEncoding := resp.Header.Get("Content-Encoding")
 			if contentEncoding != "" {
 				resp.Header.Del("Content-Encoding")
@@ -3024,7 +3567,11 @@ func (pc *persistConn) writeLoop() {
 			pc.writeErrCh <- err // to the body reader, which might recycle us
 			wr.ch <- err         // to the roundTrip function
 			if err != nil {
-				pc.close(err)
+				// keep reading the early response, the connection is
+				// closed by roundTrip or after the response is read.
+				if !transport.IsEarlyResponseEnabled(wr.req.Context()) {
+					pc.close(err)
+				}
 				return
 			}
 		case <-pc.closech:
@@ -3102,7 +3649,8 @@ func (pc *persistConn) writeRequest(r *http.Request, w io.Writer, usingProxy boo
 	host = removeZone(host)
 
 	ruri := r.URL.RequestURI()
-	if usingProxy && r.URL.Scheme != "" && r.URL.Opaque == "" {
+	absoluteURI, _ := r.Context().Value(absoluteURIKey).(bool)
+	if (usingProxy || absoluteURI) && r.URL.Scheme != "" && r.URL.Opaque == "" {
 		ruri = r.URL.Scheme + "://" + host + ruri
 	} else if r.Method == "CONNECT" && r.URL.Path == "" {
 		// CONNECT requests normally give just the host and port, not a full URL.
@@ -3380,9 +3928,7 @@ var (
 )
 
 func (pc *persistConn) roundTrip(req *transportRequest) (resp *http.Response, err error) {
-	if pc.t.Debugf != nil {
-		pc.t.Debugf("HTTP/1.1 %s %s", req.Method, req.URL.String())
-	}
+	pc.t.DebugfContext(req.Context(), "HTTP/1.1 %s %s", req.Method, req.URL.String())
 	testHookEnterRoundTrip()
 	pc.mu.Lock()
 	pc.numExpectedResponses++
@@ -3399,6 +3945,7 @@ func (pc *persistConn) roundTrip(req *transportRequest) (resp *http.Response, er
 	// requested it.
 	requestedGzip := false
 	if !pc.t.DisableCompression &&
+		!transport.IsAutoDecompressDisabled(req.Context()) &&
 		req.Header.Get("Accept-Encoding") == "" &&
 		req.Header.Get("Range") == "" &&
 		req.Method != "HEAD" {
@@ -3437,6 +3984,12 @@ func (pc *persistConn) roundTrip(req *transportRequest) (resp *http.Response, er
 	// Write the request concurrently with waiting for a response,
 	// in case the server decides to reply before reading our full
 	// request body.
+	h := wireHasherFromContext(req.Context())
+	if h != nil {
+		h.setExact()
+	}
+	pc.wireHash.Store(h)
+
 	startBytesWritten := pc.nwrite
 	writeErrCh := make(chan error, 1)
 	pc.writech <- writeRequest{req, writeErrCh, continueCh}
@@ -3462,6 +4015,10 @@ func (pc *persistConn) roundTrip(req *transportRequest) (resp *http.Response, er
 		return re.res, nil
 	}
 
+	// see transport.WithEarlyResponse.
+	earlyResponse := transport.IsEarlyResponseEnabled(req.Context())
+	wroteRequest := false
+
 	var respHeaderTimer <-chan time.Time
 	ctxDoneChan := req.ctx.Done()
 	pcClosed := pc.closech
@@ -3473,9 +4030,25 @@ func (pc *persistConn) roundTrip(req *transportRequest) (resp *http.Response, er
 				req.logf("writeErrCh recv: %T/%#v", err, err)
 			}
 			if err != nil {
+				if earlyResponse {
+					// the server may respond and close the connection
+					// before reading the whole request body.
+					timer := time.NewTimer(earlyResponseWaitTimeout)
+					select {
+					case re := <-resc:
+						timer.Stop()
+						if re.err == nil {
+							return handleResponse(re)
+						}
+					case <-timer.C:
+					case <-ctxDoneChan:
+						timer.Stop()
+					}
+				}
 				pc.close(fmt.Errorf("write error: %w", err))
 				return nil, pc.mapRoundTripError(req, startBytesWritten, err)
 			}
+			wroteRequest = true
 			if d := pc.t.ResponseHeaderTimeout; d > 0 {
 				if debugRoundTrip {
 					req.logf("starting timer for %v", d)
@@ -3504,6 +4077,12 @@ func (pc *persistConn) roundTrip(req *transportRequest) (resp *http.Response, er
 			pc.close(errTimeout)
 			return nil, errTimeout
 		case re := <-resc:
+			if earlyResponse && !wroteRequest && re.err == nil {
+				// stop writing the rest of the request body promptly, the
+				// connection is closed once the response is read since
+				// the request is not written completely.
+				pc.conn.SetWriteDeadline(time.Now())
+			}
 			return handleResponse(re)
 		case <-ctxDoneChan:
 			select {
@@ -3519,6 +4098,10 @@ func (pc *persistConn) roundTrip(req *transportRequest) (resp *http.Response, er
 	}
 }
 
+// earlyResponseWaitTimeout is how long to wait for the early response after
+// the request body fails to be written, see transport.WithEarlyResponse.
+const earlyResponseWaitTimeout = time.Second
+
 // tLogKey is a context WithValue key for test debugging contexts containing
 // a t.Logf func. See export_test.go's Request.WithT method.
 type tLogKey struct{}
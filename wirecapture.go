@@ -0,0 +1,61 @@
+package req
+
+import (
+	"io"
+	"sync"
+
+	"github.com/imroc/req/v3/pkg/wirecapture"
+)
+
+// lockedWriter serializes the writes to w.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (lw *lockedWriter) Write(p []byte) (int, error) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	return lw.w.Write(p)
+}
+
+// SetTLSKeyLogWriter set the writer which the TLS master secrets are written
+// to in NSS key log format, which allows Wireshark to decrypt the captured
+// TLS and QUIC traffic. It is applied to the TLS config shared by HTTP1,
+// HTTP2 and HTTP3, including the tls fingerprint impersonation, the writes
+// are serialized so w does not have to be safe for concurrent use. Pass nil
+// to disable it. Note it must be set after SetTLSClientConfig which replaces
+// the TLS config.
+//
+// DANGEROUS: the key log compromises the security of all connections of the
+// client, only use it for debugging, never in production.
+func (c *Client) SetTLSKeyLogWriter(w io.Writer) *Client {
+	if w == nil {
+		c.GetTLSClientConfig().KeyLogWriter = nil
+		return c
+	}
+	c.GetTLSClientConfig().KeyLogWriter = &lockedWriter{w: w}
+	return c
+}
+
+// EnableWireCapture records the plaintext application data sent and
+// received on each HTTP1 and HTTP2 connection (after TLS decryption) to w,
+// with the timestamps and directions in the framed format of the
+// wirecapture package, which also provides the reader. HTTP3 connections are
+// not captured. The writes are serialized so w does not have to be safe for
+// concurrent use. It only applies to the connections dialed after it is
+// enabled.
+//
+// DANGEROUS: the capture contains all the sensitive data of the requests
+// and responses, e.g. credentials and cookies, only use it for debugging.
+func (c *Client) EnableWireCapture(w io.Writer) *Client {
+	c.Transport.WireCapture = wirecapture.NewWriter(w)
+	return c
+}
+
+// DisableWireCapture disables the wire capture enabled by EnableWireCapture,
+// the connections which are already captured are not affected.
+func (c *Client) DisableWireCapture() *Client {
+	c.Transport.WireCapture = nil
+	return c
+}
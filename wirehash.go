@@ -0,0 +1,471 @@
+package req
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/imroc/req/v3/internal/dump"
+)
+
+var wireHashAlgorithms = map[string]func() hash.Hash{
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha384": sha512.New384,
+	"sha512": sha512.New,
+}
+
+// WireHash is the hashes of the bytes sent and received in a single exchange
+// of the request, see Request.EnableWireHashing.
+type WireHash struct {
+	// Algorithm is the hash algorithm, e.g. "sha256".
+	Algorithm string
+	// Attempt is the retry attempt of the exchange, starts from 0.
+	Attempt int
+	// Hop is the redirect hop of the exchange within the attempt, starts
+	// from 0.
+	Hop int
+	// Proto is the protocol of the response, e.g. "HTTP/1.1", it's empty if
+	// the exchange failed before the response.
+	Proto string
+	// Exact is true if the hashes are of the exact bytes on the connection
+	// (HTTP/1.x), otherwise of the canonical serialization (HTTP/2 and
+	// HTTP/3).
+	Exact bool
+	// Request is the hex encoded hash of the request.
+	Request string
+	// RequestBytes is the number of the hashed bytes of the request.
+	RequestBytes int64
+	// Response is the hex encoded hash of the response.
+	Response string
+	// ResponseBytes is the number of the hashed bytes of the response.
+	ResponseBytes int64
+}
+
+// EnableWireHashing hashes what is sent and received for the request with
+// the algorithm ("sha1", "sha256", "sha384" or "sha512"), the bytes are
+// streamed through the hasher without buffering. The hashes of the final
+// exchange are returned by Response.RequestWireHash and
+// Response.ResponseWireHash, and the earlier exchanges of the retries and
+// redirects by Response.WireHashHistory.
+//
+// For HTTP/1.x, the hashes are of the exact bytes written to and read from
+// the connection for the exchange, after the content encoding, header
+// ordering and chunked framing, before TLS encryption. The response bytes
+// include the 1xx responses and the trailers.
+//
+// For HTTP/2 and HTTP/3, the hashes are of the canonical serialization, in
+// which CRLF is "\r\n":
+//
+//	request  = *(field CRLF) CRLF body
+//	response = *(*(field CRLF) CRLF) *(field CRLF) CRLF body
+//	field    = name ": " value
+//
+// The request fields are the header fields passed to the HPACK or QPACK
+// encoder with the lowercase names, body is the octets of the DATA frames
+// after the content encoding. The response consists of the header blocks
+// of the 1xx responses (if any) followed by the final response, each with
+// the decoded fields, body is the octets of the DATA frames before the
+// decompression. In each header block, the pseudo-header fields come first
+// in the order they are sent, followed by the regular fields stably sorted
+// by name in bytewise order, i.e. the values of the same name keep the
+// order they are sent. The trailers are not included.
+//
+// The response hash covers the bytes read so far, it's complete once the
+// response body is read. It does not apply to the custom round tripper set
+// by Client.SetRoundTripper.
+func (r *Request) EnableWireHashing(algo string) *Request {
+	if _, ok := wireHashAlgorithms[algo]; !ok {
+		r.appendError(fmt.Errorf("unsupported wire hash algorithm %q", algo))
+		return r
+	}
+	r.wireHashAlgo = algo
+	return r
+}
+
+// DisableWireHashing disables the hashing enabled by EnableWireHashing.
+func (r *Request) DisableWireHashing() *Request {
+	r.wireHashAlgo = ""
+	r.wireHasher = nil
+	return r
+}
+
+// WireHash returns the hashes of the final exchange of the request, nil if
+// Request.EnableWireHashing is not called or nothing has been sent.
+func (r *Response) WireHash() *WireHash {
+	if r.Request == nil || r.Request.wireHasher == nil {
+		return nil
+	}
+	return r.Request.wireHasher.current()
+}
+
+// WireHashHistory returns the hashes of the exchanges before the final one,
+// i.e. the failed attempts of the retries and the redirected hops, in the
+// order they are sent.
+func (r *Response) WireHashHistory() []*WireHash {
+	if r.Request == nil || r.Request.wireHasher == nil {
+		return nil
+	}
+	return r.Request.wireHasher.previous()
+}
+
+// RequestWireHash returns the hex encoded hash of the request of the final
+// exchange, see Request.EnableWireHashing.
+func (r *Response) RequestWireHash() string {
+	if h := r.WireHash(); h != nil {
+		return h.Request
+	}
+	return ""
+}
+
+// ResponseWireHash returns the hex encoded hash of the response of the
+// final exchange, see Request.EnableWireHashing.
+func (r *Response) ResponseWireHash() string {
+	if h := r.WireHash(); h != nil {
+		return h.Response
+	}
+	return ""
+}
+
+// RequestWireBytes returns the number of the hashed bytes of the request of
+// the final exchange, see Request.EnableWireHashing.
+func (r *Response) RequestWireBytes() int64 {
+	if h := r.WireHash(); h != nil {
+		return h.RequestBytes
+	}
+	return 0
+}
+
+// ResponseWireBytes returns the number of the hashed bytes of the response
+// of the final exchange, see Request.EnableWireHashing.
+func (r *Response) ResponseWireBytes() int64 {
+	if h := r.WireHash(); h != nil {
+		return h.ResponseBytes
+	}
+	return 0
+}
+
+// wireHasher hashes the exchanges of a request. The bytes of HTTP/1.x are
+// fed by the persistConn, and the canonical serialization of HTTP/2 and
+// HTTP/3 is fed by the dump hooks through the Dumper of dump.WireHashKey.
+type wireHasher struct {
+	algo    string
+	newHash func() hash.Hash
+	dumper  *dump.Dumper
+
+	mu         sync.Mutex
+	attempt    int
+	hop        int
+	started    bool
+	exact      bool
+	proto      string
+	req        hash.Hash
+	resp       hash.Hash
+	reqN       int64
+	respN      int64
+	reqFields  []string // the field lines of the request header block.
+	respFields []string // the field lines of the response header block being read.
+	reqDone    bool     // the request header block is complete.
+	respDone   bool     // the final response header block is complete.
+	history    []*WireHash
+}
+
+func newWireHasher(algo string) *wireHasher {
+	h := &wireHasher{algo: algo, newHash: wireHashAlgorithms[algo]}
+	h.dumper = dump.NewDumper(wireHashDumpOptions{h})
+	return h
+}
+
+type wireHasherKeyType int
+
+const wireHasherKey wireHasherKeyType = iota
+
+func (h *wireHasher) withContext(ctx context.Context) context.Context {
+	ctx = context.WithValue(ctx, wireHasherKey, h)
+	return context.WithValue(ctx, dump.WireHashKey, h.dumper)
+}
+
+func wireHasherFromContext(ctx context.Context) *wireHasher {
+	h, _ := ctx.Value(wireHasherKey).(*wireHasher)
+	return h
+}
+
+// startAttempt starts a retry attempt, the exchange of the previous attempt
+// is moved to the history.
+func (h *wireHasher) startAttempt(attempt int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.archive()
+	h.attempt, h.hop = attempt, 0
+}
+
+// begin starts an exchange, which is called for each hop.
+func (h *wireHasher) begin() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.started {
+		h.archive()
+		h.hop++
+	}
+	h.started = true
+	h.exact, h.proto = false, ""
+	h.req, h.resp = h.newHash(), h.newHash()
+	h.reqN, h.respN = 0, 0
+	h.reqFields, h.respFields = nil, nil
+	h.reqDone, h.respDone = false, false
+}
+
+func (h *wireHasher) archive() {
+	if h.started {
+		h.history = append(h.history, h.snapshot())
+		h.started = false
+	}
+}
+
+func (h *wireHasher) snapshot() *WireHash {
+	return &WireHash{
+		Algorithm:     h.algo,
+		Attempt:       h.attempt,
+		Hop:           h.hop,
+		Proto:         h.proto,
+		Exact:         h.exact,
+		Request:       hex.EncodeToString(h.req.Sum(nil)),
+		RequestBytes:  h.reqN,
+		Response:      hex.EncodeToString(h.resp.Sum(nil)),
+		ResponseBytes: h.respN,
+	}
+}
+
+func (h *wireHasher) current() *WireHash {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.started {
+		return nil
+	}
+	return h.snapshot()
+}
+
+func (h *wireHasher) previous() []*WireHash {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]*WireHash(nil), h.history...)
+}
+
+// setExact switches the exchange to hash the exact bytes on the connection,
+// the canonical serialization fed by the dump hooks is ignored.
+func (h *wireHasher) setExact() {
+	h.mu.Lock()
+	h.exact = true
+	h.mu.Unlock()
+}
+
+func (h *wireHasher) isExact() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.exact
+}
+
+func (h *wireHasher) setProto(proto string) {
+	h.mu.Lock()
+	h.proto = proto
+	h.mu.Unlock()
+}
+
+func (h *wireHasher) sent(p []byte, exact bool) {
+	h.mu.Lock()
+	if h.started && h.exact == exact {
+		h.req.Write(p)
+		h.reqN += int64(len(p))
+	}
+	h.mu.Unlock()
+}
+
+func (h *wireHasher) received(p []byte, exact bool) {
+	h.mu.Lock()
+	if h.started && h.exact == exact {
+		h.resp.Write(p)
+		h.respN += int64(len(p))
+	}
+	h.mu.Unlock()
+}
+
+// requestHeader receives a field line or the terminating CRLF of the
+// request header block from the dump hooks, the trailers are ignored.
+func (h *wireHasher) requestHeader(p []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.started || h.exact || h.reqDone {
+		return
+	}
+	if string(p) != "\r\n" {
+		h.reqFields = append(h.reqFields, string(p))
+		return
+	}
+	h.reqN += writeHeaderBlock(h.req, h.reqFields)
+	h.reqFields = h.reqFields[:0]
+	h.reqDone = true
+}
+
+// requestBody receives the request body after the header block.
+func (h *wireHasher) requestBody(p []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.started || h.exact || !h.reqDone {
+		return
+	}
+	h.req.Write(p)
+	h.reqN += int64(len(p))
+}
+
+// responseHeader receives a field line or the terminating CRLF of the
+// response header blocks from the dump hooks, the trailers are ignored.
+func (h *wireHasher) responseHeader(p []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.started || h.exact || h.respDone {
+		return
+	}
+	if string(p) != "\r\n" {
+		h.respFields = append(h.respFields, string(p))
+		return
+	}
+	interim := slices.ContainsFunc(h.respFields, func(f string) bool {
+		return strings.HasPrefix(f, ":status: 1")
+	})
+	h.respN += writeHeaderBlock(h.resp, h.respFields)
+	h.respFields = h.respFields[:0]
+	h.respDone = !interim
+}
+
+// writeHeaderBlock writes the canonical header block of the field lines,
+// the pseudo-header fields are kept in order before the regular fields,
+// which are sorted by name and keep the order of the same name.
+func writeHeaderBlock(w io.Writer, fields []string) (n int64) {
+	name := func(f string) string {
+		name, _, _ := strings.Cut(f, ": ")
+		return name
+	}
+	slices.SortStableFunc(fields, func(a, b string) int {
+		pa, pb := strings.HasPrefix(a, ":"), strings.HasPrefix(b, ":")
+		switch {
+		case pa && pb:
+			return 0
+		case pa:
+			return -1
+		case pb:
+			return 1
+		}
+		return strings.Compare(name(a), name(b))
+	})
+	for _, f := range fields {
+		io.WriteString(w, f)
+		n += int64(len(f))
+	}
+	io.WriteString(w, "\r\n")
+	return n + 2
+}
+
+// wrapResponseBody hashes the response body before the decompression.
+func (h *wireHasher) wrapResponseBody(rc io.ReadCloser) io.ReadCloser {
+	return &wireHashReadCloser{ReadCloser: rc, h: h}
+}
+
+type wireHashReadCloser struct {
+	io.ReadCloser
+	h *wireHasher
+}
+
+func (r *wireHashReadCloser) Read(p []byte) (n int, err error) {
+	n, err = r.ReadCloser.Read(p)
+	if n > 0 {
+		r.h.received(p[:n], false)
+	}
+	return
+}
+
+// handleWireHash feeds the canonical response body of HTTP/2 and HTTP/3 to
+// the wire hasher of the request.
+func (t *Transport) handleWireHash(res *http.Response, req *http.Request) {
+	h := wireHasherFromContext(req.Context())
+	if h == nil {
+		return
+	}
+	h.setProto(res.Proto)
+	if !h.isExact() {
+		t.wrapResponseBody(res, h.wrapResponseBody)
+	}
+}
+
+type wireHashWriter func(p []byte)
+
+func (w wireHashWriter) Write(p []byte) (int, error) {
+	w(p)
+	return len(p), nil
+}
+
+// wireHashDumpOptions is the dump.Options of the Dumper which feeds the
+// dump hooks to the wire hasher.
+type wireHashDumpOptions struct {
+	h *wireHasher
+}
+
+func (o wireHashDumpOptions) Output() io.Writer {
+	return io.Discard
+}
+
+func (o wireHashDumpOptions) RequestHeaderOutput() io.Writer {
+	return wireHashWriter(o.h.requestHeader)
+}
+
+func (o wireHashDumpOptions) RequestBodyOutput() io.Writer {
+	return wireHashWriter(o.h.requestBody)
+}
+
+func (o wireHashDumpOptions) ResponseHeaderOutput() io.Writer {
+	return wireHashWriter(o.h.responseHeader)
+}
+
+func (o wireHashDumpOptions) ResponseBodyOutput() io.Writer {
+	return io.Discard
+}
+
+func (o wireHashDumpOptions) RequestHeader() bool {
+	return true
+}
+
+func (o wireHashDumpOptions) RequestBody() bool {
+	return true
+}
+
+func (o wireHashDumpOptions) ResponseHeader() bool {
+	return true
+}
+
+func (o wireHashDumpOptions) ResponseBody() bool {
+	return false
+}
+
+func (o wireHashDumpOptions) Async() bool {
+	return false
+}
+
+func (o wireHashDumpOptions) AsyncBufferSize() int {
+	return 0
+}
+
+func (o wireHashDumpOptions) AsyncOverflowPolicy() dump.OverflowPolicy {
+	return dump.OverflowBlock
+}
+
+func (o wireHashDumpOptions) Clone() dump.Options {
+	return o
+}